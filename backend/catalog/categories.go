@@ -0,0 +1,36 @@
+package catalog
+
+import (
+	"storemaker-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// StoreCategories loads every category of a store in sibling order
+func StoreCategories(db *gorm.DB, storeID uint) ([]models.Category, error) {
+	var categories []models.Category
+	err := db.Where("store_id = ?", storeID).Order("position, id").Find(&categories).Error
+	return categories, err
+}
+
+// CategoryDescendants returns rootID and the IDs of every category below it
+func CategoryDescendants(categories []models.Category, rootID uint) []uint {
+	children := make(map[uint][]uint)
+	for _, category := range categories {
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category.ID)
+		}
+	}
+
+	ids := []uint{rootID}
+	seen := map[uint]bool{rootID: true}
+	for i := 0; i < len(ids); i++ {
+		for _, childID := range children[ids[i]] {
+			if !seen[childID] {
+				seen[childID] = true
+				ids = append(ids, childID)
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,685 @@
+package catalog
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"storemaker-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Listing sort orders. Relevance needs a search query.
+const (
+	SortRelevance   = "relevance"
+	SortNewest      = "newest"
+	SortPrice       = "price"
+	SortPriceDesc   = "-price"
+	SortName        = "name"
+	SortNameDesc    = "-name"
+	SortBestSelling = "best_selling"
+	SortRating      = "rating"
+)
+
+const (
+	DefaultListingLimit = 20
+	MaxListingLimit     = 100
+
+	// priceRanges is how many ranges the price facet is split into
+	priceRanges = 5
+)
+
+// ErrInvalidListing is wrapped by every listing parameter error
+var ErrInvalidListing = errors.New("invalid listing parameters")
+
+// inStockCondition holds for digital products, products with a variant in
+// stock and products without variants that are in stock themselves
+const inStockCondition = `(products.is_digital OR EXISTS (
+	SELECT 1 FROM product_variants sv WHERE sv.product_id = products.id AND sv.deleted_at IS NULL AND sv.stock > 0
+) OR (products.stock > 0 AND NOT EXISTS (
+	SELECT 1 FROM product_variants sv WHERE sv.product_id = products.id AND sv.deleted_at IS NULL
+)))`
+
+const onSaleCondition = `(products.compare_price IS NOT NULL AND products.compare_price > products.price)`
+
+// salesJoin adds units sold per product, not counting cancelled or refunded
+// orders
+const salesJoin = `LEFT JOIN (
+	SELECT order_items.product_id, SUM(order_items.quantity) AS units_sold
+	FROM order_items JOIN orders ON orders.id = order_items.order_id
+	WHERE orders.store_id = ? AND orders.status NOT IN ? AND orders.deleted_at IS NULL AND order_items.deleted_at IS NULL
+	GROUP BY order_items.product_id
+) AS sales ON sales.product_id = products.id`
+
+// ListingParams are a storefront product listing's search, filters, sort
+// and page
+type ListingParams struct {
+	Query      string
+	PriceMin   *float64
+	PriceMax   *float64
+	Categories []string
+	InStock    *bool
+	OnSale     *bool
+	// Options maps lower-cased option names to the lower-cased values
+	// wanted; a variant must match one value of every option
+	Options map[string][]string
+	Sort    string
+	Cursor  string
+	Limit   int
+	Facets  bool
+}
+
+// ParseListingParams reads listing parameters from a query string:
+//
+//	q=blue shirt           search
+//	price=10..50           price range; either end may be left out
+//	category=shirts,pants  category slugs, including their subcategories
+//	in_stock=true          only products that can be bought
+//	on_sale=true           only products with a compare price above the price
+//	option.size=m,l        variants with any of the values, per option
+//	sort=price             relevance, newest, price, -price, name, -name, best_selling or rating
+//	cursor=...             next_cursor of the previous page
+//	limit=20               page size, at most 100
+//	facets=false           leave out facet counts
+func ParseListingParams(values url.Values) (*ListingParams, error) {
+	params := &ListingParams{
+		Query:   strings.TrimSpace(values.Get("q")),
+		Options: make(map[string][]string),
+		Sort:    values.Get("sort"),
+		Cursor:  values.Get("cursor"),
+		Limit:   DefaultListingLimit,
+		Facets:  values.Get("facets") != "false",
+	}
+
+	if price := values.Get("price"); price != "" {
+		low, high, ok := strings.Cut(price, "..")
+		if !ok {
+			return nil, fmt.Errorf("%w: price must look like 10..50", ErrInvalidListing)
+		}
+		var err error
+		if params.PriceMin, err = parsePriceBound(low); err != nil {
+			return nil, err
+		}
+		if params.PriceMax, err = parsePriceBound(high); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, slug := range strings.Split(values.Get("category"), ",") {
+		if slug = strings.TrimSpace(slug); slug != "" {
+			params.Categories = append(params.Categories, slug)
+		}
+	}
+
+	var err error
+	if params.InStock, err = parseBoolFilter(values, "in_stock"); err != nil {
+		return nil, err
+	}
+	if params.OnSale, err = parseBoolFilter(values, "on_sale"); err != nil {
+		return nil, err
+	}
+
+	for key, raw := range values {
+		name, ok := strings.CutPrefix(key, "option.")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			return nil, fmt.Errorf("%w: option filters need a name, e.g. option.size=m", ErrInvalidListing)
+		}
+		for _, list := range raw {
+			for _, value := range strings.Split(list, ",") {
+				if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+					params.Options[name] = append(params.Options[name], value)
+				}
+			}
+		}
+	}
+
+	if params.Sort == "" {
+		params.Sort = SortNewest
+		if searchTSQuery(params.Query) != "" {
+			params.Sort = SortRelevance
+		}
+	}
+	if _, ok := listingSorts[params.Sort]; !ok {
+		return nil, fmt.Errorf("%w: unknown sort %q", ErrInvalidListing, params.Sort)
+	}
+	if params.Sort == SortRelevance && searchTSQuery(params.Query) == "" {
+		return nil, fmt.Errorf("%w: sorting by relevance needs a search query", ErrInvalidListing)
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > MaxListingLimit {
+			return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidListing, MaxListingLimit)
+		}
+		params.Limit = l
+	}
+
+	return params, nil
+}
+
+// Listing is one page of a product listing
+type Listing struct {
+	Data       []models.Product `json:"data"`
+	Total      int64            `json:"total"`
+	Sort       string           `json:"sort"`
+	NextCursor *string          `json:"next_cursor"`
+	Facets     *Facets          `json:"facets,omitempty"`
+}
+
+// Facets count the products matching each filter value. Each dimension is
+// counted with every other filter applied but not its own, so choosing one
+// value still shows what the others would give.
+type Facets struct {
+	Categories []CategoryFacet `json:"categories"`
+	Price      PriceFacet      `json:"price"`
+	InStock    BoolFacet       `json:"in_stock"`
+	OnSale     BoolFacet       `json:"on_sale"`
+	Options    []OptionFacet   `json:"options"`
+}
+
+// CategoryFacet counts products in a category or its subcategories
+type CategoryFacet struct {
+	ID       uint   `json:"id"`
+	Slug     string `json:"slug"`
+	Name     string `json:"name"`
+	ParentID *uint  `json:"parent_id"`
+	Count    int64  `json:"count"`
+}
+
+type PriceFacet struct {
+	Min    *float64     `json:"min"`
+	Max    *float64     `json:"max"`
+	Ranges []PriceRange `json:"ranges"`
+}
+
+type PriceRange struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int64   `json:"count"`
+}
+
+type BoolFacet struct {
+	True  int64 `json:"true"`
+	False int64 `json:"false"`
+}
+
+type OptionFacet struct {
+	Name   string             `json:"name"`
+	Values []OptionValueFacet `json:"values"`
+}
+
+type OptionValueFacet struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// listingSort orders a listing by key, with the product ID breaking ties
+type listingSort struct {
+	desc  bool
+	sales bool
+	key   func(tsQuery string) clause.Expr
+	// value returns a pointer to scan a key value into
+	value func() interface{}
+}
+
+var listingSorts = map[string]listingSort{
+	SortRelevance:   {desc: true, key: searchRank, value: func() interface{} { return new(float64) }},
+	SortNewest:      {desc: true, key: column("products.created_at"), value: func() interface{} { return new(time.Time) }},
+	SortPrice:       {key: column("products.price"), value: func() interface{} { return new(float64) }},
+	SortPriceDesc:   {desc: true, key: column("products.price"), value: func() interface{} { return new(float64) }},
+	SortName:        {key: column("lower(products.name)"), value: func() interface{} { return new(string) }},
+	SortNameDesc:    {desc: true, key: column("lower(products.name)"), value: func() interface{} { return new(string) }},
+	SortBestSelling: {desc: true, sales: true, key: column("COALESCE(sales.units_sold, 0)"), value: func() interface{} { return new(int64) }},
+	SortRating:      {desc: true, key: column("products.rating_average"), value: func() interface{} { return new(float64) }},
+}
+
+func column(sql string) func(string) clause.Expr {
+	return func(string) clause.Expr {
+		return clause.Expr{SQL: sql}
+	}
+}
+
+// listingCursor marks the last product of a page by its sort key and ID
+type listingCursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	ID    uint            `json:"id"`
+}
+
+// listing runs one listing request
+type listing struct {
+	db          *gorm.DB
+	storeID     uint
+	statuses    []models.ProductStatus
+	params      *ListingParams
+	tsQuery     string
+	categories  []models.Category
+	categoryIDs []uint
+}
+
+// List returns a page of a store's products in the given statuses, with
+// totals and facets
+func List(db *gorm.DB, storeID uint, statuses []models.ProductStatus, params *ListingParams) (*Listing, error) {
+	l := &listing{
+		db:       db,
+		storeID:  storeID,
+		statuses: statuses,
+		params:   params,
+		tsQuery:  searchTSQuery(params.Query),
+	}
+
+	var err error
+	if l.categories, err = StoreCategories(db, storeID); err != nil {
+		return nil, err
+	}
+	for _, slug := range params.Categories {
+		for _, category := range l.categories {
+			if category.Slug == slug {
+				l.categoryIDs = append(l.categoryIDs, CategoryDescendants(l.categories, category.ID)...)
+			}
+		}
+	}
+
+	result := &Listing{Sort: params.Sort, Data: []models.Product{}}
+	if err := l.filtered("").Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+	if err := l.page(result); err != nil {
+		return nil, err
+	}
+	if params.Facets {
+		if result.Facets, err = l.facets(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// filtered selects the matching products, ignoring the filter named by skip
+// ("price", "category", "in_stock", "on_sale" or "option:<name>")
+func (l *listing) filtered(skip string) *gorm.DB {
+	query := l.db.Model(&models.Product{}).
+		Where("products.store_id = ? AND products.status IN ?", l.storeID, l.statuses)
+	if l.tsQuery != "" {
+		query = query.Where("products.search_vector @@ to_tsquery('simple', ?)", l.tsQuery)
+	}
+
+	params := l.params
+	if skip != "price" {
+		if params.PriceMin != nil {
+			query = query.Where("products.price >= ?", *params.PriceMin)
+		}
+		if params.PriceMax != nil {
+			query = query.Where("products.price <= ?", *params.PriceMax)
+		}
+	}
+	if skip != "category" && len(params.Categories) > 0 {
+		if len(l.categoryIDs) == 0 {
+			query = query.Where("1 = 0")
+		} else {
+			query = query.Where("products.category_id IN ?", l.categoryIDs)
+		}
+	}
+	if skip != "in_stock" && params.InStock != nil {
+		query = query.Where(boolCondition(inStockCondition, *params.InStock))
+	}
+	if skip != "on_sale" && params.OnSale != nil {
+		query = query.Where(boolCondition(onSaleCondition, *params.OnSale))
+	}
+
+	var conditions []string
+	var vars []interface{}
+	for _, name := range sortedKeys(params.Options) {
+		if skip == "option:"+name {
+			continue
+		}
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM jsonb_each_text(fv.options) fo WHERE lower(fo.key) = ? AND lower(fo.value) IN ?)")
+		vars = append(vars, name, params.Options[name])
+	}
+	if len(conditions) > 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM product_variants fv WHERE fv.product_id = products.id AND fv.deleted_at IS NULL AND "+
+			strings.Join(conditions, " AND ")+")", vars...)
+	}
+	return query
+}
+
+// page fetches the products after the cursor and the cursor for the next
+// page
+func (l *listing) page(result *Listing) error {
+	sorting := listingSorts[l.params.Sort]
+	key := sorting.key(l.tsQuery)
+	direction, comparison := "ASC", ">"
+	if sorting.desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	query := l.filtered("").Select("products.*")
+	if l.tsQuery != "" {
+		query = query.Scopes(selectSnippet(l.tsQuery))
+	}
+	if sorting.sales {
+		query = query.Joins(salesJoin, l.storeID, cancelledOrderStatuses())
+	}
+
+	if l.params.Cursor != "" {
+		value, id, err := l.decodeCursor(sorting)
+		if err != nil {
+			return err
+		}
+		query = query.Where(clause.Expr{
+			SQL:  "(" + key.SQL + ", products.id) " + comparison + " (?, ?)",
+			Vars: append(append([]interface{}{}, key.Vars...), value, id),
+		})
+	}
+
+	var products []models.Product
+	err := query.Scopes(PreloadVariants).
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:                key.SQL + " " + direction + ", products.id " + direction,
+			Vars:               key.Vars,
+			WithoutParentheses: true,
+		}}).
+		Limit(l.params.Limit + 1).
+		Find(&products).Error
+	if err != nil {
+		return err
+	}
+
+	if len(products) > l.params.Limit {
+		products = products[:l.params.Limit]
+		cursor, err := l.encodeCursor(sorting, products[len(products)-1].ID)
+		if err != nil {
+			return err
+		}
+		result.NextCursor = &cursor
+	}
+	result.Data = products
+	return nil
+}
+
+// encodeCursor reads the sort key of the page's last product back from the
+// database, so the next page compares against exactly the same value
+func (l *listing) encodeCursor(sorting listingSort, lastID uint) (string, error) {
+	key := sorting.key(l.tsQuery)
+	query := l.db.Model(&models.Product{}).Select(key.SQL, key.Vars...).Where("products.id = ?", lastID)
+	if sorting.sales {
+		query = query.Joins(salesJoin, l.storeID, cancelledOrderStatuses())
+	}
+
+	value := sorting.value()
+	if err := query.Row().Scan(value); err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	cursor, err := json.Marshal(listingCursor{Sort: l.params.Sort, Value: raw, ID: lastID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cursor), nil
+}
+
+func (l *listing) decodeCursor(sorting listingSort) (interface{}, uint, error) {
+	invalid := fmt.Errorf("%w: invalid cursor", ErrInvalidListing)
+
+	raw, err := base64.RawURLEncoding.DecodeString(l.params.Cursor)
+	if err != nil {
+		return nil, 0, invalid
+	}
+	var cursor listingCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, 0, invalid
+	}
+	if cursor.Sort != l.params.Sort {
+		return nil, 0, fmt.Errorf("%w: the cursor belongs to a different sort", ErrInvalidListing)
+	}
+
+	value := sorting.value()
+	if err := json.Unmarshal(cursor.Value, value); err != nil {
+		return nil, 0, invalid
+	}
+	return reflect.ValueOf(value).Elem().Interface(), cursor.ID, nil
+}
+
+func (l *listing) facets() (*Facets, error) {
+	facets := &Facets{}
+	var err error
+	if facets.Categories, err = l.categoryFacet(); err != nil {
+		return nil, err
+	}
+	if facets.Price, err = l.priceFacet(); err != nil {
+		return nil, err
+	}
+	if facets.InStock, err = l.boolFacet("in_stock", inStockCondition); err != nil {
+		return nil, err
+	}
+	if facets.OnSale, err = l.boolFacet("on_sale", onSaleCondition); err != nil {
+		return nil, err
+	}
+	if facets.Options, err = l.optionFacets(); err != nil {
+		return nil, err
+	}
+	return facets, nil
+}
+
+// categoryFacet counts products per category, adding subcategories' counts
+// to their ancestors. Categories without products are left out.
+func (l *listing) categoryFacet() ([]CategoryFacet, error) {
+	var rows []struct {
+		CategoryID uint
+		Count      int64
+	}
+	if err := l.filtered("category").Select("products.category_id, COUNT(*) AS count").
+		Where("products.category_id IS NOT NULL").Group("products.category_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	direct := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		direct[row.CategoryID] = row.Count
+	}
+
+	facets := []CategoryFacet{}
+	for _, category := range l.categories {
+		var count int64
+		for _, id := range CategoryDescendants(l.categories, category.ID) {
+			count += direct[id]
+		}
+		if count > 0 {
+			facets = append(facets, CategoryFacet{
+				ID:       category.ID,
+				Slug:     category.Slug,
+				Name:     category.Name,
+				ParentID: category.ParentID,
+				Count:    count,
+			})
+		}
+	}
+	return facets, nil
+}
+
+// priceFacet reports the price range and splits it into equal ranges
+func (l *listing) priceFacet() (PriceFacet, error) {
+	var bounds struct {
+		Min   *float64
+		Max   *float64
+		Count int64
+	}
+	if err := l.filtered("price").Select("MIN(products.price) AS min, MAX(products.price) AS max, COUNT(*) AS count").
+		Scan(&bounds).Error; err != nil {
+		return PriceFacet{}, err
+	}
+
+	facet := PriceFacet{Min: bounds.Min, Max: bounds.Max, Ranges: []PriceRange{}}
+	if bounds.Min == nil || bounds.Max == nil {
+		return facet, nil
+	}
+	low, high := *bounds.Min, *bounds.Max
+	if low == high {
+		facet.Ranges = append(facet.Ranges, PriceRange{Min: low, Max: high, Count: bounds.Count})
+		return facet, nil
+	}
+
+	var rows []struct {
+		Bucket int
+		Count  int64
+	}
+	// width_bucket puts the maximum price in an extra bucket, folded into
+	// the last range below
+	if err := l.filtered("price").Select("width_bucket(products.price, ?, ?, ?) AS bucket, COUNT(*) AS count", low, high, priceRanges).
+		Group("bucket").Scan(&rows).Error; err != nil {
+		return PriceFacet{}, err
+	}
+
+	width := (high - low) / priceRanges
+	for i := 0; i < priceRanges; i++ {
+		facet.Ranges = append(facet.Ranges, PriceRange{Min: low + float64(i)*width, Max: low + float64(i+1)*width})
+	}
+	facet.Ranges[priceRanges-1].Max = high
+	for _, row := range rows {
+		bucket := row.Bucket
+		if bucket > priceRanges {
+			bucket = priceRanges
+		}
+		if bucket >= 1 {
+			facet.Ranges[bucket-1].Count += row.Count
+		}
+	}
+	return facet, nil
+}
+
+func (l *listing) boolFacet(name, condition string) (BoolFacet, error) {
+	var counts struct {
+		Yes int64
+		No  int64
+	}
+	err := l.filtered(name).
+		Select("COUNT(*) FILTER (WHERE " + condition + ") AS yes, COUNT(*) FILTER (WHERE NOT " + condition + ") AS no").
+		Scan(&counts).Error
+	return BoolFacet{True: counts.Yes, False: counts.No}, err
+}
+
+// optionFacets counts products per variant option value. Options that are
+// being filtered on are counted without their own filter.
+func (l *listing) optionFacets() ([]OptionFacet, error) {
+	type optionCount struct {
+		Name  string
+		Value string
+		Count int64
+	}
+	count := func(skip, onlyName string) ([]optionCount, error) {
+		query := l.db.Table("product_variants AS v").
+			Select("MIN(o.key) AS name, MIN(o.value) AS value, COUNT(DISTINCT v.product_id) AS count").
+			Joins("CROSS JOIN LATERAL jsonb_each_text(v.options) AS o").
+			Where("v.deleted_at IS NULL AND v.product_id IN (?)", l.filtered(skip).Select("products.id"))
+		if onlyName != "" {
+			query = query.Where("lower(o.key) = ?", onlyName)
+		}
+		var rows []optionCount
+		err := query.Group("lower(o.key), lower(o.value)").Scan(&rows).Error
+		return rows, err
+	}
+
+	rows, err := count("", "")
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]optionCount, 0, len(rows))
+	for _, row := range rows {
+		if _, filtered := l.params.Options[strings.ToLower(row.Name)]; !filtered {
+			counts = append(counts, row)
+		}
+	}
+	for _, name := range sortedKeys(l.params.Options) {
+		rows, err := count("option:"+name, name)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, rows...)
+	}
+
+	byName := make(map[string]*OptionFacet)
+	var names []string
+	for _, row := range counts {
+		key := strings.ToLower(row.Name)
+		facet, ok := byName[key]
+		if !ok {
+			facet = &OptionFacet{Name: row.Name}
+			byName[key] = facet
+			names = append(names, key)
+		}
+		facet.Values = append(facet.Values, OptionValueFacet{Value: row.Value, Count: row.Count})
+	}
+
+	sort.Strings(names)
+	facets := make([]OptionFacet, 0, len(names))
+	for _, name := range names {
+		facet := byName[name]
+		sort.Slice(facet.Values, func(i, j int) bool {
+			if facet.Values[i].Count != facet.Values[j].Count {
+				return facet.Values[i].Count > facet.Values[j].Count
+			}
+			return facet.Values[i].Value < facet.Values[j].Value
+		})
+		facets = append(facets, *facet)
+	}
+	return facets, nil
+}
+
+func boolCondition(condition string, want bool) string {
+	if want {
+		return condition
+	}
+	return "NOT " + condition
+}
+
+func cancelledOrderStatuses() []models.OrderStatus {
+	return []models.OrderStatus{models.OrderStatusCancelled, models.OrderStatusRefunded}
+}
+
+func parsePriceBound(raw string) (*float64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || value < 0 {
+		return nil, fmt.Errorf("%w: invalid price %q", ErrInvalidListing, raw)
+	}
+	return &value, nil
+}
+
+func parseBoolFilter(values url.Values, name string) (*bool, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be true or false", ErrInvalidListing, name)
+	}
+	return &value, nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
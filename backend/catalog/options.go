@@ -0,0 +1,227 @@
+// Package catalog holds product rules shared by the product endpoints
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"storemaker-backend/models"
+	"storemaker-backend/utils"
+)
+
+// Option matrix limits
+const (
+	MaxOptions  = 3
+	MaxVariants = 100
+)
+
+// ErrInvalidOptions is wrapped by every option validation error
+var ErrInvalidOptions = errors.New("invalid product options")
+
+var (
+	ErrTooManyOptions  = fmt.Errorf("%w: a product can have at most %d options", ErrInvalidOptions, MaxOptions)
+	ErrTooManyVariants = fmt.Errorf("%w: options would generate more than %d variants", ErrInvalidOptions, MaxVariants)
+)
+
+var skuPlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// NormalizeOptions trims option names and values and rejects blanks and
+// duplicates, which compare case-insensitively
+func NormalizeOptions(options models.ProductOptions) (models.ProductOptions, error) {
+	if len(options) > MaxOptions {
+		return nil, ErrTooManyOptions
+	}
+
+	normalized := make(models.ProductOptions, 0, len(options))
+	names := make(map[string]bool, len(options))
+	combinations := 1
+	for _, option := range options {
+		name := strings.TrimSpace(option.Name)
+		if name == "" {
+			return nil, fmt.Errorf("%w: option names cannot be blank", ErrInvalidOptions)
+		}
+		if names[strings.ToLower(name)] {
+			return nil, fmt.Errorf("%w: option %q is listed twice", ErrInvalidOptions, name)
+		}
+		names[strings.ToLower(name)] = true
+
+		values := make([]string, 0, len(option.Values))
+		seen := make(map[string]bool, len(option.Values))
+		for _, value := range option.Values {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				return nil, fmt.Errorf("%w: option %q has a blank value", ErrInvalidOptions, name)
+			}
+			if seen[strings.ToLower(value)] {
+				return nil, fmt.Errorf("%w: option %q lists %q twice", ErrInvalidOptions, name, value)
+			}
+			seen[strings.ToLower(value)] = true
+			values = append(values, value)
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("%w: option %q has no values", ErrInvalidOptions, name)
+		}
+
+		combinations *= len(values)
+		if combinations > MaxVariants {
+			return nil, ErrTooManyVariants
+		}
+		normalized = append(normalized, models.ProductOption{Name: name, Values: values})
+	}
+	return normalized, nil
+}
+
+// GenerateVariants returns one variant per combination of option values, in
+// option order. A variant in existing with the same combination is kept as
+// it is, so its ID, price, SKU, stock and image survive edits to other
+// options; new combinations take the defaults and have no ID until saved.
+// No options means no variants.
+func GenerateVariants(product *models.Product, options models.ProductOptions, existing models.ProductVariants, defaults models.VariantDefaults) (models.ProductVariants, error) {
+	options, err := NormalizeOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if len(options) == 0 {
+		return models.ProductVariants{}, nil
+	}
+
+	pattern := defaults.SKUPattern
+	if pattern == "" {
+		pattern = defaultSKUPattern(product.SKU, options)
+	}
+	if err := checkSKUPattern(pattern, options); err != nil {
+		return nil, err
+	}
+
+	kept := make(map[string]models.ProductVariant, len(existing))
+	for _, variant := range existing {
+		if key, ok := combinationKey(options, variant.Options); ok {
+			if _, dup := kept[key]; !dup {
+				kept[key] = variant
+			}
+		}
+	}
+
+	price := product.Price
+	if defaults.Price != nil {
+		price = *defaults.Price
+	}
+	stock := 0
+	if defaults.Stock != nil {
+		stock = *defaults.Stock
+	}
+
+	combinations := [][]string{{}}
+	for _, option := range options {
+		next := make([][]string, 0, len(combinations)*len(option.Values))
+		for _, combination := range combinations {
+			for _, value := range option.Values {
+				next = append(next, append(append([]string{}, combination...), value))
+			}
+		}
+		combinations = next
+	}
+
+	variants := make(models.ProductVariants, 0, len(combinations))
+	for _, values := range combinations {
+		selected := make(models.VariantOptions, len(options))
+		for i, option := range options {
+			selected[option.Name] = values[i]
+		}
+		key, _ := combinationKey(options, selected)
+
+		variant, ok := kept[key]
+		if !ok {
+			variant = models.ProductVariant{
+				Price: price,
+				SKU:   expandSKUPattern(pattern, product.SKU, options, values),
+				Stock: stock,
+			}
+		}
+		// Names and option keys follow the current spelling of the options
+		variant.Name = strings.Join(values, " / ")
+		variant.Options = selected
+		variants = append(variants, variant)
+	}
+	return variants, nil
+}
+
+// combinationKey identifies a variant by its option values. It only matches
+// when the variant has a value, spelt either way, for every option and no
+// others.
+func combinationKey(options models.ProductOptions, selected models.VariantOptions) (string, bool) {
+	if len(selected) != len(options) {
+		return "", false
+	}
+
+	lowered := make(map[string]string, len(selected))
+	for name, value := range selected {
+		lowered[strings.ToLower(strings.TrimSpace(name))] = strings.ToLower(strings.TrimSpace(value))
+	}
+
+	parts := make([]string, 0, len(options))
+	for _, option := range options {
+		value, ok := lowered[strings.ToLower(option.Name)]
+		if !ok {
+			return "", false
+		}
+		found := false
+		for _, allowed := range option.Values {
+			if strings.ToLower(allowed) == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+		parts = append(parts, strings.ToLower(option.Name)+"="+value)
+	}
+	return strings.Join(parts, "\x00"), true
+}
+
+func defaultSKUPattern(sku string, options models.ProductOptions) string {
+	parts := make([]string, 0, len(options)+1)
+	if sku != "" {
+		parts = append(parts, "{sku}")
+	}
+	for _, option := range options {
+		parts = append(parts, "{"+option.Name+"}")
+	}
+	return strings.Join(parts, "-")
+}
+
+// checkSKUPattern rejects placeholders that are neither {sku} nor an option
+func checkSKUPattern(pattern string, options models.ProductOptions) error {
+	for _, match := range skuPlaceholder.FindAllStringSubmatch(pattern, -1) {
+		if optionIndex(options, match[1]) < 0 && !strings.EqualFold(strings.TrimSpace(match[1]), "sku") {
+			return fmt.Errorf("%w: unknown SKU placeholder {%s}", ErrInvalidOptions, match[1])
+		}
+	}
+	return nil
+}
+
+// expandSKUPattern fills in the pattern's placeholders. Option values are
+// upper-cased slugs, so "Navy Blue" becomes NAVY-BLUE.
+func expandSKUPattern(pattern, sku string, options models.ProductOptions, values []string) string {
+	expanded := skuPlaceholder.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		if strings.EqualFold(strings.TrimSpace(name), "sku") {
+			return sku
+		}
+		return strings.ToUpper(utils.GenerateSlug(values[optionIndex(options, name)]))
+	})
+	return strings.Trim(expanded, "-_ ")
+}
+
+func optionIndex(options models.ProductOptions, name string) int {
+	name = strings.TrimSpace(name)
+	for i, option := range options {
+		if strings.EqualFold(option.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,80 @@
+package catalog
+
+import (
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxSearchTerms caps how many words of a query are searched for
+const maxSearchTerms = 10
+
+// snippetOptions configure ts_headline. Matches are wrapped in <mark>.
+const snippetOptions = `StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5, FragmentDelimiter=" … "`
+
+// Search filters products to those matching q, best matches first, and
+// fills in each product's snippet. Every word of q must match, and the last
+// letters of a word may be missing, so "blu shi" finds "Blue Shirt". A query
+// without words leaves the statement unchanged.
+func Search(q string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		tsQuery := searchTSQuery(q)
+		if tsQuery == "" {
+			return db
+		}
+
+		rank := searchRank(tsQuery)
+		return db.Scopes(selectSnippet(tsQuery)).
+			Where("products.search_vector @@ to_tsquery('simple', ?)", tsQuery).
+			Order(clause.OrderBy{Expression: clause.Expr{
+				SQL:                rank.SQL + " DESC, products.id",
+				Vars:               rank.Vars,
+				WithoutParentheses: true,
+			}})
+	}
+}
+
+// selectSnippet selects products with a highlighted snippet of their
+// descriptions
+func selectSnippet(tsQuery string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Select("products.*, ts_headline('simple', concat_ws(' ', products.short_desc, products.description), to_tsquery('simple', ?), ?) AS snippet", tsQuery, snippetOptions)
+	}
+}
+
+// searchRank scores how well a product matches
+func searchRank(tsQuery string) clause.Expr {
+	return clause.Expr{SQL: "ts_rank_cd(products.search_vector, to_tsquery('simple', ?))", Vars: []interface{}{tsQuery}}
+}
+
+// searchTSQuery turns free text into a prefix tsquery such as
+// "blu:* & shi:*". Only letters and digits are kept, so the result is always
+// valid tsquery syntax.
+func searchTSQuery(q string) string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	// Single letters, like the s of "shirt's", would match almost anything
+	// as a prefix; they only count when they are all there is
+	longer := make([]string, 0, len(words))
+	for _, word := range words {
+		if len([]rune(word)) > 1 {
+			longer = append(longer, word)
+		}
+	}
+	if len(longer) > 0 {
+		words = longer
+	}
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = word + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
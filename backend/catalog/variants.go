@@ -0,0 +1,230 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"storemaker-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrVariantNotFound   = errors.New("variant not found")
+	ErrInsufficientStock = errors.New("not enough stock")
+)
+
+// SKUConflictError reports a SKU that is already taken in the store
+type SKUConflictError struct {
+	SKU string
+}
+
+func (e *SKUConflictError) Error() string {
+	return fmt.Sprintf("SKU %q is already used by another variant in this store", e.SKU)
+}
+
+// PreloadVariants loads products' variants in their display order
+func PreloadVariants(db *gorm.DB) *gorm.DB {
+	return db.Preload("Variants", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position, id")
+	})
+}
+
+// SaveVariants makes variants the product's full set of variants, in order.
+// Variants with the ID or legacy ID of an existing one update it, the rest
+// are created, and existing variants left out are deleted. The product's
+// variants are locked for the duration of tx.
+func SaveVariants(tx *gorm.DB, product *models.Product, variants []models.ProductVariant) error {
+	var current []models.ProductVariant
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("product_id = ?", product.ID).Find(&current).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]models.ProductVariant, len(current))
+	byLegacyID := make(map[string]uint)
+	for _, variant := range current {
+		byID[variant.ID] = variant
+		if variant.LegacyID != "" {
+			byLegacyID[variant.LegacyID] = variant.ID
+		}
+	}
+
+	saved := make([]models.ProductVariant, len(variants))
+	keep := make(map[uint]bool, len(variants))
+	skus := make(map[string]bool, len(variants))
+	for i, variant := range variants {
+		variant.SKU = strings.TrimSpace(variant.SKU)
+		if variant.SKU != "" {
+			if skus[variant.SKU] {
+				return &SKUConflictError{SKU: variant.SKU}
+			}
+			skus[variant.SKU] = true
+		}
+		if variant.ID == 0 && variant.LegacyID != "" {
+			variant.ID = byLegacyID[variant.LegacyID]
+		}
+		if _, ok := byID[variant.ID]; !ok || keep[variant.ID] {
+			variant.ID = 0
+		}
+		keep[variant.ID] = variant.ID != 0
+		variant.LegacyID = byID[variant.ID].LegacyID
+		variant.ProductID = product.ID
+		variant.StoreID = product.StoreID
+		variant.Position = i
+		if variant.Options == nil {
+			variant.Options = models.VariantOptions{}
+		}
+		saved[i] = variant
+	}
+
+	if err := checkSKUsFree(tx, product, skus); err != nil {
+		return err
+	}
+
+	var removed []uint
+	var renamed []uint
+	for _, variant := range current {
+		if !keep[variant.ID] {
+			removed = append(removed, variant.ID)
+		}
+	}
+	for _, variant := range saved {
+		if variant.ID != 0 && byID[variant.ID].SKU != variant.SKU {
+			renamed = append(renamed, variant.ID)
+		}
+	}
+	if len(removed) > 0 {
+		if err := tx.Where("id IN ?", removed).Delete(&models.ProductVariant{}).Error; err != nil {
+			return err
+		}
+	}
+	// Clear changing SKUs first so variants can swap SKUs without tripping
+	// the unique index
+	if len(renamed) > 0 {
+		if err := tx.Model(&models.ProductVariant{}).Where("id IN ?", renamed).Update("sku", "").Error; err != nil {
+			return err
+		}
+	}
+
+	for i := range saved {
+		if saved[i].ID == 0 {
+			if err := tx.Create(&saved[i]).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tx.Model(&saved[i]).
+			Select("name", "price", "sku", "stock", "image", "options", "position").
+			Updates(&saved[i]).Error; err != nil {
+			return err
+		}
+	}
+
+	product.Variants = saved
+	return nil
+}
+
+// UpdateVariant locks one of a product's variants, applies update to it and
+// saves it
+func UpdateVariant(tx *gorm.DB, product *models.Product, variantID uint, update func(*models.ProductVariant)) (*models.ProductVariant, error) {
+	variant, err := lockVariant(tx, product.ID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	update(variant)
+	variant.SKU = strings.TrimSpace(variant.SKU)
+	if variant.SKU != "" {
+		var count int64
+		if err := tx.Model(&models.ProductVariant{}).
+			Where("store_id = ? AND sku = ? AND id != ?", product.StoreID, variant.SKU, variant.ID).
+			Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, &SKUConflictError{SKU: variant.SKU}
+		}
+	}
+
+	if err := tx.Model(variant).Select("price", "sku", "stock", "image").Updates(variant).Error; err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+// AdjustStock changes a variant's stock by delta under a row lock, so
+// concurrent orders and restocks cannot lose updates. Stock never goes below
+// zero.
+func AdjustStock(tx *gorm.DB, productID, variantID uint, delta int) (*models.ProductVariant, error) {
+	variant, err := lockVariant(tx, productID, variantID)
+	if err != nil {
+		return nil, err
+	}
+	if variant.Stock+delta < 0 {
+		return nil, ErrInsufficientStock
+	}
+
+	variant.Stock += delta
+	if err := tx.Model(variant).Update("stock", variant.Stock).Error; err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+// FindVariant loads one of a product's variants by its ID, or by its legacy
+// ID when id is zero
+func FindVariant(db *gorm.DB, productID, id uint, legacyID string) (*models.ProductVariant, error) {
+	query := db.Where("product_id = ?", productID)
+	if id != 0 {
+		query = query.Where("id = ?", id)
+	} else if legacyID != "" {
+		query = query.Where("legacy_id = ?", legacyID)
+	} else {
+		return nil, ErrVariantNotFound
+	}
+
+	var variant models.ProductVariant
+	if err := query.First(&variant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVariantNotFound
+		}
+		return nil, err
+	}
+	return &variant, nil
+}
+
+func lockVariant(tx *gorm.DB, productID, variantID uint) (*models.ProductVariant, error) {
+	var variant models.ProductVariant
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND product_id = ?", variantID, productID).First(&variant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVariantNotFound
+		}
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// checkSKUsFree rejects SKUs used by variants of the store's other products
+func checkSKUsFree(tx *gorm.DB, product *models.Product, skus map[string]bool) error {
+	if len(skus) == 0 {
+		return nil
+	}
+	list := make([]string, 0, len(skus))
+	for sku := range skus {
+		list = append(list, sku)
+	}
+
+	var taken []string
+	if err := tx.Model(&models.ProductVariant{}).
+		Where("store_id = ? AND product_id != ? AND sku IN ?", product.StoreID, product.ID, list).
+		Limit(1).Pluck("sku", &taken).Error; err != nil {
+		return err
+	}
+	if len(taken) > 0 {
+		return &SKUConflictError{SKU: taken[0]}
+	}
+	return nil
+}
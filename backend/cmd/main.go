@@ -8,6 +8,7 @@ import (
 	"storemaker-backend/config"
 	"storemaker-backend/database"
 	"storemaker-backend/routes"
+	"storemaker-backend/utils"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -39,24 +40,26 @@ func main() {
 	// Initialize Gin router
 	router := gin.Default()
 
+	// Client IPs are checked against API key allowlists, so forwarded
+	// addresses are only believed from proxies that are configured
+	if err := router.SetTrustedProxies(utils.TrustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	// Configure CORS
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:3001"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Preview-Token", "X-Store-Access-Token"},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After"},
 		AllowCredentials: true,
 	}))
 
 	// Setup routes
 	routes.SetupRoutes(router, db)
 
-<<<<<<< HEAD
-=======
-	// Serve uploaded static files
-	router.Static("/uploads", "./uploads")
+	// Uploaded files are served by routes.SetupRoutes when stored locally
 
->>>>>>> url/main
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,154 @@
+// Command migrate-uploads copies uploaded files from one storage backend to
+// another and points the links stored in the database at the copies. Both
+// backends are configured from the environment as for the server:
+//
+//	S3_BUCKET=... go run cmd/migrate-uploads/migrate-uploads.go -from local -to s3
+//
+// Run it with -dry-run first to list what would be copied, and switch
+// STORAGE_DRIVER once it has finished.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path"
+
+	"storemaker-backend/database"
+	"storemaker-backend/storage"
+
+	"gorm.io/gorm"
+)
+
+// urlColumn is a column that may hold links to uploads
+type urlColumn struct {
+	table  string
+	column string
+	jsonb  bool
+}
+
+var urlColumns = []urlColumn{
+	{"stores", "logo", false},
+	{"stores", "favicon", false},
+	{"store_themes", "logo_url", false},
+	{"store_themes", "favicon_url", false},
+	{"categories", "image", false},
+	{"products", "images", true},
+	{"product_variants", "image", false},
+	{"media", "url", false},
+	{"media", "srcset", false},
+	{"media", "renditions", true},
+	{"components", "config", true},
+	{"store_layout_components", "props", true},
+	{"store_layout_revisions", "components", true},
+}
+
+func main() {
+	from := flag.String("from", "local", "storage driver to copy from")
+	to := flag.String("to", "s3", "storage driver to copy to")
+	fromURL := flag.String("from-url", "", "base URL stored links use, when not the source's, e.g. http://localhost:8080/uploads")
+	dryRun := flag.Bool("dry-run", false, "list the files without copying them or changing links")
+	deleteSource := flag.Bool("delete", false, "delete each file from the source once it has been copied")
+	flag.Parse()
+
+	if *from == *to {
+		log.Fatal("-from and -to must name different drivers")
+	}
+	source, err := storage.DriverFromEnv(*from)
+	if err != nil {
+		log.Fatalf("Failed to configure %s storage: %v", *from, err)
+	}
+	target, err := storage.DriverFromEnv(*to)
+	if err != nil {
+		log.Fatalf("Failed to configure %s storage: %v", *to, err)
+	}
+
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		log.Fatal("DATABASE_URL environment variable is required")
+	}
+	db, err := database.Initialize(databaseURL)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	ctx := context.Background()
+	var copied []string
+	var bytes int64
+	err = source.Walk(ctx, "", func(object storage.Object) error {
+		if *dryRun {
+			fmt.Printf("%s (%d bytes)\n", object.Key, object.Size)
+			copied = append(copied, object.Key)
+			bytes += object.Size
+			return nil
+		}
+
+		body, err := source.Open(ctx, object.Key)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", object.Key, err)
+		}
+		defer body.Close()
+		if err := target.Put(ctx, object.Key, body, object.Size, mime.TypeByExtension(path.Ext(object.Key))); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", object.Key, err)
+		}
+		copied = append(copied, object.Key)
+		bytes += object.Size
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Migration stopped after %d files: %v", len(copied), err)
+	}
+
+	if *dryRun {
+		fmt.Printf("Would copy %d files (%d bytes) from %s to %s\n", len(copied), bytes, *from, *to)
+		return
+	}
+	fmt.Printf("Copied %d files (%d bytes) from %s to %s\n", len(copied), bytes, *from, *to)
+
+	oldBase := source.BaseURL()
+	if *fromURL != "" {
+		oldBase = *fromURL
+	}
+	if err := rewriteURLs(db, oldBase, target.BaseURL()); err != nil {
+		log.Fatalf("Failed to update links: %v", err)
+	}
+
+	if *deleteSource {
+		for _, key := range copied {
+			if err := source.Delete(ctx, key); err != nil {
+				log.Printf("Failed to delete %s from %s: %v", key, *from, err)
+			}
+		}
+		fmt.Printf("Deleted %d files from %s\n", len(copied), *from)
+	}
+}
+
+// rewriteURLs replaces oldBase with newBase in every column that may link
+// to uploads, in one transaction
+func rewriteURLs(db *gorm.DB, oldBase, newBase string) error {
+	oldPrefix, newPrefix := oldBase+"/", newBase+"/"
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, col := range urlColumns {
+			value := col.column
+			if col.jsonb {
+				value = col.column + "::text"
+			}
+			set := fmt.Sprintf("REPLACE(%s, ?, ?)", value)
+			if col.jsonb {
+				set += "::jsonb"
+			}
+			query := fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s LIKE ?", col.table, col.column, set, value)
+			result := tx.Exec(query, oldPrefix, newPrefix, "%"+oldPrefix+"%")
+			if result.Error != nil {
+				return fmt.Errorf("%s.%s: %w", col.table, col.column, result.Error)
+			}
+			if result.RowsAffected > 0 {
+				fmt.Printf("Updated %d links in %s.%s\n", result.RowsAffected, col.table, col.column)
+			}
+		}
+		return nil
+	})
+}
@@ -3,11 +3,8 @@ package config
 import (
 	"os"
 )
-<<<<<<< HEAD
 
-=======
 // config struct
->>>>>>> url/main
 type Config struct {
 	DatabaseURL  string
 	JWTSecret    string
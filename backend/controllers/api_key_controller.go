@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"storemaker-backend/models"
+	"storemaker-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type APIKeyController struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyController(db *gorm.DB) *APIKeyController {
+	return &APIKeyController{db: db}
+}
+
+// GetAPIKeys lists the API keys of a store, including revoked ones
+func (ctrl *APIKeyController) GetAPIKeys(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var keys []models.APIKey
+	if err := ctrl.db.Where("store_id = ?", store.ID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey creates a key and returns the plain value. It is never shown again.
+func (ctrl *APIKeyController) CreateAPIKey(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var req models.APIKeyCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !validAPIKeyScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope: " + scope})
+			return
+		}
+	}
+	for _, entry := range req.AllowedIPs {
+		if !validIPEntry(entry) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IP address or CIDR range: " + entry})
+			return
+		}
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	secret, err := utils.GenerateRandomString(40)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+	rawKey := models.APIKeyPrefix + secret
+
+	key := models.APIKey{
+		StoreID:     store.ID,
+		CreatedByID: c.GetUint("user_id"),
+		Name:        req.Name,
+		Prefix:      rawKey[:len(models.APIKeyPrefix)+6],
+		KeyHash:     utils.HashToken(rawKey),
+		Scopes:      models.StringList(req.Scopes),
+		AllowedIPs:  models.StringList(req.AllowedIPs),
+		ExpiresAt:   req.ExpiresAt,
+	}
+	if key.AllowedIPs == nil {
+		key.AllowedIPs = models.StringList{}
+	}
+
+	if err := db.Create(&key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": key,
+		"key":     rawKey,
+		"message": "Store this key now, it will not be shown again",
+	})
+}
+
+// RevokeAPIKey revokes a key immediately. Revoked keys stay listed for reference.
+func (ctrl *APIKeyController) RevokeAPIKey(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	keyID, err := strconv.ParseUint(c.Param("keyId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	var key models.APIKey
+	if err := db.Where("id = ? AND store_id = ?", keyID, store.ID).First(&key).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API key"})
+		}
+		return
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		if err := db.Model(&key).Update("revoked_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
+
+func validAPIKeyScope(scope string) bool {
+	parts := strings.SplitN(scope, ":", 2)
+	if len(parts) != 2 || (parts[1] != "read" && parts[1] != "write") {
+		return false
+	}
+	for _, resource := range models.APIKeyResources {
+		if parts[0] == resource {
+			return true
+		}
+	}
+	return false
+}
+
+func validIPEntry(entry string) bool {
+	if strings.Contains(entry, "/") {
+		_, _, err := net.ParseCIDR(entry)
+		return err == nil
+	}
+	return net.ParseIP(entry) != nil
+}
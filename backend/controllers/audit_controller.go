@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"storemaker-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// auditExportLimit caps the number of rows in a CSV export
+const auditExportLimit = 50000
+
+type AuditController struct {
+	db *gorm.DB
+}
+
+func NewAuditController(db *gorm.DB) *AuditController {
+	return &AuditController{db: db}
+}
+
+// GetStoreAuditLog lists audit entries for one of the merchant's stores.
+// Supports the filters of applyAuditFilters and format=csv.
+func (ctrl *AuditController) GetStoreAuditLog(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	query := ctrl.db.Model(&models.AuditLog{}).Where("store_id = ?", store.ID)
+	ctrl.respondWithAuditLog(c, query, fmt.Sprintf("%s-audit", store.Slug))
+}
+
+// GetAuditLog lists audit entries across the platform. Admins can also filter
+// by store_id.
+func (ctrl *AuditController) GetAuditLog(c *gin.Context) {
+	query := ctrl.db.Model(&models.AuditLog{})
+	if storeID := c.Query("store_id"); storeID != "" {
+		id, err := strconv.ParseUint(storeID, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+			return
+		}
+		query = query.Where("store_id = ?", id)
+	}
+
+	ctrl.respondWithAuditLog(c, query, "audit")
+}
+
+func (ctrl *AuditController) respondWithAuditLog(c *gin.Context, query *gorm.DB, filename string) {
+	query, err := applyAuditFilters(c, query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		var entries []models.AuditLog
+		if err := query.Order("created_at DESC, id DESC").Limit(auditExportLimit).Find(&entries).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+			return
+		}
+		writeAuditCSV(c, entries, fmt.Sprintf("%s-%s.csv", filename, time.Now().Format("2006-01-02")))
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	// Pagination
+	page := 1
+	limit := 50
+	if p, err := strconv.Atoi(c.DefaultQuery("page", "1")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(c.DefaultQuery("limit", "50")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+
+	var entries []models.AuditLog
+	if err := query.Order("created_at DESC, id DESC").Offset((page - 1) * limit).Limit(limit).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  entries,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// applyAuditFilters narrows query by the action, entity_type, entity_id,
+// actor_id, from and to query parameters. Dates are RFC 3339 or YYYY-MM-DD;
+// a bare "to" date includes the whole day.
+func applyAuditFilters(c *gin.Context, query *gorm.DB) (*gorm.DB, error) {
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if entityType := c.Query("entity_type"); entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	if entityID := c.Query("entity_id"); entityID != "" {
+		id, err := strconv.ParseUint(entityID, 10, 32)
+		if err != nil {
+			return nil, errors.New("Invalid entity ID")
+		}
+		query = query.Where("entity_id = ?", id)
+	}
+	if actorID := c.Query("actor_id"); actorID != "" {
+		id, err := strconv.ParseUint(actorID, 10, 32)
+		if err != nil {
+			return nil, errors.New("Invalid actor ID")
+		}
+		query = query.Where("actor_id = ?", id)
+	}
+	if from := c.Query("from"); from != "" {
+		t, _, err := parseAuditDate(from)
+		if err != nil {
+			return nil, errors.New("Invalid from date")
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, dateOnly, err := parseAuditDate(to)
+		if err != nil {
+			return nil, errors.New("Invalid to date")
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+			query = query.Where("created_at < ?", t)
+		} else {
+			query = query.Where("created_at <= ?", t)
+		}
+	}
+	return query, nil
+}
+
+func parseAuditDate(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	return t, true, err
+}
+
+func writeAuditCSV(c *gin.Context, entries []models.AuditLog, filename string) {
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{
+		"id", "created_at", "action", "actor_id", "actor_email", "impersonator_id",
+		"store_id", "entity_type", "entity_id", "before", "after", "metadata", "ip_address", "user_agent",
+	})
+	for _, entry := range entries {
+		writer.Write([]string{
+			strconv.FormatUint(uint64(entry.ID), 10),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			string(entry.Action),
+			formatOptionalID(entry.ActorID),
+			entry.ActorEmail,
+			formatOptionalID(entry.ImpersonatorID),
+			formatOptionalID(entry.StoreID),
+			entry.EntityType,
+			formatOptionalID(entry.EntityID),
+			formatAuditJSON(entry.Before),
+			formatAuditJSON(entry.After),
+			formatAuditJSON(entry.Metadata),
+			entry.IPAddress,
+			entry.UserAgent,
+		})
+	}
+	writer.Flush()
+}
+
+func formatOptionalID(id *uint) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*id), 10)
+}
+
+func formatAuditJSON(values models.AuditMetadata) string {
+	if len(values) == 0 {
+		return ""
+	}
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
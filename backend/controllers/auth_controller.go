@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 
 	"storemaker-backend/middleware"
 	"storemaker-backend/models"
@@ -12,11 +14,12 @@ import (
 )
 
 type AuthController struct {
-	db *gorm.DB
+	db      *gorm.DB
+	limiter *utils.LoginLimiter
 }
 
-func NewAuthController(db *gorm.DB) *AuthController {
-	return &AuthController{db: db}
+func NewAuthController(db *gorm.DB, limiter *utils.LoginLimiter) *AuthController {
+	return &AuthController{db: db, limiter: limiter}
 }
 
 func (ctrl *AuthController) Register(c *gin.Context) {
@@ -105,48 +108,28 @@ func (ctrl *AuthController) Login(c *gin.Context) {
 		return
 	}
 
+	// Count the attempt before checking the password, rejecting it while the
+	// account or client IP is backing off or locked
+	if !reserveLoginAttempt(ctrl.db, ctrl.limiter, c, req.Email) {
+		return
+	}
+
 	// Find user by email
 	var user models.User
 	if err := ctrl.db.Where("email = ? AND is_active = ?", req.Email, true).First(&user).Error; err != nil {
+		recordLoginFailure(ctrl.db, c, req.Email, nil, "unknown_account")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
 	// Check password
 	if err := utils.CheckPassword(user.Password, req.Password); err != nil {
+		recordLoginFailure(ctrl.db, c, req.Email, &user.ID, "invalid_password")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	// Generate tokens
-	accessToken, err := middleware.GenerateToken(&user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
-		return
-	}
-
-	refreshToken, err := middleware.GenerateRefreshToken(&user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
-		return
-	}
-
-	userResponse := models.UserResponse{
-		ID:        user.ID,
-		Email:     user.Email,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		Role:      user.Role,
-		IsActive:  user.IsActive,
-		CreatedAt: user.CreatedAt,
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"message":       "Login successful",
-		"user":          userResponse,
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
-	})
+	finishLogin(ctrl.db, ctrl.limiter, c, &user, "password")
 }
 
 func (ctrl *AuthController) RefreshToken(c *gin.Context) {
@@ -163,7 +146,7 @@ func (ctrl *AuthController) RefreshToken(c *gin.Context) {
 	// Parse and validate refresh token
 	claims := &middleware.Claims{}
 	token, err := utils.ParseJWTToken(req.RefreshToken, claims)
-	if err != nil || !token.Valid {
+	if err != nil || !token.Valid || claims.Issuer != middleware.RefreshTokenIssuer {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
@@ -186,3 +169,137 @@ func (ctrl *AuthController) RefreshToken(c *gin.Context) {
 		"access_token": accessToken,
 	})
 }
+
+// respondWithTokens issues an access/refresh token pair and writes them, with
+// the user, into the given response body
+func respondWithTokens(c *gin.Context, user *models.User, status int, body gin.H) {
+	accessToken, err := middleware.GenerateToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
+		return
+	}
+
+	refreshToken, err := middleware.GenerateRefreshToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		return
+	}
+
+	body["user"] = toUserResponse(user)
+	body["access_token"] = accessToken
+	body["refresh_token"] = refreshToken
+	c.JSON(status, body)
+}
+
+func toUserResponse(user *models.User) models.UserResponse {
+	return models.UserResponse{
+		ID:               user.ID,
+		Email:            user.Email,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		Role:             user.Role,
+		IsActive:         user.IsActive,
+		CreatedAt:        user.CreatedAt,
+		TwoFactorEnabled: user.TwoFactorEnabled,
+		EmailVerifiedAt:  user.EmailVerifiedAt,
+	}
+}
+
+// reserveLoginAttempt counts the attempt with the limiter, or writes a 429
+// response when it must wait and returns false. A reserved attempt ends in
+// recordLoginFailure, recordLoginSuccess or releaseLoginAttempt.
+func reserveLoginAttempt(db *gorm.DB, limiter *utils.LoginLimiter, c *gin.Context, email string) bool {
+	wait := limiter.Reserve(email, c.ClientIP())
+	if wait <= 0 {
+		return true
+	}
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	middleware.RecordAudit(db, c, models.AuditLog{
+		ActorEmail: email,
+		Action:     models.AuditActionLoginBlocked,
+		Metadata:   models.AuditMetadata{"retry_after": retryAfter},
+	})
+
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts. Please try again later.",
+		"retry_after": retryAfter,
+	})
+	return false
+}
+
+// recordLoginFailure audits a failed attempt; the limiter counted it when it
+// was reserved
+func recordLoginFailure(db *gorm.DB, c *gin.Context, email string, userID *uint, reason string) {
+	middleware.RecordAudit(db, c, models.AuditLog{
+		ActorID:    userID,
+		ActorEmail: email,
+		Action:     models.AuditActionLoginFailure,
+		Metadata:   models.AuditMetadata{"reason": reason},
+	})
+}
+
+func recordLoginSuccess(db *gorm.DB, limiter *utils.LoginLimiter, c *gin.Context, user *models.User, method string) {
+	limiter.RecordSuccess(user.Email, c.ClientIP())
+	middleware.RecordAudit(db, c, models.AuditLog{
+		ActorID:    &user.ID,
+		ActorEmail: user.Email,
+		Action:     models.AuditActionLoginSuccess,
+		Metadata:   models.AuditMetadata{"method": method},
+	})
+}
+
+// releaseLoginAttempt uncounts a reserved attempt that did not fail
+func releaseLoginAttempt(limiter *utils.LoginLimiter, c *gin.Context, email string) {
+	limiter.Release(email, c.ClientIP())
+}
+
+// finishLogin runs the steps shared by every login method once the primary
+// credential has been verified: the 2FA challenge, the admin 2FA policy and
+// finally token issuance.
+func finishLogin(db *gorm.DB, limiter *utils.LoginLimiter, c *gin.Context, user *models.User, method string) {
+	// Second step: accounts with 2FA must present a code before receiving tokens
+	if user.TwoFactorEnabled {
+		// The code is counted again when it is verified
+		releaseLoginAttempt(limiter, c, user.Email)
+		twoFactorToken, err := middleware.GenerateTwoFactorToken(user, middleware.TwoFactorPurposeVerify)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate two-factor token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":             "Two-factor authentication required",
+			"two_factor_required": true,
+			"two_factor_token":    twoFactorToken,
+		})
+		return
+	}
+
+	// Admins must enroll first when the platform policy requires 2FA
+	if user.Role == models.RoleAdmin {
+		policy, err := loadSecurityPolicy(db)
+		if err != nil {
+			releaseLoginAttempt(limiter, c, user.Email)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load security policy"})
+			return
+		}
+		if policy.RequireAdminTwoFactor {
+			releaseLoginAttempt(limiter, c, user.Email)
+			setupToken, err := middleware.GenerateTwoFactorToken(user, middleware.TwoFactorPurposeSetup)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate two-factor token"})
+				return
+			}
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                     "Two-factor authentication must be set up for admin accounts",
+				"two_factor_setup_required": true,
+				"two_factor_token":          setupToken,
+			})
+			return
+		}
+	}
+
+	recordLoginSuccess(db, limiter, c, user, method)
+	respondWithTokens(c, user, http.StatusOK, gin.H{"message": "Login successful"})
+}
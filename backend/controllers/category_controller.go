@@ -0,0 +1,531 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"storemaker-backend/catalog"
+	"storemaker-backend/models"
+	"storemaker-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errCategoryParentNotFound = errors.New("parent category not found")
+	errCategoryCycle          = errors.New("a category cannot be moved under itself or one of its descendants")
+	errCategorySlugTaken      = errors.New("category slug is already in use in this store")
+)
+
+type CategoryController struct {
+	db *gorm.DB
+}
+
+func NewCategoryController(db *gorm.DB) *CategoryController {
+	return &CategoryController{db: db}
+}
+
+// GetCategories returns the store's categories as a tree, or as a flat list
+// ordered by parent and position with ?flat=true
+func (ctrl *CategoryController) GetCategories(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	categories, err := catalog.StoreCategories(ctrl.db, store.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	if c.Query("flat") == "true" {
+		c.JSON(http.StatusOK, gin.H{"data": categories})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": categoryTree(categories)})
+}
+
+func (ctrl *CategoryController) GetCategory(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	category, ok := ctrl.storeCategory(c, ctrl.db, store.ID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// CreateCategory adds a category under an optional parent. It goes last among
+// its siblings unless a position is given. The slug is derived from the name
+// when omitted; an explicit slug must be free in the store.
+func (ctrl *CategoryController) CreateCategory(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var req models.CategoryCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category := models.Category{
+		Name:        req.Name,
+		Description: req.Description,
+		Image:       req.Image,
+		ParentID:    req.ParentID,
+		StoreID:     store.ID,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if req.ParentID != nil {
+			if err := checkCategoryParent(tx, store.ID, *req.ParentID, 0); err != nil {
+				return err
+			}
+		}
+
+		slug, err := categorySlug(tx, store.ID, req.Slug, req.Name, 0)
+		if err != nil {
+			return err
+		}
+		category.Slug = slug
+
+		// Created last, then placed, so the row has an ID to order by
+		category.Position = 1 << 30
+		if err := tx.Create(&category).Error; err != nil {
+			return err
+		}
+		return placeCategory(tx, store.ID, &category, req.ParentID, req.Position)
+	})
+	if !categoryWriteOK(c, err, "Failed to create category") {
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+// UpdateCategory edits a category's details. Its place in the tree is
+// changed with MoveCategory.
+func (ctrl *CategoryController) UpdateCategory(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var req models.CategoryUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category, ok := ctrl.storeCategory(c, db, store.ID)
+	if !ok {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.Image != nil {
+		updates["image"] = *req.Image
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if req.Slug != nil {
+			slug, err := categorySlug(tx, store.ID, *req.Slug, category.Name, category.ID)
+			if err != nil {
+				return err
+			}
+			updates["slug"] = slug
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(category).Updates(updates).Error
+	})
+	if !categoryWriteOK(c, err, "Failed to update category") {
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// MoveCategory reparents a category and/or changes its position among its
+// siblings. Moves that would put a category inside its own subtree are
+// rejected.
+func (ctrl *CategoryController) MoveCategory(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var req models.CategoryMoveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category, ok := ctrl.storeCategory(c, db, store.ID)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if req.ParentID != nil {
+			if err := checkCategoryParent(tx, store.ID, *req.ParentID, category.ID); err != nil {
+				return err
+			}
+		}
+
+		oldParentID := category.ParentID
+		if err := placeCategory(tx, store.ID, category, req.ParentID, req.Position); err != nil {
+			return err
+		}
+		if !sameParent(oldParentID, req.ParentID) {
+			return placeCategory(tx, store.ID, nil, oldParentID, nil)
+		}
+		return nil
+	})
+	if !categoryWriteOK(c, err, "Failed to move category") {
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// DeleteCategory removes a category. Its children and products move up to
+// its parent, or to the top level and uncategorized when it had none.
+func (ctrl *CategoryController) DeleteCategory(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	category, ok := ctrl.storeCategory(c, db, store.ID)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var children []models.Category
+		if err := tx.Where("store_id = ? AND parent_id = ?", store.ID, category.ID).
+			Order("position, id").Find(&children).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Product{}).
+			Where("store_id = ? AND category_id = ?", store.ID, category.ID).
+			Update("category_id", category.ParentID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(category).Error; err != nil {
+			return err
+		}
+
+		// Children keep their order and go after the deleted category's
+		// remaining siblings
+		for i := range children {
+			children[i].Position = 1<<30 + i
+			if err := tx.Model(&children[i]).Updates(map[string]interface{}{
+				"parent_id": category.ParentID,
+				"position":  children[i].Position,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return placeCategory(tx, store.ID, nil, category.ParentID, nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+// GetStoreCategories returns a public store's category tree
+func (ctrl *CategoryController) GetStoreCategories(c *gin.Context) {
+	store, _, ok := findPublicStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	categories, err := catalog.StoreCategories(ctrl.db, store.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": categoryTree(categories)})
+}
+
+// GetStoreCategoryProducts lists a public store's products in a category.
+// With ?include_descendants=true products in its subcategories are included.
+func (ctrl *CategoryController) GetStoreCategoryProducts(c *gin.Context) {
+	store, preview, ok := findPublicStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	categories, err := catalog.StoreCategories(ctrl.db, store.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	var category *models.Category
+	for i := range categories {
+		if categories[i].Slug == c.Param("categorySlug") {
+			category = &categories[i]
+			break
+		}
+	}
+	if category == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	categoryIDs := []uint{category.ID}
+	if c.Query("include_descendants") == "true" {
+		categoryIDs = catalog.CategoryDescendants(categories, category.ID)
+	}
+
+	// Pagination
+	page := 1
+	limit := 20
+	if p, err := strconv.Atoi(c.DefaultQuery("page", "1")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(c.DefaultQuery("limit", "20")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+
+	query := ctrl.db.Model(&models.Product{}).
+		Where("store_id = ? AND status IN ? AND category_id IN ?", store.ID, publicProductStatuses(preview), categoryIDs).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		return
+	}
+
+	var products []models.Product
+	if err := query.Scopes(catalog.PreloadVariants).Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"category": category,
+		"data":     products,
+		"page":     page,
+		"limit":    limit,
+		"total":    total,
+	})
+}
+
+// storeCategory loads the :categoryId category of a store
+func (ctrl *CategoryController) storeCategory(c *gin.Context, db *gorm.DB, storeID uint) (*models.Category, bool) {
+	categoryID, err := strconv.ParseUint(c.Param("categoryId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return nil, false
+	}
+
+	var category models.Category
+	if err := db.Where("id = ? AND store_id = ?", categoryID, storeID).First(&category).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category"})
+		}
+		return nil, false
+	}
+	return &category, true
+}
+
+// categoryWriteOK maps category validation errors to responses and reports
+// whether the write succeeded
+func categoryWriteOK(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errCategoryParentNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parent category not found"})
+	case errors.Is(err, errCategoryCycle):
+		c.JSON(http.StatusConflict, gin.H{"error": "A category cannot be moved under itself or one of its descendants"})
+	case errors.Is(err, errCategorySlugTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Category slug is already in use in this store"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return false
+}
+
+// categoryTree nests categories under their parents. Categories whose parent
+// is missing are treated as top level.
+func categoryTree(categories []models.Category) []models.Category {
+	known := make(map[uint]bool, len(categories))
+	for _, category := range categories {
+		known[category.ID] = true
+	}
+
+	children := make(map[uint][]models.Category)
+	var roots []models.Category
+	for _, category := range categories {
+		if category.ParentID == nil || !known[*category.ParentID] || *category.ParentID == category.ID {
+			roots = append(roots, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	visited := make(map[uint]bool, len(categories))
+	var build func(nodes []models.Category) []models.Category
+	build = func(nodes []models.Category) []models.Category {
+		tree := make([]models.Category, 0, len(nodes))
+		for _, node := range nodes {
+			if visited[node.ID] {
+				continue
+			}
+			visited[node.ID] = true
+			node.Children = build(children[node.ID])
+			tree = append(tree, node)
+		}
+		return tree
+	}
+	return build(roots)
+}
+
+// checkCategoryParent checks parentID is a category of the store and, when
+// categoryID is set, that it is not categoryID or one of its descendants
+func checkCategoryParent(db *gorm.DB, storeID, parentID, categoryID uint) error {
+	var parents []models.Category
+	if err := db.Select("id", "parent_id").Where("store_id = ?", storeID).Find(&parents).Error; err != nil {
+		return err
+	}
+	parentOf := make(map[uint]*uint, len(parents))
+	for _, category := range parents {
+		parentOf[category.ID] = category.ParentID
+	}
+
+	if _, ok := parentOf[parentID]; !ok {
+		return errCategoryParentNotFound
+	}
+	if categoryID == 0 {
+		return nil
+	}
+
+	// Walk up from the new parent; reaching the category means a cycle
+	seen := make(map[uint]bool)
+	for id := &parentID; id != nil && !seen[*id]; id = parentOf[*id] {
+		if *id == categoryID {
+			return errCategoryCycle
+		}
+		seen[*id] = true
+	}
+	return nil
+}
+
+// categorySlug returns the slug for a category. A requested slug must be
+// unused in the store; otherwise one is generated from the name.
+func categorySlug(db *gorm.DB, storeID uint, requested, name string, categoryID uint) (string, error) {
+	exists := func(s string) bool {
+		var count int64
+		db.Model(&models.Category{}).Where("store_id = ? AND slug = ? AND id != ?", storeID, s, categoryID).Count(&count)
+		return count > 0
+	}
+
+	if requested != "" {
+		slug := utils.GenerateSlug(requested)
+		if slug == "" {
+			slug = utils.GenerateSlug(name)
+		}
+		if exists(slug) {
+			return "", errCategorySlugTaken
+		}
+		return slug, nil
+	}
+	return utils.GenerateUniqueSlug(utils.GenerateSlug(name), exists), nil
+}
+
+// placeCategory renumbers the store's children of parentID from zero,
+// inserting category at position (last when nil). With a nil category the
+// siblings are only compacted, closing any gaps.
+func placeCategory(db *gorm.DB, storeID uint, category *models.Category, parentID *uint, position *int) error {
+	query := db.Model(&models.Category{}).Where("store_id = ?", storeID)
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+	if category != nil {
+		query = query.Where("id != ?", category.ID)
+	}
+
+	var siblings []models.Category
+	if err := query.Order("position, id").Find(&siblings).Error; err != nil {
+		return err
+	}
+
+	if category != nil {
+		index := len(siblings)
+		if position != nil && *position < index {
+			index = *position
+		}
+		siblings = append(siblings, models.Category{})
+		copy(siblings[index+1:], siblings[index:])
+		siblings[index] = *category
+	}
+
+	for i := range siblings {
+		moving := category != nil && siblings[i].ID == category.ID
+		updates := map[string]interface{}{}
+		if siblings[i].Position != i {
+			updates["position"] = i
+		}
+		if moving && !sameParent(siblings[i].ParentID, parentID) {
+			updates["parent_id"] = parentID
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		if err := db.Model(&models.Category{}).Where("id = ?", siblings[i].ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if moving {
+			category.Position = i
+			category.ParentID = parentID
+		}
+	}
+	return nil
+}
+
+func sameParent(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
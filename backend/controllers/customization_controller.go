@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"storemaker-backend/media"
 	"storemaker-backend/models"
 	"storemaker-backend/utils"
 
@@ -55,45 +56,6 @@ func (ctrl *CustomizationController) GetStoreLayout(c *gin.Context) {
 		return
 	}
 
-<<<<<<< HEAD
-	// Get home page for this store
-	var homePage models.Page
-	if err := ctrl.db.Where("store_id = ? AND type = ?", storeID, models.PageTypeHome).
-		Preload("Sections.Components").First(&homePage).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			// Check if there are any pages for this store (might be from template)
-			var anyPage models.Page
-			if err := ctrl.db.Where("store_id = ?", storeID).
-				Preload("Sections.Components").First(&anyPage).Error; err != nil {
-				if err == gorm.ErrRecordNotFound {
-					// No pages exist, create default home page
-					homePage = models.Page{
-						Title:       "Home",
-						Slug:        "home",
-						Type:        models.PageTypeHome,
-						StoreID:     uint(storeID),
-						IsPublished: true,
-					}
-					if err := ctrl.db.Create(&homePage).Error; err != nil {
-						c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create home page"})
-						return
-					}
-				} else {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store layout"})
-					return
-				}
-			} else {
-				// Use the first page found (likely from template)
-				homePage = anyPage
-			}
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store layout"})
-			return
-		}
-	}
-
-=======
->>>>>>> url/main
 	// Get store theme
 	var theme models.StoreTheme
 	if err := ctrl.db.Where("store_id = ?", storeID).First(&theme).Error; err != nil && err != gorm.ErrRecordNotFound {
@@ -101,18 +63,6 @@ func (ctrl *CustomizationController) GetStoreLayout(c *gin.Context) {
 		return
 	}
 
-<<<<<<< HEAD
-	// Convert sections/components to frontend format
-	var components []ComponentData
-	for _, section := range homePage.Sections {
-		for _, component := range section.Components {
-			components = append(components, ComponentData{
-				ID:    component.Name, // Use name as ID for now
-				Type:  string(component.Type),
-				Props: component.Config,
-				Order: component.Order,
-			})
-=======
 	// Get store layout components
 	var storeLayout models.StoreLayout
 	var components []ComponentData
@@ -135,7 +85,6 @@ func (ctrl *CustomizationController) GetStoreLayout(c *gin.Context) {
 				Order: comp.Order,
 			}
 			components = append(components, component)
->>>>>>> url/main
 		}
 	}
 
@@ -147,115 +96,175 @@ func (ctrl *CustomizationController) GetStoreLayout(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// Public endpoint - Get store layout by slug (for public store access)
+// Public endpoint - Get store layout by slug (for public store access).
+// Visitors get the latest published revision, or an empty layout until the
+// first publish. With a preview token the working layout is served instead,
+// or an older revision via ?revision=.
 func (ctrl *CustomizationController) GetPublicStoreLayout(c *gin.Context) {
-	storeSlug := c.Param("slug")
+	store, preview, ok := findPublicStore(ctrl.db, c)
+	if !ok {
+		return
+	}
 
-<<<<<<< HEAD
-	// Get store by slug
-	var store models.Store
-	if err := ctrl.db.Where("slug = ? AND status = ?", storeSlug, models.StoreStatusActive).First(&store).Error; err != nil {
-=======
-	// Get store by slug (allow both active and draft for development)
-	var store models.Store
-	if err := ctrl.db.Where("slug = ? AND status IN (?, ?)", storeSlug, models.StoreStatusActive, models.StoreStatusDraft).First(&store).Error; err != nil {
->>>>>>> url/main
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store"})
-		}
+	// Get store theme
+	var theme models.StoreTheme
+	if err := ctrl.db.Where("store_id = ?", store.ID).First(&theme).Error; err != nil && err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store theme"})
 		return
 	}
 
-<<<<<<< HEAD
-	// Get home page for this store
-	var homePage models.Page
-	if err := ctrl.db.Where("store_id = ? AND type = ?", store.ID, models.PageTypeHome).
-		Preload("Sections.Components").First(&homePage).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			// Check if there are any pages for this store (might be from template)
-			var anyPage models.Page
-			if err := ctrl.db.Where("store_id = ?", store.ID).
-				Preload("Sections.Components").First(&anyPage).Error; err != nil {
-				if err == gorm.ErrRecordNotFound {
-					// No pages exist, return empty layout
-					response := StoreLayoutResponse{
-						Components: []ComponentData{},
-						Theme:      nil,
-					}
-					c.JSON(http.StatusOK, response)
-					return
-				} else {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store layout"})
-					return
-				}
+	if preview && c.Query("revision") != "" {
+		revisionID, err := strconv.ParseUint(c.Query("revision"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision ID"})
+			return
+		}
+
+		var revision models.StoreLayoutRevision
+		if err := ctrl.db.Where("id = ? AND store_id = ?", revisionID, store.ID).First(&revision).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Layout revision not found"})
 			} else {
-				// Use the first page found (likely from template)
-				homePage = anyPage
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch layout revision"})
 			}
-		} else {
+			return
+		}
+
+		ctrl.publicLayout(c, store.ID, revisionComponents(&revision), &theme)
+		return
+	}
+
+	if !preview {
+		var revision models.StoreLayoutRevision
+		err := ctrl.db.Where("store_id = ?", store.ID).Order("id DESC").First(&revision).Error
+		if err == gorm.ErrRecordNotFound {
+			// Nothing is published yet; the saved layout needs a preview token
+			c.JSON(http.StatusOK, StoreLayoutResponse{Components: []ComponentData{}, Theme: &theme})
+			return
+		}
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store layout"})
 			return
 		}
+		ctrl.publicLayout(c, store.ID, revisionComponents(&revision), &theme)
+		return
 	}
 
-=======
->>>>>>> url/main
-	// Get store theme
-	var theme models.StoreTheme
-	if err := ctrl.db.Where("store_id = ?", store.ID).First(&theme).Error; err != nil && err != gorm.ErrRecordNotFound {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store theme"})
+	components, err := ctrl.workingLayoutComponents(store.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store layout"})
 		return
 	}
 
-<<<<<<< HEAD
-	// Convert sections/components to frontend format
-	var components []ComponentData
-	for _, section := range homePage.Sections {
-		for _, component := range section.Components {
-			components = append(components, ComponentData{
-				ID:    component.Name, // Use name as ID for now
-				Type:  string(component.Type),
-				Props: component.Config,
-				Order: component.Order,
-			})
-=======
-	// Get store layout components
-	var storeLayout models.StoreLayout
-	var components []ComponentData
+	ctrl.publicLayout(c, store.ID, components, &theme)
+}
 
-	if err := ctrl.db.Preload("Components").Where("store_id = ?", store.ID).First(&storeLayout).Error; err != nil {
+// publicLayout answers with a layout whose component props have their
+// media references resolved
+func (ctrl *CustomizationController) publicLayout(c *gin.Context, storeID uint, components []ComponentData, theme *models.StoreTheme) {
+	if !resolveComponentMedia(ctrl.db, c, storeID, components) {
+		return
+	}
+
+	c.JSON(http.StatusOK, StoreLayoutResponse{Components: components, Theme: theme})
+}
+
+// resolveComponentMedia adds the media library images component props
+// refer to, as described in media.ResolveProps
+func resolveComponentMedia(db *gorm.DB, c *gin.Context, storeID uint, components []ComponentData) bool {
+	props := make([]map[string]interface{}, 0, len(components))
+	for _, comp := range components {
+		props = append(props, comp.Props)
+	}
+	if err := media.ResolveProps(db, storeID, props...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch layout media"})
+		return false
+	}
+	return true
+}
+
+// PublishStoreLayout snapshots the saved layout as the published revision
+func (ctrl *CustomizationController) PublishStoreLayout(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	components, err := ctrl.workingLayoutComponents(store.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store layout"})
+		return
+	}
+
+	snapshot := make(models.LayoutComponents, 0, len(components))
+	for _, comp := range components {
+		snapshot = append(snapshot, models.LayoutComponent(comp))
+	}
+
+	revision := models.StoreLayoutRevision{
+		StoreID:       store.ID,
+		Components:    snapshot,
+		PublishedByID: c.GetUint("user_id"),
+	}
+	if err := ctrl.db.WithContext(c.Request.Context()).Create(&revision).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish layout"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, revision)
+}
+
+// GetLayoutRevisions lists a store's published layout revisions, newest first
+func (ctrl *CustomizationController) GetLayoutRevisions(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var revisions []models.StoreLayoutRevision
+	if err := ctrl.db.Where("store_id = ?", store.ID).Order("id DESC").Limit(50).Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch layout revisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": revisions})
+}
+
+// workingLayoutComponents loads the saved, possibly unpublished, layout
+func (ctrl *CustomizationController) workingLayoutComponents(storeID uint) ([]ComponentData, error) {
+	var storeLayout models.StoreLayout
+	if err := ctrl.db.Preload("Components").Where("store_id = ?", storeID).First(&storeLayout).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			// No layout saved yet, return empty components
-			components = []ComponentData{}
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store layout"})
-			return
-		}
-	} else {
-		// Convert stored components to ComponentData format
-		for _, comp := range storeLayout.Components {
-			component := ComponentData{
-				ID:    strconv.FormatUint(uint64(comp.ID), 10),
-				Type:  comp.Type,
-				Props: comp.Props,
-				Order: comp.Order,
-			}
-			components = append(components, component)
->>>>>>> url/main
+			return []ComponentData{}, nil
 		}
+		return nil, err
 	}
 
-	response := StoreLayoutResponse{
-		Components: components,
-		Theme:      &theme,
+	components := make([]ComponentData, 0, len(storeLayout.Components))
+	for _, comp := range storeLayout.Components {
+		components = append(components, ComponentData{
+			ID:    strconv.FormatUint(uint64(comp.ID), 10),
+			Type:  comp.Type,
+			Props: comp.Props,
+			Order: comp.Order,
+		})
 	}
+	return components, nil
+}
 
-	c.JSON(http.StatusOK, response)
+// revisionComponents converts a revision snapshot to the frontend format
+func revisionComponents(revision *models.StoreLayoutRevision) []ComponentData {
+	components := make([]ComponentData, 0, len(revision.Components))
+	for _, comp := range revision.Components {
+		components = append(components, ComponentData(comp))
+	}
+	return components
 }
 
 func (ctrl *CustomizationController) SaveStoreLayout(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
 	storeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
@@ -269,34 +278,13 @@ func (ctrl *CustomizationController) SaveStoreLayout(c *gin.Context) {
 	}
 
 	// Start transaction
-	tx := ctrl.db.Begin()
+	tx := db.Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
 		}
 	}()
 
-<<<<<<< HEAD
-	// Get or create home page
-	var homePage models.Page
-	if err := tx.Where("store_id = ? AND type = ?", storeID, models.PageTypeHome).First(&homePage).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			homePage = models.Page{
-				Title:       "Home",
-				Slug:        "home",
-				Type:        models.PageTypeHome,
-				StoreID:     uint(storeID),
-				IsPublished: true,
-			}
-			if err := tx.Create(&homePage).Error; err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create home page"})
-				return
-			}
-		} else {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch home page"})
-=======
 	// Save or update store layout
 	var existingLayout models.StoreLayout
 	if err := tx.Where("store_id = ?", storeID).First(&existingLayout).Error; err != nil {
@@ -314,48 +302,10 @@ func (ctrl *CustomizationController) SaveStoreLayout(c *gin.Context) {
 		} else {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch existing layout"})
->>>>>>> url/main
 			return
 		}
 	}
 
-<<<<<<< HEAD
-	// Clear existing sections and components
-	if err := tx.Where("page_id = ?", homePage.ID).Delete(&models.Section{}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear existing layout"})
-		return
-	}
-
-	// Create new section for components
-	section := models.Section{
-		Name:      "Main Content",
-		Type:      models.SectionTypeText, // Generic type
-		PageID:    homePage.ID,
-		Order:     0,
-		IsVisible: true,
-	}
-	if err := tx.Create(&section).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create section"})
-		return
-	}
-
-	// Create components
-	for _, comp := range req.Components {
-		component := models.Component{
-			Name:      comp.ID,
-			Type:      models.ComponentType(comp.Type),
-			Config:    models.ComponentConfig(comp.Props),
-			Order:     comp.Order,
-			SectionID: section.ID,
-			IsVisible: true,
-		}
-		if err := tx.Create(&component).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create component"})
-			return
-=======
 	// Delete existing components
 	if err := tx.Where("store_layout_id = ?", existingLayout.ID).Delete(&models.StoreLayoutComponent{}).Error; err != nil {
 		tx.Rollback()
@@ -377,7 +327,6 @@ func (ctrl *CustomizationController) SaveStoreLayout(c *gin.Context) {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create component"})
 				return
 			}
->>>>>>> url/main
 		}
 	}
 
@@ -464,7 +413,7 @@ func (ctrl *CustomizationController) GetPages(c *gin.Context) {
 		}
 	}
 
-	if err := query.Order("created_at DESC").Find(&pages).Error; err != nil {
+	if err := query.Preload("Media").Order("created_at DESC").Find(&pages).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pages"})
 		return
 	}
@@ -484,7 +433,7 @@ func (ctrl *CustomizationController) GetStorePage(c *gin.Context) {
 
 	var page models.Page
 	if err := ctrl.db.Where("store_id = ? AND slug = ? AND is_published = ?", store.ID, pageSlug, true).
-		Preload("Sections.Components").First(&page).Error; err != nil {
+		Preload("Media").Preload("Sections.Components").First(&page).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
 		return
 	}
@@ -492,17 +441,15 @@ func (ctrl *CustomizationController) GetStorePage(c *gin.Context) {
 	c.JSON(http.StatusOK, page)
 }
 
+// GetPublicStorePages lists published pages, or all pages with a preview token
 func (ctrl *CustomizationController) GetPublicStorePages(c *gin.Context) {
-	storeSlug := c.Param("slug")
-
-	var store models.Store
-	if err := ctrl.db.Where("slug = ?", storeSlug).First(&store).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+	store, preview, ok := findPublicStore(ctrl.db, c)
+	if !ok {
 		return
 	}
 
 	var pages []models.Page
-	if err := ctrl.db.Where("store_id = ? AND is_published = ?", store.ID, true).
+	if err := publicPages(ctrl.db, store.ID, preview).
 		Preload("Sections.Components").
 		Find(&pages).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pages"})
@@ -513,17 +460,15 @@ func (ctrl *CustomizationController) GetPublicStorePages(c *gin.Context) {
 }
 
 func (ctrl *CustomizationController) GetPublicStorePage(c *gin.Context) {
-	storeSlug := c.Param("slug")
 	pageSlug := c.Param("pageSlug")
 
-	var store models.Store
-	if err := ctrl.db.Where("slug = ?", storeSlug).First(&store).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+	store, preview, ok := findPublicStore(ctrl.db, c)
+	if !ok {
 		return
 	}
 
 	var page models.Page
-	if err := ctrl.db.Where("store_id = ? AND slug = ? AND is_published = ?", store.ID, pageSlug, true).
+	if err := publicPages(ctrl.db, store.ID, preview).Where("slug = ?", pageSlug).
 		Preload("Sections.Components").
 		First(&page).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
@@ -533,7 +478,18 @@ func (ctrl *CustomizationController) GetPublicStorePage(c *gin.Context) {
 	c.JSON(http.StatusOK, page)
 }
 
+// publicPages scopes a page query to what visitors may see
+func publicPages(db *gorm.DB, storeID uint, preview bool) *gorm.DB {
+	query := db.Preload("Media").Where("store_id = ?", storeID)
+	if !preview {
+		query = query.Where("is_published = ?", true)
+	}
+	return query
+}
+
 func (ctrl *CustomizationController) CreatePage(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
 	storeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
@@ -545,19 +501,22 @@ func (ctrl *CustomizationController) CreatePage(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !storeMediaExists(db, c, uint(storeID), req.MediaID) {
+		return
+	}
 
 	// Generate slug from title if not provided
 	if req.Slug == "" && req.Title != "" {
 		baseSlug := utils.GenerateSlug(req.Title)
 		req.Slug = utils.GenerateUniqueSlug(baseSlug, func(s string) bool {
 			var count int64
-			ctrl.db.Model(&models.Page{}).Where("store_id = ? AND slug = ?", storeID, s).Count(&count)
+			db.Model(&models.Page{}).Where("store_id = ? AND slug = ?", storeID, s).Count(&count)
 			return count > 0
 		})
 	}
 
 	req.StoreID = uint(storeID)
-	if err := ctrl.db.Create(&req).Error; err != nil {
+	if err := db.Create(&req).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create page"})
 		return
 	}
@@ -566,6 +525,8 @@ func (ctrl *CustomizationController) CreatePage(c *gin.Context) {
 }
 
 func (ctrl *CustomizationController) UpdatePage(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
 	pageID, err := strconv.ParseUint(c.Param("pageId"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page ID"})
@@ -577,8 +538,16 @@ func (ctrl *CustomizationController) UpdatePage(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	storeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		return
+	}
+	if !storeMediaExists(db, c, uint(storeID), req.MediaID) {
+		return
+	}
 
-	if err := ctrl.db.Model(&models.Page{}).Where("id = ?", pageID).Updates(&req).Error; err != nil {
+	if err := db.Model(&models.Page{}).Where("id = ?", pageID).Updates(&req).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update page"})
 		return
 	}
@@ -587,13 +556,15 @@ func (ctrl *CustomizationController) UpdatePage(c *gin.Context) {
 }
 
 func (ctrl *CustomizationController) DeletePage(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
 	pageID, err := strconv.ParseUint(c.Param("pageId"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page ID"})
 		return
 	}
 
-	if err := ctrl.db.Delete(&models.Page{}, pageID).Error; err != nil {
+	if err := db.Delete(&models.Page{}, pageID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete page"})
 		return
 	}
@@ -634,6 +605,8 @@ func (ctrl *CustomizationController) GetStoreSettings(c *gin.Context) {
 }
 
 func (ctrl *CustomizationController) UpdateStoreSettings(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
 	storeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
@@ -646,7 +619,7 @@ func (ctrl *CustomizationController) UpdateStoreSettings(c *gin.Context) {
 		return
 	}
 
-	if err := ctrl.db.Model(&models.StoreSettings{}).Where("store_id = ?", storeID).Updates(&req).Error; err != nil {
+	if err := db.Model(&models.StoreSettings{}).Where("store_id = ?", storeID).Updates(&req).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
 		return
 	}
@@ -684,6 +657,8 @@ func (ctrl *CustomizationController) GetStoreTheme(c *gin.Context) {
 }
 
 func (ctrl *CustomizationController) UpdateStoreTheme(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
 	storeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
@@ -696,15 +671,13 @@ func (ctrl *CustomizationController) UpdateStoreTheme(c *gin.Context) {
 		return
 	}
 
-	if err := ctrl.db.Model(&models.StoreTheme{}).Where("store_id = ?", storeID).Updates(&req).Error; err != nil {
+	if err := db.Model(&models.StoreTheme{}).Where("store_id = ?", storeID).Updates(&req).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update theme"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Theme updated successfully"})
 }
-<<<<<<< HEAD
-=======
 
 // Page Layout Management
 type PageLayoutResponse struct {
@@ -766,6 +739,8 @@ func (ctrl *CustomizationController) GetPageLayout(c *gin.Context) {
 
 // Save page layout by page ID
 func (ctrl *CustomizationController) SavePageLayout(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
 	pageID, err := strconv.ParseUint(c.Param("pageId"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page ID"})
@@ -780,7 +755,7 @@ func (ctrl *CustomizationController) SavePageLayout(c *gin.Context) {
 
 	// Get page to verify it exists and get store ID
 	var page models.Page
-	if err := ctrl.db.First(&page, pageID).Error; err != nil {
+	if err := db.First(&page, pageID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
 		} else {
@@ -790,7 +765,7 @@ func (ctrl *CustomizationController) SavePageLayout(c *gin.Context) {
 	}
 
 	// Start transaction
-	tx := ctrl.db.Begin()
+	tx := db.Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -875,23 +850,16 @@ func (ctrl *CustomizationController) SavePageLayout(c *gin.Context) {
 
 // Get public page layout by store slug and page slug
 func (ctrl *CustomizationController) GetPublicPageLayout(c *gin.Context) {
-	storeSlug := c.Param("slug")
 	pageSlug := c.Param("pageSlug")
 
-	// Get store by slug (allow both active and draft for development)
-	var store models.Store
-	if err := ctrl.db.Where("slug = ? AND status IN (?, ?)", storeSlug, models.StoreStatusActive, models.StoreStatusDraft).First(&store).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store"})
-		}
+	store, preview, ok := findPublicStore(ctrl.db, c)
+	if !ok {
 		return
 	}
 
 	// Get page by slug
 	var page models.Page
-	if err := ctrl.db.Where("store_id = ? AND slug = ? AND is_published = ?", store.ID, pageSlug, true).
+	if err := publicPages(ctrl.db, store.ID, preview).Where("slug = ?", pageSlug).
 		Preload("Sections.Components").First(&page).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
@@ -921,6 +889,10 @@ func (ctrl *CustomizationController) GetPublicPageLayout(c *gin.Context) {
 		}
 	}
 
+	if !resolveComponentMedia(ctrl.db, c, store.ID, components) {
+		return
+	}
+
 	response := PageLayoutResponse{
 		Components: components,
 		Theme:      &theme,
@@ -928,4 +900,3 @@ func (ctrl *CustomizationController) GetPublicPageLayout(c *gin.Context) {
 
 	c.JSON(http.StatusOK, response)
 }
->>>>>>> url/main
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"storemaker-backend/domains"
+	"storemaker-backend/models"
+	"storemaker-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type DomainController struct {
+	db       *gorm.DB
+	verifier *domains.Verifier
+}
+
+func NewDomainController(db *gorm.DB, verifier *domains.Verifier) *DomainController {
+	return &DomainController{db: db, verifier: verifier}
+}
+
+// GetDomains lists a store's domain claims
+func (ctrl *DomainController) GetDomains(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var claims []models.StoreDomain
+	if err := ctrl.db.Where("store_id = ?", store.ID).Order("created_at DESC").Find(&claims).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch domains"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(claims))
+	for i := range claims {
+		response = append(response, domainClaimResponse(&claims[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+// ClaimDomain starts a claim and returns the TXT record the merchant must publish
+func (ctrl *DomainController) ClaimDomain(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var req models.DomainClaimRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	domain, err := domains.NormalizeDomain(req.Domain)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain name"})
+		return
+	}
+	if ctrl.verifier.IsPlatformDomain(domain) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Platform domains cannot be claimed"})
+		return
+	}
+
+	var count int64
+	db.Model(&models.StoreDomain{}).Where("store_id = ? AND domain = ?", store.ID, domain).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This store has already claimed the domain"})
+		return
+	}
+	db.Model(&models.StoreDomain{}).Where("domain = ? AND status = ?", domain, models.DomainStatusVerified).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Domain is already in use by another store"})
+		return
+	}
+
+	token, err := utils.GenerateRandomString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate verification token"})
+		return
+	}
+
+	nextCheck := time.Now()
+	claim := models.StoreDomain{
+		StoreID:     store.ID,
+		Domain:      domain,
+		Token:       token,
+		Status:      models.DomainStatusPending,
+		NextCheckAt: &nextCheck,
+	}
+	if err := db.Create(&claim).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim domain"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, domainClaimResponse(&claim))
+}
+
+// VerifyDomain checks the TXT record right away instead of waiting for the
+// next periodic recheck. Failed claims can be retried this way.
+func (ctrl *DomainController) VerifyDomain(c *gin.Context) {
+	claim, ok := ctrl.ownedClaim(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.verifier.Check(c.Request.Context(), claim); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify domain"})
+		return
+	}
+
+	if err := ctrl.db.First(claim, claim.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch domain"})
+		return
+	}
+
+	c.JSON(http.StatusOK, domainClaimResponse(claim))
+}
+
+// DeleteDomain drops a claim. A routed domain stops serving the store, which
+// falls back to its platform subdomain.
+func (ctrl *DomainController) DeleteDomain(c *gin.Context) {
+	claim, ok := ctrl.ownedClaim(c)
+	if !ok {
+		return
+	}
+
+	err := ctrl.db.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if claim.Status == models.DomainStatusVerified {
+			if err := ctrl.verifier.Release(tx, claim); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(claim).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete domain"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Domain removed successfully"})
+}
+
+// ownedClaim loads the :domainId claim of the :id store
+func (ctrl *DomainController) ownedClaim(c *gin.Context) (*models.StoreDomain, bool) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return nil, false
+	}
+
+	domainID, err := strconv.ParseUint(c.Param("domainId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+		return nil, false
+	}
+
+	var claim models.StoreDomain
+	if err := ctrl.db.Where("id = ? AND store_id = ?", domainID, store.ID).First(&claim).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch domain"})
+		}
+		return nil, false
+	}
+
+	return &claim, true
+}
+
+// domainClaimResponse adds the DNS record to publish to a claim
+func domainClaimResponse(claim *models.StoreDomain) gin.H {
+	return gin.H{
+		"domain": claim,
+		"dns_record": gin.H{
+			"type":  "TXT",
+			"name":  domains.ChallengeRecordName(claim.Domain),
+			"value": domains.ChallengeRecordValue(claim.Token),
+		},
+	}
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"storemaker-backend/mail"
+	"storemaker-backend/middleware"
+	"storemaker-backend/models"
+	"storemaker-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type EmailVerificationController struct {
+	db     *gorm.DB
+	mailer mail.Sender
+}
+
+func NewEmailVerificationController(db *gorm.DB, mailer mail.Sender) *EmailVerificationController {
+	return &EmailVerificationController{db: db, mailer: mailer}
+}
+
+// SendVerification emails the current user a link to verify their address
+func (ctrl *EmailVerificationController) SendVerification(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	var user models.User
+	if err := ctrl.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Email is already verified"})
+		return
+	}
+
+	token, err := middleware.GenerateEmailVerificationToken(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate verification token"})
+		return
+	}
+
+	link := strings.TrimRight(utils.GetEnv("FRONTEND_URL", "http://localhost:3000"), "/") + "/verify-email?token=" + url.QueryEscape(token)
+	err = ctrl.mailer.Send(c.Request.Context(), mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    "Hi " + user.FirstName + ",\n\nConfirm your email address by opening this link within 24 hours:\n\n" + link + "\n",
+	})
+	if err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// VerifyEmail marks the address in a verification token as verified. The
+// token only counts while the account still uses that address.
+func (ctrl *EmailVerificationController) VerifyEmail(c *gin.Context) {
+	var req models.EmailVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := middleware.ParseEmailVerificationToken(req.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+
+	var user models.User
+	if err := ctrl.db.First(&user, claims.UserID).Error; err != nil || !strings.EqualFold(user.Email, claims.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		if err := ctrl.db.Model(&user).Update("email_verified_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+			return
+		}
+		user.EmailVerifiedAt = &now
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email verified successfully",
+		"user":    toUserResponse(&user),
+	})
+}
@@ -44,6 +44,9 @@ func (ctrl *ExportController) DownloadStoreSource(c *gin.Context) {
 		Preload("Theme").
 		Preload("Pages").
 		Preload("Products").
+		Preload("Products.Variants", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position, id")
+		}).
 		First(&store).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found or you don't have permission"})
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"storemaker-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ownedStore loads the :id store and checks it belongs to the current user
+func ownedStore(db *gorm.DB, c *gin.Context) (*models.Store, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return nil, false
+	}
+
+	storeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		return nil, false
+	}
+
+	var store models.Store
+	if err := db.Where("id = ? AND owner_id = ?", storeID, userID).First(&store).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store"})
+		}
+		return nil, false
+	}
+
+	return &store, true
+}
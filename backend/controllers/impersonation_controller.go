@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"storemaker-backend/middleware"
+	"storemaker-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// defaultImpersonationDuration applies when the admin does not ask for one
+const defaultImpersonationDuration = 30 * time.Minute
+
+type ImpersonationController struct {
+	db *gorm.DB
+}
+
+func NewImpersonationController(db *gorm.DB) *ImpersonationController {
+	return &ImpersonationController{db: db}
+}
+
+// Impersonate starts a session acting as the :id user and returns a
+// short-lived token. Sessions are read-only unless allow_writes is set.
+func (ctrl *ImpersonationController) Impersonate(c *gin.Context) {
+	adminID := c.GetUint("user_id")
+
+	targetID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.ImpersonationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var admin models.User
+	if err := ctrl.db.First(&admin, adminID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	var target models.User
+	if err := ctrl.db.First(&target, targetID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		}
+		return
+	}
+
+	if target.ID == admin.ID || target.Role == models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin accounts cannot be impersonated"})
+		return
+	}
+	if !target.IsActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot impersonate a disabled account"})
+		return
+	}
+
+	duration := defaultImpersonationDuration
+	if req.DurationMinutes > 0 {
+		duration = time.Duration(req.DurationMinutes) * time.Minute
+	}
+
+	session := models.ImpersonationSession{
+		AdminID:      admin.ID,
+		TargetUserID: target.ID,
+		Reason:       req.Reason,
+		AllowWrites:  req.AllowWrites,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		ExpiresAt:    time.Now().Add(duration),
+	}
+	if err := ctrl.db.Create(&session).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		return
+	}
+
+	token, err := middleware.GenerateImpersonationToken(&admin, &target, &session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	middleware.RecordAudit(ctrl.db, c, models.AuditLog{
+		Action: models.AuditActionImpersonationStart,
+		Metadata: models.AuditMetadata{
+			"session_id":     session.ID,
+			"target_user_id": target.ID,
+			"target_email":   target.Email,
+			"reason":         req.Reason,
+			"allow_writes":   req.AllowWrites,
+			"expires_at":     session.ExpiresAt,
+		},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"access_token": token,
+		"session":      session,
+		"user":         toUserResponse(&target),
+	})
+}
+
+// GetImpersonationSessions lists recent sessions, optionally filtered by admin_id or user_id
+func (ctrl *ImpersonationController) GetImpersonationSessions(c *gin.Context) {
+	query := ctrl.db.Model(&models.ImpersonationSession{}).Preload("Admin").Preload("TargetUser")
+	if adminID := c.Query("admin_id"); adminID != "" {
+		query = query.Where("admin_id = ?", adminID)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("target_user_id = ?", userID)
+	}
+
+	var sessions []models.ImpersonationSession
+	if err := query.Order("created_at DESC").Limit(200).Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch impersonation sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": sessions})
+}
+
+// EndImpersonation closes a session; its token is rejected from then on
+func (ctrl *ImpersonationController) EndImpersonation(c *gin.Context) {
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	var session models.ImpersonationSession
+	if err := ctrl.db.First(&session, sessionID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Impersonation session not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch impersonation session"})
+		}
+		return
+	}
+
+	if session.EndedAt == nil {
+		now := time.Now()
+		if err := ctrl.db.Model(&session).Update("ended_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end impersonation session"})
+			return
+		}
+
+		middleware.RecordAudit(ctrl.db, c, models.AuditLog{
+			Action: models.AuditActionImpersonationEnd,
+			Metadata: models.AuditMetadata{
+				"session_id":     session.ID,
+				"target_user_id": session.TargetUserID,
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation session ended"})
+}
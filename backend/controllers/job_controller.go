@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"storemaker-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type JobController struct {
+	db *gorm.DB
+}
+
+func NewJobController(db *gorm.DB) *JobController {
+	return &JobController{db: db}
+}
+
+// GetStoreJobs lists the store's background jobs, newest first
+func (ctrl *JobController) GetStoreJobs(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	query := ctrl.db.Where("store_id = ?", store.ID)
+	if jobType := c.Query("type"); jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+
+	var jobs []models.Job
+	if err := query.Order("created_at DESC").Limit(50).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch jobs"})
+		return
+	}
+
+	data := make([]gin.H, 0, len(jobs))
+	for i := range jobs {
+		data = append(data, jobResponse(&jobs[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// GetStoreJob returns a job with its progress, for polling
+func (ctrl *JobController) GetStoreJob(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	jobID, err := strconv.ParseUint(c.Param("jobId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	var job models.Job
+	if err := ctrl.db.Where("id = ? AND store_id = ?", jobID, store.ID).First(&job).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch job"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, jobResponse(&job))
+}
+
+func jobResponse(job *models.Job) gin.H {
+	return gin.H{
+		"job":      job,
+		"progress": job.Percent(),
+	}
+}
+
+// jobStatusPath is where a store's job can be polled
+func jobStatusPath(storeID, jobID uint) string {
+	return "/api/v1/manage/stores/" + strconv.FormatUint(uint64(storeID), 10) + "/jobs/" + strconv.FormatUint(uint64(jobID), 10)
+}
@@ -0,0 +1,431 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"storemaker-backend/media"
+	"storemaker-backend/models"
+	"storemaker-backend/plans"
+	"storemaker-backend/storage"
+	"storemaker-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type MediaController struct {
+	db    *gorm.DB
+	files storage.Storage
+}
+
+func NewMediaController(db *gorm.DB, files storage.Storage) *MediaController {
+	return &MediaController{db: db, files: files}
+}
+
+// presignedUploadExpiry is how long a presigned upload URL stays valid
+const presignedUploadExpiry = 15 * time.Minute
+
+// GET /manage/stores/:id/media?page=&limit=
+func (ctrl *MediaController) GetMedia(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	page := 1
+	limit := 50
+	if p, err := strconv.Atoi(c.DefaultQuery("page", "1")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(c.DefaultQuery("limit", "50")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+
+	query := ctrl.db.Model(&models.Media{}).Where("store_id = ? AND pending = ?", store.ID, false)
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch media"})
+		return
+	}
+	var items []models.Media
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch media"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": items, "page": page, "limit": limit, "total": total})
+}
+
+// POST /manage/stores/:id/media multipart/form-data: file, alt
+// Uploading an image already in the library returns it with 200 instead of
+// storing it again.
+func (ctrl *MediaController) UploadMedia(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saved, created, ok := saveMedia(c, db, ctrl.files, store, header, false)
+	if !ok {
+		return
+	}
+	ctrl.mediaSaved(c, saved, created, c.PostForm("alt"))
+}
+
+// POST /manage/stores/:id/media/uploads
+// Returns a presigned URL the client uploads the image to, then passes the
+// key to CompleteMediaUpload. Uploads that are never completed stay under
+// media.IncomingPrefix; a bucket lifecycle rule can expire them.
+func (ctrl *MediaController) CreateMediaUpload(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var req models.MediaUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Size > media.MaxUploadBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": media.ErrTooLarge.Error()})
+		return
+	}
+	ext, ok := media.Extension(req.ContentType)
+	if !ok {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": media.ErrUnsupportedType.Error()})
+		return
+	}
+
+	plan, ok := userPlan(db, c, store.OwnerID)
+	if !ok {
+		return
+	}
+	if !planAllows(c, plans.CheckStorage(db, plan, store.OwnerID, req.Size)) {
+		return
+	}
+
+	token, err := utils.GenerateRandomString(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+		return
+	}
+	key := fmt.Sprintf("%s%d/%s%s", media.IncomingPrefix, store.ID, token, ext)
+	upload, err := ctrl.files.PresignUpload(c.Request.Context(), key, req.ContentType, req.Size, presignedUploadExpiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, upload)
+}
+
+// POST /manage/stores/:id/media/uploads/complete
+// Processes an image uploaded to a presigned URL as UploadMedia would.
+func (ctrl *MediaController) CompleteMediaUpload(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var req models.MediaUploadCompleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !strings.HasPrefix(req.Key, fmt.Sprintf("%s%d/", media.IncomingPrefix, store.ID)) || !storage.ValidKey(req.Key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload key"})
+		return
+	}
+
+	file, err := ctrl.files.Open(c.Request.Context(), req.Key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read upload"})
+		}
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxUploadBytes+1))
+	file.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read upload"})
+		return
+	}
+
+	name := req.Filename
+	if name == "" {
+		name = path.Base(req.Key)
+	}
+	saved, created, ok := saveMediaData(c, db, ctrl.files, store, filepath.Base(name), data, false)
+	if !ok {
+		return
+	}
+	if err := ctrl.files.Delete(c.Request.Context(), req.Key); err != nil {
+		log.Printf("Failed to remove completed upload %s: %v", req.Key, err)
+	}
+	ctrl.mediaSaved(c, saved, created, req.Alt)
+}
+
+// mediaSaved sets the alt text of newly saved media, or media without any,
+// and answers with it
+func (ctrl *MediaController) mediaSaved(c *gin.Context, saved *models.Media, created bool, alt string) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	if alt != "" && saved.Alt == "" {
+		if err := db.Model(saved).Update("alt", alt).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save alt text"})
+			return
+		}
+		saved.Alt = alt
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, saved)
+}
+
+// GET /manage/stores/:id/media/:mediaId
+func (ctrl *MediaController) GetMediaItem(c *gin.Context) {
+	item, ok := ctrl.ownedMedia(c)
+	if !ok {
+		return
+	}
+
+	usage, err := media.Usage(ctrl.db, item)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch media usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"media": item, "usage": usage})
+}
+
+// PUT /manage/stores/:id/media/:mediaId
+func (ctrl *MediaController) UpdateMedia(c *gin.Context) {
+	item, ok := ctrl.ownedMedia(c)
+	if !ok {
+		return
+	}
+
+	var req models.MediaUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Alt != nil {
+		if err := ctrl.db.WithContext(c.Request.Context()).Model(item).Update("alt", *req.Alt).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update media"})
+			return
+		}
+		item.Alt = *req.Alt
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// DELETE /manage/stores/:id/media/:mediaId
+// Media shown on products, pages, reviews or components is not deleted.
+func (ctrl *MediaController) DeleteMedia(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	item, ok := ctrl.ownedMedia(c)
+	if !ok {
+		return
+	}
+
+	usage, err := media.Usage(db, item)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch media usage"})
+		return
+	}
+	if usage.InUse() {
+		c.JSON(http.StatusConflict, gin.H{"error": "The image is still in use", "usage": usage})
+		return
+	}
+
+	if err := media.Remove(db, ctrl.files, item); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete media"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Media deleted successfully"})
+}
+
+// saveMedia adds an uploaded image to the store's media library, as
+// saveMediaData does
+func saveMedia(c *gin.Context, db *gorm.DB, files storage.Storage, store *models.Store, header *multipart.FileHeader, pending bool) (*models.Media, bool, bool) {
+	if header.Size > media.MaxUploadBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": media.ErrTooLarge.Error()})
+		return nil, false, false
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false, false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxUploadBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false, false
+	}
+	return saveMediaData(c, db, files, store, filepath.Base(header.Filename), data, pending)
+}
+
+// saveMediaData adds an image to the store's media library and counts its
+// files against the owner's storage. Pending images, such as review photos,
+// are kept out of both until media.Publish. An identical image already
+// saved is returned instead, with created false.
+func saveMediaData(c *gin.Context, db *gorm.DB, files storage.Storage, store *models.Store, name string, data []byte, pending bool) (*models.Media, bool, bool) {
+	if len(data) > media.MaxUploadBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": media.ErrTooLarge.Error()})
+		return nil, false, false
+	}
+
+	hash := media.Hash(data)
+	existing, err := media.Find(db, store.ID, hash)
+	if err == nil {
+		// The merchant uploading a pending review photo adds it to the library
+		if existing.Pending && !pending {
+			if !publishMedia(c, db, store, []models.Media{*existing}) {
+				return nil, false, false
+			}
+			existing.Pending = false
+		}
+		return existing, false, true
+	}
+	if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch media"})
+		return nil, false, false
+	}
+
+	img, err := media.Process(data)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrTooLarge), errors.Is(err, media.ErrTooManyPixels):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case errors.Is(err, media.ErrUnsupportedType):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		case errors.Is(err, media.ErrInvalidImage):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process image"})
+		}
+		return nil, false, false
+	}
+
+	if !pending {
+		plan, ok := userPlan(db, c, store.OwnerID)
+		if !ok {
+			return nil, false, false
+		}
+		if !planAllows(c, plans.CheckStorage(db, plan, store.OwnerID, img.Size())) {
+			return nil, false, false
+		}
+	}
+
+	saved, created, err := media.Save(db, files, store.ID, hash, name, img, pending)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save upload"})
+		return nil, false, false
+	}
+	return saved, created, true
+}
+
+// publishMedia adds pending media to the library if the owner's plan has
+// room for its files
+func publishMedia(c *gin.Context, db *gorm.DB, store *models.Store, items []models.Media) bool {
+	size, err := media.PendingBytes(db, store.ID, items)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check plan limits"})
+		return false
+	}
+	if size > 0 {
+		plan, ok := userPlan(db, c, store.OwnerID)
+		if !ok {
+			return false
+		}
+		if !planAllows(c, plans.CheckStorage(db, plan, store.OwnerID, size)) {
+			return false
+		}
+	}
+
+	if err := media.Publish(db, store.ID, items); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish media"})
+		return false
+	}
+	return true
+}
+
+// storeMediaExists checks an optional media ID is in the store's library
+func storeMediaExists(db *gorm.DB, c *gin.Context, storeID uint, mediaID *uint) bool {
+	if mediaID == nil {
+		return true
+	}
+
+	var count int64
+	if err := db.Model(&models.Media{}).Where("id = ? AND store_id = ? AND pending = ?", *mediaID, storeID, false).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch media"})
+		return false
+	}
+	if count == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Media not found"})
+		return false
+	}
+	return true
+}
+
+// ownedMedia loads the :mediaId media of the current user's :id store
+func (ctrl *MediaController) ownedMedia(c *gin.Context) (*models.Media, bool) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return nil, false
+	}
+
+	mediaID, err := strconv.ParseUint(c.Param("mediaId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return nil, false
+	}
+
+	var item models.Media
+	if err := ctrl.db.Where("id = ? AND store_id = ?", mediaID, store.ID).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch media"})
+		}
+		return nil, false
+	}
+
+	return &item, true
+}
@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"storemaker-backend/models"
+	"storemaker-backend/oidc"
+	"storemaker-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// oidcStateTTL is how long a user has to complete sign-in at the provider
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie holds a hash of the state of the sign-in the browser
+// started. The callback requires it, so a code and state obtained by someone
+// else cannot sign the browser in as them.
+const oidcStateCookie = "oidc_state"
+
+type OIDCController struct {
+	db       *gorm.DB
+	registry *oidc.Registry
+	limiter  *utils.LoginLimiter
+}
+
+func NewOIDCController(db *gorm.DB, registry *oidc.Registry, limiter *utils.LoginLimiter) *OIDCController {
+	return &OIDCController{db: db, registry: registry, limiter: limiter}
+}
+
+// GetProviders lists the configured identity providers
+func (ctrl *OIDCController) GetProviders(c *gin.Context) {
+	providers := make([]gin.H, 0)
+	for _, provider := range ctrl.registry.List() {
+		providers = append(providers, gin.H{
+			"name":         provider.Config.Name,
+			"display_name": provider.Config.DisplayName,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": providers})
+}
+
+// Authorize starts the authorization code flow and returns the provider URL
+// the browser should be sent to
+func (ctrl *OIDCController) Authorize(c *gin.Context) {
+	provider, ok := ctrl.registry.Get(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity provider not found"})
+		return
+	}
+
+	state, err := utils.GenerateRandomString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+	nonce, err := utils.GenerateRandomString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+
+	authURL, err := provider.AuthorizationURL(c.Request.Context(), state, nonce, oidc.CodeChallengeS256(verifier))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	// Clear out abandoned attempts while we are here
+	ctrl.db.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{})
+
+	loginState := models.OIDCLoginState{
+		State:        state,
+		Provider:     provider.Config.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}
+	if err := ctrl.db.Create(&loginState).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+	setOIDCStateCookie(c, oidcStateHash(state), int(oidcStateTTL.Seconds()))
+
+	c.JSON(http.StatusOK, gin.H{
+		"authorization_url": authURL,
+		"state":             state,
+	})
+}
+
+// Callback completes sign-in with the code and state returned by the provider.
+// The user is linked by provider subject, or else by verified email, and is
+// created when no account exists yet.
+func (ctrl *OIDCController) Callback(c *gin.Context) {
+	provider, ok := ctrl.registry.Get(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity provider not found"})
+		return
+	}
+
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkOIDCStateCookie(c, req.State) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired sign-in state"})
+		return
+	}
+
+	loginState, ok := ctrl.consumeState(req.State, provider.Config.Name)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired sign-in state"})
+		return
+	}
+
+	tokens, err := provider.Exchange(c.Request.Context(), req.Code, loginState.CodeVerifier)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to exchange authorization code"})
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(c.Request.Context(), tokens.IDToken, loginState.Nonce)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid ID token"})
+		return
+	}
+
+	if claims.Subject == "" || claims.Email == "" || !bool(claims.EmailVerified) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The identity provider did not return a verified email address"})
+		return
+	}
+
+	user, status, err := ctrl.linkOrCreateUser(provider.Config.Name, claims)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !reserveLoginAttempt(ctrl.db, ctrl.limiter, c, user.Email) {
+		return
+	}
+
+	finishLogin(ctrl.db, ctrl.limiter, c, user, "oidc:"+provider.Config.Name)
+}
+
+// checkOIDCStateCookie reports whether the browser's state cookie matches
+// state, and clears the cookie as each state is used once
+func checkOIDCStateCookie(c *gin.Context, state string) bool {
+	cookie, err := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "", -1)
+	return err == nil && subtle.ConstantTimeCompare([]byte(cookie), []byte(oidcStateHash(state))) == 1
+}
+
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, "/", "", secure, true)
+}
+
+func oidcStateHash(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// consumeState loads and deletes a pending login state so it can only be used once
+func (ctrl *OIDCController) consumeState(state, providerName string) (*models.OIDCLoginState, bool) {
+	var loginState models.OIDCLoginState
+	if err := ctrl.db.Where("state = ? AND provider = ?", state, providerName).First(&loginState).Error; err != nil {
+		return nil, false
+	}
+
+	result := ctrl.db.Delete(&models.OIDCLoginState{}, loginState.ID)
+	if result.Error != nil || result.RowsAffected != 1 {
+		return nil, false
+	}
+
+	if loginState.ExpiresAt.Before(time.Now()) {
+		return nil, false
+	}
+	return &loginState, true
+}
+
+func (ctrl *OIDCController) linkOrCreateUser(providerName string, claims *oidc.IDTokenClaims) (*models.User, int, error) {
+	var user models.User
+
+	// Known identity: sign in the linked user
+	var identity models.UserIdentity
+	err := ctrl.db.Where("provider = ? AND subject = ?", providerName, claims.Subject).First(&identity).Error
+	if err == nil {
+		if err := ctrl.db.Where("id = ? AND is_active = ?", identity.UserID, true).First(&user).Error; err != nil {
+			return nil, http.StatusUnauthorized, errors.New("Account is disabled")
+		}
+		return &user, http.StatusOK, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, http.StatusInternalServerError, errors.New("Failed to look up identity")
+	}
+
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	err = ctrl.db.Transaction(func(tx *gorm.DB) error {
+		findErr := tx.Where("LOWER(email) = ?", email).First(&user).Error
+		switch {
+		case findErr == nil:
+			// Linking by email would let anyone controlling the email at the
+			// provider take over an admin account, so admins must use a password
+			if user.Role == models.RoleAdmin {
+				return errOIDCAdminLink
+			}
+			if !user.IsActive {
+				return errOIDCInactive
+			}
+			// The provider vouched for the address
+			if user.EmailVerifiedAt == nil {
+				now := time.Now()
+				user.EmailVerifiedAt = &now
+				if err := tx.Model(&user).Update("email_verified_at", now).Error; err != nil {
+					return err
+				}
+			}
+		case findErr == gorm.ErrRecordNotFound:
+			// The random password is never disclosed, so the account can only
+			// sign in through the provider until a password is set
+			randomPassword, err := utils.GenerateRandomString(48)
+			if err != nil {
+				return err
+			}
+			hashedPassword, err := utils.HashPassword(randomPassword)
+			if err != nil {
+				return err
+			}
+			firstName, lastName := claims.GivenName, claims.FamilyName
+			if firstName == "" && lastName == "" {
+				firstName = claims.Name
+			}
+			verifiedAt := time.Now()
+			user = models.User{
+				Email:           email,
+				Password:        hashedPassword,
+				FirstName:       firstName,
+				LastName:        lastName,
+				Role:            models.RoleMerchant,
+				IsActive:        true,
+				EmailVerifiedAt: &verifiedAt,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		default:
+			return findErr
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: providerName,
+			Subject:  claims.Subject,
+			Email:    email,
+		}).Error
+	})
+
+	switch err {
+	case nil:
+		return &user, http.StatusOK, nil
+	case errOIDCAdminLink:
+		return nil, http.StatusForbidden, err
+	case errOIDCInactive:
+		return nil, http.StatusUnauthorized, err
+	default:
+		return nil, http.StatusInternalServerError, errors.New("Failed to sign in with identity provider")
+	}
+}
+
+var (
+	errOIDCAdminLink = errors.New("Admin accounts cannot be linked to an external identity provider")
+	errOIDCInactive  = errors.New("Account is disabled")
+)
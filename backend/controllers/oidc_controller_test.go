@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckOIDCStateCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		cookie string
+		state  string
+		want   bool
+	}{
+		{"matching", oidcStateHash("state-1"), "state-1", true},
+		{"other state", oidcStateHash("state-1"), "attacker-state", false},
+		{"raw state", "state-1", "state-1", false},
+		{"no cookie", "", "state-1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/auth/oidc/stub/callback", nil)
+			if tt.cookie != "" {
+				c.Request.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+
+			if got := checkOIDCStateCookie(c, tt.state); got != tt.want {
+				t.Fatalf("checkOIDCStateCookie = %v, want %v", got, tt.want)
+			}
+			setCookie := w.Header().Get("Set-Cookie")
+			if !strings.HasPrefix(setCookie, oidcStateCookie+"=;") || !strings.Contains(setCookie, "HttpOnly") {
+				t.Fatalf("state cookie not cleared: %q", setCookie)
+			}
+		})
+	}
+}
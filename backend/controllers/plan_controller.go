@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"storemaker-backend/models"
+	"storemaker-backend/plans"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PlanController struct {
+	db *gorm.DB
+}
+
+func NewPlanController(db *gorm.DB) *PlanController {
+	return &PlanController{db: db}
+}
+
+// GetPlans lists the available plans
+func (ctrl *PlanController) GetPlans(c *gin.Context) {
+	var planList []models.Plan
+	if err := ctrl.db.Order("price, id").Find(&planList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": planList})
+}
+
+// GetUsage shows the current user's consumption against their plan
+func (ctrl *PlanController) GetUsage(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	summary, err := plans.Usage(ctrl.db, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// CreatePlan adds a plan (admin)
+func (ctrl *PlanController) CreatePlan(c *gin.Context) {
+	var req models.PlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan := models.Plan{}
+	applyPlanRequest(&plan, &req)
+	if err := ctrl.savePlan(ctrl.db.WithContext(c.Request.Context()), &plan); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create plan"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, plan)
+}
+
+// UpdatePlan changes a plan's limits (admin). Subscribers get the new limits
+// straight away; usage already above them is kept but cannot grow.
+func (ctrl *PlanController) UpdatePlan(c *gin.Context) {
+	planID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
+		return
+	}
+
+	var plan models.Plan
+	if err := ctrl.db.First(&plan, planID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plan"})
+		}
+		return
+	}
+
+	var req models.PlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	applyPlanRequest(&plan, &req)
+	if err := ctrl.savePlan(ctrl.db.WithContext(c.Request.Context()), &plan); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update plan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// SetUserPlan moves a user to another plan (admin)
+func (ctrl *PlanController) SetUserPlan(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.UserPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var plan models.Plan
+	if err := ctrl.db.First(&plan, req.PlanID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Plan not found"})
+		return
+	}
+
+	result := ctrl.db.Model(&models.User{}).Where("id = ?", userID).Update("plan_id", plan.ID)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update plan"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	summary, err := plans.Usage(ctrl.db, uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// savePlan saves the plan, making it the only default when flagged as such
+func (ctrl *PlanController) savePlan(db *gorm.DB, plan *models.Plan) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if plan.IsDefault {
+			if err := tx.Model(&models.Plan{}).Where("is_default = ? AND id <> ?", true, plan.ID).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(plan).Error
+	})
+}
+
+func applyPlanRequest(plan *models.Plan, req *models.PlanRequest) {
+	plan.Code = req.Code
+	plan.Name = req.Name
+	plan.Price = req.Price
+	plan.MaxStores = req.MaxStores
+	plan.MaxProductsPerStore = req.MaxProductsPerStore
+	plan.MaxStorageBytes = req.MaxStorageBytes
+	plan.MaxStaffSeats = req.MaxStaffSeats
+	plan.PremiumTemplates = req.PremiumTemplates
+	plan.AICreditsPerMonth = req.AICreditsPerMonth
+	plan.IsDefault = req.IsDefault
+}
+
+// userPlan loads the plan of a user, answering with a 500 on failure
+func userPlan(db *gorm.DB, c *gin.Context, userID uint) (*models.Plan, bool) {
+	plan, err := plans.ForUser(db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plan"})
+		return nil, false
+	}
+	return plan, true
+}
+
+// planAllows turns the result of a plan check into a response: 402 when a
+// limit would be exceeded, 403 for features outside the plan. It returns
+// false if the caller should stop.
+func planAllows(c *gin.Context, err error) bool {
+	if err == nil {
+		return true
+	}
+
+	var limitErr *plans.LimitError
+	switch {
+	case errors.As(err, &limitErr):
+		c.JSON(http.StatusPaymentRequired, gin.H{
+			"error": planLimitMessage(limitErr),
+			"code":  "plan_limit_exceeded",
+			"quota": limitErr.Quota,
+			"limit": limitErr.Limit,
+			"used":  limitErr.Used,
+			"plan":  limitErr.Plan,
+		})
+	case errors.Is(err, plans.ErrPremiumTemplate):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Premium templates are not included in your plan. Upgrade to use this template.",
+			"code":  "premium_template",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check plan limits"})
+	}
+	return false
+}
+
+func planLimitMessage(err *plans.LimitError) string {
+	switch err.Quota {
+	case plans.QuotaStores:
+		return fmt.Sprintf("Your plan allows %d store(s). Upgrade to add more.", err.Limit)
+	case plans.QuotaProducts:
+		return fmt.Sprintf("Your plan allows %d products per store. Upgrade to add more.", err.Limit)
+	case plans.QuotaStorage:
+		return fmt.Sprintf("Your plan includes %d MB of storage. Upgrade for more space.", err.Limit/(1<<20))
+	case plans.QuotaAICredits:
+		return fmt.Sprintf("You have used all %d AI credits included in your plan this month.", err.Limit)
+	}
+	return "Your plan limit has been reached. Upgrade to continue."
+}
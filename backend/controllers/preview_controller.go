@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"storemaker-backend/middleware"
+	"storemaker-backend/models"
+	"storemaker-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// defaultPreviewTokenLifetime applies when no expiry is requested
+const defaultPreviewTokenLifetime = 72 * time.Hour
+
+type PreviewController struct {
+	db *gorm.DB
+}
+
+func NewPreviewController(db *gorm.DB) *PreviewController {
+	return &PreviewController{db: db}
+}
+
+// GetPreviewTokens lists a store's preview tokens, including expired and revoked ones
+func (ctrl *PreviewController) GetPreviewTokens(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var tokens []models.StorePreviewToken
+	if err := ctrl.db.Where("store_id = ?", store.ID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch preview tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": tokens})
+}
+
+// CreatePreviewToken mints a preview token. The plain token is only returned here.
+func (ctrl *PreviewController) CreatePreviewToken(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var req models.PreviewTokenCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lifetime := defaultPreviewTokenLifetime
+	if req.ExpiresInHours > 0 {
+		lifetime = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	secret, err := utils.GenerateRandomString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate preview token"})
+		return
+	}
+	rawToken := models.PreviewTokenPrefix + secret
+
+	token := models.StorePreviewToken{
+		StoreID:     store.ID,
+		CreatedByID: c.GetUint("user_id"),
+		Name:        req.Name,
+		Prefix:      rawToken[:len(models.PreviewTokenPrefix)+6],
+		TokenHash:   utils.HashToken(rawToken),
+		ExpiresAt:   time.Now().Add(lifetime),
+	}
+	if err := ctrl.db.WithContext(c.Request.Context()).Create(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create preview token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"preview_token": token,
+		"token":         rawToken,
+		"preview_path":  "/stores/" + store.Slug + "?preview=" + rawToken,
+	})
+}
+
+// RevokePreviewToken stops a preview token from working
+func (ctrl *PreviewController) RevokePreviewToken(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	tokenID, err := strconv.ParseUint(c.Param("tokenId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid preview token ID"})
+		return
+	}
+
+	var token models.StorePreviewToken
+	if err := ctrl.db.Where("id = ? AND store_id = ?", tokenID, store.ID).First(&token).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Preview token not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch preview token"})
+		}
+		return
+	}
+
+	if token.RevokedAt == nil {
+		if err := ctrl.db.Model(&token).Update("revoked_at", time.Now()).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke preview token"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Preview token revoked successfully"})
+}
+
+// previewableStoreStatuses are served publicly to preview token holders only
+var previewableStoreStatuses = []models.StoreStatus{models.StoreStatusDraft, models.StoreStatusPendingReview}
+
+// findPublicStore loads the :slug store for a public endpoint and reports
+// whether the request carries a valid preview token for it. Unlaunched
+// stores are only found with a preview token; suspended and archived stores
+// are never found. It writes the error response itself.
+func findPublicStore(db *gorm.DB, c *gin.Context) (*models.Store, bool, bool) {
+	var store models.Store
+	if err := db.Where("slug = ? AND status IN ?", c.Param("slug"), publicStoreStatuses()).First(&store).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store"})
+		}
+		return nil, false, false
+	}
+
+	preview := middleware.HasStorePreview(db, c, store.ID)
+	if store.Status != models.StoreStatusActive && !preview {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		return nil, false, false
+	}
+
+	return &store, preview, true
+}
+
+// publicStoreStatuses lists the statuses a store may be served publicly in
+func publicStoreStatuses() []models.StoreStatus {
+	return append([]models.StoreStatus{models.StoreStatusActive}, previewableStoreStatuses...)
+}
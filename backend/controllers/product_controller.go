@@ -1,14 +1,19 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"storemaker-backend/catalog"
+	"storemaker-backend/media"
 	"storemaker-backend/models"
+	"storemaker-backend/plans"
 	"storemaker-backend/utils"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ProductController struct {
@@ -19,81 +24,84 @@ func NewProductController(db *gorm.DB) *ProductController {
 	return &ProductController{db: db}
 }
 
-// Public endpoints - Get products by store slug
+// Public endpoints - Get products by store slug. Draft products are only
+// listed with a valid preview token. GetStoreProducts takes the search,
+// filter, sort and cursor parameters of catalog.ParseListingParams and
+// returns a page with totals and facet counts.
 func (ctrl *ProductController) GetStoreProducts(c *gin.Context) {
-	storeSlug := c.Param("slug")
-
-	var store models.Store
-	if err := ctrl.db.Where("slug = ?", storeSlug).First(&store).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+	store, preview, ok := findPublicStore(ctrl.db, c)
+	if !ok {
 		return
 	}
 
-	var products []models.Product
-<<<<<<< HEAD
-	query := ctrl.db.Where("store_id = ? AND status = ?", store.ID, models.ProductStatusActive)
-=======
-	query := ctrl.db.Where("store_id = ? AND status IN (?, ?)", store.ID, models.ProductStatusActive, models.ProductStatusDraft)
->>>>>>> url/main
-
-	// Pagination
-	page := 1
-	limit := 20
-	if p, err := strconv.Atoi(c.DefaultQuery("page", "1")); err == nil && p > 0 {
-		page = p
-	}
-	if l, err := strconv.Atoi(c.DefaultQuery("limit", "20")); err == nil && l > 0 && l <= 100 {
-		limit = l
+	params, err := catalog.ParseListingParams(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	offset := (page - 1) * limit
-
-	if err := query.Offset(offset).Limit(limit).Find(&products).Error; err != nil {
+	listing, err := catalog.List(ctrl.db.WithContext(c.Request.Context()), store.ID, publicProductStatuses(preview), params)
+	if err != nil {
+		if errors.Is(err, catalog.ErrInvalidListing) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
 		return
 	}
+	if err := media.AttachToProducts(ctrl.db, listing.Data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product media"})
+		return
+	}
 
-	c.JSON(http.StatusOK, products)
+	c.JSON(http.StatusOK, listing)
 }
 
 func (ctrl *ProductController) GetStoreProduct(c *gin.Context) {
-	storeSlug := c.Param("slug")
 	productSlug := c.Param("productSlug")
 
-	var store models.Store
-	if err := ctrl.db.Where("slug = ?", storeSlug).First(&store).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+	store, preview, ok := findPublicStore(ctrl.db, c)
+	if !ok {
 		return
 	}
 
 	var product models.Product
-<<<<<<< HEAD
-	if err := ctrl.db.Where("store_id = ? AND slug = ? AND status = ?", store.ID, productSlug, models.ProductStatusActive).First(&product).Error; err != nil {
-=======
-	if err := ctrl.db.Where("store_id = ? AND slug = ? AND status IN (?, ?)", store.ID, productSlug, models.ProductStatusActive, models.ProductStatusDraft).First(&product).Error; err != nil {
->>>>>>> url/main
+	if err := ctrl.db.Scopes(catalog.PreloadVariants).Where("store_id = ? AND slug = ? AND status IN ?", store.ID, productSlug, publicProductStatuses(preview)).First(&product).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
+	if err := media.AttachToProduct(ctrl.db, &product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product media"})
+		return
+	}
 
 	c.JSON(http.StatusOK, product)
 }
 
-// Management endpoints - CRUD operations for store owners
+// publicProductStatuses lists the product statuses visitors may see
+func publicProductStatuses(preview bool) []models.ProductStatus {
+	if preview {
+		return []models.ProductStatus{models.ProductStatusActive, models.ProductStatusDraft}
+	}
+	return []models.ProductStatus{models.ProductStatusActive}
+}
+
+// Management endpoints - CRUD operations for store owners. GetProducts takes
+// the same ?q= search as the storefront.
 func (ctrl *ProductController) GetProducts(c *gin.Context) {
-	storeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
 		return
 	}
 
 	var products []models.Product
-	query := ctrl.db.Where("store_id = ?", storeID)
+	query := ctrl.db.Where("store_id = ?", store.ID)
 
 	// Filter by status if provided
 	if status := c.Query("status"); status != "" {
 		query = query.Where("status = ?", status)
 	}
+	query = query.Scopes(catalog.Search(c.Query("q")))
 
 	// Pagination
 	page := 1
@@ -107,20 +115,26 @@ func (ctrl *ProductController) GetProducts(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
-	if err := query.Offset(offset).Limit(limit).Find(&products).Error; err != nil {
+	if err := query.Scopes(catalog.PreloadVariants).Offset(offset).Limit(limit).Find(&products).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
 		return
 	}
+	if err := media.AttachToProducts(ctrl.db, products); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product media"})
+		return
+	}
 
 	c.JSON(http.StatusOK, products)
 }
 
 func (ctrl *ProductController) CreateProduct(c *gin.Context) {
-	storeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
 		return
 	}
+	storeID := store.ID
 
 	var req models.Product
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -128,11 +142,26 @@ func (ctrl *ProductController) CreateProduct(c *gin.Context) {
 		return
 	}
 
+	plan, ok := userPlan(db, c, store.OwnerID)
+	if !ok {
+		return
+	}
+	if !planAllows(c, plans.CheckProducts(db, plan, store.ID, 1)) {
+		return
+	}
+	if !storeCategoryExists(db, c, storeID, req.CategoryID) {
+		return
+	}
+	images, ok := storeMedia(db, c, storeID, req.MediaIDs)
+	if !ok {
+		return
+	}
+
 	// Generate slug from name
 	baseSlug := utils.GenerateSlug(req.Name)
 	slug := utils.GenerateUniqueSlug(baseSlug, func(s string) bool {
 		var count int64
-		ctrl.db.Model(&models.Product{}).Where("store_id = ? AND slug = ?", storeID, s).Count(&count)
+		db.Model(&models.Product{}).Where("store_id = ? AND slug = ?", storeID, s).Count(&count)
 		return count > 0
 	})
 
@@ -145,19 +174,45 @@ func (ctrl *ProductController) CreateProduct(c *gin.Context) {
 		ComparePrice: req.ComparePrice,
 		SKU:          req.SKU,
 		Images:       req.Images,
-		Variants:     req.Variants,
 		Status:       models.ProductStatusDraft,
 		Stock:        req.Stock,
 		Weight:       req.Weight,
 		IsDigital:    req.IsDigital,
 		SeoTitle:     req.SeoTitle,
 		SeoDesc:      req.SeoDesc,
-		StoreID:      uint(storeID),
+		StoreID:      storeID,
 		CategoryID:   req.CategoryID,
 	}
+	if req.MediaIDs != nil {
+		product.MediaIDs = req.MediaIDs
+		product.Images = media.URLs(images)
+		product.Media = images
+	}
 
-	if err := ctrl.db.Create(&product).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
+	// Options generate the variants; variants sent alongside them keep their
+	// fields when their combination is generated
+	variants := req.Variants
+	if len(req.Options) > 0 {
+		options, err := catalog.NormalizeOptions(req.Options)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		product.Options = options
+		variants, err = catalog.GenerateVariants(&product, options, req.Variants, models.VariantDefaults{})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Variants").Create(&product).Error; err != nil {
+			return err
+		}
+		return catalog.SaveVariants(tx, &product, variants)
+	})
+	if !variantWriteOK(c, err, "Failed to create product") {
 		return
 	}
 
@@ -165,11 +220,13 @@ func (ctrl *ProductController) CreateProduct(c *gin.Context) {
 }
 
 func (ctrl *ProductController) UpdateProduct(c *gin.Context) {
-	storeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
 		return
 	}
+	storeID := store.ID
 
 	productID, err := strconv.ParseUint(c.Param("productId"), 10, 32)
 	if err != nil {
@@ -185,23 +242,79 @@ func (ctrl *ProductController) UpdateProduct(c *gin.Context) {
 
 	// Find existing product
 	var product models.Product
-	if err := ctrl.db.Where("id = ? AND store_id = ?", productID, storeID).First(&product).Error; err != nil {
+	if err := db.Scopes(catalog.PreloadVariants).Where("id = ? AND store_id = ?", productID, storeID).First(&product).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
+	if !storeCategoryExists(db, c, storeID, req.CategoryID) {
+		return
+	}
+	images, ok := storeMedia(db, c, storeID, req.MediaIDs)
+	if !ok {
+		return
+	}
+	if req.MediaIDs != nil {
+		req.Images = media.URLs(images)
+	}
+
+	// Variants are only replaced when sent, or regenerated from options
+	variants := req.Variants
+	req.Variants = nil
+	if req.Options != nil {
+		options, err := catalog.NormalizeOptions(req.Options)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		existing := product.Variants
+		if variants != nil {
+			existing = variants
+		}
+		updated := product
+		if req.Price != 0 {
+			updated.Price = req.Price
+		}
+		if req.SKU != "" {
+			updated.SKU = req.SKU
+		}
+		variants, err = catalog.GenerateVariants(&updated, options, existing, models.VariantDefaults{})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Options = options
+	}
 
 	// Update slug if name changed
 	if req.Name != "" && req.Name != product.Name {
 		baseSlug := utils.GenerateSlug(req.Name)
 		req.Slug = utils.GenerateUniqueSlug(baseSlug, func(s string) bool {
 			var count int64
-			ctrl.db.Model(&models.Product{}).Where("store_id = ? AND slug = ? AND id != ?", storeID, s, productID).Count(&count)
+			db.Model(&models.Product{}).Where("store_id = ? AND slug = ? AND id != ?", storeID, s, productID).Count(&count)
 			return count > 0
 		})
 	}
 
-	if err := ctrl.db.Model(&product).Updates(&req).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Ratings are kept by review moderation and the store never changes
+		if err := tx.Model(&product).Omit("Variants", "StoreID", "RatingAverage", "RatingCount").Updates(&req).Error; err != nil {
+			return err
+		}
+		if variants == nil {
+			return nil
+		}
+		return catalog.SaveVariants(tx, &product, variants)
+	})
+	if !variantWriteOK(c, err, "Failed to update product") {
+		return
+	}
+	if req.MediaIDs != nil {
+		product.MediaIDs = req.MediaIDs
+		product.Images = req.Images
+		product.Media = images
+	} else if err := media.AttachToProduct(db, &product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product media"})
 		return
 	}
 
@@ -209,11 +322,13 @@ func (ctrl *ProductController) UpdateProduct(c *gin.Context) {
 }
 
 func (ctrl *ProductController) DeleteProduct(c *gin.Context) {
-	storeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
 		return
 	}
+	storeID := store.ID
 
 	productID, err := strconv.ParseUint(c.Param("productId"), 10, 32)
 	if err != nil {
@@ -221,10 +336,236 @@ func (ctrl *ProductController) DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	if err := ctrl.db.Where("id = ? AND store_id = ?", productID, storeID).Delete(&models.Product{}).Error; err != nil {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND store_id = ?", productID, storeID).Delete(&models.Product{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		// Deleted variants free their SKUs for reuse
+		return tx.Where("product_id = ?", productID).Delete(&models.ProductVariant{}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 }
+
+// SetProductOptions replaces a product's options and regenerates its
+// variants. Variants whose combination still exists are left untouched; new
+// combinations take the request's defaults.
+func (ctrl *ProductController) SetProductOptions(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	productID, err := strconv.ParseUint(c.Param("productId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req models.ProductOptionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	options, err := catalog.NormalizeOptions(req.Options)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var product models.Product
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(catalog.PreloadVariants).
+			Where("id = ? AND store_id = ?", productID, store.ID).First(&product).Error; err != nil {
+			return err
+		}
+
+		variants, err := catalog.GenerateVariants(&product, options, product.Variants, req.Defaults)
+		if err != nil {
+			return err
+		}
+
+		product.Options = options
+		if err := tx.Model(&product).Select("options").Updates(&product).Error; err != nil {
+			return err
+		}
+		return catalog.SaveVariants(tx, &product, variants)
+	})
+	if !variantWriteOK(c, err, "Failed to update product options") {
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// UpdateProductVariant edits one variant's price, SKU, stock or image
+func (ctrl *ProductController) UpdateProductVariant(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	product, variantID, ok := ctrl.variantParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.ProductVariantUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var variant *models.ProductVariant
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		variant, err = catalog.UpdateVariant(tx, product, variantID, func(variant *models.ProductVariant) {
+			if req.Price != nil {
+				variant.Price = *req.Price
+			}
+			if req.SKU != nil {
+				variant.SKU = *req.SKU
+			}
+			if req.Stock != nil {
+				variant.Stock = *req.Stock
+			}
+			if req.Image != nil {
+				variant.Image = *req.Image
+			}
+		})
+		return err
+	})
+	if !variantWriteOK(c, err, "Failed to update variant") {
+		return
+	}
+
+	c.JSON(http.StatusOK, variant)
+}
+
+// AdjustVariantStock adds to or takes from a variant's stock. The variant
+// row is locked, so concurrent adjustments all apply.
+func (ctrl *ProductController) AdjustVariantStock(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	product, variantID, ok := ctrl.variantParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.ProductVariantStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var variant *models.ProductVariant
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		variant, err = catalog.AdjustStock(tx, product.ID, variantID, req.Adjustment)
+		return err
+	})
+	if !variantWriteOK(c, err, "Failed to adjust stock") {
+		return
+	}
+
+	c.JSON(http.StatusOK, variant)
+}
+
+// variantParams loads the :productId product of the current user's :id store
+// and parses :variantId
+func (ctrl *ProductController) variantParams(c *gin.Context) (*models.Product, uint, bool) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return nil, 0, false
+	}
+
+	productID, err := strconv.ParseUint(c.Param("productId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return nil, 0, false
+	}
+	variantID, err := strconv.ParseUint(c.Param("variantId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return nil, 0, false
+	}
+
+	var product models.Product
+	if err := ctrl.db.Where("id = ? AND store_id = ?", productID, store.ID).First(&product).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		}
+		return nil, 0, false
+	}
+	return &product, uint(variantID), true
+}
+
+// variantWriteOK maps product and variant write errors to responses and
+// reports whether the write succeeded
+func variantWriteOK(c *gin.Context, err error, message string) bool {
+	var skuConflict *catalog.SKUConflictError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &skuConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": skuConflict.Error(), "sku": skuConflict.SKU})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	case errors.Is(err, catalog.ErrVariantNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+	case errors.Is(err, catalog.ErrInsufficientStock):
+		c.JSON(http.StatusConflict, gin.H{"error": "Not enough stock"})
+	case errors.Is(err, catalog.ErrInvalidOptions):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return false
+}
+
+// storeCategoryExists checks an optional category ID belongs to the store
+func storeCategoryExists(db *gorm.DB, c *gin.Context, storeID uint, categoryID *uint) bool {
+	if categoryID == nil {
+		return true
+	}
+
+	var count int64
+	if err := db.Model(&models.Category{}).Where("id = ? AND store_id = ?", *categoryID, storeID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category"})
+		return false
+	}
+	if count == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
+		return false
+	}
+	return true
+}
+
+// storeMedia loads the media library images a product lists, which must
+// all belong to the store
+func storeMedia(db *gorm.DB, c *gin.Context, storeID uint, ids models.MediaIDs) ([]models.Media, bool) {
+	images, err := media.ForStore(db, storeID, ids)
+	if err != nil {
+		if errors.Is(err, media.ErrUnknownMedia) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Media not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch media"})
+		}
+		return nil, false
+	}
+	return images, true
+}
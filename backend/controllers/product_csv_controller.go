@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"storemaker-backend/jobs"
+	"storemaker-backend/models"
+	"storemaker-backend/productcsv"
+	"storemaker-backend/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ProductCSVController struct {
+	db     *gorm.DB
+	runner *jobs.Runner
+	files  storage.Storage
+}
+
+func NewProductCSVController(db *gorm.DB, runner *jobs.Runner, files storage.Storage) *ProductCSVController {
+	return &ProductCSVController{db: db, runner: runner, files: files}
+}
+
+// ImportProducts starts a background import of the "file" form field, a
+// product CSV in Shopify's layout. With dry_run=true the job only validates
+// the file and reports what it would change.
+func (ctrl *ProductCSVController) ImportProducts(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if header.Size > productcsv.MaxImportBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Import files can be at most 10 MB"})
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.PostForm("dry_run"))
+
+	upload, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer upload.Close()
+
+	file, err := productcsv.Parse(upload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job := models.Job{
+		Type:    models.JobTypeProductImport,
+		StoreID: &store.ID,
+		UserID:  store.OwnerID,
+		Params: models.JobData{
+			"filename": header.Filename,
+			"rows":     file.Rows(),
+			"dry_run":  dryRun,
+		},
+	}
+	ctrl.enqueue(c, store, &job, productcsv.ImportHandler(ctrl.db, store.ID, file, dryRun), "Failed to start import")
+}
+
+// ExportProducts starts a background export of the store's products. The
+// file is downloaded from DownloadProductExport once the job completes, for
+// up to productcsv.ExportTTL.
+func (ctrl *ProductCSVController) ExportProducts(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	job := models.Job{
+		Type:    models.JobTypeProductExport,
+		StoreID: &store.ID,
+		UserID:  store.OwnerID,
+		Params:  models.JobData{},
+	}
+	ctrl.enqueue(c, store, &job, productcsv.ExportHandler(ctrl.db, ctrl.files, store.ID), "Failed to start export")
+}
+
+// DownloadProductExport sends the file of a completed export job
+func (ctrl *ProductCSVController) DownloadProductExport(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	jobID, err := strconv.ParseUint(c.Param("jobId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	var job models.Job
+	if err := ctrl.db.Where("id = ? AND store_id = ? AND type = ?", jobID, store.ID, models.JobTypeProductExport).
+		First(&job).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch export"})
+		}
+		return
+	}
+	if job.Status != models.JobStatusCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "The export has not finished", "job": jobResponse(&job)})
+		return
+	}
+
+	key, ok := productcsv.ExportFile(&job)
+	if !ok {
+		c.JSON(http.StatusGone, gin.H{"error": "The export file is no longer available"})
+		return
+	}
+	file, err := ctrl.files.Open(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusGone, gin.H{"error": "The export file is no longer available"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read export"})
+		}
+		return
+	}
+	defer file.Close()
+
+	c.DataFromReader(http.StatusOK, -1, "text/csv", file, map[string]string{
+		"Content-Disposition": `attachment; filename="products-` + store.Slug + `.csv"`,
+	})
+}
+
+// enqueue starts job and answers with where to poll it
+func (ctrl *ProductCSVController) enqueue(c *gin.Context, store *models.Store, job *models.Job, handler jobs.Handler, failure string) {
+	if err := ctrl.runner.Enqueue(c.Request.Context(), job, handler); err != nil {
+		if err == jobs.ErrQueueFull {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many jobs are running. Please try again later."})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job":        job,
+		"status_url": jobStatusPath(store.ID, job.ID),
+	})
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"storemaker-backend/jobs"
+	"storemaker-backend/models"
+	"storemaker-backend/recommendations"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RecommendationController struct {
+	db     *gorm.DB
+	runner *jobs.Runner
+}
+
+func NewRecommendationController(db *gorm.DB, runner *jobs.Runner) *RecommendationController {
+	return &RecommendationController{db: db, runner: runner}
+}
+
+// GET /stores/:slug/products/:productSlug/recommendations?type=related&limit=8
+// Returns "related" and "bought_together" products, or only the kind named
+// by type, for the product-carousel and product-showcase components
+func (ctrl *RecommendationController) GetProductRecommendations(c *gin.Context) {
+	store, preview, ok := findPublicStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	limit := recommendations.DefaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		l, err := strconv.Atoi(raw)
+		if err != nil || l < 1 || l > recommendations.MaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be 1 to " + strconv.Itoa(recommendations.MaxLimit)})
+			return
+		}
+		limit = l
+	}
+	kind := models.RecommendationKind(c.Query("type"))
+	if kind != "" && kind != models.RecommendationKindRelated && kind != models.RecommendationKindBoughtTogether {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be related or bought_together"})
+		return
+	}
+
+	var product models.Product
+	if err := ctrl.db.Where("store_id = ? AND slug = ? AND status IN ?", store.ID, c.Param("productSlug"), publicProductStatuses(preview)).
+		First(&product).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		}
+		return
+	}
+
+	recommended, err := recommendations.For(ctrl.db.WithContext(c.Request.Context()), &product, publicProductStatuses(preview), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recommendations"})
+		return
+	}
+
+	response := gin.H{"product_id": product.ID}
+	for _, k := range recommendations.Kinds {
+		if kind == "" || kind == k {
+			response[string(k)] = recommended[k]
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GET /manage/stores/:id/products/:productId/recommendations
+// Returns the product's overrides and its latest computed recommendations
+func (ctrl *RecommendationController) GetRecommendations(c *gin.Context) {
+	product, ok := ctrl.ownedProduct(c)
+	if !ok {
+		return
+	}
+
+	overrides, err := recommendations.Overrides(ctrl.db, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recommendations"})
+		return
+	}
+	computed, err := recommendations.Computed(ctrl.db, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recommendations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"overrides": overrides, "computed": computed})
+}
+
+// PUT /manage/stores/:id/products/:productId/recommendations
+// Pins or excludes products; kinds left out of the request are unchanged
+func (ctrl *RecommendationController) UpdateRecommendations(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	product, ok := ctrl.ownedProduct(c)
+	if !ok {
+		return
+	}
+
+	var req models.RecommendationOverridesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := recommendations.SetOverrides(db, product, &req); err != nil {
+		if errors.Is(err, recommendations.ErrUnknownProduct) || errors.Is(err, recommendations.ErrConflictingOverride) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recommendations"})
+		}
+		return
+	}
+
+	overrides, err := recommendations.Overrides(db, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recommendations"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"overrides": overrides})
+}
+
+// POST /manage/stores/:id/recommendations/recompute
+// Starts a background recompute of the store's recommendations, which
+// otherwise happens periodically
+func (ctrl *RecommendationController) RecomputeRecommendations(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	job := models.Job{
+		Type:    models.JobTypeRecommendations,
+		StoreID: &store.ID,
+		UserID:  store.OwnerID,
+		Params:  models.JobData{},
+	}
+	if err := ctrl.runner.Enqueue(c.Request.Context(), &job, recommendations.Handler(ctrl.db, store.ID)); err != nil {
+		if err == jobs.ErrQueueFull {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many jobs are running. Please try again later."})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start recommendations"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job":        job,
+		"status_url": jobStatusPath(store.ID, job.ID),
+	})
+}
+
+// ownedProduct loads the :productId product of the current user's :id store
+func (ctrl *RecommendationController) ownedProduct(c *gin.Context) (*models.Product, bool) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return nil, false
+	}
+
+	productID, err := strconv.ParseUint(c.Param("productId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return nil, false
+	}
+
+	var product models.Product
+	if err := ctrl.db.Where("id = ? AND store_id = ?", productID, store.ID).First(&product).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		}
+		return nil, false
+	}
+
+	return &product, true
+}
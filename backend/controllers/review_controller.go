@@ -0,0 +1,471 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"storemaker-backend/media"
+	"storemaker-backend/models"
+	"storemaker-backend/reviews"
+	"storemaker-backend/storage"
+	"storemaker-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ReviewController struct {
+	db      *gorm.DB
+	files   storage.Storage
+	limiter *utils.RateLimiter
+}
+
+func NewReviewController(db *gorm.DB, files storage.Storage, limiter *utils.RateLimiter) *ReviewController {
+	return &ReviewController{db: db, files: files, limiter: limiter}
+}
+
+// GET /stores/:slug/reviews
+// Approved reviews across the store, for components such as reviews-grid
+// that are not on a product page. Takes reviews.ParseListParams parameters.
+func (ctrl *ReviewController) GetStoreReviews(c *gin.Context) {
+	store, preview, ok := findPublicStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	query := ctrl.db.WithContext(c.Request.Context()).Model(&models.Review{}).
+		Scopes(reviews.Approved(store.ID, publicProductStatuses(preview)))
+	ctrl.listPublicReviews(c, query)
+}
+
+// GET /stores/:slug/products/:productSlug/reviews
+// Approved reviews of a product with its rating summary. Takes
+// reviews.ParseListParams parameters.
+func (ctrl *ReviewController) GetProductReviews(c *gin.Context) {
+	store, preview, ok := findPublicStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+	product, ok := ctrl.publicProduct(c, store, preview)
+	if !ok {
+		return
+	}
+
+	query := ctrl.db.WithContext(c.Request.Context()).Model(&models.Review{}).
+		Scopes(reviews.Approved(store.ID, publicProductStatuses(preview))).
+		Where("reviews.product_id = ?", product.ID)
+	ctrl.listPublicReviews(c, query)
+}
+
+func (ctrl *ReviewController) listPublicReviews(c *gin.Context, query *gorm.DB) {
+	params, err := reviews.ParseListParams(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	listing, err := reviews.List(query, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+
+	c.JSON(http.StatusOK, listing)
+}
+
+// POST /stores/:slug/products/:productSlug/reviews
+// JSON, or multipart/form-data with up to reviews.MaxPhotos "photos" files.
+// Reviews wait for the merchant's approval before they are shown. Each
+// client IP and store may receive only so many reviews an hour.
+func (ctrl *ReviewController) CreateProductReview(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, preview, ok := findPublicStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+	if wait := ctrl.limiter.Allow(reviews.RateLimits(store.ID, c.ClientIP())...); wait > 0 {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many reviews have been submitted. Please try again later.",
+			"retry_after": retryAfter,
+		})
+		return
+	}
+	product, ok := ctrl.publicProduct(c, store, preview)
+	if !ok {
+		return
+	}
+
+	var req models.ReviewCreateRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var headers []*multipart.FileHeader
+	if form, err := c.MultipartForm(); err == nil {
+		headers = form.File["photos"]
+	}
+	if len(headers) > reviews.MaxPhotos {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A review may have at most %d photos", reviews.MaxPhotos)})
+		return
+	}
+
+	review := models.Review{
+		StoreID:   store.ID,
+		ProductID: product.ID,
+		Rating:    req.Rating,
+		Title:     strings.TrimSpace(req.Title),
+		Body:      strings.TrimSpace(req.Body),
+		PhotoIDs:  models.MediaIDs{},
+		Name:      strings.TrimSpace(req.Name),
+		Email:     reviews.NormalizeEmail(req.Email),
+		Status:    models.ReviewStatusPending,
+	}
+
+	var reviewed int64
+	if err := db.Model(&models.Review{}).Where("product_id = ? AND email = ?", product.ID, review.Email).Count(&reviewed).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check reviews"})
+		return
+	}
+	if reviewed > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already reviewed this product"})
+		return
+	}
+
+	if strings.TrimSpace(req.OrderNumber) != "" {
+		orderID, err := reviews.VerifyPurchase(db, store.ID, product.ID, review.Email, req.OrderNumber)
+		if err != nil {
+			if errors.Is(err, reviews.ErrOrderNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify purchase"})
+			}
+			return
+		}
+		review.OrderID = &orderID
+		review.Verified = true
+	}
+
+	// Photos already in the library are shared; ones saved here are removed
+	// again if the review is not created
+	var created []*models.Media
+	for _, header := range headers {
+		saved, isNew, ok := saveMedia(c, db, ctrl.files, store, header, true)
+		if !ok {
+			ctrl.removeUnusedPhotos(db, created)
+			return
+		}
+		if isNew {
+			created = append(created, saved)
+		}
+		if !slices.Contains(review.PhotoIDs, saved.ID) {
+			review.PhotoIDs = append(review.PhotoIDs, saved.ID)
+			review.Photos = append(review.Photos, *saved)
+		}
+	}
+
+	if err := db.Create(&review).Error; err != nil {
+		ctrl.removeUnusedPhotos(db, created)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save review"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Thank you! Your review will appear once it has been approved.",
+		"review":  reviews.ToPublic([]models.Review{review})[0],
+	})
+}
+
+// publicProduct loads the :productSlug product if visitors may see it
+func (ctrl *ReviewController) publicProduct(c *gin.Context, store *models.Store, preview bool) (*models.Product, bool) {
+	var product models.Product
+	if err := ctrl.db.Where("store_id = ? AND slug = ? AND status IN ?", store.ID, c.Param("productSlug"), publicProductStatuses(preview)).
+		First(&product).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		}
+		return nil, false
+	}
+	return &product, true
+}
+
+// GET /manage/stores/:id/reviews?status=pending&product_id=1&rating=5
+// Lists reviews with counts by status. The pending list is the moderation
+// queue and is oldest first; other lists are newest first.
+func (ctrl *ReviewController) GetReviews(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	page := 1
+	limit := 20
+	if p, err := strconv.Atoi(c.DefaultQuery("page", "1")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(c.DefaultQuery("limit", "20")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+
+	query := ctrl.db.Model(&models.Review{}).Where("store_id = ?", store.ID)
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+	if rating := c.Query("rating"); rating != "" {
+		query = query.Where("rating = ?", rating)
+	}
+
+	var counts []struct {
+		Status models.ReviewStatus
+		Count  int64
+	}
+	if err := query.Session(&gorm.Session{}).Select("status, COUNT(*) AS count").Group("status").Scan(&counts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+	byStatus := gin.H{
+		string(models.ReviewStatusPending):  int64(0),
+		string(models.ReviewStatusApproved): int64(0),
+		string(models.ReviewStatusRejected): int64(0),
+	}
+	for _, count := range counts {
+		byStatus[string(count.Status)] = count.Count
+	}
+
+	order := "id DESC"
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+		if models.ReviewStatus(status) == models.ReviewStatusPending {
+			order = "id ASC"
+		}
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+	var items []models.Review
+	if err := query.Preload("Product").Order(order).Offset((page - 1) * limit).Limit(limit).Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+	if err := reviews.AttachPhotos(ctrl.db, items); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch review photos"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": items, "page": page, "limit": limit, "total": total, "counts": byStatus})
+}
+
+// PUT /manage/stores/:id/reviews/:reviewId
+// Approves or rejects a review, or returns it to the queue. Approving adds
+// the review's photos to the media library and counts them against the
+// owner's storage; rejecting deletes them.
+func (ctrl *ReviewController) ModerateReview(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	review, ok := ctrl.ownedReview(c)
+	if !ok {
+		return
+	}
+
+	var req models.ReviewModerateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	photos, ok := ctrl.pendingPhotos(c, db, review)
+	if !ok {
+		return
+	}
+	if req.Status == models.ReviewStatusApproved && !publishMedia(c, db, &review.Store, photos) {
+		return
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": req.Status, "moderated_at": now}
+	var rejected []*models.Media
+	if req.Status == models.ReviewStatusRejected && len(photos) > 0 {
+		kept := models.MediaIDs{}
+		for _, id := range review.PhotoIDs {
+			if !slices.ContainsFunc(photos, func(photo models.Media) bool { return photo.ID == id }) {
+				kept = append(kept, id)
+			}
+		}
+		updates["photo_ids"] = kept
+		review.PhotoIDs = kept
+		for i := range photos {
+			rejected = append(rejected, &photos[i])
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(review).Updates(updates).Error; err != nil {
+			return err
+		}
+		return reviews.RefreshRating(tx, review.ProductID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate review"})
+		return
+	}
+	review.Status = req.Status
+	review.ModeratedAt = &now
+	ctrl.removeUnusedPhotos(db, rejected)
+
+	c.JSON(http.StatusOK, review)
+}
+
+// PUT /manage/stores/:id/reviews/:reviewId/reply
+// Sets the merchant's public reply to a review
+func (ctrl *ReviewController) ReplyToReview(c *gin.Context) {
+	review, ok := ctrl.ownedReview(c)
+	if !ok {
+		return
+	}
+
+	var req models.ReviewReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	reply := strings.TrimSpace(req.Body)
+	if err := ctrl.db.WithContext(c.Request.Context()).Model(review).
+		Updates(map[string]interface{}{"reply": reply, "replied_at": now}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save reply"})
+		return
+	}
+	review.Reply = reply
+	review.RepliedAt = &now
+
+	c.JSON(http.StatusOK, review)
+}
+
+// DELETE /manage/stores/:id/reviews/:reviewId/reply
+func (ctrl *ReviewController) DeleteReviewReply(c *gin.Context) {
+	review, ok := ctrl.ownedReview(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.db.WithContext(c.Request.Context()).Model(review).
+		Updates(map[string]interface{}{"reply": "", "replied_at": nil}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete reply"})
+		return
+	}
+	review.Reply = ""
+	review.RepliedAt = nil
+
+	c.JSON(http.StatusOK, review)
+}
+
+// DELETE /manage/stores/:id/reviews/:reviewId
+// Photos only the review used are removed from the media library with it.
+func (ctrl *ReviewController) DeleteReview(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	review, ok := ctrl.ownedReview(c)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(review).Error; err != nil {
+			return err
+		}
+		return reviews.RefreshRating(tx, review.ProductID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete review"})
+		return
+	}
+
+	var photos []models.Media
+	if len(review.PhotoIDs) > 0 {
+		if err := db.Where("store_id = ? AND id IN ?", review.StoreID, []uint(review.PhotoIDs)).Find(&photos).Error; err != nil {
+			log.Printf("Failed to load photos of deleted review %d: %v", review.ID, err)
+		}
+	}
+	unused := make([]*models.Media, 0, len(photos))
+	for i := range photos {
+		unused = append(unused, &photos[i])
+	}
+	ctrl.removeUnusedPhotos(db, unused)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Review deleted successfully"})
+}
+
+// removeUnusedPhotos removes review photos from the media library unless a
+// product, page, component or other review shows them
+func (ctrl *ReviewController) removeUnusedPhotos(db *gorm.DB, photos []*models.Media) {
+	for _, photo := range photos {
+		usage, err := media.Usage(db, photo)
+		if err != nil {
+			log.Printf("Failed to check usage of media %d: %v", photo.ID, err)
+			continue
+		}
+		if usage.InUse() {
+			continue
+		}
+		if err := media.Remove(db, ctrl.files, photo); err != nil {
+			log.Printf("Failed to remove media %d: %v", photo.ID, err)
+		}
+	}
+}
+
+// pendingPhotos loads the review's photos that await its approval
+func (ctrl *ReviewController) pendingPhotos(c *gin.Context, db *gorm.DB, review *models.Review) ([]models.Media, bool) {
+	var photos []models.Media
+	if len(review.PhotoIDs) == 0 {
+		return photos, true
+	}
+	if err := db.Where("store_id = ? AND id IN ? AND pending = ?", review.StoreID, []uint(review.PhotoIDs), true).
+		Find(&photos).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch review photos"})
+		return nil, false
+	}
+	return photos, true
+}
+
+// ownedReview loads the :reviewId review of the current user's :id store
+func (ctrl *ReviewController) ownedReview(c *gin.Context) (*models.Review, bool) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return nil, false
+	}
+
+	reviewID, err := strconv.ParseUint(c.Param("reviewId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review ID"})
+		return nil, false
+	}
+
+	var review models.Review
+	if err := ctrl.db.Where("id = ? AND store_id = ?", reviewID, store.ID).First(&review).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch review"})
+		}
+		return nil, false
+	}
+	review.Store = *store
+
+	return &review, true
+}
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"storemaker-backend/middleware"
+	"storemaker-backend/models"
+	"storemaker-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type StoreAccessController struct {
+	db      *gorm.DB
+	limiter *utils.LoginLimiter
+}
+
+func NewStoreAccessController(db *gorm.DB, limiter *utils.LoginLimiter) *StoreAccessController {
+	return &StoreAccessController{db: db, limiter: limiter}
+}
+
+// GetStoreAccess returns a store's access policy. Stores without one are open.
+func (ctrl *StoreAccessController) GetStoreAccess(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	policy, err := ctrl.loadPolicy(ctrl.db, store.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store access"})
+		return
+	}
+
+	c.JSON(http.StatusOK, storeAccessResponse(policy))
+}
+
+// UpdateStoreAccess switches the access mode. Setting a new password signs
+// out every visitor who unlocked the store with the old one.
+func (ctrl *StoreAccessController) UpdateStoreAccess(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var req models.StoreAccessUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := ctrl.loadPolicy(db, store.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store access"})
+		return
+	}
+
+	if req.BypassIPs != nil {
+		for _, entry := range req.BypassIPs {
+			if !validIPOrCIDR(entry) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bypass IP: " + entry})
+				return
+			}
+		}
+		policy.BypassIPs = models.StringList(req.BypassIPs)
+	}
+
+	if req.Password != nil {
+		hashedPassword, err := utils.HashPassword(*req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+		policy.PasswordHash = hashedPassword
+		policy.PasswordVersion++
+	}
+	if req.Mode == models.StoreAccessPassword && !policy.HasPassword() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A password is required for password-protected stores"})
+		return
+	}
+
+	if req.MaintenanceMessage != nil {
+		policy.MaintenanceMessage = *req.MaintenanceMessage
+	}
+	if req.RetryAfterSeconds != nil {
+		policy.RetryAfterSeconds = *req.RetryAfterSeconds
+	}
+	policy.Mode = req.Mode
+
+	if err := db.Save(policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update store access"})
+		return
+	}
+
+	c.JSON(http.StatusOK, storeAccessResponse(policy))
+}
+
+// GetAccessStatus tells the storefront which gate, if any, to show. It is
+// not itself gated.
+func (ctrl *StoreAccessController) GetAccessStatus(c *gin.Context) {
+	store, ok := ctrl.publicStore(c)
+	if !ok {
+		return
+	}
+
+	policy, err := ctrl.loadPolicy(ctrl.db, store.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store access"})
+		return
+	}
+
+	response := gin.H{"access_mode": policy.Mode}
+	if policy.Mode == models.StoreAccessMaintenance {
+		response["message"] = policy.MaintenanceMessage
+		response["retry_after"] = policy.RetryAfterSeconds
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UnlockStore exchanges the storefront password for an access token, returned
+// in the body and set as a cookie
+func (ctrl *StoreAccessController) UnlockStore(c *gin.Context) {
+	store, ok := ctrl.publicStore(c)
+	if !ok {
+		return
+	}
+
+	var req models.StoreUnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := ctrl.loadPolicy(ctrl.db, store.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store access"})
+		return
+	}
+	if policy.Mode != models.StoreAccessPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Store is not password protected"})
+		return
+	}
+
+	limiterKey := "store:" + strconv.FormatUint(uint64(store.ID), 10)
+	if wait := ctrl.limiter.Reserve(limiterKey, c.ClientIP()); wait > 0 {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many failed attempts. Please try again later.",
+			"retry_after": retryAfter,
+		})
+		return
+	}
+
+	if err := utils.CheckPassword(policy.PasswordHash, req.Password); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+	ctrl.limiter.RecordSuccess(limiterKey, c.ClientIP())
+
+	expiresAt := time.Now().Add(middleware.StoreAccessTokenLifetime)
+	token, err := middleware.GenerateStoreAccessToken(policy, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
+		return
+	}
+
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(middleware.StoreAccessCookieName(store.ID), token, int(middleware.StoreAccessTokenLifetime.Seconds()), "/", "", secure, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": token,
+		"expires_at":   expiresAt,
+	})
+}
+
+// loadPolicy returns the store's access policy, or an unsaved open one
+func (ctrl *StoreAccessController) loadPolicy(db *gorm.DB, storeID uint) (*models.StoreAccessPolicy, error) {
+	var policy models.StoreAccessPolicy
+	if err := db.Where("store_id = ?", storeID).First(&policy).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return &models.StoreAccessPolicy{StoreID: storeID, Mode: models.StoreAccessOpen, BypassIPs: models.StringList{}}, nil
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// publicStore loads the :slug store without applying its access policy
+func (ctrl *StoreAccessController) publicStore(c *gin.Context) (*models.Store, bool) {
+	var store models.Store
+	if err := ctrl.db.Where("slug = ? AND status IN ?", c.Param("slug"), publicStoreStatuses()).First(&store).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store"})
+		}
+		return nil, false
+	}
+	return &store, true
+}
+
+// storeAccessResponse adds whether a password is set, without revealing it
+func storeAccessResponse(policy *models.StoreAccessPolicy) gin.H {
+	return gin.H{
+		"access":       policy,
+		"has_password": policy.HasPassword(),
+	}
+}
+
+func validIPOrCIDR(entry string) bool {
+	if strings.Contains(entry, "/") {
+		_, _, err := net.ParseCIDR(entry)
+		return err == nil
+	}
+	return net.ParseIP(entry) != nil
+}
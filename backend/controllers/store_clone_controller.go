@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"storemaker-backend/jobs"
+	"storemaker-backend/models"
+	"storemaker-backend/plans"
+	"storemaker-backend/storeclone"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type StoreCloneController struct {
+	db     *gorm.DB
+	runner *jobs.Runner
+}
+
+func NewStoreCloneController(db *gorm.DB, runner *jobs.Runner) *StoreCloneController {
+	return &StoreCloneController{db: db, runner: runner}
+}
+
+// CloneStore creates a draft copy of a store for the same owner. The new
+// store is created straight away; its contents are copied by a background
+// job whose progress can be polled.
+func (ctrl *StoreCloneController) CloneStore(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	source, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var req models.StoreCloneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := storeclone.AllOptions()
+	if req.Include != nil {
+		opts = *req.Include
+	}
+
+	plan, ok := userPlan(db, c, source.OwnerID)
+	if !ok {
+		return
+	}
+	if !planAllows(c, plans.CheckStores(db, plan, source.OwnerID, 1)) {
+		return
+	}
+	if opts.Products && !planAllows(c, plans.CheckProducts(db, plan, source.ID, 0)) {
+		return
+	}
+
+	slug, subdomain, domain := uniqueStoreAddresses(db, req.Name)
+	target := models.Store{
+		Name:        req.Name,
+		Slug:        slug,
+		Subdomain:   subdomain,
+		Domain:      domain,
+		Description: source.Description,
+		Logo:        source.Logo,
+		Favicon:     source.Favicon,
+		OwnerID:     source.OwnerID,
+		TemplateID:  source.TemplateID,
+		Status:      models.StoreStatusDraft,
+	}
+	if err := db.Create(&target).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create store"})
+		return
+	}
+
+	job := models.Job{
+		Type:    models.JobTypeStoreClone,
+		StoreID: &target.ID,
+		UserID:  source.OwnerID,
+		Params: models.JobData{
+			"source_store_id": source.ID,
+			"include":         opts,
+		},
+	}
+	handler := storeclone.Handler(ctrl.db, source.ID, target.ID, opts)
+	if err := ctrl.runner.Enqueue(c.Request.Context(), &job, handler); err != nil {
+		// The empty store would otherwise count toward the plan's store limit
+		discardCloneTarget(db, &target, &job)
+		if err == jobs.ErrQueueFull {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many jobs are running. Please try again later."})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start clone"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"store":      target,
+		"job":        job,
+		"status_url": jobStatusPath(target.ID, job.ID),
+	})
+}
+
+// discardCloneTarget removes a clone's store, and its job if one was saved,
+// when the copy could not be started
+func discardCloneTarget(db *gorm.DB, target *models.Store, job *models.Job) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if job.ID != 0 {
+			if err := tx.Delete(job).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(target).Error
+	})
+	if err != nil {
+		log.Printf("Failed to remove store %d after its clone could not start: %v", target.ID, err)
+	}
+}
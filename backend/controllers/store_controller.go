@@ -3,12 +3,16 @@ package controllers
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"storemaker-backend/lifecycle"
 	"storemaker-backend/models"
+	"storemaker-backend/plans"
+	"storemaker-backend/trash"
 	"storemaker-backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -41,6 +45,8 @@ func (ctrl *StoreController) GetUserStores(c *gin.Context) {
 }
 
 func (ctrl *StoreController) CreateStore(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
@@ -53,27 +59,25 @@ func (ctrl *StoreController) CreateStore(c *gin.Context) {
 		return
 	}
 
-	// Generate slug from name
-	baseSlug := utils.GenerateSlug(req.Name)
-	slug := utils.GenerateUniqueSlug(baseSlug, func(s string) bool {
-		var count int64
-		ctrl.db.Model(&models.Store{}).Where("slug = ?", s).Count(&count)
-		return count > 0
-	})
-
-	// Generate subdomain
-	subdomain := utils.GenerateUniqueSlug(baseSlug, func(s string) bool {
-		var count int64
-		ctrl.db.Model(&models.Store{}).Where("subdomain = ?", s).Count(&count)
-		return count > 0
-	})
+	plan, ok := userPlan(db, c, userID.(uint))
+	if !ok {
+		return
+	}
+	if !planAllows(c, plans.CheckStores(db, plan, userID.(uint), 1)) {
+		return
+	}
+	if req.TemplateID != nil {
+		var template models.Template
+		if err := db.First(&template, *req.TemplateID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Template not found"})
+			return
+		}
+		if !planAllows(c, plans.CheckTemplate(plan, &template)) {
+			return
+		}
+	}
 
-	// Generate unique domain (using subdomain with a domain suffix)
-	domain := utils.GenerateUniqueSlug(baseSlug, func(s string) bool {
-		var count int64
-		ctrl.db.Model(&models.Store{}).Where("domain = ?", s+".storemaker.com").Count(&count)
-		return count > 0
-	}) + ".storemaker.com"
+	slug, subdomain, domain := uniqueStoreAddresses(db, req.Name)
 
 	store := models.Store{
 		Name:        req.Name,
@@ -87,7 +91,7 @@ func (ctrl *StoreController) CreateStore(c *gin.Context) {
 	}
 
 	// Save the store first
-	if err := ctrl.db.Create(&store).Error; err != nil {
+	if err := db.Create(&store).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create store"})
 		return
 	}
@@ -95,7 +99,7 @@ func (ctrl *StoreController) CreateStore(c *gin.Context) {
 	// If a template is selected, copy its theme, settings, and pages to the new store
 	if req.TemplateID != nil {
 		var template models.Template
-		if err := ctrl.db.Preload("Stores").First(&template, *req.TemplateID).Error; err != nil {
+		if err := db.Preload("Stores").First(&template, *req.TemplateID).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Template not found"})
 			return
 		}
@@ -142,7 +146,7 @@ func (ctrl *StoreController) CreateStore(c *gin.Context) {
 			if v, ok := themeConfig["custom_css"].(string); ok {
 				theme.CustomCSS = v
 			}
-			if err := ctrl.db.Create(&theme).Error; err != nil {
+			if err := db.Create(&theme).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy template theme"})
 				return
 			}
@@ -183,76 +187,17 @@ func (ctrl *StoreController) CreateStore(c *gin.Context) {
 			if v, ok := settingsConfig["order_prefix"].(string); ok {
 				settings.OrderPrefix = v
 			}
-			if err := ctrl.db.Create(&settings).Error; err != nil {
+			if err := db.Create(&settings).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy template settings"})
 				return
 			}
 		}
 
 		// Copy components from template (new structure from admin panel)
-<<<<<<< HEAD
-		if componentsConfig, ok := template.Config["components"].([]interface{}); ok {
-			fmt.Printf("Found %d components in template\n", len(componentsConfig))
-			// Create a default home page for the store
-			homePage := models.Page{
-				StoreID:     store.ID,
-				Title:       "Home",
-				Slug:        "home",
-				Type:        models.PageTypeHome,
-				IsPublished: true,
-			}
-			if err := ctrl.db.Create(&homePage).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create home page"})
-				return
-			}
-
-			// Create a main section for components
-			mainSection := models.Section{
-				PageID:    homePage.ID,
-				Name:      "Main Content",
-				Type:      models.SectionTypeText,
-				Order:     0,
-				IsVisible: true,
-			}
-			if err := ctrl.db.Create(&mainSection).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create main section"})
-				return
-			}
-
-			// Copy components from template
-			for _, compRaw := range componentsConfig {
-				compMap, ok := compRaw.(map[string]interface{})
-				if !ok {
-					continue
-				}
-
-				component := models.Component{
-					SectionID: mainSection.ID,
-					Name:      getString(compMap, "id"), // Use id as name
-					Type:      models.ComponentType(getString(compMap, "type")),
-					Order:     getInt(compMap, "order"),
-					IsVisible: true,
-				}
-
-				// Copy component props as config
-				if props, ok := compMap["props"].(map[string]interface{}); ok {
-					configBytes, _ := json.Marshal(props)
-					var compConfig models.ComponentConfig
-					_ = json.Unmarshal(configBytes, &compConfig)
-					component.Config = compConfig
-				}
-
-				if err := ctrl.db.Create(&component).Error; err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy template component"})
-					return
-				}
-			}
-=======
 		// Note: Template components are now stored directly in the store layout
 		// and will be loaded via the store layout API, not as a separate home page
 		if componentsConfig, ok := template.Config["components"].([]interface{}); ok {
 			fmt.Printf("Found %d components in template - these will be loaded via store layout\n", len(componentsConfig))
->>>>>>> url/main
 		}
 
 		// Copy pages (if template.Config has pages info) - legacy structure
@@ -272,7 +217,7 @@ func (ctrl *StoreController) CreateStore(c *gin.Context) {
 					SeoTitle:    getString(pageMap, "seo_title"),
 					SeoDesc:     getString(pageMap, "seo_description"),
 				}
-				if err := ctrl.db.Create(&page).Error; err != nil {
+				if err := db.Create(&page).Error; err != nil {
 					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy template page"})
 					return
 				}
@@ -290,7 +235,7 @@ func (ctrl *StoreController) CreateStore(c *gin.Context) {
 							Order:     getInt(sectionMap, "order"),
 							IsVisible: getBool(sectionMap, "is_visible"),
 						}
-						if err := ctrl.db.Create(&section).Error; err != nil {
+						if err := db.Create(&section).Error; err != nil {
 							c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy template section"})
 							return
 						}
@@ -315,7 +260,7 @@ func (ctrl *StoreController) CreateStore(c *gin.Context) {
 									_ = json.Unmarshal(configBytes, &compConfig)
 									component.Config = compConfig
 								}
-								if err := ctrl.db.Create(&component).Error; err != nil {
+								if err := db.Create(&component).Error; err != nil {
 									c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy template component"})
 									return
 								}
@@ -356,20 +301,11 @@ func (ctrl *StoreController) GetStore(c *gin.Context) {
 	c.JSON(http.StatusOK, store)
 }
 
+// GetStoreBySlug serves a public store. Draft stores are only served with a
+// valid preview token.
 func (ctrl *StoreController) GetStoreBySlug(c *gin.Context) {
-	slug := c.Param("slug")
-
-	var store models.Store
-<<<<<<< HEAD
-	if err := ctrl.db.Where("slug = ? AND status = ?", slug, models.StoreStatusActive).First(&store).Error; err != nil {
-=======
-	if err := ctrl.db.Where("slug = ? AND status IN (?, ?)", slug, models.StoreStatusActive, models.StoreStatusDraft).First(&store).Error; err != nil {
->>>>>>> url/main
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store"})
-		}
+	store, _, ok := findPublicStore(ctrl.db, c)
+	if !ok {
 		return
 	}
 
@@ -377,6 +313,8 @@ func (ctrl *StoreController) GetStoreBySlug(c *gin.Context) {
 }
 
 func (ctrl *StoreController) UpdateStore(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
@@ -390,7 +328,7 @@ func (ctrl *StoreController) UpdateStore(c *gin.Context) {
 	}
 
 	var store models.Store
-	if err := ctrl.db.Where("id = ? AND owner_id = ?", storeID, userID).First(&store).Error; err != nil {
+	if err := db.Where("id = ? AND owner_id = ?", storeID, userID).First(&store).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
 		} else {
@@ -404,6 +342,10 @@ func (ctrl *StoreController) UpdateStore(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Status != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Store status is changed through POST /manage/stores/:id/lifecycle"})
+		return
+	}
 
 	// Update fields if provided
 	if req.Name != nil {
@@ -415,7 +357,7 @@ func (ctrl *StoreController) UpdateStore(c *gin.Context) {
 				return false // Allow keeping the same slug
 			}
 			var count int64
-			ctrl.db.Model(&models.Store{}).Where("slug = ?", s).Count(&count)
+			db.Unscoped().Model(&models.Store{}).Where("slug = ?", s).Count(&count)
 			return count > 0
 		})
 		store.Slug = newSlug
@@ -429,14 +371,8 @@ func (ctrl *StoreController) UpdateStore(c *gin.Context) {
 	if req.Favicon != nil {
 		store.Favicon = *req.Favicon
 	}
-	if req.Domain != nil {
-		store.Domain = *req.Domain
-	}
-	if req.Status != nil {
-		store.Status = *req.Status
-	}
 
-	if err := ctrl.db.Save(&store).Error; err != nil {
+	if err := db.Save(&store).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update store"})
 		return
 	}
@@ -444,7 +380,11 @@ func (ctrl *StoreController) UpdateStore(c *gin.Context) {
 	c.JSON(http.StatusOK, store)
 }
 
+// DeleteStore moves a store and its content to the trash, from where it can
+// be restored until it is purged
 func (ctrl *StoreController) DeleteStore(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
@@ -458,7 +398,7 @@ func (ctrl *StoreController) DeleteStore(c *gin.Context) {
 	}
 
 	var store models.Store
-	if err := ctrl.db.Where("id = ? AND owner_id = ?", storeID, userID).First(&store).Error; err != nil {
+	if err := db.Where("id = ? AND owner_id = ?", storeID, userID).First(&store).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
 		} else {
@@ -467,12 +407,15 @@ func (ctrl *StoreController) DeleteStore(c *gin.Context) {
 		return
 	}
 
-	if err := ctrl.db.Delete(&store).Error; err != nil {
+	if err := trash.Delete(db, &store); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete store"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Store deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Store moved to trash",
+		"purge_at": trash.PurgeAt(&store, trash.RetentionFromEnv()),
+	})
 }
 
 func (ctrl *StoreController) GetStoreAnalytics(c *gin.Context) {
@@ -490,27 +433,99 @@ func (ctrl *StoreController) GetAllStores(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": stores})
 }
 
+// UpdateStoreStatus lets an admin move a store through its lifecycle.
+// Suspensions need a reason, which the merchant sees on their store.
 func (ctrl *StoreController) UpdateStoreStatus(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
 	storeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
 		return
 	}
 
-	var req struct {
-		Status models.StoreStatus `json:"status" binding:"required"`
-	}
+	var req models.StoreLifecycleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := ctrl.db.Model(&models.Store{}).Where("id = ?", storeID).Update("status", req.Status).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update store status"})
+	var store models.Store
+	if err := db.First(&store, storeID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store"})
+		}
+		return
+	}
+
+	applyStoreEvent(c, db, &store, req, lifecycle.ActorAdmin)
+}
+
+// GetStoreLifecycle returns the store's status, the status changes the
+// merchant can make and the launch checklist
+func (ctrl *StoreController) GetStoreLifecycle(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	checklist, err := lifecycle.LaunchChecklist(ctrl.db, store)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate launch checklist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":            store.Status,
+		"suspension_reason": store.SuspensionReason,
+		"suspended_at":      store.SuspendedAt,
+		"events":            lifecycle.AllowedEvents(store.Status, lifecycle.ActorMerchant),
+		"checklist":         checklist,
+	})
+}
+
+// ChangeStoreLifecycle lets the merchant submit, unpublish, archive or
+// restore their store
+func (ctrl *StoreController) ChangeStoreLifecycle(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var req models.StoreLifecycleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Store status updated successfully"})
+	applyStoreEvent(c, db, store, req, lifecycle.ActorMerchant)
+}
+
+// applyStoreEvent runs a lifecycle event and writes the response
+func applyStoreEvent(c *gin.Context, db *gorm.DB, store *models.Store, req models.StoreLifecycleRequest, actor lifecycle.Actor) {
+	checklist, err := lifecycle.Transition(db, store, lifecycle.ParseEvent(req.Event), actor, req.Reason)
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, store)
+	case lifecycle.ErrChecklistIncomplete:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "checklist": checklist})
+	case lifecycle.ErrNotPermitted:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case lifecycle.ErrInvalidTransition:
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  err.Error(),
+			"status": store.Status,
+			"events": lifecycle.AllowedEvents(store.Status, actor),
+		})
+	case lifecycle.ErrReasonRequired:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update store status"})
+	}
 }
 
 func (ctrl *StoreController) GetSystemAnalytics(c *gin.Context) {
@@ -536,6 +551,8 @@ func (ctrl *StoreController) GetSystemAnalytics(c *gin.Context) {
 
 // CreateStoreWithAI handles AI-powered store creation using Gemini API
 func (ctrl *StoreController) CreateStoreWithAI(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
@@ -548,6 +565,17 @@ func (ctrl *StoreController) CreateStoreWithAI(c *gin.Context) {
 		return
 	}
 
+	plan, ok := userPlan(db, c, userID.(uint))
+	if !ok {
+		return
+	}
+	if !planAllows(c, plans.CheckStores(db, plan, userID.(uint), 1)) {
+		return
+	}
+	if !planAllows(c, plans.CheckAICredits(db, plan, userID.(uint), plans.AIStoreCredits)) {
+		return
+	}
+
 	// Generate AI-powered store configuration
 	aiConfig, err := ctrl.generateAIStoreConfig(req.Description, req.Industry, req.BusinessType)
 	if err != nil {
@@ -555,27 +583,7 @@ func (ctrl *StoreController) CreateStoreWithAI(c *gin.Context) {
 		return
 	}
 
-	// Generate slug from name
-	baseSlug := utils.GenerateSlug(req.Name)
-	slug := utils.GenerateUniqueSlug(baseSlug, func(s string) bool {
-		var count int64
-		ctrl.db.Model(&models.Store{}).Where("slug = ?", s).Count(&count)
-		return count > 0
-	})
-
-	// Generate subdomain
-	subdomain := utils.GenerateUniqueSlug(baseSlug, func(s string) bool {
-		var count int64
-		ctrl.db.Model(&models.Store{}).Where("subdomain = ?", s).Count(&count)
-		return count > 0
-	})
-
-	// Generate unique domain
-	domain := utils.GenerateUniqueSlug(baseSlug, func(s string) bool {
-		var count int64
-		ctrl.db.Model(&models.Store{}).Where("domain = ?", s+".storemaker.com").Count(&count)
-		return count > 0
-	}) + ".storemaker.com"
+	slug, subdomain, domain := uniqueStoreAddresses(db, req.Name)
 
 	store := models.Store{
 		Name:        req.Name,
@@ -588,11 +596,15 @@ func (ctrl *StoreController) CreateStoreWithAI(c *gin.Context) {
 	}
 
 	// Save the store first
-	if err := ctrl.db.Create(&store).Error; err != nil {
+	if err := db.Create(&store).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create store"})
 		return
 	}
 
+	if err := plans.ChargeAICredits(db, store.OwnerID, &store.ID, plans.FeatureAIStore, plans.AIStoreCredits); err != nil {
+		log.Printf("Failed to charge AI credits for store %d: %v", store.ID, err)
+	}
+
 	// Create AI-generated theme
 	if aiConfig.Theme != nil {
 		theme := models.StoreTheme{
@@ -624,7 +636,7 @@ func (ctrl *StoreController) CreateStoreWithAI(c *gin.Context) {
 			theme.CustomCSS = aiConfig.Theme.CustomCSS
 		}
 
-		if err := ctrl.db.Create(&theme).Error; err != nil {
+		if err := db.Create(&theme).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create AI theme"})
 			return
 		}
@@ -667,71 +679,17 @@ func (ctrl *StoreController) CreateStoreWithAI(c *gin.Context) {
 			settings.OrderPrefix = aiConfig.Settings.OrderPrefix
 		}
 
-		if err := ctrl.db.Create(&settings).Error; err != nil {
+		if err := db.Create(&settings).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create AI settings"})
 			return
 		}
 	}
 
 	// Create AI-generated components
-<<<<<<< HEAD
-	if aiConfig.Components != nil {
-		// Create a default home page
-		homePage := models.Page{
-			StoreID:     store.ID,
-			Title:       "Home",
-			Slug:        "home",
-			Content:     "Welcome to our store",
-			Type:        models.PageTypeHome,
-			IsPublished: true,
-		}
-		if err := ctrl.db.Create(&homePage).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create home page"})
-			return
-		}
-
-		// Create a main section for components
-		mainSection := models.Section{
-			PageID:    homePage.ID,
-			Name:      "Main Content",
-			Type:      models.SectionTypeText,
-			Order:     0,
-			IsVisible: true,
-		}
-		if err := ctrl.db.Create(&mainSection).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create main section"})
-			return
-		}
-
-		// Create components from AI config
-		for _, compConfig := range aiConfig.Components {
-			component := models.Component{
-				SectionID: mainSection.ID,
-				Name:      compConfig.ID, // Use ID as name
-				Type:      models.ComponentType(compConfig.Type),
-				Order:     compConfig.Order,
-				IsVisible: true,
-			}
-
-			// Convert props to config
-			if compConfig.Props != nil {
-				configBytes, _ := json.Marshal(compConfig.Props)
-				var compConfigData models.ComponentConfig
-				_ = json.Unmarshal(configBytes, &compConfigData)
-				component.Config = compConfigData
-			}
-
-			if err := ctrl.db.Create(&component).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create AI component"})
-				return
-			}
-		}
-=======
 	// Note: AI-generated components are now stored directly in the store layout
 	// and will be loaded via the store layout API, not as a separate home page
 	if aiConfig.Components != nil {
 		fmt.Printf("Found %d AI-generated components - these will be loaded via store layout\n", len(aiConfig.Components))
->>>>>>> url/main
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
@@ -984,3 +942,29 @@ func getMapKeys(m map[string]interface{}) []string {
 	}
 	return keys
 }
+
+// uniqueStoreAddresses generates an unused slug, subdomain and domain from a
+// store name. Stores in the trash keep their addresses until purged.
+func uniqueStoreAddresses(db *gorm.DB, name string) (slug, subdomain, domain string) {
+	baseSlug := utils.GenerateSlug(name)
+	slug = utils.GenerateUniqueSlug(baseSlug, func(s string) bool {
+		var count int64
+		db.Unscoped().Model(&models.Store{}).Where("slug = ?", s).Count(&count)
+		return count > 0
+	})
+
+	subdomain = utils.GenerateUniqueSlug(baseSlug, func(s string) bool {
+		var count int64
+		db.Unscoped().Model(&models.Store{}).Where("subdomain = ?", s).Count(&count)
+		return count > 0
+	})
+
+	// The default domain is the subdomain under the storefront base domain
+	domain = utils.GenerateUniqueSlug(baseSlug, func(s string) bool {
+		var count int64
+		db.Unscoped().Model(&models.Store{}).Where("domain = ?", s+"."+utils.StorefrontBaseDomain()).Count(&count)
+		return count > 0
+	}) + "." + utils.StorefrontBaseDomain()
+
+	return slug, subdomain, domain
+}
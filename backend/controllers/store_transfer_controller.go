@@ -0,0 +1,389 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"storemaker-backend/mail"
+	"storemaker-backend/models"
+	"storemaker-backend/plans"
+	"storemaker-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// storeTransferLifetime is how long the recipient has to accept a transfer
+const storeTransferLifetime = 7 * 24 * time.Hour
+
+var (
+	errTransferClosed = errors.New("transfer is no longer pending")
+	errTransferStale  = errors.New("store owner changed since the transfer was started")
+)
+
+type StoreTransferController struct {
+	db     *gorm.DB
+	mailer mail.Sender
+}
+
+func NewStoreTransferController(db *gorm.DB, mailer mail.Sender) *StoreTransferController {
+	return &StoreTransferController{db: db, mailer: mailer}
+}
+
+// GetTransfer returns the store's pending transfer, if any
+func (ctrl *StoreTransferController) GetTransfer(c *gin.Context) {
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var transfer models.StoreTransfer
+	err := ctrl.db.Where("store_id = ? AND status = ? AND expires_at > ?", store.ID, models.StoreTransferPending, time.Now()).
+		Order("created_at DESC").First(&transfer).Error
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusOK, gin.H{"transfer": nil})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transfer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transfer": transfer})
+}
+
+// InitiateTransfer offers the store to another account and emails the
+// recipient a link to accept. Starting a new transfer cancels a pending one.
+func (ctrl *StoreTransferController) InitiateTransfer(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	var req models.StoreTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var owner models.User
+	if err := db.First(&owner, store.OwnerID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store owner"})
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if strings.EqualFold(email, owner.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You already own this store"})
+		return
+	}
+
+	rawToken, err := utils.GenerateRandomString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate transfer token"})
+		return
+	}
+
+	transfer := models.StoreTransfer{
+		StoreID:    store.ID,
+		FromUserID: owner.ID,
+		ToEmail:    email,
+		TokenHash:  utils.HashToken(rawToken),
+		Status:     models.StoreTransferPending,
+		Message:    req.Message,
+		ExpiresAt:  time.Now().Add(storeTransferLifetime),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.StoreTransfer{}).
+			Where("store_id = ? AND status = ?", store.ID, models.StoreTransferPending).
+			Update("status", models.StoreTransferCancelled).Error; err != nil {
+			return err
+		}
+		return tx.Create(&transfer).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transfer"})
+		return
+	}
+
+	link := strings.TrimRight(utils.GetEnv("FRONTEND_URL", "http://localhost:3000"), "/") + "/store-transfers/accept?token=" + url.QueryEscape(rawToken)
+	body := owner.FirstName + " " + owner.LastName + " (" + owner.Email + ") would like to transfer the store \"" + store.Name + "\" to you.\n\n"
+	if req.Message != "" {
+		body += req.Message + "\n\n"
+	}
+	body += "Sign in with this email address and open this link within 7 days to accept:\n\n" + link + "\n"
+	err = ctrl.mailer.Send(c.Request.Context(), mail.Message{
+		To:      email,
+		Subject: "You have been offered the store " + store.Name,
+		Body:    body,
+	})
+	if err != nil {
+		log.Printf("Failed to send transfer email for store %d: %v", store.ID, err)
+		db.Model(&transfer).Update("status", models.StoreTransferCancelled)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send transfer email"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"transfer": transfer})
+}
+
+// CancelTransfer withdraws the store's pending transfer
+func (ctrl *StoreTransferController) CancelTransfer(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ownedStore(ctrl.db, c)
+	if !ok {
+		return
+	}
+
+	result := db.Model(&models.StoreTransfer{}).
+		Where("store_id = ? AND status = ?", store.ID, models.StoreTransferPending).
+		Update("status", models.StoreTransferCancelled)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel transfer"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending transfer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer cancelled"})
+}
+
+// GetIncomingTransfers lists pending transfers addressed to the current user
+func (ctrl *StoreTransferController) GetIncomingTransfers(c *gin.Context) {
+	user, ok := ctrl.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var transfers []models.StoreTransfer
+	if err := ctrl.db.Preload("Store").
+		Where("LOWER(to_email) = ? AND status = ? AND expires_at > ?", strings.ToLower(user.Email), models.StoreTransferPending, time.Now()).
+		Order("created_at DESC").Find(&transfers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transfers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": transfers})
+}
+
+// AcceptTransfer makes the current user the owner of the store, provided it
+// fits in their plan. API keys and preview tokens issued under the previous
+// owner are revoked.
+func (ctrl *StoreTransferController) AcceptTransfer(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	user, transfer, ok := ctrl.openTransfer(c)
+	if !ok {
+		return
+	}
+	if user.Role != models.RoleMerchant && user.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only merchant accounts can receive stores"})
+		return
+	}
+	if !ctrl.recipientPlanAllows(c, db, user, transfer.StoreID) {
+		return
+	}
+
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var locked models.StoreTransfer
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, transfer.ID).Error; err != nil {
+			return err
+		}
+		if !locked.IsOpen() {
+			return errTransferClosed
+		}
+
+		result := tx.Model(&models.Store{}).
+			Where("id = ? AND owner_id = ?", locked.StoreID, locked.FromUserID).
+			Update("owner_id", user.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errTransferStale
+		}
+
+		if err := tx.Model(&models.APIKey{}).
+			Where("store_id = ? AND revoked_at IS NULL", locked.StoreID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.StorePreviewToken{}).
+			Where("store_id = ? AND revoked_at IS NULL", locked.StoreID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&locked).Updates(map[string]interface{}{
+			"status":       models.StoreTransferAccepted,
+			"to_user_id":   user.ID,
+			"responded_at": now,
+		}).Error
+	})
+	switch err {
+	case nil:
+	case errTransferClosed:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired transfer"})
+		return
+	case errTransferStale:
+		db.Model(transfer).Update("status", models.StoreTransferCancelled)
+		c.JSON(http.StatusConflict, gin.H{"error": "The store is no longer owned by the sender"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept transfer"})
+		return
+	}
+
+	var store models.Store
+	if err := ctrl.db.First(&store, transfer.StoreID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store"})
+		return
+	}
+
+	ctrl.notifySender(c, transfer, &store, user.Email+" accepted the transfer of \""+store.Name+"\". You no longer have access to the store.")
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Store transferred successfully",
+		"store":   store,
+	})
+}
+
+// DeclineTransfer turns down a transfer addressed to the current user
+func (ctrl *StoreTransferController) DeclineTransfer(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	user, transfer, ok := ctrl.openTransfer(c)
+	if !ok {
+		return
+	}
+
+	result := db.Model(&models.StoreTransfer{}).
+		Where("id = ? AND status = ?", transfer.ID, models.StoreTransferPending).
+		Updates(map[string]interface{}{
+			"status":       models.StoreTransferDeclined,
+			"to_user_id":   user.ID,
+			"responded_at": time.Now(),
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline transfer"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired transfer"})
+		return
+	}
+
+	var store models.Store
+	if err := ctrl.db.First(&store, transfer.StoreID).Error; err == nil {
+		ctrl.notifySender(c, transfer, &store, user.Email+" declined the transfer of \""+store.Name+"\".")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer declined"})
+}
+
+// recipientPlanAllows checks the store fits in the recipient's plan on top of
+// what they already have
+func (ctrl *StoreTransferController) recipientPlanAllows(c *gin.Context, db *gorm.DB, user *models.User, storeID uint) bool {
+	plan, ok := userPlan(db, c, user.ID)
+	if !ok {
+		return false
+	}
+
+	var store models.Store
+	if err := db.Preload("Template").First(&store, storeID).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "The store is no longer available"})
+		return false
+	}
+
+	var storeBytes int64
+	if err := db.Model(&models.StoreUpload{}).Where("store_id = ? AND pending = ?", storeID, false).
+		Select("COALESCE(SUM(size), 0)").Scan(&storeBytes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check plan limits"})
+		return false
+	}
+
+	checks := []error{
+		plans.CheckStores(db, plan, user.ID, 1),
+		plans.CheckProducts(db, plan, storeID, 0),
+		plans.CheckStorage(db, plan, user.ID, storeBytes),
+	}
+	if store.Template != nil {
+		checks = append(checks, plans.CheckTemplate(plan, store.Template))
+	}
+	for _, err := range checks {
+		if !planAllows(c, err) {
+			return false
+		}
+	}
+	return true
+}
+
+// openTransfer loads the pending transfer for the request token and checks it
+// was sent to the current user's email address
+func (ctrl *StoreTransferController) openTransfer(c *gin.Context) (*models.User, *models.StoreTransfer, bool) {
+	user, ok := ctrl.currentUser(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	var req models.StoreTransferResponseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+
+	var transfer models.StoreTransfer
+	if err := ctrl.db.Where("token_hash = ?", utils.HashToken(req.Token)).First(&transfer).Error; err != nil || !transfer.IsOpen() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired transfer"})
+		return nil, nil, false
+	}
+	if !strings.EqualFold(transfer.ToEmail, user.Email) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This transfer was sent to a different email address"})
+		return nil, nil, false
+	}
+
+	return user, &transfer, true
+}
+
+func (ctrl *StoreTransferController) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := ctrl.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// notifySender tells the previous owner how the transfer ended. Failures are
+// only logged.
+func (ctrl *StoreTransferController) notifySender(c *gin.Context, transfer *models.StoreTransfer, store *models.Store, body string) {
+	var sender models.User
+	if err := ctrl.db.First(&sender, transfer.FromUserID).Error; err != nil {
+		return
+	}
+	err := ctrl.mailer.Send(c.Request.Context(), mail.Message{
+		To:      sender.Email,
+		Subject: "Transfer of " + store.Name,
+		Body:    "Hi " + sender.FirstName + ",\n\n" + body + "\n",
+	})
+	if err != nil {
+		log.Printf("Failed to notify user %d about transfer %d: %v", sender.ID, transfer.ID, err)
+	}
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"storemaker-backend/models"
+	"storemaker-backend/plans"
+	"storemaker-backend/trash"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TrashController struct {
+	db     *gorm.DB
+	purger *trash.Purger
+}
+
+func NewTrashController(db *gorm.DB, purger *trash.Purger) *TrashController {
+	return &TrashController{db: db, purger: purger}
+}
+
+// GetTrash lists the current user's deleted stores with when each will be purged
+func (ctrl *TrashController) GetTrash(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	var stores []models.Store
+	if err := ctrl.db.Unscoped().Where("owner_id = ? AND deleted_at IS NOT NULL", userID).
+		Order("deleted_at DESC").Find(&stores).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deleted stores"})
+		return
+	}
+
+	data := make([]gin.H, 0, len(stores))
+	for i := range stores {
+		data = append(data, ctrl.trashedStoreResponse(&stores[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// RestoreStore takes a store out of the trash with the content deleted with it
+func (ctrl *TrashController) RestoreStore(c *gin.Context) {
+	db := ctrl.db.WithContext(c.Request.Context())
+
+	store, ok := ctrl.trashedStore(c)
+	if !ok {
+		return
+	}
+
+	plan, ok := userPlan(db, c, store.OwnerID)
+	if !ok {
+		return
+	}
+	if !planAllows(c, plans.CheckStores(db, plan, store.OwnerID, 1)) {
+		return
+	}
+
+	if err := trash.Restore(db, store, ctrl.purger.Retention()); err != nil {
+		if err == trash.ErrRetentionExpired {
+			c.JSON(http.StatusGone, gin.H{"error": "Store can no longer be restored"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore store"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Store restored successfully",
+		"store":   store,
+	})
+}
+
+// PurgeStore permanently deletes a store in the trash without waiting for
+// the retention window
+func (ctrl *TrashController) PurgeStore(c *gin.Context) {
+	store, ok := ctrl.trashedStore(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.purger.Purge(c.Request.Context(), store); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete store permanently"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Store deleted permanently"})
+}
+
+// trashedStore loads the deleted :id store and checks it belongs to the current user
+func (ctrl *TrashController) trashedStore(c *gin.Context) (*models.Store, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return nil, false
+	}
+
+	storeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		return nil, false
+	}
+
+	var store models.Store
+	if err := ctrl.db.Unscoped().Where("id = ? AND owner_id = ? AND deleted_at IS NOT NULL", storeID, userID).First(&store).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found in trash"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store"})
+		}
+		return nil, false
+	}
+
+	return &store, true
+}
+
+func (ctrl *TrashController) trashedStoreResponse(store *models.Store) gin.H {
+	return gin.H{
+		"store":      store,
+		"deleted_at": store.DeletedAt.Time,
+		"purge_at":   trash.PurgeAt(store, ctrl.purger.Retention()),
+	}
+}
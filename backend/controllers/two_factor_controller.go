@@ -0,0 +1,478 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"storemaker-backend/middleware"
+	"storemaker-backend/models"
+	"storemaker-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+type TwoFactorController struct {
+	db      *gorm.DB
+	limiter *utils.LoginLimiter
+}
+
+func NewTwoFactorController(db *gorm.DB, limiter *utils.LoginLimiter) *TwoFactorController {
+	return &TwoFactorController{db: db, limiter: limiter}
+}
+
+// Enroll generates a new TOTP secret for the current user. 2FA is not active
+// until the user confirms a code through Enable.
+func (ctrl *TwoFactorController) Enroll(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	var user models.User
+	if err := ctrl.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	enrollment, err := ctrl.beginEnrollment(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Enable confirms enrollment with a valid code and returns the recovery codes.
+// The plain recovery codes are only ever shown in this response.
+func (ctrl *TwoFactorController) Enable(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := ctrl.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	codes, status, err := ctrl.confirmEnrollment(&user, req.Code)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// Disable turns 2FA off after re-checking the password and a current code
+func (ctrl *TwoFactorController) Disable(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	var req models.TwoFactorDisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := ctrl.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if user.Role == models.RoleAdmin {
+		policy, err := loadSecurityPolicy(ctrl.db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load security policy"})
+			return
+		}
+		if policy.RequireAdminTwoFactor {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for admin accounts"})
+			return
+		}
+	}
+
+	if err := utils.CheckPassword(user.Password, req.Password); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	if !verifySecondFactor(ctrl.db, &user, req.Code, "") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	err := ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"two_factor_enabled":   false,
+			"two_factor_secret":    "",
+			"two_factor_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a current code
+func (ctrl *TwoFactorController) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := ctrl.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if !verifySecondFactor(ctrl.db, &user, req.Code, "") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	codes, err := issueRecoveryCodes(ctrl.db, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// VerifyLogin completes the second login step with a TOTP or recovery code
+func (ctrl *TwoFactorController) VerifyLogin(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A code or recovery code is required"})
+		return
+	}
+
+	claims, err := middleware.ParseTwoFactorToken(req.TwoFactorToken, middleware.TwoFactorPurposeVerify)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired two-factor token"})
+		return
+	}
+
+	if !reserveLoginAttempt(ctrl.db, ctrl.limiter, c, claims.Email) {
+		return
+	}
+
+	var user models.User
+	if err := ctrl.db.Where("id = ? AND is_active = ?", claims.UserID, true).First(&user).Error; err != nil {
+		// The account was deactivated or removed after the password step
+		recordLoginFailure(ctrl.db, c, claims.Email, nil, "unknown_account")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !user.TwoFactorEnabled || !verifySecondFactor(ctrl.db, &user, req.Code, req.RecoveryCode) {
+		recordLoginFailure(ctrl.db, c, user.Email, &user.ID, "invalid_two_factor_code")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	method := "totp"
+	if req.Code == "" {
+		method = "recovery_code"
+	}
+	recordLoginSuccess(ctrl.db, ctrl.limiter, c, &user, method)
+	respondWithTokens(c, &user, http.StatusOK, gin.H{"message": "Login successful"})
+}
+
+// BeginSetup starts forced enrollment for an admin whose login was blocked by policy
+func (ctrl *TwoFactorController) BeginSetup(c *gin.Context) {
+	var req models.TwoFactorSetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := ctrl.setupUser(c, req.TwoFactorToken)
+	if !ok {
+		return
+	}
+
+	enrollment, err := ctrl.beginEnrollment(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmSetup finishes forced enrollment and logs the user in
+func (ctrl *TwoFactorController) ConfirmSetup(c *gin.Context) {
+	var req models.TwoFactorSetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+		return
+	}
+
+	user, ok := ctrl.setupUser(c, req.TwoFactorToken)
+	if !ok {
+		return
+	}
+
+	if !reserveLoginAttempt(ctrl.db, ctrl.limiter, c, user.Email) {
+		return
+	}
+
+	codes, status, err := ctrl.confirmEnrollment(user, req.Code)
+	if err != nil {
+		if status == http.StatusUnauthorized {
+			recordLoginFailure(ctrl.db, c, user.Email, &user.ID, "invalid_two_factor_code")
+		} else {
+			releaseLoginAttempt(ctrl.limiter, c, user.Email)
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordLoginSuccess(ctrl.db, ctrl.limiter, c, user, "totp_setup")
+	respondWithTokens(c, user, http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// GetSecurityPolicy returns the platform security policy (admin only)
+func (ctrl *TwoFactorController) GetSecurityPolicy(c *gin.Context) {
+	policy, err := loadSecurityPolicy(ctrl.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load security policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpdateSecurityPolicy updates the platform security policy (admin only)
+func (ctrl *TwoFactorController) UpdateSecurityPolicy(c *gin.Context) {
+	var req models.SecurityPolicyUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := loadSecurityPolicy(ctrl.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load security policy"})
+		return
+	}
+
+	if req.RequireAdminTwoFactor != nil {
+		policy.RequireAdminTwoFactor = *req.RequireAdminTwoFactor
+	}
+
+	if err := ctrl.db.Save(policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update security policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// setupUser resolves the admin behind a pending setup token and checks that
+// forced enrollment still applies
+func (ctrl *TwoFactorController) setupUser(c *gin.Context, tokenString string) (*models.User, bool) {
+	claims, err := middleware.ParseTwoFactorToken(tokenString, middleware.TwoFactorPurposeSetup)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired two-factor token"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := ctrl.db.Where("id = ? AND is_active = ?", claims.UserID, true).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return nil, false
+	}
+
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return nil, false
+	}
+
+	return &user, true
+}
+
+func (ctrl *TwoFactorController) beginEnrollment(user *models.User) (*models.TwoFactorEnrollmentResponse, error) {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctrl.db.Model(user).Updates(map[string]interface{}{
+		"two_factor_secret":    secret,
+		"two_factor_last_step": 0,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	issuer := utils.GetEnv("TOTP_ISSUER", "StoreMaker")
+	return &models.TwoFactorEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(issuer, user.Email, secret),
+	}, nil
+}
+
+// confirmEnrollment verifies the first code from the authenticator app, turns
+// 2FA on and issues fresh recovery codes. The returned status is only
+// meaningful when err is non-nil.
+func (ctrl *TwoFactorController) confirmEnrollment(user *models.User, code string) ([]string, int, error) {
+	if user.TwoFactorEnabled {
+		return nil, http.StatusConflict, errors.New("Two-factor authentication is already enabled")
+	}
+	if user.TwoFactorSecret == "" {
+		return nil, http.StatusBadRequest, errors.New("Two-factor enrollment has not been started")
+	}
+
+	step, ok := utils.ValidateTOTPCode(user.TwoFactorSecret, code, time.Now())
+	if !ok {
+		return nil, http.StatusUnauthorized, errors.New("Invalid two-factor code")
+	}
+
+	var codes []string
+	err := ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"two_factor_enabled":   true,
+			"two_factor_last_step": step,
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = issueRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("Failed to enable two-factor authentication")
+	}
+
+	return codes, http.StatusOK, nil
+}
+
+// verifySecondFactor checks a TOTP code, or failing that a recovery code.
+// Each TOTP time step and each recovery code can only be used once.
+func verifySecondFactor(db *gorm.DB, user *models.User, code, recoveryCode string) bool {
+	if code != "" {
+		step, ok := utils.ValidateTOTPCode(user.TwoFactorSecret, code, time.Now())
+		if !ok {
+			return false
+		}
+		result := db.Model(&models.User{}).
+			Where("id = ? AND two_factor_last_step < ?", user.ID, step).
+			Update("two_factor_last_step", step)
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	if recoveryCode != "" {
+		hash := utils.HashToken(strings.ToLower(recoveryCode))
+		var stored models.RecoveryCode
+		if err := db.Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hash).First(&stored).Error; err != nil {
+			return false
+		}
+		result := db.Model(&models.RecoveryCode{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", time.Now())
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	return false
+}
+
+// issueRecoveryCodes replaces the user's recovery codes and returns the plain codes
+func issueRecoveryCodes(db *gorm.DB, userID uint) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	records := make([]models.RecoveryCode, 0, len(codes))
+	for _, code := range codes {
+		records = append(records, models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(code),
+		})
+	}
+	if err := db.Create(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// loadSecurityPolicy returns the single platform policy row, creating it if needed
+func loadSecurityPolicy(db *gorm.DB) (*models.SecurityPolicy, error) {
+	var policy models.SecurityPolicy
+	if err := db.FirstOrCreate(&policy, models.SecurityPolicy{ID: 1}).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
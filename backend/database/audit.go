@@ -0,0 +1,334 @@
+package database
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+
+	"storemaker-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// auditedTables maps the tables whose changes are written to the audit log to
+// the entity type recorded for them
+var auditedTables = map[string]string{
+	"stores":                 "store",
+	"store_settings":         "store_settings",
+	"store_themes":           "store_theme",
+	"store_layouts":          "store_layout",
+	"pages":                  "page",
+	"products":               "product",
+	"product_variants":       "product_variant",
+	"categories":             "category",
+	"orders":                 "order",
+	"api_keys":               "api_key",
+	"store_domains":          "store_domain",
+	"store_preview_tokens":   "preview_token",
+	"store_layout_revisions": "layout_revision",
+	"store_access_policies":  "store_access",
+	"store_transfers":        "store_transfer",
+	"plans":                  "plan",
+}
+
+// auditRedactedColumns are never copied into audit entries
+var auditRedactedColumns = map[string]bool{
+	"key_hash":             true,
+	"token_hash":           true,
+	"password":             true,
+	"password_hash":        true,
+	"two_factor_secret":    true,
+	"two_factor_last_step": true,
+}
+
+// auditIgnoredColumns change on every write or use and are left out of diffs
+var auditIgnoredColumns = map[string]bool{
+	"updated_at":   true,
+	"last_used_at": true,
+}
+
+// auditMaxRows bounds how many rows a single bulk statement records
+const auditMaxRows = 200
+
+const auditBeforeKey = "audit:before"
+
+// RegisterAuditCallbacks records creates, updates and deletes on audited
+// tables. The actor is taken from the statement context, so handlers must use
+// db.WithContext(c.Request.Context()) for their writes to be attributed.
+// Entries are written on the statement's connection, so they roll back with
+// the transaction they belong to.
+func RegisterAuditCallbacks(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("audit:after_create", auditAfterCreate); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("audit:before_update", auditCaptureBefore); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("audit:after_update", auditAfterUpdate); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("audit:before_delete", auditCaptureBefore); err != nil {
+		return err
+	}
+	return callbacks.Delete().After("gorm:delete").Register("audit:after_delete", auditAfterDelete)
+}
+
+func auditEntityType(db *gorm.DB) (string, bool) {
+	if db.Statement.Schema == nil || db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return "", false
+	}
+	entityType, ok := auditedTables[db.Statement.Schema.Table]
+	return entityType, ok
+}
+
+func auditAfterCreate(db *gorm.DB) {
+	entityType, ok := auditEntityType(db)
+	if !ok || db.Error != nil {
+		return
+	}
+
+	ids := auditPrimaryKeys(db)
+	if len(ids) == 0 {
+		return
+	}
+	for _, row := range auditLoadRows(db, ids) {
+		auditWrite(db, entityType, models.AuditOperationCreate, row, nil, auditClean(row))
+	}
+}
+
+// auditCaptureBefore snapshots the rows an update or delete is about to touch
+func auditCaptureBefore(db *gorm.DB) {
+	if _, ok := auditEntityType(db); !ok || db.Error != nil {
+		return
+	}
+
+	stmt := db.Statement
+	query := auditModel(db)
+	if stmt.Unscoped {
+		query = query.Unscoped()
+	}
+	hasCondition := false
+
+	if where, ok := stmt.Clauses["WHERE"]; ok {
+		if expr, ok := where.Expression.(clause.Where); ok && len(expr.Exprs) > 0 {
+			query = query.Clauses(expr)
+			hasCondition = true
+		}
+	}
+	if ids := auditPrimaryKeys(db); len(ids) > 0 {
+		query = query.Where(clause.IN{Column: clause.Column{Name: stmt.Schema.PrioritizedPrimaryField.DBName}, Values: ids})
+		hasCondition = true
+	}
+	// Statements without conditions are rejected by gorm anyway
+	if !hasCondition {
+		return
+	}
+	var rows []map[string]interface{}
+	if err := query.Limit(auditMaxRows).Find(&rows).Error; err != nil {
+		log.Printf("Failed to capture audit snapshot for %s: %v", stmt.Schema.Table, err)
+		return
+	}
+	db.InstanceSet(auditBeforeKey, rows)
+}
+
+func auditAfterUpdate(db *gorm.DB) {
+	entityType, ok := auditEntityType(db)
+	if !ok || db.Error != nil {
+		return
+	}
+	before := auditBeforeRows(db)
+	if len(before) == 0 {
+		return
+	}
+
+	pk := db.Statement.Schema.PrioritizedPrimaryField.DBName
+	ids := make([]interface{}, 0, len(before))
+	for _, row := range before {
+		ids = append(ids, row[pk])
+	}
+	after := make(map[string]map[string]interface{})
+	for _, row := range auditLoadRows(db, ids) {
+		after[auditKey(row[pk])] = row
+	}
+
+	for _, row := range before {
+		oldValues, newValues := auditDiff(row, after[auditKey(row[pk])])
+		if len(newValues) == 0 && len(oldValues) == 0 {
+			continue
+		}
+		auditWrite(db, entityType, models.AuditOperationUpdate, row, oldValues, newValues)
+	}
+}
+
+func auditAfterDelete(db *gorm.DB) {
+	entityType, ok := auditEntityType(db)
+	if !ok || db.Error != nil {
+		return
+	}
+	for _, row := range auditBeforeRows(db) {
+		auditWrite(db, entityType, models.AuditOperationDelete, row, auditClean(row), nil)
+	}
+}
+
+// auditWrite appends one entry for row, whose columns give the entity and store IDs
+func auditWrite(db *gorm.DB, entityType, operation string, row, before, after map[string]interface{}) {
+	entry := models.AuditLog{
+		EntityType: entityType,
+		Action:     models.EntityAuditAction(entityType, operation),
+		Before:     before,
+		After:      after,
+	}
+	if id, ok := auditUint(row[db.Statement.Schema.PrioritizedPrimaryField.DBName]); ok {
+		entry.EntityID = &id
+	}
+	storeColumn := "store_id"
+	if entityType == "store" {
+		storeColumn = "id"
+	}
+	if storeID, ok := auditUint(row[storeColumn]); ok {
+		entry.StoreID = &storeID
+	}
+
+	if actor, ok := models.AuditActorFromContext(db.Statement.Context); ok {
+		entry.ActorID = actor.UserID
+		entry.ActorEmail = actor.Email
+		entry.ImpersonatorID = actor.ImpersonatorID
+		entry.IPAddress = actor.IPAddress
+		entry.UserAgent = actor.UserAgent
+		entry.Metadata = models.AuditMetadata{"method": actor.Method, "path": actor.Path}
+	}
+
+	if err := auditSession(db).Create(&entry).Error; err != nil {
+		log.Printf("Failed to record audit entry %s: %v", entry.Action, err)
+	}
+}
+
+// auditSession starts a fresh statement on the same connection (and therefore
+// the same transaction) without triggering hooks
+func auditSession(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+}
+
+// auditModel starts a query on the statement's model, so primary key and soft
+// delete clauses resolve as they do for the statement itself
+func auditModel(db *gorm.DB) *gorm.DB {
+	return auditSession(db).Model(reflect.New(db.Statement.Schema.ModelType).Interface())
+}
+
+func auditLoadRows(db *gorm.DB, ids []interface{}) []map[string]interface{} {
+	pk := db.Statement.Schema.PrioritizedPrimaryField.DBName
+	var rows []map[string]interface{}
+	if err := auditModel(db).Unscoped().Where(clause.IN{Column: clause.Column{Name: pk}, Values: ids}).Limit(auditMaxRows).Find(&rows).Error; err != nil {
+		log.Printf("Failed to load audit snapshot for %s: %v", db.Statement.Schema.Table, err)
+		return nil
+	}
+	return rows
+}
+
+func auditBeforeRows(db *gorm.DB) []map[string]interface{} {
+	value, ok := db.InstanceGet(auditBeforeKey)
+	if !ok {
+		return nil
+	}
+	rows, _ := value.([]map[string]interface{})
+	return rows
+}
+
+// auditPrimaryKeys returns the non-zero primary keys of the statement's model
+func auditPrimaryKeys(db *gorm.DB) []interface{} {
+	stmt := db.Statement
+	field := stmt.Schema.PrioritizedPrimaryField
+	reflectValue := stmt.ReflectValue
+
+	var ids []interface{}
+	switch reflectValue.Kind() {
+	case reflect.Struct:
+		if value, isZero := field.ValueOf(stmt.Context, reflectValue); !isZero {
+			ids = append(ids, value)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < reflectValue.Len() && len(ids) < auditMaxRows; i++ {
+			element := reflect.Indirect(reflectValue.Index(i))
+			if element.Kind() != reflect.Struct {
+				continue
+			}
+			if value, isZero := field.ValueOf(stmt.Context, element); !isZero {
+				ids = append(ids, value)
+			}
+		}
+	}
+	return ids
+}
+
+// auditDiff returns the old and new values of the columns that changed
+func auditDiff(before, after map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	oldValues := make(map[string]interface{})
+	newValues := make(map[string]interface{})
+	for column, oldValue := range before {
+		if auditRedactedColumns[column] || auditIgnoredColumns[column] {
+			continue
+		}
+		newValue := after[column]
+		if auditKey(oldValue) != auditKey(newValue) {
+			oldValues[column] = auditValue(oldValue)
+			newValues[column] = auditValue(newValue)
+		}
+	}
+	return oldValues, newValues
+}
+
+// auditClean drops redacted columns and decodes JSON columns of a full row
+func auditClean(row map[string]interface{}) map[string]interface{} {
+	cleaned := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		if auditRedactedColumns[column] {
+			continue
+		}
+		cleaned[column] = auditValue(value)
+	}
+	return cleaned
+}
+
+// auditValue makes raw column values JSON-friendly; jsonb columns come back as
+// bytes or strings holding JSON
+func auditValue(value interface{}) interface{} {
+	var raw []byte
+	switch v := value.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return value
+	}
+	var decoded interface{}
+	if (len(raw) > 0 && (raw[0] == '{' || raw[0] == '[')) && json.Unmarshal(raw, &decoded) == nil {
+		return decoded
+	}
+	return string(raw)
+}
+
+func auditKey(value interface{}) string {
+	encoded, _ := json.Marshal(auditValue(value))
+	return string(encoded)
+}
+
+func auditUint(value interface{}) (uint, bool) {
+	switch v := value.(type) {
+	case int64:
+		return uint(v), v > 0
+	case int32:
+		return uint(v), v > 0
+	case int:
+		return uint(v), v > 0
+	case uint:
+		return v, v > 0
+	case uint32:
+		return uint(v), v > 0
+	case uint64:
+		return uint(v), v > 0
+	}
+	return 0, false
+}
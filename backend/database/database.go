@@ -4,16 +4,14 @@ import (
 	"log"
 
 	"storemaker-backend/models"
+	"storemaker-backend/plans"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
-<<<<<<< HEAD
 
-=======
 // initialize database
->>>>>>> url/main
 func Initialize(databaseURL string) (*gorm.DB, error) {
 	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
@@ -22,6 +20,10 @@ func Initialize(databaseURL string) (*gorm.DB, error) {
 		return nil, err
 	}
 
+	if err := RegisterAuditCallbacks(db); err != nil {
+		return nil, err
+	}
+
 	log.Println("Database connection established")
 	return db, nil
 }
@@ -29,11 +31,17 @@ func Initialize(databaseURL string) (*gorm.DB, error) {
 func RunMigrations(db *gorm.DB) error {
 	log.Println("Running database migrations...")
 
+	if err := prepareVariantMigration(db); err != nil {
+		return err
+	}
+	layoutsPublished := hasLayoutRevisions(db)
+
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.Store{},
 		&models.Template{},
 		&models.Product{},
+		&models.ProductVariant{},
 		&models.Category{},
 		&models.Order{},
 		&models.OrderItem{},
@@ -43,17 +51,58 @@ func RunMigrations(db *gorm.DB) error {
 		&models.Section{},
 		&models.Component{},
 		&models.NewsletterSubscription{},
-<<<<<<< HEAD
-=======
+		&models.RecoveryCode{},
+		&models.SecurityPolicy{},
+		&models.AuditLog{},
+		&models.APIKey{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
+		&models.ImpersonationSession{},
+		&models.StoreDomain{},
+		&models.StorePreviewToken{},
+		&models.StoreLayoutRevision{},
+		&models.StoreAccessPolicy{},
+		&models.Job{},
+		&models.StoreTransfer{},
+		&models.Plan{},
+		&models.StoreUpload{},
+		&models.Media{},
+		&models.Review{},
+		&models.ProductRecommendation{},
+		&models.ProductRecommendationOverride{},
+		&models.AICreditUsage{},
 		&models.StoreLayout{},
 		&models.StoreLayoutComponent{},
->>>>>>> url/main
 	)
 
 	if err != nil {
 		return err
 	}
 
+	// The old "inactive" status maps onto the lifecycle as an unpublished draft
+	if err := db.Model(&models.Store{}).Where("status = ?", models.StoreStatusInactive).
+		Update("status", models.StoreStatusDraft).Error; err != nil {
+		return err
+	}
+
+	if err := migrateLegacyVariants(db); err != nil {
+		return err
+	}
+
+	if !layoutsPublished {
+		if err := publishExistingLayouts(db); err != nil {
+			return err
+		}
+	}
+
+	if err := setupProductSearch(db); err != nil {
+		return err
+	}
+
+	if err := plans.Seed(db); err != nil {
+		return err
+	}
+
 	log.Println("Migrations completed successfully")
 	return nil
 }
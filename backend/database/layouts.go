@@ -0,0 +1,71 @@
+package database
+
+import (
+	"log"
+	"strconv"
+
+	"storemaker-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// hasLayoutRevisions reports whether layouts are published as revisions yet
+func hasLayoutRevisions(db *gorm.DB) bool {
+	return db.Migrator().HasTable(&models.StoreLayoutRevision{})
+}
+
+// publishExistingLayouts publishes every saved layout as its store's first
+// revision. Layouts were served publicly before revisions existed, so this
+// keeps those storefronts unchanged; it runs once, when the revisions table
+// is created.
+func publishExistingLayouts(db *gorm.DB) error {
+	published := 0
+	var batch []models.StoreLayout
+	err := db.Preload("Components", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order(`"order", id`)
+	}).Order("id").FindInBatches(&batch, 100, func(tx *gorm.DB, _ int) error {
+		storeIDs := make([]uint, 0, len(batch))
+		for _, layout := range batch {
+			storeIDs = append(storeIDs, layout.StoreID)
+		}
+		var stores []models.Store
+		if err := tx.Unscoped().Select("id", "owner_id").Where("id IN ?", storeIDs).Find(&stores).Error; err != nil {
+			return err
+		}
+		owners := make(map[uint]uint, len(stores))
+		for _, store := range stores {
+			owners[store.ID] = store.OwnerID
+		}
+
+		revisions := make([]models.StoreLayoutRevision, 0, len(batch))
+		for _, layout := range batch {
+			components := make(models.LayoutComponents, 0, len(layout.Components))
+			for _, comp := range layout.Components {
+				components = append(components, models.LayoutComponent{
+					ID:    strconv.FormatUint(uint64(comp.ID), 10),
+					Type:  comp.Type,
+					Props: comp.Props,
+					Order: comp.Order,
+				})
+			}
+			revisions = append(revisions, models.StoreLayoutRevision{
+				StoreID:       layout.StoreID,
+				Components:    components,
+				PublishedByID: owners[layout.StoreID],
+			})
+		}
+		if len(revisions) == 0 {
+			return nil
+		}
+		published += len(revisions)
+		return db.Create(&revisions).Error
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	if published > 0 {
+		log.Printf("Published the saved layouts of %d stores", published)
+	}
+	return nil
+}
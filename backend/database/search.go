@@ -0,0 +1,97 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// productSearchStatements maintain products.search_vector. The vector weighs
+// the name and SKUs (the product's and its variants') highest, then the
+// names of the product's category and its ancestors, then the short
+// description and finally the description. Triggers keep it current when a
+// product, its variants or its categories change.
+var productSearchStatements = []string{
+	`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+	`CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)`,
+
+	`CREATE OR REPLACE FUNCTION product_search_vector(p products) RETURNS tsvector
+	LANGUAGE sql STABLE AS $$
+		SELECT
+			setweight(to_tsvector('simple', coalesce(p.name, '')), 'A') ||
+			setweight(to_tsvector('simple', coalesce(p.sku, '') || ' ' || coalesce((
+				SELECT string_agg(v.sku, ' ') FROM product_variants v
+				WHERE v.product_id = p.id AND v.deleted_at IS NULL
+			), '')), 'A') ||
+			setweight(to_tsvector('simple', coalesce((
+				WITH RECURSIVE ancestors AS (
+					SELECT c.id, c.parent_id, c.name, 1 AS depth FROM categories c
+					WHERE c.id = p.category_id AND c.deleted_at IS NULL
+					UNION ALL
+					SELECT c.id, c.parent_id, c.name, a.depth + 1 FROM categories c
+					JOIN ancestors a ON c.id = a.parent_id
+					WHERE c.deleted_at IS NULL AND a.depth < 20
+				)
+				SELECT string_agg(name, ' ') FROM ancestors
+			), '')), 'B') ||
+			setweight(to_tsvector('simple', coalesce(p.short_desc, '')), 'C') ||
+			setweight(to_tsvector('simple', coalesce(p.description, '')), 'D')
+	$$`,
+
+	`CREATE OR REPLACE FUNCTION products_search_vector_trigger() RETURNS trigger
+	LANGUAGE plpgsql AS $$
+	BEGIN
+		NEW.search_vector := product_search_vector(NEW);
+		RETURN NEW;
+	END
+	$$`,
+	`DROP TRIGGER IF EXISTS products_search_vector_update ON products`,
+	`CREATE TRIGGER products_search_vector_update
+		BEFORE INSERT OR UPDATE OF name, short_desc, description, sku, category_id ON products
+		FOR EACH ROW EXECUTE FUNCTION products_search_vector_trigger()`,
+
+	// Touching category_id recomputes the vectors of products in the subtree
+	`CREATE OR REPLACE FUNCTION categories_search_vector_trigger() RETURNS trigger
+	LANGUAGE plpgsql AS $$
+	BEGIN
+		WITH RECURSIVE subtree AS (
+			SELECT NEW.id AS id, 1 AS depth
+			UNION ALL
+			SELECT c.id, s.depth + 1 FROM categories c
+			JOIN subtree s ON c.parent_id = s.id
+			WHERE s.depth < 20
+		)
+		UPDATE products SET category_id = category_id WHERE category_id IN (SELECT id FROM subtree);
+		RETURN NULL;
+	END
+	$$`,
+	`DROP TRIGGER IF EXISTS categories_search_vector_update ON categories`,
+	`CREATE TRIGGER categories_search_vector_update
+		AFTER UPDATE OF name, parent_id, deleted_at ON categories
+		FOR EACH ROW
+		WHEN (OLD.name IS DISTINCT FROM NEW.name OR OLD.parent_id IS DISTINCT FROM NEW.parent_id OR OLD.deleted_at IS DISTINCT FROM NEW.deleted_at)
+		EXECUTE FUNCTION categories_search_vector_trigger()`,
+
+	`CREATE OR REPLACE FUNCTION product_variants_search_vector_trigger() RETURNS trigger
+	LANGUAGE plpgsql AS $$
+	BEGIN
+		UPDATE products SET sku = sku WHERE id = COALESCE(NEW.product_id, OLD.product_id);
+		RETURN NULL;
+	END
+	$$`,
+	`DROP TRIGGER IF EXISTS product_variants_search_vector_update ON product_variants`,
+	`CREATE TRIGGER product_variants_search_vector_update
+		AFTER INSERT OR DELETE OR UPDATE OF sku, deleted_at ON product_variants
+		FOR EACH ROW EXECUTE FUNCTION product_variants_search_vector_trigger()`,
+
+	`UPDATE products SET search_vector = product_search_vector(products) WHERE search_vector IS NULL`,
+}
+
+// setupProductSearch creates the product search column, index and triggers
+// and fills in vectors for products that have none
+func setupProductSearch(db *gorm.DB) error {
+	for _, statement := range productSearchStatements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"storemaker-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// legacyVariant is a variant as stored in the old products.variants column
+type legacyVariant struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Price   float64           `json:"price"`
+	SKU     string            `json:"sku"`
+	Stock   int               `json:"stock"`
+	Image   string            `json:"image"`
+	Options map[string]string `json:"options"`
+}
+
+type legacyVariants []legacyVariant
+
+func (lv legacyVariants) Value() (driver.Value, error) {
+	return json.Marshal(lv)
+}
+
+func (lv *legacyVariants) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, lv)
+	case string:
+		return json.Unmarshal([]byte(v), lv)
+	}
+	return nil
+}
+
+type legacyProduct struct {
+	ID        uint
+	StoreID   uint
+	Variants  legacyVariants
+	DeletedAt gorm.DeletedAt
+}
+
+// hasLegacyVariants reports whether variants still live in products.variants
+func hasLegacyVariants(db *gorm.DB) bool {
+	return db.Migrator().HasColumn("products", "variants")
+}
+
+// prepareVariantMigration moves the old string order_items.variant_id out of
+// the way, so AutoMigrate can add the new foreign key column
+func prepareVariantMigration(db *gorm.DB) error {
+	if !hasLegacyVariants(db) || !db.Migrator().HasColumn("order_items", "variant_id") ||
+		db.Migrator().HasColumn("order_items", "legacy_variant_id") {
+		return nil
+	}
+	return db.Migrator().RenameColumn("order_items", "variant_id", "legacy_variant_id")
+}
+
+// migrateLegacyVariants copies variants from products.variants into the
+// product_variants table, points order items at the new rows and drops the
+// old column. Variants and order items keep the old string ID in legacy_id
+// and legacy_variant_id.
+func migrateLegacyVariants(db *gorm.DB) error {
+	if !hasLegacyVariants(db) {
+		return nil
+	}
+	log.Println("Migrating product variants out of products.variants...")
+
+	hasLegacyOrderItems := db.Migrator().HasColumn("order_items", "legacy_variant_id")
+	migrated := 0
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// SKUs already taken in each store, to keep the unique index happy
+		usedSKUs := make(map[uint]map[string]bool)
+
+		var batch []legacyProduct
+		err := tx.Unscoped().Table("products").Select("id", "store_id", "variants", "deleted_at").
+			Where("variants IS NOT NULL AND jsonb_typeof(variants) = 'array' AND jsonb_array_length(variants) > 0").
+			Order("id").
+			FindInBatches(&batch, 100, func(_ *gorm.DB, _ int) error {
+				for _, product := range batch {
+					if usedSKUs[product.StoreID] == nil {
+						usedSKUs[product.StoreID] = make(map[string]bool)
+					}
+
+					for position, legacy := range product.Variants {
+						variant := models.ProductVariant{
+							LegacyID:  legacy.ID,
+							ProductID: product.ID,
+							StoreID:   product.StoreID,
+							Name:      legacy.Name,
+							Price:     legacy.Price,
+							SKU:       legacy.SKU,
+							Stock:     legacy.Stock,
+							Image:     legacy.Image,
+							Options:   models.VariantOptions(legacy.Options),
+							Position:  position,
+							// Variants of deleted products are deleted with them
+							DeletedAt: product.DeletedAt,
+						}
+						if variant.Options == nil {
+							variant.Options = models.VariantOptions{}
+						}
+						if variant.SKU != "" && !variant.DeletedAt.Valid {
+							variant.SKU = freeSKU(usedSKUs[product.StoreID], variant.SKU, product.ID)
+							usedSKUs[product.StoreID][variant.SKU] = true
+						}
+
+						if err := tx.Create(&variant).Error; err != nil {
+							return err
+						}
+						migrated++
+
+						if hasLegacyOrderItems && legacy.ID != "" {
+							if err := tx.Table("order_items").
+								Where("product_id = ? AND legacy_variant_id = ?", product.ID, legacy.ID).
+								Update("variant_id", variant.ID).Error; err != nil {
+								return err
+							}
+						}
+					}
+				}
+				return nil
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Migrator().DropColumn("products", "variants")
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Migrated %d product variants", migrated)
+	return nil
+}
+
+// freeSKU returns sku, or sku with a numeric suffix when the store already
+// uses it
+func freeSKU(used map[string]bool, sku string, productID uint) string {
+	if !used[sku] {
+		return sku
+	}
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d", sku, i)
+		if !used[candidate] {
+			log.Printf("Variant SKU %s of product %d is a duplicate; renamed to %s", sku, productID, candidate)
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"storemaker-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ChallengePrefix is the label the TXT challenge record is published under
+const ChallengePrefix = "_storemaker-challenge"
+
+// challengeValuePrefix precedes the token in the TXT record value
+const challengeValuePrefix = "storemaker-verification="
+
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// Resolver looks up TXT records. Tests can substitute an in-process fake.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// NetResolver resolves through the system DNS configuration
+type NetResolver struct {
+	Resolver *net.Resolver
+}
+
+func (r NetResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return resolver.LookupTXT(ctx, name)
+}
+
+// ErrRecordNotFound is returned by resolvers when the name has no TXT records
+var ErrRecordNotFound = errors.New("no TXT record found")
+
+// ChallengeRecordName is the DNS name the merchant publishes the TXT record at
+func ChallengeRecordName(domain string) string {
+	return ChallengePrefix + "." + domain
+}
+
+// ChallengeRecordValue is the TXT record value proving control of the domain
+func ChallengeRecordValue(token string) string {
+	return challengeValuePrefix + token
+}
+
+// NormalizeDomain lowercases a domain and strips a scheme, path, port and
+// trailing dot. It returns an error if the result is not a valid hostname.
+func NormalizeDomain(raw string) (string, error) {
+	domain := strings.ToLower(strings.TrimSpace(raw))
+	domain = strings.TrimPrefix(strings.TrimPrefix(domain, "https://"), "http://")
+	if i := strings.IndexAny(domain, "/?#"); i >= 0 {
+		domain = domain[:i]
+	}
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		domain = host
+	}
+	domain = strings.TrimSuffix(domain, ".")
+
+	if len(domain) > 253 || !hostnamePattern.MatchString(domain) {
+		return "", errors.New("invalid domain name")
+	}
+	return domain, nil
+}
+
+// VerifierConfig controls how often claims are rechecked
+type VerifierConfig struct {
+	// PendingInterval is the wait between checks of a pending claim
+	PendingInterval time.Duration
+	// PendingTimeout marks a pending claim failed when it was not verified in time
+	PendingTimeout time.Duration
+	// VerifiedInterval is the wait between rechecks of a verified claim
+	VerifiedInterval time.Duration
+	// MaxVerifiedFailures unroutes a verified domain after this many misses in a row
+	MaxVerifiedFailures int
+	// LookupTimeout bounds each DNS lookup
+	LookupTimeout time.Duration
+}
+
+// DefaultVerifierConfig returns the intervals used by the API
+func DefaultVerifierConfig() VerifierConfig {
+	return VerifierConfig{
+		PendingInterval:     5 * time.Minute,
+		PendingTimeout:      72 * time.Hour,
+		VerifiedInterval:    24 * time.Hour,
+		MaxVerifiedFailures: 3,
+		LookupTimeout:       10 * time.Second,
+	}
+}
+
+// Verifier checks domain claims against DNS and keeps the store's routed
+// domain in sync with the claim state
+type Verifier struct {
+	db         *gorm.DB
+	resolver   Resolver
+	baseDomain string
+	config     VerifierConfig
+}
+
+// NewVerifier creates a verifier. baseDomain is the platform domain stores
+// fall back to (as <subdomain>.<baseDomain>) when a custom domain is lost.
+func NewVerifier(db *gorm.DB, resolver Resolver, baseDomain string, config VerifierConfig) *Verifier {
+	return &Verifier{db: db, resolver: resolver, baseDomain: baseDomain, config: config}
+}
+
+// IsPlatformDomain reports whether domain is the base domain or one of its
+// subdomains, which cannot be claimed
+func (v *Verifier) IsPlatformDomain(domain string) bool {
+	return domain == v.baseDomain || strings.HasSuffix(domain, "."+v.baseDomain)
+}
+
+// Check looks up the challenge record for a claim and updates its state.
+// DNS errors other than a missing record leave the state unchanged and are
+// retried at the next check.
+func (v *Verifier) Check(ctx context.Context, claim *models.StoreDomain) error {
+	now := time.Now()
+	found, lookupErr := v.lookup(ctx, claim)
+
+	updates := map[string]interface{}{"last_checked_at": now}
+	claim.LastCheckedAt = &now
+
+	switch {
+	case lookupErr != nil:
+		updates["last_error"] = lookupErr.Error()
+		updates["next_check_at"] = now.Add(v.config.PendingInterval)
+
+	case found:
+		updates["consecutive_failures"] = 0
+		updates["last_error"] = ""
+		updates["next_check_at"] = now.Add(v.config.VerifiedInterval)
+		if claim.Status != models.DomainStatusVerified {
+			return v.markVerified(claim, updates, now)
+		}
+
+	default:
+		updates["consecutive_failures"] = claim.ConsecutiveFailures + 1
+		updates["last_error"] = "TXT record " + ChallengeRecordName(claim.Domain) + " not found"
+		switch claim.Status {
+		case models.DomainStatusVerified:
+			if claim.ConsecutiveFailures+1 >= v.config.MaxVerifiedFailures {
+				return v.markFailed(claim, updates)
+			}
+			updates["next_check_at"] = now.Add(v.config.PendingInterval)
+		case models.DomainStatusPending:
+			if now.Sub(claim.CreatedAt) > v.config.PendingTimeout {
+				return v.markFailed(claim, updates)
+			}
+			updates["next_check_at"] = now.Add(v.config.PendingInterval)
+		default:
+			// Failed claims are only rechecked on request
+			updates["next_check_at"] = nil
+		}
+	}
+
+	return v.db.Model(claim).Updates(updates).Error
+}
+
+// RecheckDue checks every pending or verified claim whose next check is due
+func (v *Verifier) RecheckDue(ctx context.Context) error {
+	var claims []models.StoreDomain
+	if err := v.db.Where("status IN (?, ?) AND next_check_at <= ?", models.DomainStatusPending, models.DomainStatusVerified, time.Now()).
+		Order("next_check_at").Limit(100).Find(&claims).Error; err != nil {
+		return err
+	}
+
+	for i := range claims {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := v.Check(ctx, &claims[i]); err != nil {
+			log.Printf("Failed to check domain %s: %v", claims[i].Domain, err)
+		}
+	}
+	return nil
+}
+
+// Run rechecks due claims every interval until ctx is cancelled
+func (v *Verifier) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := v.RecheckDue(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Domain recheck failed: %v", err)
+			}
+		}
+	}
+}
+
+// Release unroutes a claim's domain from its store, if it is routed there
+func (v *Verifier) Release(tx *gorm.DB, claim *models.StoreDomain) error {
+	var store models.Store
+	if err := tx.First(&store, claim.StoreID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+	if !strings.EqualFold(store.Domain, claim.Domain) {
+		return nil
+	}
+	return tx.Model(&store).Updates(map[string]interface{}{
+		"domain":             v.platformDomain(&store),
+		"domain_verified_at": nil,
+	}).Error
+}
+
+func (v *Verifier) lookup(ctx context.Context, claim *models.StoreDomain) (bool, error) {
+	lookupCtx, cancel := context.WithTimeout(ctx, v.config.LookupTimeout)
+	defer cancel()
+
+	records, err := v.resolver.LookupTXT(lookupCtx, ChallengeRecordName(claim.Domain))
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.Is(err, ErrRecordNotFound) || (errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("DNS lookup failed: %w", err)
+	}
+
+	expected := ChallengeRecordValue(claim.Token)
+	for _, record := range records {
+		if strings.TrimSpace(record) == expected {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// markVerified routes the domain to the claim's store. A domain verified by
+// another store must be released there first, and any store still holding
+// the domain without proof loses it.
+func (v *Verifier) markVerified(claim *models.StoreDomain, updates map[string]interface{}, now time.Time) error {
+	return v.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.StoreDomain{}).
+			Where("domain = ? AND status = ? AND store_id <> ?", claim.Domain, models.DomainStatusVerified, claim.StoreID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			updates["status"] = models.DomainStatusFailed
+			updates["last_error"] = "Domain is verified by another store"
+			updates["next_check_at"] = nil
+			claim.Status = models.DomainStatusFailed
+			return tx.Model(claim).Updates(updates).Error
+		}
+
+		var holders []models.Store
+		if err := tx.Where("LOWER(domain) = ? AND id <> ?", claim.Domain, claim.StoreID).Find(&holders).Error; err != nil {
+			return err
+		}
+		for i := range holders {
+			if err := tx.Model(&holders[i]).Updates(map[string]interface{}{
+				"domain":             v.platformDomain(&holders[i]),
+				"domain_verified_at": nil,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		// A store routes one custom domain at a time; older verified claims are superseded
+		if err := tx.Model(&models.StoreDomain{}).
+			Where("store_id = ? AND status = ? AND id <> ?", claim.StoreID, models.DomainStatusVerified, claim.ID).
+			Updates(map[string]interface{}{
+				"status":        models.DomainStatusFailed,
+				"last_error":    "Replaced by " + claim.Domain,
+				"next_check_at": nil,
+			}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Store{}).Where("id = ?", claim.StoreID).Updates(map[string]interface{}{
+			"domain":             claim.Domain,
+			"domain_verified_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		updates["status"] = models.DomainStatusVerified
+		updates["verified_at"] = now
+		claim.Status = models.DomainStatusVerified
+		claim.VerifiedAt = &now
+		return tx.Model(claim).Updates(updates).Error
+	})
+}
+
+func (v *Verifier) markFailed(claim *models.StoreDomain, updates map[string]interface{}) error {
+	return v.db.Transaction(func(tx *gorm.DB) error {
+		if err := v.Release(tx, claim); err != nil {
+			return err
+		}
+		updates["status"] = models.DomainStatusFailed
+		updates["next_check_at"] = nil
+		claim.Status = models.DomainStatusFailed
+		return tx.Model(claim).Updates(updates).Error
+	})
+}
+
+// platformDomain is the store's address under the base domain
+func (v *Verifier) platformDomain(store *models.Store) string {
+	return store.Subdomain + "." + v.baseDomain
+}
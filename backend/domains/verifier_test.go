@@ -0,0 +1,222 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"storemaker-backend/models"
+	"storemaker-backend/testdb"
+
+	"gorm.io/gorm"
+)
+
+const testBaseDomain = "storemaker.test"
+
+// fakeResolver serves TXT records from memory
+type fakeResolver struct {
+	mu      sync.Mutex
+	records map[string][]string
+	err     error
+}
+
+func newFakeResolver() *fakeResolver {
+	return &fakeResolver{records: make(map[string][]string)}
+}
+
+func (r *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	records, ok := r.records[name]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return records, nil
+}
+
+func (r *fakeResolver) publish(domain, token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[ChallengeRecordName(domain)] = []string{"v=spf1 -all", ChallengeRecordValue(token)}
+}
+
+func (r *fakeResolver) remove(domain string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.records, ChallengeRecordName(domain))
+}
+
+func testVerifier(t *testing.T) (*Verifier, *fakeResolver, *gorm.DB) {
+	db := testdb.Open(t, &models.User{}, &models.Store{}, &models.StoreDomain{})
+	resolver := newFakeResolver()
+	config := DefaultVerifierConfig()
+	config.MaxVerifiedFailures = 2
+	return NewVerifier(db, resolver, testBaseDomain, config), resolver, db
+}
+
+func createStore(t *testing.T, db *gorm.DB, subdomain string) *models.Store {
+	t.Helper()
+	owner := models.User{Email: subdomain + "@example.com", Password: "x", Role: models.RoleMerchant, IsActive: true}
+	if err := db.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	store := models.Store{
+		Name:      subdomain,
+		Slug:      subdomain,
+		Subdomain: subdomain,
+		Domain:    subdomain + "." + testBaseDomain,
+		OwnerID:   owner.ID,
+	}
+	if err := db.Create(&store).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &store
+}
+
+func createClaim(t *testing.T, db *gorm.DB, store *models.Store, domain, token string) *models.StoreDomain {
+	t.Helper()
+	claim := models.StoreDomain{StoreID: store.ID, Domain: domain, Token: token, Status: models.DomainStatusPending}
+	if err := db.Create(&claim).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &claim
+}
+
+func reload(t *testing.T, db *gorm.DB, store *models.Store, claim *models.StoreDomain) {
+	t.Helper()
+	var freshStore models.Store
+	if err := db.First(&freshStore, store.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	var freshClaim models.StoreDomain
+	if err := db.First(&freshClaim, claim.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	*store, *claim = freshStore, freshClaim
+}
+
+func TestCheckVerifiesPendingClaim(t *testing.T) {
+	verifier, resolver, db := testVerifier(t)
+	store := createStore(t, db, "shop")
+	claim := createClaim(t, db, store, "shop.example.com", "token-1")
+
+	if err := verifier.Check(context.Background(), claim); err != nil {
+		t.Fatal(err)
+	}
+	reload(t, db, store, claim)
+	if claim.Status != models.DomainStatusPending || claim.ConsecutiveFailures != 1 {
+		t.Fatalf("claim without a record is %s with %d failures", claim.Status, claim.ConsecutiveFailures)
+	}
+	if store.Domain != "shop."+testBaseDomain {
+		t.Fatalf("unverified domain routed: %s", store.Domain)
+	}
+
+	resolver.publish("shop.example.com", "token-1")
+	if err := verifier.Check(context.Background(), claim); err != nil {
+		t.Fatal(err)
+	}
+	reload(t, db, store, claim)
+	if claim.Status != models.DomainStatusVerified || claim.VerifiedAt == nil || claim.ConsecutiveFailures != 0 {
+		t.Fatalf("claim is %s, verified at %v", claim.Status, claim.VerifiedAt)
+	}
+	if store.Domain != "shop.example.com" || store.DomainVerifiedAt == nil {
+		t.Fatalf("store routes %q, verified at %v", store.Domain, store.DomainVerifiedAt)
+	}
+}
+
+func TestCheckRejectsWrongToken(t *testing.T) {
+	verifier, resolver, db := testVerifier(t)
+	store := createStore(t, db, "shop")
+	claim := createClaim(t, db, store, "shop.example.com", "token-1")
+
+	// Another store's token, as published for an earlier claim
+	resolver.publish("shop.example.com", "token-2")
+	if err := verifier.Check(context.Background(), claim); err != nil {
+		t.Fatal(err)
+	}
+	reload(t, db, store, claim)
+	if claim.Status != models.DomainStatusPending || claim.LastError == "" {
+		t.Fatalf("claim with the wrong token is %s (%q)", claim.Status, claim.LastError)
+	}
+	if store.DomainVerifiedAt != nil || store.Domain == "shop.example.com" {
+		t.Fatal("domain routed with the wrong token")
+	}
+}
+
+func TestCheckKeepsStateOnDNSError(t *testing.T) {
+	verifier, resolver, db := testVerifier(t)
+	store := createStore(t, db, "shop")
+	claim := createClaim(t, db, store, "shop.example.com", "token-1")
+
+	resolver.err = errors.New("server misbehaving")
+	if err := verifier.Check(context.Background(), claim); err != nil {
+		t.Fatal(err)
+	}
+	reload(t, db, store, claim)
+	if claim.Status != models.DomainStatusPending || claim.ConsecutiveFailures != 0 || claim.LastError == "" {
+		t.Fatalf("DNS error left claim %s with %d failures (%q)", claim.Status, claim.ConsecutiveFailures, claim.LastError)
+	}
+}
+
+func TestRecheckFailsVerifiedClaim(t *testing.T) {
+	verifier, resolver, db := testVerifier(t)
+	store := createStore(t, db, "shop")
+	claim := createClaim(t, db, store, "shop.example.com", "token-1")
+
+	resolver.publish("shop.example.com", "token-1")
+	if err := verifier.Check(context.Background(), claim); err != nil {
+		t.Fatal(err)
+	}
+
+	// The record is removed; the domain stays routed until MaxVerifiedFailures misses
+	resolver.remove("shop.example.com")
+	past := time.Now().Add(-time.Minute)
+	for i := 1; i <= 2; i++ {
+		if err := db.Model(claim).Update("next_check_at", past).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := verifier.RecheckDue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		reload(t, db, store, claim)
+		if i == 1 && (claim.Status != models.DomainStatusVerified || store.Domain != "shop.example.com") {
+			t.Fatalf("one miss unrouted the domain: claim %s, store %q", claim.Status, store.Domain)
+		}
+	}
+
+	if claim.Status != models.DomainStatusFailed || claim.NextCheckAt != nil {
+		t.Fatalf("claim is %s, next check %v", claim.Status, claim.NextCheckAt)
+	}
+	if store.Domain != "shop."+testBaseDomain || store.DomainVerifiedAt != nil {
+		t.Fatalf("failed domain still routed: %q, verified at %v", store.Domain, store.DomainVerifiedAt)
+	}
+}
+
+func TestCheckReleasesDomainFromUnverifiedHolder(t *testing.T) {
+	verifier, resolver, db := testVerifier(t)
+	holder := createStore(t, db, "squatter")
+	if err := db.Model(holder).Update("domain", "shop.example.com").Error; err != nil {
+		t.Fatal(err)
+	}
+	store := createStore(t, db, "shop")
+	claim := createClaim(t, db, store, "shop.example.com", "token-1")
+
+	resolver.publish("shop.example.com", "token-1")
+	if err := verifier.Check(context.Background(), claim); err != nil {
+		t.Fatal(err)
+	}
+	reload(t, db, store, claim)
+	var released models.Store
+	if err := db.First(&released, holder.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if released.Domain != "squatter."+testBaseDomain || store.Domain != "shop.example.com" {
+		t.Fatalf("holder has %q, verified store has %q", released.Domain, store.Domain)
+	}
+}
@@ -0,0 +1,245 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"storemaker-backend/models"
+	"storemaker-backend/sqc/concurrency"
+
+	"gorm.io/gorm"
+)
+
+// ErrQueueFull is returned when the runner cannot accept more jobs
+var ErrQueueFull = errors.New("job queue is full")
+
+// progressFlushInterval limits how often progress is written to the database
+const progressFlushInterval = 500 * time.Millisecond
+
+const (
+	// heartbeatInterval is how often a runner renews the jobs it owns
+	heartbeatInterval = 30 * time.Second
+	// leaseDuration is how long a job survives without a heartbeat before
+	// its owner is taken to be gone
+	leaseDuration = 4 * heartbeatInterval
+)
+
+// Handler does the work of a job and returns its result
+type Handler func(ctx context.Context, progress *Progress) (models.JobData, error)
+
+// Runner executes jobs on a worker pool. Jobs are kept in memory, so queued
+// and running jobs do not survive their runner. Each runner stamps its jobs
+// with its instance ID and renews their heartbeat; jobs whose heartbeat has
+// lapsed belonged to a runner that is gone and are marked failed.
+type Runner struct {
+	db   *gorm.DB
+	pool *concurrency.WorkerPool
+	id   string
+	done chan struct{}
+}
+
+// NewRunner creates a runner with the given number of workers and queue size
+func NewRunner(db *gorm.DB, workers, queueSize int) *Runner {
+	return &Runner{
+		db:   db,
+		pool: concurrency.NewWorkerPool(workers, queueSize),
+		id:   newInstanceID(),
+		done: make(chan struct{}),
+	}
+}
+
+// newInstanceID names this runner uniquely across hosts and restarts
+func newInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "runner"
+	}
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("%s-%d", host, time.Now().UnixNano())
+	}
+	return host + "-" + hex.EncodeToString(suffix)
+}
+
+// Start fails jobs whose runner is gone, starts the workers and keeps the
+// heartbeat of this runner's jobs fresh
+func (r *Runner) Start() {
+	r.failAbandoned()
+
+	r.pool.Start()
+	go r.heartbeat()
+
+	// Workers block on the result channel once it fills, so keep it drained
+	go func() {
+		for result := range r.pool.Results() {
+			if result.Error != nil {
+				log.Printf("Job failed: %v", result.Error)
+			}
+		}
+	}()
+}
+
+// Stop waits for running jobs to finish
+func (r *Runner) Stop() {
+	r.pool.Stop()
+	close(r.done)
+}
+
+// heartbeat renews this runner's unfinished jobs and fails those of runners
+// that stopped renewing theirs
+func (r *Runner) heartbeat() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			if err := r.db.Model(&models.Job{}).
+				Where("owner = ? AND status IN ?", r.id, unfinishedStatuses).
+				Update("heartbeat_at", time.Now()).Error; err != nil {
+				log.Printf("Failed to renew job heartbeats: %v", err)
+			}
+			r.failAbandoned()
+		}
+	}
+}
+
+var unfinishedStatuses = []models.JobStatus{models.JobStatusQueued, models.JobStatusRunning}
+
+// failAbandoned marks failed the unfinished jobs of other runners whose
+// heartbeat has lapsed. Jobs from before owners were recorded have none.
+func (r *Runner) failAbandoned() {
+	now := time.Now()
+	if err := r.db.Model(&models.Job{}).
+		Where("status IN ?", unfinishedStatuses).
+		Where("owner IS NULL OR owner <> ?", r.id).
+		Where("heartbeat_at IS NULL OR heartbeat_at < ?", now.Add(-leaseDuration)).
+		Updates(map[string]interface{}{
+			"status":      models.JobStatusFailed,
+			"error":       "Interrupted by a server restart",
+			"finished_at": now,
+		}).Error; err != nil {
+		log.Printf("Failed to clean up interrupted jobs: %v", err)
+	}
+}
+
+// Enqueue saves the job and queues handler to run it. The handler receives
+// ctx without its cancellation, so request-scoped values such as the audit
+// actor carry over after the request ends.
+func (r *Runner) Enqueue(ctx context.Context, job *models.Job, handler Handler) error {
+	now := time.Now()
+	job.Status = models.JobStatusQueued
+	job.Owner = r.id
+	job.HeartbeatAt = &now
+	if err := r.db.Create(job).Error; err != nil {
+		return err
+	}
+
+	jobCtx := context.WithoutCancel(ctx)
+	if !r.pool.Submit(func() error { return r.run(jobCtx, job, handler) }) {
+		now = time.Now()
+		r.db.Model(job).Updates(map[string]interface{}{
+			"status":      models.JobStatusFailed,
+			"error":       ErrQueueFull.Error(),
+			"finished_at": now,
+		})
+		return ErrQueueFull
+	}
+	return nil
+}
+
+func (r *Runner) run(ctx context.Context, job *models.Job, handler Handler) (err error) {
+	started := time.Now()
+	if err := r.db.Model(job).Updates(map[string]interface{}{
+		"status":     models.JobStatusRunning,
+		"started_at": started,
+	}).Error; err != nil {
+		return err
+	}
+
+	progress := &Progress{db: r.db, job: job}
+	var result models.JobData
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("job %d panicked: %v", job.ID, recovered)
+		}
+
+		finished := time.Now()
+		updates := map[string]interface{}{"finished_at": finished}
+		progress.mu.Lock()
+		updates["processed"] = job.Processed
+		updates["stage"] = job.Stage
+		progress.mu.Unlock()
+		if err != nil {
+			updates["status"] = models.JobStatusFailed
+			updates["error"] = err.Error()
+		} else {
+			updates["status"] = models.JobStatusCompleted
+			updates["result"] = result
+		}
+		if updateErr := r.db.Model(job).Updates(updates).Error; updateErr != nil {
+			log.Printf("Failed to record the outcome of job %d: %v", job.ID, updateErr)
+		}
+	}()
+
+	result, err = handler(ctx, progress)
+	return err
+}
+
+// Progress reports how far a running job has got
+type Progress struct {
+	db        *gorm.DB
+	job       *models.Job
+	lastFlush time.Time
+	mu        sync.Mutex
+}
+
+// Job returns the job being run
+func (p *Progress) Job() *models.Job {
+	return p.job
+}
+
+// SetTotal sets the number of items the job will process
+func (p *Progress) SetTotal(total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.job.Total = total
+	p.flush(true)
+}
+
+// SetStage names the step the job is on
+func (p *Progress) SetStage(stage string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.job.Stage = stage
+	p.flush(true)
+}
+
+// Add records n more processed items
+func (p *Progress) Add(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.job.Processed += n
+	p.flush(false)
+}
+
+func (p *Progress) flush(force bool) {
+	if !force && time.Since(p.lastFlush) < progressFlushInterval {
+		return
+	}
+	p.lastFlush = time.Now()
+	p.db.Model(p.job).Updates(map[string]interface{}{
+		"stage":     p.job.Stage,
+		"total":     p.job.Total,
+		"processed": p.job.Processed,
+	})
+}
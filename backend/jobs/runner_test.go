@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"storemaker-backend/models"
+	"storemaker-backend/testdb"
+)
+
+func TestFailAbandonedKeepsLiveRunnersJobs(t *testing.T) {
+	db := testdb.Open(t, &models.Job{})
+	runner := NewRunner(db, 1, 1)
+
+	fresh := time.Now()
+	stale := fresh.Add(-2 * leaseDuration)
+	jobs := map[string]*models.Job{
+		"other runner, alive":  {Owner: "other", HeartbeatAt: &fresh},
+		"other runner, gone":   {Owner: "other", HeartbeatAt: &stale},
+		"this runner":          {Owner: runner.id, HeartbeatAt: &stale},
+		"before owners":        {},
+		"finished, other gone": {Owner: "other", HeartbeatAt: &stale, Status: models.JobStatusCompleted},
+	}
+	for _, job := range jobs {
+		job.Type = models.JobTypeProductExport
+		if job.Status == "" {
+			job.Status = models.JobStatusRunning
+		}
+		if err := db.Create(job).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner.failAbandoned()
+
+	want := map[string]models.JobStatus{
+		"other runner, alive":  models.JobStatusRunning,
+		"other runner, gone":   models.JobStatusFailed,
+		"this runner":          models.JobStatusRunning,
+		"before owners":        models.JobStatusFailed,
+		"finished, other gone": models.JobStatusCompleted,
+	}
+	for name, job := range jobs {
+		var got models.Job
+		if err := db.First(&got, job.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != want[name] {
+			t.Errorf("%s: status = %s, want %s", name, got.Status, want[name])
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package lifecycle
+
+import (
+	"storemaker-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Checklist item keys
+const (
+	CheckActiveProduct = "active_product"
+	CheckSettings      = "settings"
+	CheckLegalPages    = "legal_pages"
+	CheckVerifiedEmail = "verified_email"
+)
+
+// ChecklistItem is one launch requirement
+type ChecklistItem struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	Done        bool   `json:"done"`
+}
+
+// Checklist lists what a store needs before it can go live
+type Checklist struct {
+	Complete bool            `json:"complete"`
+	Items    []ChecklistItem `json:"items"`
+}
+
+// legalPageTypes must each have a published page
+var legalPageTypes = []models.PageType{models.PageTypePrivacy, models.PageTypeTerms}
+
+// LaunchChecklist evaluates the launch requirements for a store
+func LaunchChecklist(db *gorm.DB, store *models.Store) (*Checklist, error) {
+	var activeProducts int64
+	if err := db.Model(&models.Product{}).
+		Where("store_id = ? AND status = ?", store.ID, models.ProductStatusActive).
+		Count(&activeProducts).Error; err != nil {
+		return nil, err
+	}
+
+	var settings int64
+	if err := db.Model(&models.StoreSettings{}).Where("store_id = ?", store.ID).Count(&settings).Error; err != nil {
+		return nil, err
+	}
+
+	var legalPages int64
+	if err := db.Model(&models.Page{}).
+		Where("store_id = ? AND type IN ? AND is_published = ?", store.ID, legalPageTypes, true).
+		Distinct("type").Count(&legalPages).Error; err != nil {
+		return nil, err
+	}
+
+	var owner models.User
+	if err := db.Select("id", "email_verified_at").First(&owner, store.OwnerID).Error; err != nil {
+		return nil, err
+	}
+
+	items := []ChecklistItem{
+		{Key: CheckActiveProduct, Description: "At least one active product", Done: activeProducts > 0},
+		{Key: CheckSettings, Description: "Store settings saved", Done: settings > 0},
+		{Key: CheckLegalPages, Description: "Privacy policy and terms pages published", Done: legalPages == int64(len(legalPageTypes))},
+		{Key: CheckVerifiedEmail, Description: "Owner email address verified", Done: owner.EmailVerifiedAt != nil},
+	}
+
+	checklist := &Checklist{Complete: true, Items: items}
+	for _, item := range items {
+		if !item.Done {
+			checklist.Complete = false
+		}
+	}
+	return checklist, nil
+}
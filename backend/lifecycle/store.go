@@ -0,0 +1,174 @@
+package lifecycle
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"storemaker-backend/models"
+	"storemaker-backend/sqc/automata"
+
+	"gorm.io/gorm"
+)
+
+// Store lifecycle states, mapped from models.StoreStatus
+const (
+	StoreDraft         automata.State = automata.State(models.StoreStatusDraft)
+	StorePendingReview automata.State = automata.State(models.StoreStatusPendingReview)
+	StoreActive        automata.State = automata.State(models.StoreStatusActive)
+	StoreSuspended     automata.State = automata.State(models.StoreStatusSuspended)
+	StoreArchived      automata.State = automata.State(models.StoreStatusArchived)
+)
+
+// Store lifecycle events
+const (
+	EventSubmit    automata.Event = "SUBMIT"
+	EventApprove   automata.Event = "APPROVE"
+	EventReject    automata.Event = "REJECT"
+	EventUnpublish automata.Event = "UNPUBLISH"
+	EventSuspend   automata.Event = "SUSPEND"
+	EventReinstate automata.Event = "REINSTATE"
+	EventArchive   automata.Event = "ARCHIVE"
+	EventRestore   automata.Event = "RESTORE"
+)
+
+// Actor is who triggers an event
+type Actor string
+
+const (
+	ActorMerchant Actor = "merchant"
+	ActorAdmin    Actor = "admin"
+)
+
+var storeTransitions = []automata.Transition{
+	// draft → pending_review → active, with review sending it back to draft
+	{From: StoreDraft, Event: EventSubmit, To: StorePendingReview},
+	{From: StorePendingReview, Event: EventApprove, To: StoreActive},
+	{From: StorePendingReview, Event: EventReject, To: StoreDraft},
+	{From: StoreActive, Event: EventUnpublish, To: StoreDraft},
+
+	// Admin suspension of a live or submitted store
+	{From: StorePendingReview, Event: EventSuspend, To: StoreSuspended},
+	{From: StoreActive, Event: EventSuspend, To: StoreSuspended},
+	{From: StoreSuspended, Event: EventReinstate, To: StoreActive},
+
+	// Archiving retires a store; a restored store starts over as a draft.
+	// Suspended stores can be archived, but not restored around the suspension.
+	{From: StoreDraft, Event: EventArchive, To: StoreArchived},
+	{From: StoreActive, Event: EventArchive, To: StoreArchived},
+	{From: StoreSuspended, Event: EventArchive, To: StoreArchived},
+	{From: StoreArchived, Event: EventRestore, To: StoreDraft},
+}
+
+// eventActors lists who may trigger each event
+var eventActors = map[automata.Event][]Actor{
+	EventSubmit:    {ActorMerchant},
+	EventApprove:   {ActorAdmin},
+	EventReject:    {ActorAdmin},
+	EventUnpublish: {ActorMerchant, ActorAdmin},
+	EventSuspend:   {ActorAdmin},
+	EventReinstate: {ActorAdmin},
+	EventArchive:   {ActorMerchant, ActorAdmin},
+	EventRestore:   {ActorMerchant, ActorAdmin},
+}
+
+var (
+	ErrInvalidTransition   = errors.New("this status change is not allowed from the current status")
+	ErrNotPermitted        = errors.New("you are not allowed to perform this status change")
+	ErrReasonRequired      = errors.New("a reason is required to suspend a store")
+	ErrChecklistIncomplete = errors.New("the launch checklist is not complete")
+)
+
+// NewStoreStateMachine creates a pre-configured FSM positioned at status
+func NewStoreStateMachine(status models.StoreStatus) *automata.FSM {
+	fsm := automata.NewFSM(automata.State(status))
+	for _, t := range storeTransitions {
+		fsm.AddTransition(t.From, t.Event, t.To)
+	}
+	return fsm
+}
+
+// ParseEvent accepts event names in any case
+func ParseEvent(name string) automata.Event {
+	return automata.Event(strings.ToUpper(strings.TrimSpace(name)))
+}
+
+// AllowedEvents returns the events actor may trigger from status
+func AllowedEvents(status models.StoreStatus, actor Actor) []automata.Event {
+	fsm := NewStoreStateMachine(status)
+	events := make([]automata.Event, 0)
+	for _, t := range storeTransitions {
+		if t.From == fsm.Current() && actorMayTrigger(t.Event, actor) {
+			events = append(events, t.Event)
+		}
+	}
+	return events
+}
+
+// Transition applies event to the store and saves the new status. Moving
+// towards launch (submit, approve, reinstate) requires a complete checklist,
+// which is returned alongside ErrChecklistIncomplete.
+func Transition(db *gorm.DB, store *models.Store, event automata.Event, actor Actor, reason string) (*Checklist, error) {
+	if !actorMayTrigger(event, actor) {
+		return nil, ErrNotPermitted
+	}
+
+	fsm := NewStoreStateMachine(store.Status)
+	if !fsm.CanTransition(event) {
+		return nil, ErrInvalidTransition
+	}
+
+	reason = strings.TrimSpace(reason)
+	if event == EventSuspend && reason == "" {
+		return nil, ErrReasonRequired
+	}
+
+	updates := map[string]interface{}{}
+	fsm.OnTransition(EventSuspend, func(from, to automata.State) {
+		updates["suspension_reason"] = reason
+		updates["suspended_at"] = time.Now()
+	})
+	// A store going live again no longer shows an old suspension
+	clearSuspension := func(from, to automata.State) {
+		updates["suspension_reason"] = ""
+		updates["suspended_at"] = nil
+	}
+	fsm.OnTransition(EventReinstate, clearSuspension)
+	fsm.OnTransition(EventApprove, clearSuspension)
+
+	if err := fsm.Trigger(event); err != nil {
+		return nil, ErrInvalidTransition
+	}
+	next := fsm.Current()
+
+	if next == StorePendingReview || next == StoreActive {
+		checklist, err := LaunchChecklist(db, store)
+		if err != nil {
+			return nil, err
+		}
+		if !checklist.Complete {
+			return checklist, ErrChecklistIncomplete
+		}
+	}
+
+	updates["status"] = models.StoreStatus(next)
+	// Guard against a concurrent change made since the store was loaded
+	result := db.Model(store).Where("status = ?", store.Status).Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidTransition
+	}
+
+	return nil, db.First(store, store.ID).Error
+}
+
+func actorMayTrigger(event automata.Event, actor Actor) bool {
+	for _, allowed := range eventActors[event] {
+		if allowed == actor {
+			return true
+		}
+	}
+	return false
+}
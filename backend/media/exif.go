@@ -0,0 +1,181 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// JPEG markers
+const (
+	markerSOI  = 0xD8
+	markerSOS  = 0xDA
+	markerAPP1 = 0xE1
+	markerIPTC = 0xED
+	markerCOM  = 0xFE
+)
+
+// strippedJPEGMarkers hold EXIF and XMP (APP1), IPTC (APP13) and comments.
+// ICC profiles (APP2) and Adobe colour information (APP14) are kept as the
+// pixels depend on them.
+var strippedJPEGMarkers = map[byte]bool{
+	markerAPP1: true,
+	markerIPTC: true,
+	markerCOM:  true,
+}
+
+// jpegSegment is a marker segment before the scan data; data excludes the
+// marker and length bytes
+type jpegSegment struct {
+	marker byte
+	start  int
+	end    int
+	data   []byte
+}
+
+// jpegSegments splits the header of a JPEG into its segments and returns
+// the offset the scan starts at
+func jpegSegments(data []byte) ([]jpegSegment, int, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil, 0, false
+	}
+
+	var segments []jpegSegment
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return nil, 0, false
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			// Fill byte
+			i++
+			continue
+		}
+		if marker == markerSOS {
+			return segments, i, true
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			i += 2
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, 0, false
+		}
+		segments = append(segments, jpegSegment{marker: marker, start: i, end: end, data: data[i+4 : end]})
+		i = end
+	}
+	return nil, 0, false
+}
+
+// stripJPEG removes metadata segments without re-encoding the image
+func stripJPEG(data []byte) ([]byte, error) {
+	segments, scan, ok := jpegSegments(data)
+	if !ok {
+		return nil, ErrInvalidImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, markerSOI)
+	for _, segment := range segments {
+		if !strippedJPEGMarkers[segment.marker] {
+			out = append(out, data[segment.start:segment.end]...)
+		}
+	}
+	return append(out, data[scan:]...), nil
+}
+
+// jpegOrientation reads the EXIF orientation of a JPEG, 1 to 8. Images
+// without one, or with an unreadable one, are upright.
+func jpegOrientation(data []byte) int {
+	segments, _, ok := jpegSegments(data)
+	if !ok {
+		return 1
+	}
+	for _, segment := range segments {
+		if segment.marker == markerAPP1 && bytes.HasPrefix(segment.data, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment.data[6:])
+		}
+	}
+	return 1
+}
+
+// tiffOrientation finds the orientation tag in the first IFD of the TIFF
+// structure EXIF data is stored in
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		// Tag 0x0112 holds one SHORT
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// strippedPNGChunks hold EXIF, text and timestamp metadata
+var strippedPNGChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// stripPNG removes metadata chunks without re-encoding the image
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrInvalidImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	i := len(pngSignature)
+	for i+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) || end < i {
+			return nil, ErrInvalidImage
+		}
+		kind := string(data[i+4 : i+8])
+		if !strippedPNGChunks[kind] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+		if kind == "IEND" {
+			return out, nil
+		}
+	}
+	return nil, ErrInvalidImage
+}
@@ -0,0 +1,354 @@
+package media
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+
+	"storemaker-backend/models"
+	"storemaker-backend/storage"
+
+	"gorm.io/gorm"
+)
+
+// IncomingPrefix is where presigned uploads go before they are processed
+// into the library
+const IncomingPrefix = "incoming/"
+
+// ErrUnknownMedia is returned when media IDs do not all belong to the store
+var ErrUnknownMedia = errors.New("unknown media")
+
+// Find returns the store's media with the given content hash
+func Find(db *gorm.DB, storeID uint, hash string) (*models.Media, error) {
+	var media models.Media
+	if err := db.Where("store_id = ? AND hash = ?", storeID, hash).First(&media).Error; err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// Save puts a processed upload in files and adds it to the store's library.
+// The files are recorded as store uploads so they count against the
+// owner's storage, or once it is published when pending is set. When the
+// same content was saved concurrently the existing media is returned and
+// created is false.
+func Save(db *gorm.DB, files storage.Storage, storeID uint, hash, name string, img *Image, pending bool) (media *models.Media, created bool, err error) {
+	ctx := db.Statement.Context
+
+	base := fmt.Sprintf("media_%d_%s", storeID, hash[:16])
+	media = &models.Media{
+		StoreID:      storeID,
+		Hash:         hash,
+		Filename:     base + img.Ext,
+		OriginalName: name,
+		MimeType:     img.MimeType,
+		Size:         int64(len(img.Data)),
+		Width:        img.Width,
+		Height:       img.Height,
+		URL:          files.URL(base + img.Ext),
+		Renditions:   models.MediaRenditions{},
+		Pending:      pending,
+	}
+	contents := map[string][]byte{media.Filename: img.Data}
+	for _, rendition := range img.Renditions {
+		filename := fmt.Sprintf("%s_%dw%s", base, rendition.Width, rendition.Ext)
+		contents[filename] = rendition.Data
+		media.Renditions = append(media.Renditions, models.MediaRendition{
+			Width:    rendition.Width,
+			Height:   rendition.Height,
+			Filename: filename,
+			URL:      files.URL(filename),
+			Size:     int64(len(rendition.Data)),
+		})
+	}
+	media.Srcset = Srcset(media)
+
+	written := make([]string, 0, len(contents))
+	removeWritten := func() {
+		for _, filename := range written {
+			files.Delete(ctx, filename)
+		}
+	}
+	for filename, data := range contents {
+		contentType := mime.TypeByExtension(filename[strings.LastIndex(filename, "."):])
+		if err := files.Put(ctx, filename, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+			removeWritten()
+			return nil, false, err
+		}
+		written = append(written, filename)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(media).Error; err != nil {
+			return err
+		}
+		for filename, data := range contents {
+			upload := models.StoreUpload{StoreID: storeID, Filename: filename, Size: int64(len(data)), Pending: pending}
+			if err := tx.Create(&upload).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// The files are named by content, so a concurrent upload of the
+		// same image wrote the same files and they must stay
+		if existing, findErr := Find(db, storeID, hash); findErr == nil {
+			return existing, false, nil
+		}
+		removeWritten()
+		return nil, false, err
+	}
+	return media, true, nil
+}
+
+// PendingBytes sums the files of items that are not yet counted against the
+// owner's storage
+func PendingBytes(db *gorm.DB, storeID uint, items []models.Media) (int64, error) {
+	var names []string
+	for i := range items {
+		if items[i].Pending {
+			names = append(names, Filenames(&items[i])...)
+		}
+	}
+	if len(names) == 0 {
+		return 0, nil
+	}
+
+	var total int64
+	err := db.Model(&models.StoreUpload{}).Where("store_id = ? AND pending = ? AND filename IN ?", storeID, true, names).
+		Select("COALESCE(SUM(size), 0)").Scan(&total).Error
+	return total, err
+}
+
+// Publish adds pending items to the library and starts counting their files
+// against the owner's storage
+func Publish(db *gorm.DB, storeID uint, items []models.Media) error {
+	var ids []uint
+	var names []string
+	for i := range items {
+		if items[i].Pending {
+			ids = append(ids, items[i].ID)
+			names = append(names, Filenames(&items[i])...)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Media{}).Where("store_id = ? AND id IN ?", storeID, ids).Update("pending", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.StoreUpload{}).Where("store_id = ? AND filename IN ?", storeID, names).Update("pending", false).Error
+	})
+}
+
+// Srcset lists the renditions and the original for an img srcset attribute
+func Srcset(media *models.Media) string {
+	candidates := make([]string, 0, len(media.Renditions)+1)
+	for _, rendition := range media.Renditions {
+		candidates = append(candidates, fmt.Sprintf("%s %dw", rendition.URL, rendition.Width))
+	}
+	candidates = append(candidates, fmt.Sprintf("%s %dw", media.URL, media.Width))
+	return strings.Join(candidates, ", ")
+}
+
+// Filenames lists the files of media, the original first
+func Filenames(media *models.Media) []string {
+	names := []string{media.Filename}
+	for _, rendition := range media.Renditions {
+		names = append(names, rendition.Filename)
+	}
+	return names
+}
+
+// ForStore loads the store's library media with the given IDs in the order
+// given. It returns ErrUnknownMedia unless every ID is in the library.
+func ForStore(db *gorm.DB, storeID uint, ids []uint) ([]models.Media, error) {
+	if len(ids) == 0 {
+		return []models.Media{}, nil
+	}
+
+	var found []models.Media
+	if err := db.Where("store_id = ? AND id IN ? AND pending = ?", storeID, ids, false).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Media, len(found))
+	for _, media := range found {
+		byID[media.ID] = media
+	}
+
+	ordered := make([]models.Media, 0, len(ids))
+	for _, id := range ids {
+		media, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownMedia, id)
+		}
+		ordered = append(ordered, media)
+	}
+	return ordered, nil
+}
+
+// URLs returns the original URLs of media
+func URLs(media []models.Media) models.ProductImages {
+	urls := make(models.ProductImages, 0, len(media))
+	for _, m := range media {
+		urls = append(urls, m.URL)
+	}
+	return urls
+}
+
+// AttachToProducts fills in the Media of products from their MediaIDs.
+// Media deleted since are left out.
+func AttachToProducts(db *gorm.DB, products []models.Product) error {
+	var ids []uint
+	for _, product := range products {
+		ids = append(ids, product.MediaIDs...)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var found []models.Media
+	if err := db.Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]models.Media, len(found))
+	for _, media := range found {
+		byID[media.ID] = media
+	}
+
+	for i := range products {
+		products[i].Media = make([]models.Media, 0, len(products[i].MediaIDs))
+		for _, id := range products[i].MediaIDs {
+			if media, ok := byID[id]; ok && media.StoreID == products[i].StoreID {
+				products[i].Media = append(products[i].Media, media)
+			}
+		}
+	}
+	return nil
+}
+
+// AttachToProduct fills in the Media of one product
+func AttachToProduct(db *gorm.DB, product *models.Product) error {
+	products := []models.Product{*product}
+	if err := AttachToProducts(db, products); err != nil {
+		return err
+	}
+	product.Media = products[0].Media
+	return nil
+}
+
+// UsageCounts is how many products, pages, reviews and components show a
+// piece of media
+type UsageCounts struct {
+	Products   int64 `json:"products"`
+	Pages      int64 `json:"pages"`
+	Reviews    int64 `json:"reviews"`
+	Components int64 `json:"components"`
+}
+
+// InUse reports whether anything shows the media
+func (u UsageCounts) InUse() bool {
+	return u.Products > 0 || u.Pages > 0 || u.Reviews > 0 || u.Components > 0
+}
+
+// Usage counts the products, pages, reviews and components that show media.
+// Components are those of the store's pages, its working layout and its
+// published layout, which refer to media from their config or props.
+func Usage(db *gorm.DB, media *models.Media) (UsageCounts, error) {
+	var usage UsageCounts
+	contains := fmt.Sprintf("[%d]", media.ID)
+	if err := db.Model(&models.Product{}).Where("store_id = ? AND media_ids @> ?", media.StoreID, contains).
+		Count(&usage.Products).Error; err != nil {
+		return usage, err
+	}
+	if err := db.Model(&models.Page{}).Where("store_id = ? AND media_id = ?", media.StoreID, media.ID).
+		Count(&usage.Pages).Error; err != nil {
+		return usage, err
+	}
+	if err := db.Model(&models.Review{}).Where("store_id = ? AND photo_ids @> ?", media.StoreID, contains).
+		Count(&usage.Reviews).Error; err != nil {
+		return usage, err
+	}
+
+	props, err := componentProps(db, media.StoreID)
+	if err != nil {
+		return usage, err
+	}
+	for _, p := range props {
+		if PropsReference(p, media.ID) {
+			usage.Components++
+		}
+	}
+	return usage, nil
+}
+
+// componentProps loads the config of the store's page components and the
+// props of its working and latest published layout components
+func componentProps(db *gorm.DB, storeID uint) ([]map[string]interface{}, error) {
+	var configs []string
+	if err := db.Model(&models.Component{}).
+		Joins("JOIN sections ON sections.id = components.section_id AND sections.deleted_at IS NULL").
+		Joins("JOIN pages ON pages.id = sections.page_id AND pages.deleted_at IS NULL").
+		Where("pages.store_id = ? AND components.config IS NOT NULL", storeID).
+		Pluck("components.config", &configs).Error; err != nil {
+		return nil, err
+	}
+	var layoutProps []string
+	if err := db.Model(&models.StoreLayoutComponent{}).
+		Joins("JOIN store_layouts ON store_layouts.id = store_layout_components.store_layout_id AND store_layouts.deleted_at IS NULL").
+		Where("store_layouts.store_id = ? AND store_layout_components.props IS NOT NULL", storeID).
+		Pluck("store_layout_components.props", &layoutProps).Error; err != nil {
+		return nil, err
+	}
+	props := make([]map[string]interface{}, 0, len(configs)+len(layoutProps))
+	for _, data := range append(configs, layoutProps...) {
+		var p map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			return nil, err
+		}
+		props = append(props, p)
+	}
+
+	var revision models.StoreLayoutRevision
+	err := db.Where("store_id = ?", storeID).Order("id DESC").First(&revision).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	for _, component := range revision.Components {
+		props = append(props, component.Props)
+	}
+	return props, nil
+}
+
+// Remove deletes media from the library along with its upload records, then
+// its files unless media of another store, copied by a store clone, still
+// uses them
+func Remove(db *gorm.DB, files storage.Storage, media *models.Media) error {
+	names := Filenames(media)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Delete(media).Error; err != nil {
+			return err
+		}
+		return tx.Where("store_id = ? AND filename IN ?", media.StoreID, names).Delete(&models.StoreUpload{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	var shared int64
+	if err := db.Unscoped().Model(&models.Media{}).Where("filename = ?", media.Filename).Count(&shared).Error; err != nil || shared > 0 {
+		return err
+	}
+	for _, name := range names {
+		if err := files.Delete(db.Statement.Context, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
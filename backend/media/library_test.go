@@ -0,0 +1,58 @@
+package media
+
+import (
+	"testing"
+
+	"storemaker-backend/models"
+	"storemaker-backend/plans"
+	"storemaker-backend/storage"
+	"storemaker-backend/testdb"
+)
+
+func TestPendingMediaIsNotCountedUntilPublished(t *testing.T) {
+	db := testdb.Open(t, &models.User{}, &models.Store{}, &models.Media{}, &models.StoreUpload{})
+	files, err := storage.NewLocal(t.TempDir(), "http://localhost:8080/uploads", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner := models.User{Email: "owner@example.com", Password: "x", Role: models.RoleMerchant, IsActive: true}
+	if err := db.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	store := models.Store{Name: "Shop", Slug: "shop", Subdomain: "shop", Domain: "shop.example.com", OwnerID: owner.ID}
+	if err := db.Create(&store).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	img := &Image{Data: []byte("photo"), Ext: ".jpg", MimeType: "image/jpeg", Width: 1, Height: 1}
+	photo, _, err := Save(db, files, store.ID, "0123456789abcdef0123", "photo.jpg", img, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used, err := plans.StorageBytes(db, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := PendingBytes(db, store.ID, []models.Media{*photo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != 0 || pending != 5 {
+		t.Fatalf("pending photo: %d bytes used, %d pending", used, pending)
+	}
+	if _, err := ForStore(db, store.ID, []uint{photo.ID}); err == nil {
+		t.Fatal("pending photo is in the library")
+	}
+
+	if err := Publish(db, store.ID, []models.Media{*photo}); err != nil {
+		t.Fatal(err)
+	}
+	if used, err = plans.StorageBytes(db, owner.ID); err != nil || used != 5 {
+		t.Fatalf("published photo: %d bytes used (%v)", used, err)
+	}
+	if _, err := ForStore(db, store.ID, []uint{photo.ID}); err != nil {
+		t.Fatalf("published photo is not in the library: %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+// Package media keeps each store's library of images. Uploads are sniffed,
+// stripped of metadata, stored once per store by content hash and resized
+// into renditions for responsive srcsets.
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// Upload limits. MaxPixels keeps small files that decode to huge images
+// from exhausting memory.
+const (
+	MaxUploadBytes = 20 << 20
+	MaxPixels      = 50_000_000
+)
+
+// RenditionWidths are the widths images are resized to. Only widths smaller
+// than the original are made.
+var RenditionWidths = []int{320, 640, 960, 1280, 1920}
+
+// JPEG qualities for re-encoded originals and for renditions
+const (
+	originalQuality  = 90
+	renditionQuality = 82
+)
+
+var (
+	ErrTooLarge        = errors.New("images can be at most 20 MB")
+	ErrUnsupportedType = errors.New("only JPEG, PNG and GIF images are supported")
+	ErrInvalidImage    = errors.New("the image could not be read")
+	ErrTooManyPixels   = errors.New("images can have at most 50 megapixels")
+)
+
+// extensions maps the accepted content types to file extensions
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Extension returns the file extension of an accepted content type
+func Extension(mimeType string) (string, bool) {
+	ext, ok := extensions[mimeType]
+	return ext, ok
+}
+
+// Image is a processed upload ready to be saved
+type Image struct {
+	Data       []byte
+	MimeType   string
+	Ext        string
+	Width      int
+	Height     int
+	Renditions []Rendition
+}
+
+// Rendition is a resized copy of an Image
+type Rendition struct {
+	Data   []byte
+	Ext    string
+	Width  int
+	Height int
+}
+
+// Size is the number of bytes the image and its renditions take up
+func (img *Image) Size() int64 {
+	size := int64(len(img.Data))
+	for _, rendition := range img.Renditions {
+		size += int64(len(rendition.Data))
+	}
+	return size
+}
+
+// Hash returns the hex SHA-256 of an upload, which identifies it within a
+// store's library
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sniff returns the content type of data from its leading bytes, whatever
+// the file name or client claimed
+func Sniff(data []byte) (string, error) {
+	mimeType := http.DetectContentType(data)
+	if _, ok := extensions[mimeType]; !ok {
+		return "", ErrUnsupportedType
+	}
+	return mimeType, nil
+}
+
+// Process checks an upload, strips its EXIF and text metadata and makes its
+// renditions. JPEGs with an EXIF orientation are re-encoded upright, as the
+// orientation is lost with the metadata; other images keep their encoded
+// pixels. Renditions of GIFs are still PNGs of the first frame.
+func Process(data []byte) (*Image, error) {
+	if len(data) > MaxUploadBytes {
+		return nil, ErrTooLarge
+	}
+	mimeType, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrInvalidImage
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	pixels := toRGBA(decoded)
+
+	img := &Image{MimeType: mimeType, Ext: extensions[mimeType]}
+	switch mimeType {
+	case "image/jpeg":
+		if orientation := jpegOrientation(data); orientation > 1 {
+			pixels = orient(pixels, orientation)
+			if img.Data, err = encode(pixels, mimeType, originalQuality); err != nil {
+				return nil, err
+			}
+		} else if img.Data, err = stripJPEG(data); err != nil {
+			return nil, err
+		}
+	case "image/png":
+		if img.Data, err = stripPNG(data); err != nil {
+			return nil, err
+		}
+	default:
+		img.Data = data
+	}
+
+	bounds := pixels.Bounds()
+	img.Width, img.Height = bounds.Dx(), bounds.Dy()
+
+	renditionType, renditionExt := mimeType, img.Ext
+	if mimeType == "image/gif" {
+		renditionType, renditionExt = "image/png", ".png"
+	}
+	for _, width := range RenditionWidths {
+		if width >= img.Width {
+			break
+		}
+		resized := resize(pixels, width)
+		encoded, err := encode(resized, renditionType, renditionQuality)
+		if err != nil {
+			return nil, err
+		}
+		img.Renditions = append(img.Renditions, Rendition{
+			Data:   encoded,
+			Ext:    renditionExt,
+			Width:  resized.Bounds().Dx(),
+			Height: resized.Bounds().Dy(),
+		})
+	}
+	return img, nil
+}
+
+// encode writes img as a JPEG, or otherwise as a PNG
+func encode(img image.Image, mimeType string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch mimeType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	default:
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,178 @@
+package media
+
+import (
+	"strconv"
+	"strings"
+
+	"storemaker-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Component props refer to media with keys named media_id or ending in
+// _media_id, holding one ID, and media_ids or ending in _media_ids, holding
+// a list. They may appear at any depth, such as inside slides or items.
+
+func isMediaKey(key string) bool {
+	return key == "media_id" || strings.HasSuffix(key, "_media_id")
+}
+
+func isMediaListKey(key string) bool {
+	return key == "media_ids" || strings.HasSuffix(key, "_media_ids")
+}
+
+// ResolveProps adds the media each reference points at next to it, under
+// the key without its _id or _ids suffix: "hero_media_id": 4 gains
+// "hero_media": {...}. References to media outside the store's library are
+// dropped.
+func ResolveProps(db *gorm.DB, storeID uint, props ...map[string]interface{}) error {
+	ids := make(map[uint]bool)
+	for _, p := range props {
+		walkProps(p, func(m map[string]interface{}, key string, value interface{}) {
+			if isMediaKey(key) {
+				if id, ok := propID(value); ok {
+					ids[id] = true
+				}
+			} else if list, ok := value.([]interface{}); ok && isMediaListKey(key) {
+				for _, item := range list {
+					if id, ok := propID(item); ok {
+						ids[id] = true
+					}
+				}
+			}
+		})
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	idList := make([]uint, 0, len(ids))
+	for id := range ids {
+		idList = append(idList, id)
+	}
+	var found []models.Media
+	if err := db.Where("store_id = ? AND id IN ? AND pending = ?", storeID, idList, false).Find(&found).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]models.Media, len(found))
+	for _, media := range found {
+		byID[media.ID] = media
+	}
+
+	for _, p := range props {
+		walkProps(p, func(m map[string]interface{}, key string, value interface{}) {
+			if isMediaKey(key) {
+				if id, ok := propID(value); ok {
+					if media, ok := byID[id]; ok {
+						m[strings.TrimSuffix(key, "_id")] = media
+					}
+				}
+			} else if list, ok := value.([]interface{}); ok && isMediaListKey(key) {
+				resolved := make([]models.Media, 0, len(list))
+				for _, item := range list {
+					if id, ok := propID(item); ok {
+						if media, ok := byID[id]; ok {
+							resolved = append(resolved, media)
+						}
+					}
+				}
+				m[strings.TrimSuffix(key, "_ids")] = resolved
+			}
+		})
+	}
+	return nil
+}
+
+// RemapProps points media references at new IDs, as when a store is
+// cloned. References without a new ID are removed.
+func RemapProps(props map[string]interface{}, ids map[uint]uint) {
+	walkProps(props, func(m map[string]interface{}, key string, value interface{}) {
+		if isMediaKey(key) {
+			if id, ok := propID(value); ok {
+				if newID, ok := ids[id]; ok {
+					m[key] = newID
+				} else {
+					delete(m, key)
+				}
+			}
+		} else if list, ok := value.([]interface{}); ok && isMediaListKey(key) {
+			remapped := make([]interface{}, 0, len(list))
+			for _, item := range list {
+				if id, ok := propID(item); ok {
+					if newID, ok := ids[id]; ok {
+						remapped = append(remapped, newID)
+					}
+				}
+			}
+			m[key] = remapped
+		}
+	})
+}
+
+// PropsReference reports whether props refer to the media with the given ID
+func PropsReference(props map[string]interface{}, id uint) bool {
+	found := false
+	walkProps(props, func(m map[string]interface{}, key string, value interface{}) {
+		if isMediaKey(key) {
+			if ref, ok := propID(value); ok && ref == id {
+				found = true
+			}
+		} else if list, ok := value.([]interface{}); ok && isMediaListKey(key) {
+			for _, item := range list {
+				if ref, ok := propID(item); ok && ref == id {
+					found = true
+				}
+			}
+		}
+	})
+	return found
+}
+
+// walkProps calls visit for every key of props and of the maps nested in
+// it. visit may replace values and add or delete keys of m.
+func walkProps(props map[string]interface{}, visit func(m map[string]interface{}, key string, value interface{})) {
+	if props == nil {
+		return
+	}
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		value := props[key]
+		walkValue(value, visit)
+		visit(props, key, value)
+	}
+}
+
+func walkValue(value interface{}, visit func(m map[string]interface{}, key string, value interface{})) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		walkProps(v, visit)
+	case []interface{}:
+		for _, item := range v {
+			walkValue(item, visit)
+		}
+	}
+}
+
+// propID reads a media ID from a decoded JSON value
+func propID(value interface{}) (uint, bool) {
+	switch v := value.(type) {
+	case float64:
+		if v > 0 && v == float64(uint(v)) {
+			return uint(v), true
+		}
+	case int:
+		if v > 0 {
+			return uint(v), true
+		}
+	case uint:
+		return v, v > 0
+	case string:
+		if id, err := strconv.ParseUint(v, 10, 32); err == nil && id > 0 {
+			return uint(id), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,34 @@
+package media
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPropsReference(t *testing.T) {
+	var props map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"title": "Welcome",
+		"background_media_id": 4,
+		"slides": [{"media_id": "7"}, {"caption": "no image"}],
+		"gallery": {"media_ids": [9, 11]},
+		"product_id": 12
+	}`), &props)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []uint{4, 7, 9, 11} {
+		if !PropsReference(props, id) {
+			t.Errorf("reference to media %d not found", id)
+		}
+	}
+	for _, id := range []uint{1, 12} {
+		if PropsReference(props, id) {
+			t.Errorf("media %d found without a reference", id)
+		}
+	}
+	if PropsReference(nil, 4) {
+		t.Error("nil props refer to media")
+	}
+}
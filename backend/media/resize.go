@@ -0,0 +1,137 @@
+package media
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// toRGBA copies img into an RGBA image anchored at the origin
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// tap is a source pixel's share of an output pixel
+type tap struct {
+	index  int
+	weight float32
+}
+
+// boxTaps gives, for each of the dst output pixels along one axis, the src
+// pixels it covers weighted by how much of each it covers
+func boxTaps(src, dst int) [][]tap {
+	scale := float64(src) / float64(dst)
+	taps := make([][]tap, dst)
+	for i := range taps {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for j := int(start); j < src && float64(j) < end; j++ {
+			overlap := math.Min(end, float64(j+1)) - math.Max(start, float64(j))
+			if overlap > 0 {
+				taps[i] = append(taps[i], tap{index: j, weight: float32(overlap / scale)})
+			}
+		}
+	}
+	return taps
+}
+
+// resize scales src down to width, keeping its aspect ratio. Each output
+// pixel is the area average of the source pixels under it. Rows are resized
+// one at a time so memory stays proportional to the output width.
+func resize(src *image.RGBA, width int) *image.RGBA {
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	height := int(math.Round(float64(srcHeight) * float64(width) / float64(srcWidth)))
+	if height < 1 {
+		height = 1
+	}
+
+	columns := boxTaps(srcWidth, width)
+	rows := boxTaps(srcHeight, height)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	line := make([]float32, width*4)
+	sum := make([]float32, width*4)
+	for y, rowTaps := range rows {
+		for i := range sum {
+			sum[i] = 0
+		}
+		for _, row := range rowTaps {
+			pix := src.Pix[row.index*src.Stride:]
+			for x, columnTaps := range columns {
+				var r, g, b, a float32
+				for _, column := range columnTaps {
+					p := pix[column.index*4 : column.index*4+4]
+					r += float32(p[0]) * column.weight
+					g += float32(p[1]) * column.weight
+					b += float32(p[2]) * column.weight
+					a += float32(p[3]) * column.weight
+				}
+				line[x*4], line[x*4+1], line[x*4+2], line[x*4+3] = r, g, b, a
+			}
+			for i, value := range line {
+				sum[i] += value * row.weight
+			}
+		}
+
+		out := dst.Pix[y*dst.Stride : y*dst.Stride+width*4]
+		for i, value := range sum {
+			out[i] = clamp(value)
+		}
+	}
+	return dst
+}
+
+func clamp(value float32) uint8 {
+	if value <= 0 {
+		return 0
+	}
+	if value >= 255 {
+		return 255
+	}
+	return uint8(value + 0.5)
+}
+
+// orient turns an image stored with an EXIF orientation upright. The
+// orientations are 2 mirrored, 3 rotated 180°, 4 flipped, 5 transposed,
+// 6 rotated 90° clockwise to display, 7 transversed and 8 rotated 90°
+// anticlockwise to display.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dstWidth, dstHeight := w, h
+	if orientation >= 5 {
+		dstWidth, dstHeight = h, w
+	}
+
+	var place func(x, y int) (int, int)
+	switch orientation {
+	case 2:
+		place = func(x, y int) (int, int) { return w - 1 - x, y }
+	case 3:
+		place = func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case 4:
+		place = func(x, y int) (int, int) { return x, h - 1 - y }
+	case 5:
+		place = func(x, y int) (int, int) { return y, x }
+	case 6:
+		place = func(x, y int) (int, int) { return h - 1 - y, x }
+	case 7:
+		place = func(x, y int) (int, int) { return h - 1 - y, w - 1 - x }
+	case 8:
+		place = func(x, y int) (int, int) { return y, w - 1 - x }
+	default:
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := place(x, y)
+			s := y*src.Stride + x*4
+			d := dy*dst.Stride + dx*4
+			copy(dst.Pix[d:d+4], src.Pix[s:s+4])
+		}
+	}
+	return dst
+}
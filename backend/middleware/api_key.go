@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"storemaker-backend/models"
+	"storemaker-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// lastUsedResolution limits how often last-used details are written per key
+const lastUsedResolution = time.Minute
+
+// apiKeyRouteResources maps the path segment after /manage/stores/:id to the
+// resource whose scope guards it. Segments not listed are closed to API keys,
+// as is deleting the store itself.
+var apiKeyRouteResources = map[string]string{
+	"":                "store",
+	"settings":        "store",
+	"theme":           "store",
+	"layout":          "store",
+	"logo":            "store",
+	"favicon":         "store",
+	"download":        "store",
+	"jobs":            "store",
+	"media":           "store",
+	"pages":           "pages",
+	"products":        "products",
+	"categories":      "products",
+	"reviews":         "products",
+	"recommendations": "products",
+	"orders":          "orders",
+	"newsletter":      "newsletter",
+}
+
+// authenticateAPIKey resolves a store API key and sets the store owner as the
+// acting user, alongside the key's store and scopes
+func authenticateAPIKey(c *gin.Context, db *gorm.DB, rawKey string) {
+	var key models.APIKey
+	if err := db.Where("key_hash = ?", utils.HashToken(rawKey)).First(&key).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key has been revoked"})
+		c.Abort()
+		return
+	}
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(now) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key expired"})
+		c.Abort()
+		return
+	}
+
+	clientIP := c.ClientIP()
+	if len(key.AllowedIPs) > 0 && !ipAllowed(clientIP, key.AllowedIPs) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key is not allowed from this IP address"})
+		c.Abort()
+		return
+	}
+
+	var store models.Store
+	if err := db.Preload("Owner").First(&store, key.StoreID).Error; err != nil || !store.Owner.IsActive {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedResolution || key.LastUsedIP != clientIP {
+		db.Model(&key).UpdateColumns(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": clientIP,
+		})
+	}
+
+	c.Set("user_id", store.OwnerID)
+	c.Set("user_email", store.Owner.Email)
+	c.Set("user_role", store.Owner.Role)
+	c.Set("api_key_id", key.ID)
+	c.Set("api_key_store_id", key.StoreID)
+	c.Set("api_key_scopes", key.Scopes)
+
+	c.Next()
+}
+
+// IsAPIKeyRequest reports whether the request was authenticated with an API key
+func IsAPIKeyRequest(c *gin.Context) bool {
+	_, exists := c.Get("api_key_id")
+	return exists
+}
+
+// SessionOnlyMiddleware rejects API keys and impersonation tokens on routes
+// meant for the account holder, such as password and 2FA changes
+func SessionOnlyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsAPIKeyRequest(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot access this route"})
+			c.Abort()
+			return
+		}
+		if IsImpersonationRequest(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This route is not available while impersonating a user"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// APIKeyScopeMiddleware enforces API key scopes on /manage/stores routes.
+// Session-authenticated requests pass through untouched. For API keys the
+// route must target the key's own store, and the key must hold the
+// "<resource>:read" scope for GET/HEAD or "<resource>:write" otherwise.
+func APIKeyScopeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsAPIKeyRequest(c) {
+			c.Next()
+			return
+		}
+
+		storeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil || uint(storeID) != c.GetUint("api_key_store_id") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is not valid for this store"})
+			c.Abort()
+			return
+		}
+
+		segment := storeRouteSegment(c.FullPath())
+		resource, ok := apiKeyRouteResources[segment]
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot access this route"})
+			c.Abort()
+			return
+		}
+		if segment == "" && c.Request.Method == http.MethodDelete {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot delete a store"})
+			c.Abort()
+			return
+		}
+
+		scope := resource + ":write"
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			scope = resource + ":read"
+		}
+
+		scopes, _ := c.Get("api_key_scopes")
+		if granted, ok := scopes.(models.StringList); !ok || !granted.Contains(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing the required scope", "required_scope": scope})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// storeRouteSegment returns the first path segment after ":id" in a
+// /manage/stores/:id/... route pattern
+func storeRouteSegment(fullPath string) string {
+	idx := strings.Index(fullPath, "/:id")
+	if idx == -1 {
+		return ""
+	}
+	rest := strings.TrimPrefix(fullPath[idx+len("/:id"):], "/")
+	if slash := strings.Index(rest, "/"); slash != -1 {
+		rest = rest[:slash]
+	}
+	return rest
+}
+
+// ipAllowed checks an address against a list of IPs and CIDR ranges
+func ipAllowed(clientIP string, allowed []string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if allowedIP := net.ParseIP(entry); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
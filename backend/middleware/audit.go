@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"log"
+
+	"storemaker-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RecordAudit appends an entry to the audit log, filling in the client IP,
+// user agent and authenticated actor from the request when not already set.
+// Failures are logged rather than returned so auditing never breaks a request.
+func RecordAudit(db *gorm.DB, c *gin.Context, entry models.AuditLog) {
+	if c != nil {
+		if entry.IPAddress == "" {
+			entry.IPAddress = c.ClientIP()
+		}
+		if entry.UserAgent == "" {
+			entry.UserAgent = c.Request.UserAgent()
+		}
+		if entry.ActorID == nil {
+			if userID, exists := c.Get("user_id"); exists {
+				if id, ok := userID.(uint); ok {
+					entry.ActorID = &id
+				}
+			}
+		}
+		if entry.ActorEmail == "" {
+			entry.ActorEmail = c.GetString("user_email")
+		}
+		if entry.ImpersonatorID == nil {
+			if adminID, ok := ImpersonatorID(c); ok {
+				entry.ImpersonatorID = &adminID
+			}
+		}
+	}
+
+	if err := db.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record audit entry %s: %v", entry.Action, err)
+	}
+}
+
+// AuditContextMiddleware puts the authenticated actor on the request context.
+// Database writes made with db.WithContext(c.Request.Context()) are then
+// attributed to that actor in the audit log. Use it after AuthMiddleware.
+func AuditContextMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor := models.AuditActor{
+			Email:     c.GetString("user_email"),
+			IPAddress: c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+		}
+		if userID, exists := c.Get("user_id"); exists {
+			if id, ok := userID.(uint); ok {
+				actor.UserID = &id
+			}
+		}
+		if adminID, ok := ImpersonatorID(c); ok {
+			actor.ImpersonatorID = &adminID
+		}
+
+		c.Request = c.Request.WithContext(models.ContextWithAuditActor(c.Request.Context(), actor))
+		c.Next()
+	}
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 	"time"
@@ -10,16 +11,45 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// Token issuers distinguish access, refresh and pending two-factor tokens,
+// which are all signed with the same secret.
+const (
+	AccessTokenIssuer    = "storemaker-backend"
+	RefreshTokenIssuer   = "storemaker-backend-refresh"
+	TwoFactorTokenIssuer = "storemaker-backend-2fa"
+
+	ImpersonationTokenIssuer = "storemaker-backend-impersonation"
+	StoreAccessTokenIssuer   = "storemaker-backend-store-access"
+	EmailTokenIssuer         = "storemaker-backend-email"
+)
+
+// Purposes carried by pending two-factor tokens
+const (
+	TwoFactorPurposeVerify = "verify"
+	TwoFactorPurposeSetup  = "setup"
 )
 
 type Claims struct {
-	UserID uint            `json:"user_id"`
-	Email  string          `json:"email"`
-	Role   models.UserRole `json:"role"`
+	UserID  uint            `json:"user_id"`
+	Email   string          `json:"email"`
+	Role    models.UserRole `json:"role"`
+	Purpose string          `json:"purpose,omitempty"`
+
+	// Set on impersonation tokens only
+	ImpersonatorID    uint   `json:"impersonator_id,omitempty"`
+	ImpersonatorEmail string `json:"impersonator_email,omitempty"`
+	SessionID         uint   `json:"session_id,omitempty"`
+	AllowWrites       bool   `json:"allow_writes,omitempty"`
+
 	jwt.RegisteredClaims
 }
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware authenticates requests carrying either a JWT access token or a
+// store API key. API key requests are further restricted by APIKeyScopeMiddleware.
+func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -36,6 +66,11 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := bearerToken[1]
+		if strings.HasPrefix(tokenString, models.APIKeyPrefix) {
+			authenticateAPIKey(c, db, tokenString)
+			return
+		}
+
 		claims := &Claims{}
 
 		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -48,6 +83,18 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if claims.Issuer == ImpersonationTokenIssuer {
+			authenticateImpersonation(c, db, claims)
+			return
+		}
+
+		// Only access tokens may be used here, not refresh or pending 2FA tokens
+		if claims.Issuer != AccessTokenIssuer {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
 		// Check token expiration
 		if claims.ExpiresAt != nil && claims.ExpiresAt.Time.Before(time.Now()) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
@@ -80,6 +127,17 @@ func AdminMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if IsAPIKeyRequest(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot access admin routes"})
+			c.Abort()
+			return
+		}
+		if IsImpersonationRequest(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Impersonation tokens cannot access admin routes"})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
@@ -113,7 +171,7 @@ func GenerateToken(user *models.User) (string, error) {
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "storemaker-backend",
+			Issuer:    AccessTokenIssuer,
 		},
 	}
 
@@ -130,10 +188,71 @@ func GenerateRefreshToken(user *models.User) (string, error) {
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "storemaker-backend-refresh",
+			Issuer:    RefreshTokenIssuer,
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(utils.GetJWTSecret())
 }
+
+// GenerateTwoFactorToken issues a short-lived token proving the password step
+// of a login succeeded. It can only be exchanged at the 2FA login endpoints.
+func GenerateTwoFactorToken(user *models.User, purpose string) (string, error) {
+	expirationTime := time.Now().Add(5 * time.Minute)
+	claims := &Claims{
+		UserID:  user.ID,
+		Email:   user.Email,
+		Role:    user.Role,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    TwoFactorTokenIssuer,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(utils.GetJWTSecret())
+}
+
+// ParseTwoFactorToken validates a pending two-factor token for the given purpose
+func ParseTwoFactorToken(tokenString, purpose string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := utils.ParseJWTToken(tokenString, claims)
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid two-factor token")
+	}
+	if claims.Issuer != TwoFactorTokenIssuer || claims.Purpose != purpose {
+		return nil, errors.New("invalid two-factor token")
+	}
+	return claims, nil
+}
+
+// GenerateEmailVerificationToken issues a token proving the holder received
+// mail at the user's address
+func GenerateEmailVerificationToken(user *models.User) (string, error) {
+	expirationTime := time.Now().Add(24 * time.Hour)
+	claims := &Claims{
+		UserID: user.ID,
+		Email:  user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    EmailTokenIssuer,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(utils.GetJWTSecret())
+}
+
+// ParseEmailVerificationToken validates an email verification token
+func ParseEmailVerificationToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := utils.ParseJWTToken(tokenString, claims)
+	if err != nil || !token.Valid || claims.Issuer != EmailTokenIssuer {
+		return nil, errors.New("invalid email verification token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"strings"
+	"time"
+
+	"storemaker-backend/models"
+	"storemaker-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// HasStorePreview checks the preview token from the "preview" query parameter
+// or the X-Preview-Token header against the store
+func HasStorePreview(db *gorm.DB, c *gin.Context, storeID uint) bool {
+	if checked, exists := c.Get("store_preview"); exists {
+		return checked.(bool)
+	}
+
+	preview := validStorePreview(db, c, storeID)
+	c.Set("store_preview", preview)
+	if preview {
+		// Previews must not be cached and shown to other visitors
+		c.Header("Cache-Control", "private, no-store")
+	}
+	return preview
+}
+
+func validStorePreview(db *gorm.DB, c *gin.Context, storeID uint) bool {
+	rawToken := c.Query("preview")
+	if rawToken == "" {
+		rawToken = c.GetHeader("X-Preview-Token")
+	}
+	if !strings.HasPrefix(rawToken, models.PreviewTokenPrefix) {
+		return false
+	}
+
+	var token models.StorePreviewToken
+	if err := db.Where("token_hash = ? AND store_id = ?", utils.HashToken(rawToken), storeID).First(&token).Error; err != nil {
+		return false
+	}
+
+	now := time.Now()
+	if token.RevokedAt != nil || now.After(token.ExpiresAt) {
+		return false
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > time.Minute {
+		db.Model(&token).UpdateColumn("last_used_at", now)
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"storemaker-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// StorefrontMiddleware resolves the store from the Host header, either as a
+// subdomain of baseDomain or as a verified custom domain. The store's slug is
+// added as the :slug parameter so the slug-based public handlers can serve
+// the slug-less /storefront routes unchanged.
+func StorefrontMiddleware(db *gorm.DB, baseDomain string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		host := requestHostname(c.Request.Host)
+		if host == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Host header required"})
+			c.Abort()
+			return
+		}
+
+		var store models.Store
+		var err error
+		if subdomain, ok := storeSubdomain(host, baseDomain); ok {
+			err = db.Where("subdomain = ?", subdomain).First(&store).Error
+		} else {
+			err = db.Where("LOWER(domain) = ? AND domain_verified_at IS NOT NULL", host).First(&store).Error
+		}
+
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store"})
+			}
+			c.Abort()
+			return
+		}
+
+		c.Set("storefront_store_id", store.ID)
+		c.Params = append(c.Params, gin.Param{Key: "slug", Value: store.Slug})
+		c.Next()
+	}
+}
+
+// requestHostname strips the port and trailing dot from a Host header value
+func requestHostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// storeSubdomain returns the single label in front of baseDomain, if any
+func storeSubdomain(host, baseDomain string) (string, bool) {
+	if baseDomain == "" || !strings.HasSuffix(host, "."+baseDomain) {
+		return "", false
+	}
+	label := strings.TrimSuffix(host, "."+baseDomain)
+	if label == "" || strings.Contains(label, ".") || label == "www" {
+		return "", false
+	}
+	return label, true
+}
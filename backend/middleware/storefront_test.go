@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"storemaker-backend/models"
+	"storemaker-backend/testdb"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStorefrontRoutesOnlyVerifiedDomains(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testdb.Open(t, &models.User{}, &models.Store{}, &models.StoreDomain{})
+
+	owner := models.User{Email: "owner@example.com", Password: "x", Role: models.RoleMerchant, IsActive: true}
+	if err := db.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	verifiedAt := time.Now()
+	stores := []models.Store{
+		{Name: "Verified", Slug: "verified", Subdomain: "verified", Domain: "verified.example.com", DomainVerifiedAt: &verifiedAt, OwnerID: owner.ID},
+		{Name: "Claimed", Slug: "claimed", Subdomain: "claimed", Domain: "claimed.example.com", OwnerID: owner.ID},
+	}
+	if err := db.Create(&stores).Error; err != nil {
+		t.Fatal(err)
+	}
+	// A pending claim does not route either
+	if err := db.Create(&models.StoreDomain{StoreID: stores[1].ID, Domain: "pending.example.com", Token: "t", Status: models.DomainStatusPending}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/storefront", StorefrontMiddleware(db, "storemaker.test"), func(c *gin.Context) {
+		c.String(http.StatusOK, c.Param("slug"))
+	})
+
+	tests := []struct {
+		host   string
+		status int
+		slug   string
+	}{
+		{"verified.example.com", http.StatusOK, "verified"},
+		{"VERIFIED.example.com.:443", http.StatusOK, "verified"},
+		{"claimed.example.com", http.StatusNotFound, ""},
+		{"pending.example.com", http.StatusNotFound, ""},
+		{"claimed.storemaker.test", http.StatusOK, "claimed"},
+		{"unknown.storemaker.test", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/storefront", nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.slug != "" && w.Body.String() != tt.slug {
+				t.Fatalf("slug = %q, want %q", w.Body.String(), tt.slug)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix marks bearer tokens that are API keys rather than JWTs
+const APIKeyPrefix = "smk_"
+
+// APIKeyResources are the resources a key can be scoped to. Each resource has
+// a ":read" and a ":write" scope, e.g. "products:read".
+var APIKeyResources = []string{"store", "pages", "products", "orders", "newsletter"}
+
+type StringList []string
+
+func (sl StringList) Value() (driver.Value, error) {
+	return json.Marshal(sl)
+}
+
+func (sl *StringList) Scan(value interface{}) error {
+	if value == nil {
+		*sl = []string{}
+		return nil
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, sl)
+	case string:
+		return json.Unmarshal([]byte(v), sl)
+	}
+	return nil
+}
+
+// Contains reports whether the list holds the given value
+func (sl StringList) Contains(value string) bool {
+	for _, item := range sl {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey is a long-lived, store-scoped credential for merchant integrations.
+// Only a SHA-256 hash of the key is stored; the plain key is shown once.
+type APIKey struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	StoreID     uint           `json:"store_id" gorm:"not null;index"`
+	CreatedByID uint           `json:"created_by_id" gorm:"not null"`
+	Name        string         `json:"name" gorm:"not null"`
+	Prefix      string         `json:"prefix" gorm:"not null"`
+	KeyHash     string         `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes      StringList     `json:"scopes" gorm:"type:jsonb"`
+	AllowedIPs  StringList     `json:"allowed_ips" gorm:"type:jsonb"`
+	LastUsedAt  *time.Time     `json:"last_used_at"`
+	LastUsedIP  string         `json:"last_used_ip"`
+	ExpiresAt   *time.Time     `json:"expires_at"`
+	RevokedAt   *time.Time     `json:"revoked_at"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Relationships
+	Store     Store `json:"-" gorm:"foreignKey:StoreID"`
+	CreatedBy User  `json:"-" gorm:"foreignKey:CreatedByID"`
+}
+
+type APIKeyCreateRequest struct {
+	Name       string     `json:"name" binding:"required"`
+	Scopes     []string   `json:"scopes" binding:"required,min=1"`
+	AllowedIPs []string   `json:"allowed_ips"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditActionLoginSuccess AuditAction = "auth.login.success"
+	AuditActionLoginFailure AuditAction = "auth.login.failure"
+	AuditActionLoginBlocked AuditAction = "auth.login.blocked"
+
+	AuditActionImpersonationStart   AuditAction = "admin.impersonation.start"
+	AuditActionImpersonationEnd     AuditAction = "admin.impersonation.end"
+	AuditActionImpersonationRequest AuditAction = "admin.impersonation.request"
+	AuditActionImpersonationBlocked AuditAction = "admin.impersonation.blocked"
+)
+
+// Operations recorded for entity changes. The action of a change entry is
+// "<entity type>.<operation>", e.g. "product.delete".
+const (
+	AuditOperationCreate = "create"
+	AuditOperationUpdate = "update"
+	AuditOperationDelete = "delete"
+)
+
+// EntityAuditAction builds the action name for a change to an entity type
+func EntityAuditAction(entityType, operation string) AuditAction {
+	return AuditAction(entityType + "." + operation)
+}
+
+type AuditMetadata map[string]interface{}
+
+func (am AuditMetadata) Value() (driver.Value, error) {
+	return json.Marshal(am)
+}
+
+func (am *AuditMetadata) Scan(value interface{}) error {
+	if value == nil {
+		*am = make(map[string]interface{})
+		return nil
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, am)
+	case string:
+		return json.Unmarshal([]byte(v), am)
+	}
+	return nil
+}
+
+// AuditLog is an append-only record of security-relevant events and of changes
+// to store data. Entries are never updated or deleted by the application.
+//
+// For entity changes Before and After hold only the columns that changed.
+// During impersonation the actor is the impersonated user and ImpersonatorID
+// is the admin behind the session. A nil actor means a system change.
+type AuditLog struct {
+	ID             uint          `json:"id" gorm:"primaryKey"`
+	ActorID        *uint         `json:"actor_id" gorm:"index"`
+	ActorEmail     string        `json:"actor_email" gorm:"index"`
+	ImpersonatorID *uint         `json:"impersonator_id" gorm:"index"`
+	StoreID        *uint         `json:"store_id" gorm:"index"`
+	EntityType     string        `json:"entity_type" gorm:"index"`
+	EntityID       *uint         `json:"entity_id" gorm:"index"`
+	Action         AuditAction   `json:"action" gorm:"not null;index"`
+	Before         AuditMetadata `json:"before,omitempty" gorm:"type:jsonb"`
+	After          AuditMetadata `json:"after,omitempty" gorm:"type:jsonb"`
+	IPAddress      string        `json:"ip_address"`
+	UserAgent      string        `json:"user_agent"`
+	Metadata       AuditMetadata `json:"metadata" gorm:"type:jsonb"`
+	CreatedAt      time.Time     `json:"created_at" gorm:"index"`
+}
+
+// AuditActor describes who is behind a request. It travels on the request
+// context so database callbacks can attribute the changes they record.
+type AuditActor struct {
+	UserID         *uint
+	Email          string
+	ImpersonatorID *uint
+	IPAddress      string
+	UserAgent      string
+	Method         string
+	Path           string
+}
+
+type auditActorKey struct{}
+
+// ContextWithAuditActor returns a copy of ctx carrying the actor
+func ContextWithAuditActor(ctx context.Context, actor AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// AuditActorFromContext returns the actor stored on ctx, if any
+func AuditActorFromContext(ctx context.Context) (AuditActor, bool) {
+	if ctx == nil {
+		return AuditActor{}, false
+	}
+	actor, ok := ctx.Value(auditActorKey{}).(AuditActor)
+	return actor, ok
+}
@@ -110,6 +110,7 @@ type Page struct {
 	IsPublished bool           `json:"is_published" gorm:"default:false"`
 	SeoTitle    string         `json:"seo_title"`
 	SeoDesc     string         `json:"seo_description"`
+	MediaID     *uint          `json:"media_id"`
 	StoreID     uint           `json:"store_id" gorm:"not null"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
@@ -117,6 +118,7 @@ type Page struct {
 
 	// Relationships
 	Store    Store     `json:"store,omitempty" gorm:"foreignKey:StoreID"`
+	Media    *Media    `json:"media,omitempty" gorm:"foreignKey:MediaID;constraint:OnDelete:SET NULL"`
 	Sections []Section `json:"sections,omitempty" gorm:"foreignKey:PageID"`
 }
 
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// ImpersonationSession records an admin acting as another user. Tokens issued
+// for a session stop working once it has ended or expired.
+type ImpersonationSession struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	AdminID      uint       `json:"admin_id" gorm:"not null;index"`
+	TargetUserID uint       `json:"target_user_id" gorm:"not null;index"`
+	Reason       string     `json:"reason" gorm:"not null"`
+	AllowWrites  bool       `json:"allow_writes" gorm:"default:false"`
+	IPAddress    string     `json:"ip_address"`
+	UserAgent    string     `json:"user_agent"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null"`
+	EndedAt      *time.Time `json:"ended_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	// Relationships
+	Admin      User `json:"admin,omitempty" gorm:"foreignKey:AdminID"`
+	TargetUser User `json:"target_user,omitempty" gorm:"foreignKey:TargetUserID"`
+}
+
+// IsActive reports whether tokens for the session may still be used
+func (s *ImpersonationSession) IsActive(now time.Time) bool {
+	return s.EndedAt == nil && now.Before(s.ExpiresAt)
+}
+
+type ImpersonationRequest struct {
+	Reason          string `json:"reason" binding:"required"`
+	AllowWrites     bool   `json:"allow_writes"`
+	DurationMinutes int    `json:"duration_minutes" binding:"omitempty,min=1,max=60"`
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+// Job types
+const (
+	JobTypeStoreClone      = "store.clone"
+	JobTypeProductImport   = "products.import"
+	JobTypeProductExport   = "products.export"
+	JobTypeRecommendations = "products.recommendations"
+)
+
+type JobData map[string]interface{}
+
+func (jd JobData) Value() (driver.Value, error) {
+	return json.Marshal(jd)
+}
+
+func (jd *JobData) Scan(value interface{}) error {
+	if value == nil {
+		*jd = make(map[string]interface{})
+		return nil
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, jd)
+	case string:
+		return json.Unmarshal([]byte(v), jd)
+	}
+	return nil
+}
+
+// Job is a unit of background work. Progress is reported as Processed out
+// of Total items, with Stage naming the current step. Owner is the runner
+// instance holding the job, which renews HeartbeatAt while it is alive.
+type Job struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Type        string     `json:"type" gorm:"not null;index"`
+	StoreID     *uint      `json:"store_id" gorm:"index"`
+	UserID      uint       `json:"user_id" gorm:"index"`
+	Status      JobStatus  `json:"status" gorm:"default:'queued';index"`
+	Stage       string     `json:"stage"`
+	Total       int        `json:"total" gorm:"default:0"`
+	Processed   int        `json:"processed" gorm:"default:0"`
+	Params      JobData    `json:"params" gorm:"type:jsonb"`
+	Result      JobData    `json:"result,omitempty" gorm:"type:jsonb"`
+	Error       string     `json:"error,omitempty"`
+	Owner       string     `json:"-" gorm:"index"`
+	HeartbeatAt *time.Time `json:"-" gorm:"index"`
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Percent is the share of work done, from 0 to 100
+func (j *Job) Percent() int {
+	if j.Status == JobStatusCompleted {
+		return 100
+	}
+	if j.Total <= 0 {
+		return 0
+	}
+	percent := j.Processed * 100 / j.Total
+	if percent > 99 {
+		percent = 99
+	}
+	return percent
+}
+
+// StoreCloneOptions selects what is copied into a cloned store
+type StoreCloneOptions struct {
+	Products   bool `json:"products"`
+	Categories bool `json:"categories"`
+	Pages      bool `json:"pages"`
+	Layout     bool `json:"layout"`
+	Theme      bool `json:"theme"`
+	Settings   bool `json:"settings"`
+}
+
+// StoreCloneRequest copies a store into a new one. Everything is copied when
+// Include is omitted.
+type StoreCloneRequest struct {
+	Name    string             `json:"name" binding:"required"`
+	Include *StoreCloneOptions `json:"include,omitempty"`
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MediaRendition is a resized copy of a media image
+type MediaRendition struct {
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Filename string `json:"filename"`
+	URL      string `json:"url"`
+	Size     int64  `json:"size"`
+}
+
+type MediaRenditions []MediaRendition
+
+func (mr MediaRenditions) Value() (driver.Value, error) {
+	return json.Marshal(mr)
+}
+
+func (mr *MediaRenditions) Scan(value interface{}) error {
+	if value == nil {
+		*mr = []MediaRendition{}
+		return nil
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, mr)
+	case string:
+		return json.Unmarshal([]byte(v), mr)
+	}
+	return nil
+}
+
+// MediaIDs lists media library images in display order
+type MediaIDs []uint
+
+func (mi MediaIDs) Value() (driver.Value, error) {
+	return json.Marshal(mi)
+}
+
+func (mi *MediaIDs) Scan(value interface{}) error {
+	if value == nil {
+		*mi = []uint{}
+		return nil
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, mi)
+	case string:
+		return json.Unmarshal([]byte(v), mi)
+	}
+	return nil
+}
+
+// Media is an image in a store's media library. Uploads with the same
+// content are stored once per store, keyed by their SHA-256 hash. Renditions
+// are ordered by width and Srcset lists them with the original for use in
+// an img srcset attribute. Pending media, the photos of reviews awaiting
+// approval, is left out of the library and its files are not counted
+// against the owner's storage until it is published.
+type Media struct {
+	ID           uint            `json:"id" gorm:"primaryKey"`
+	StoreID      uint            `json:"store_id" gorm:"not null;uniqueIndex:idx_media_store_hash,where:deleted_at IS NULL"`
+	Hash         string          `json:"hash" gorm:"not null;uniqueIndex:idx_media_store_hash,where:deleted_at IS NULL"`
+	Filename     string          `json:"filename" gorm:"not null"`
+	OriginalName string          `json:"original_name"`
+	MimeType     string          `json:"mime_type" gorm:"not null"`
+	Size         int64           `json:"size" gorm:"not null"`
+	Width        int             `json:"width"`
+	Height       int             `json:"height"`
+	Alt          string          `json:"alt"`
+	URL          string          `json:"url" gorm:"not null"`
+	Renditions   MediaRenditions `json:"renditions" gorm:"type:jsonb"`
+	Srcset       string          `json:"srcset" gorm:"type:text"`
+	Pending      bool            `json:"pending" gorm:"not null;default:false"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt  `json:"-" gorm:"index"`
+
+	// Relationships
+	Store Store `json:"-" gorm:"foreignKey:StoreID"`
+}
+
+func (Media) TableName() string {
+	return "media"
+}
+
+type MediaUpdateRequest struct {
+	Alt *string `json:"alt" binding:"omitempty,max=500"`
+}
+
+// MediaUploadRequest asks for a presigned URL to upload an image of Size
+// bytes directly to storage
+type MediaUploadRequest struct {
+	ContentType string `json:"content_type" binding:"required"`
+	Size        int64  `json:"size" binding:"required,min=1"`
+}
+
+// MediaUploadCompleteRequest adds an image uploaded to a presigned URL to
+// the media library. Filename is the name the image had on the client.
+type MediaUploadCompleteRequest struct {
+	Key      string `json:"key" binding:"required"`
+	Filename string `json:"filename"`
+	Alt      string `json:"alt" binding:"max=500"`
+}
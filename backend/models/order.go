@@ -76,22 +76,26 @@ type Order struct {
 	OrderItems []OrderItem `json:"order_items,omitempty" gorm:"foreignKey:OrderID"`
 }
 
+// OrderItem is one line of an order. Items ordered before variants had their
+// own table keep the variant's old string ID in LegacyVariantID.
 type OrderItem struct {
-	ID           uint           `json:"id" gorm:"primaryKey"`
-	OrderID      uint           `json:"order_id" gorm:"not null"`
-	ProductID    uint           `json:"product_id" gorm:"not null"`
-	VariantID    string         `json:"variant_id"`
-	Quantity     int            `json:"quantity" gorm:"not null"`
-	Price        float64        `json:"price" gorm:"not null"`
-	ProductTitle string         `json:"product_title" gorm:"not null"`
-	ProductSKU   string         `json:"product_sku"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	OrderID         uint           `json:"order_id" gorm:"not null"`
+	ProductID       uint           `json:"product_id" gorm:"not null"`
+	VariantID       *uint          `json:"variant_id" gorm:"index"`
+	LegacyVariantID string         `json:"legacy_variant_id,omitempty"`
+	Quantity        int            `json:"quantity" gorm:"not null"`
+	Price           float64        `json:"price" gorm:"not null"`
+	ProductTitle    string         `json:"product_title" gorm:"not null"`
+	ProductSKU      string         `json:"product_sku"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
-	Order   Order   `json:"order,omitempty" gorm:"foreignKey:OrderID"`
-	Product Product `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	Order   Order           `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+	Product Product         `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	Variant *ProductVariant `json:"variant,omitempty" gorm:"foreignKey:VariantID;constraint:OnDelete:SET NULL"`
 }
 
 type OrderCreateRequest struct {
@@ -102,10 +106,34 @@ type OrderCreateRequest struct {
 	Notes           string             `json:"notes"`
 }
 
+// OrderItemRequest names the variant by its ID, or by the legacy string ID
+// older clients still send as variant_id
 type OrderItemRequest struct {
-	ProductID uint   `json:"product_id" binding:"required"`
-	VariantID string `json:"variant_id"`
-	Quantity  int    `json:"quantity" binding:"required,min=1"`
+	ProductID       uint   `json:"product_id" binding:"required"`
+	VariantID       *uint  `json:"variant_id"`
+	LegacyVariantID string `json:"-"`
+	Quantity        int    `json:"quantity" binding:"required,min=1"`
+}
+
+func (r *OrderItemRequest) UnmarshalJSON(data []byte) error {
+	type plain OrderItemRequest
+	aux := struct {
+		*plain
+		VariantID json.RawMessage `json:"variant_id"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	id, legacyID, err := ParseVariantID(aux.VariantID)
+	if err != nil {
+		return err
+	}
+	r.VariantID = nil
+	if id != 0 {
+		r.VariantID = &id
+	}
+	r.LegacyVariantID = legacyID
+	return nil
 }
 
 type OrderUpdateRequest struct {
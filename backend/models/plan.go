@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Unlimited marks a plan limit that is not enforced
+const Unlimited = -1
+
+// Plan sets the limits of the accounts subscribed to it. Limits of
+// Unlimited (-1) are not enforced.
+type Plan struct {
+	ID                  uint      `json:"id" gorm:"primaryKey"`
+	Code                string    `json:"code" gorm:"uniqueIndex;not null"`
+	Name                string    `json:"name" gorm:"not null"`
+	Price               float64   `json:"price" gorm:"default:0"`
+	MaxStores           int       `json:"max_stores"`
+	MaxProductsPerStore int       `json:"max_products_per_store"`
+	MaxStorageBytes     int64     `json:"max_storage_bytes"`
+	MaxStaffSeats       int       `json:"max_staff_seats"`
+	PremiumTemplates    bool      `json:"premium_templates" gorm:"default:false"`
+	AICreditsPerMonth   int       `json:"ai_credits_per_month"`
+	IsDefault           bool      `json:"is_default" gorm:"default:false"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// StoreUpload records a file uploaded for a store, so storage use can be
+// counted against the owner's plan. Pending uploads are not counted yet.
+type StoreUpload struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	StoreID   uint      `json:"store_id" gorm:"not null;index"`
+	Filename  string    `json:"filename" gorm:"not null"`
+	Size      int64     `json:"size" gorm:"not null"`
+	Pending   bool      `json:"pending" gorm:"not null;default:false"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Relationships
+	Store Store `json:"-" gorm:"foreignKey:StoreID"`
+}
+
+// AICreditUsage is one charge against a user's monthly AI credits
+type AICreditUsage struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	StoreID   *uint     `json:"store_id"`
+	Feature   string    `json:"feature" gorm:"not null"`
+	Credits   int       `json:"credits" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+type PlanRequest struct {
+	Code                string  `json:"code" binding:"required"`
+	Name                string  `json:"name" binding:"required"`
+	Price               float64 `json:"price" binding:"min=0"`
+	MaxStores           int     `json:"max_stores" binding:"min=-1"`
+	MaxProductsPerStore int     `json:"max_products_per_store" binding:"min=-1"`
+	MaxStorageBytes     int64   `json:"max_storage_bytes" binding:"min=-1"`
+	MaxStaffSeats       int     `json:"max_staff_seats" binding:"min=-1"`
+	PremiumTemplates    bool    `json:"premium_templates"`
+	AICreditsPerMonth   int     `json:"ai_credits_per_month" binding:"min=-1"`
+	IsDefault           bool    `json:"is_default"`
+}
+
+type UserPlanRequest struct {
+	PlanID uint `json:"plan_id" binding:"required"`
+}
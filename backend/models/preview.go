@@ -0,0 +1,74 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// PreviewTokenPrefix marks store preview tokens
+const PreviewTokenPrefix = "smp_"
+
+// StorePreviewToken is a shareable, expiring token that unlocks a store's
+// unpublished content (draft store and products, unpublished pages and the
+// unpublished layout) on the public endpoints. Only a hash is stored.
+type StorePreviewToken struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	StoreID     uint       `json:"store_id" gorm:"not null;index"`
+	CreatedByID uint       `json:"created_by_id" gorm:"not null"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix" gorm:"not null"`
+	TokenHash   string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Relationships
+	Store Store `json:"-" gorm:"foreignKey:StoreID"`
+}
+
+type PreviewTokenCreateRequest struct {
+	Name           string `json:"name"`
+	ExpiresInHours int    `json:"expires_in_hours" binding:"omitempty,min=1,max=720"`
+}
+
+// LayoutComponent is one component of a layout revision snapshot
+type LayoutComponent struct {
+	ID    string                 `json:"id"`
+	Type  string                 `json:"type"`
+	Props map[string]interface{} `json:"props"`
+	Order int                    `json:"order"`
+}
+
+type LayoutComponents []LayoutComponent
+
+func (lc LayoutComponents) Value() (driver.Value, error) {
+	return json.Marshal(lc)
+}
+
+func (lc *LayoutComponents) Scan(value interface{}) error {
+	if value == nil {
+		*lc = LayoutComponents{}
+		return nil
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, lc)
+	case string:
+		return json.Unmarshal([]byte(v), lc)
+	}
+	return nil
+}
+
+// StoreLayoutRevision is a published snapshot of a store's layout. The
+// working StoreLayout stays unpublished until the merchant publishes it.
+type StoreLayoutRevision struct {
+	ID            uint             `json:"id" gorm:"primaryKey"`
+	StoreID       uint             `json:"store_id" gorm:"not null;index"`
+	Components    LayoutComponents `json:"components" gorm:"type:jsonb"`
+	PublishedByID uint             `json:"published_by_id"`
+	CreatedAt     time.Time        `json:"created_at"`
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"fmt"
+	"strconv"
 	"time"
 
 	"gorm.io/gorm"
@@ -39,60 +41,156 @@ func (pi *ProductImages) Scan(value interface{}) error {
 
 type ProductVariants []ProductVariant
 
-func (pv ProductVariants) Value() (driver.Value, error) {
-	return json.Marshal(pv)
+// VariantOptions maps option names to the variant's values
+type VariantOptions map[string]string
+
+func (vo VariantOptions) Value() (driver.Value, error) {
+	return json.Marshal(vo)
 }
 
-func (pv *ProductVariants) Scan(value interface{}) error {
+func (vo *VariantOptions) Scan(value interface{}) error {
 	if value == nil {
-		*pv = []ProductVariant{}
+		*vo = make(map[string]string)
 		return nil
 	}
 
 	switch v := value.(type) {
 	case []byte:
-		return json.Unmarshal(v, pv)
+		return json.Unmarshal(v, vo)
 	case string:
-		return json.Unmarshal([]byte(v), pv)
+		return json.Unmarshal([]byte(v), vo)
 	}
 	return nil
 }
 
+// ProductVariant is a purchasable version of a product. SKUs are unique among
+// a store's live variants. Variants migrated from the old products.variants
+// column keep their string ID as LegacyID.
 type ProductVariant struct {
-	ID      string            `json:"id"`
-	Name    string            `json:"name"`
-	Price   float64           `json:"price"`
-	SKU     string            `json:"sku"`
-	Stock   int               `json:"stock"`
-	Options map[string]string `json:"options"`
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	LegacyID  string         `json:"legacy_id,omitempty" gorm:"index"`
+	ProductID uint           `json:"product_id" gorm:"not null;index"`
+	StoreID   uint           `json:"store_id" gorm:"not null;index;uniqueIndex:idx_product_variants_store_sku,where:sku <> '' AND deleted_at IS NULL"`
+	Name      string         `json:"name"`
+	Price     float64        `json:"price"`
+	SKU       string         `json:"sku" gorm:"uniqueIndex:idx_product_variants_store_sku,where:sku <> '' AND deleted_at IS NULL"`
+	Stock     int            `json:"stock" gorm:"default:0"`
+	Image     string         `json:"image,omitempty"`
+	Options   VariantOptions `json:"options" gorm:"type:jsonb"`
+	Position  int            `json:"position" gorm:"default:0"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// UnmarshalJSON accepts the variant's id as a number or, from clients written
+// against the old variants column, as its legacy string ID
+func (pv *ProductVariant) UnmarshalJSON(data []byte) error {
+	type plain ProductVariant
+	aux := struct {
+		*plain
+		ID json.RawMessage `json:"id"`
+	}{plain: (*plain)(pv)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	id, legacyID, err := ParseVariantID(aux.ID)
+	if err != nil {
+		return err
+	}
+	pv.ID = id
+	if legacyID != "" {
+		pv.LegacyID = legacyID
+	}
+	return nil
+}
+
+// ParseVariantID reads a variant reference that is either a numeric ID or a
+// legacy string ID. Numeric strings are taken as IDs.
+func ParseVariantID(raw json.RawMessage) (uint, string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, "", nil
+	}
+	var id uint
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id, "", nil
+	}
+	var legacyID string
+	if err := json.Unmarshal(raw, &legacyID); err != nil {
+		return 0, "", fmt.Errorf("invalid variant id %s", raw)
+	}
+	if parsed, err := strconv.ParseUint(legacyID, 10, 32); err == nil {
+		return uint(parsed), "", nil
+	}
+	return 0, legacyID, nil
+}
+
+// ProductOption is a product-level option such as Size with the values
+// variants are generated from
+type ProductOption struct {
+	Name   string   `json:"name" binding:"required"`
+	Values []string `json:"values" binding:"required,min=1,dive,required"`
+}
+
+type ProductOptions []ProductOption
+
+func (po ProductOptions) Value() (driver.Value, error) {
+	return json.Marshal(po)
+}
+
+func (po *ProductOptions) Scan(value interface{}) error {
+	if value == nil {
+		*po = []ProductOption{}
+		return nil
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, po)
+	case string:
+		return json.Unmarshal([]byte(v), po)
+	}
+	return nil
 }
 
 type Product struct {
-	ID           uint            `json:"id" gorm:"primaryKey"`
-	Name         string          `json:"name" gorm:"not null"`
-	Slug         string          `json:"slug" gorm:"not null"`
-	Description  string          `json:"description"`
-	ShortDesc    string          `json:"short_description"`
-	Price        float64         `json:"price" gorm:"not null"`
-	ComparePrice *float64        `json:"compare_price"`
-	SKU          string          `json:"sku"`
-	Images       ProductImages   `json:"images" gorm:"type:jsonb"`
-	Variants     ProductVariants `json:"variants" gorm:"type:jsonb"`
-	Status       ProductStatus   `json:"status" gorm:"default:'draft'"`
-	Stock        int             `json:"stock" gorm:"default:0"`
-	Weight       *float64        `json:"weight"`
-	IsDigital    bool            `json:"is_digital" gorm:"default:false"`
-	SeoTitle     string          `json:"seo_title"`
-	SeoDesc      string          `json:"seo_description"`
-	StoreID      uint            `json:"store_id" gorm:"not null"`
-	CategoryID   *uint           `json:"category_id"`
-	CreatedAt    time.Time       `json:"created_at"`
-	UpdatedAt    time.Time       `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt  `json:"-" gorm:"index"`
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	Name         string         `json:"name" gorm:"not null"`
+	Slug         string         `json:"slug" gorm:"not null"`
+	Description  string         `json:"description"`
+	ShortDesc    string         `json:"short_description"`
+	Price        float64        `json:"price" gorm:"not null"`
+	ComparePrice *float64       `json:"compare_price"`
+	SKU          string         `json:"sku"`
+	Images       ProductImages  `json:"images" gorm:"type:jsonb"`
+	MediaIDs     MediaIDs       `json:"media_ids" gorm:"type:jsonb"`
+	Options      ProductOptions `json:"options" gorm:"type:jsonb"`
+	Status       ProductStatus  `json:"status" gorm:"default:'draft'"`
+	Stock        int            `json:"stock" gorm:"default:0"`
+	Weight       *float64       `json:"weight"`
+	IsDigital    bool           `json:"is_digital" gorm:"default:false"`
+	SeoTitle     string         `json:"seo_title"`
+	SeoDesc      string         `json:"seo_description"`
+	StoreID      uint           `json:"store_id" gorm:"not null"`
+	CategoryID   *uint          `json:"category_id"`
+	// RatingAverage and RatingCount cache the product's approved reviews
+	RatingAverage float64        `json:"rating_average" gorm:"default:0"`
+	RatingCount   int            `json:"rating_count" gorm:"default:0"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Snippet highlights search matches; it is only set on search results
+	Snippet string `json:"snippet,omitempty" gorm:"->;-:migration"`
+
+	// Media holds the library images of MediaIDs; Images mirrors their URLs
+	// for clients that predate the media library
+	Media []Media `json:"media,omitempty" gorm:"-"`
 
 	// Relationships
-	Store    Store     `json:"store,omitempty" gorm:"foreignKey:StoreID"`
-	Category *Category `json:"category,omitempty" gorm:"foreignKey:CategoryID"`
+	Store    Store            `json:"store,omitempty" gorm:"foreignKey:StoreID"`
+	Category *Category        `json:"category,omitempty" gorm:"foreignKey:CategoryID"`
+	Variants []ProductVariant `json:"variants" gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE"`
 }
 
 type Category struct {
@@ -101,8 +199,9 @@ type Category struct {
 	Slug        string         `json:"slug" gorm:"not null"`
 	Description string         `json:"description"`
 	Image       string         `json:"image"`
-	ParentID    *uint          `json:"parent_id"`
-	StoreID     uint           `json:"store_id" gorm:"not null"`
+	ParentID    *uint          `json:"parent_id" gorm:"index"`
+	Position    int            `json:"position" gorm:"default:0"`
+	StoreID     uint           `json:"store_id" gorm:"not null;index"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
@@ -114,6 +213,59 @@ type Category struct {
 	Products []Product  `json:"products,omitempty" gorm:"foreignKey:CategoryID"`
 }
 
+type CategoryCreateRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	ParentID    *uint  `json:"parent_id"`
+	Position    *int   `json:"position" binding:"omitempty,min=0"`
+}
+
+type CategoryUpdateRequest struct {
+	Name        *string `json:"name" binding:"omitempty,min=1"`
+	Slug        *string `json:"slug" binding:"omitempty,min=1"`
+	Description *string `json:"description"`
+	Image       *string `json:"image"`
+}
+
+// CategoryMoveRequest places a category under ParentID, or at the top level
+// when it is null, at Position among its new siblings. An omitted Position
+// puts it last.
+type CategoryMoveRequest struct {
+	ParentID *uint `json:"parent_id"`
+	Position *int  `json:"position" binding:"omitempty,min=0"`
+}
+
+// VariantDefaults seed the fields of newly generated variants. Price falls
+// back to the product price. SKUPattern may use {sku} and {option name}
+// placeholders, e.g. "{sku}-{size}-{colour}".
+type VariantDefaults struct {
+	Price      *float64 `json:"price" binding:"omitempty,min=0"`
+	SKUPattern string   `json:"sku_pattern"`
+	Stock      *int     `json:"stock" binding:"omitempty,min=0"`
+}
+
+// ProductOptionsRequest replaces a product's options and regenerates its
+// variants
+type ProductOptionsRequest struct {
+	Options  ProductOptions  `json:"options" binding:"max=3,dive"`
+	Defaults VariantDefaults `json:"defaults"`
+}
+
+// ProductVariantStockRequest changes a variant's stock by a relative amount,
+// so concurrent adjustments do not overwrite each other
+type ProductVariantStockRequest struct {
+	Adjustment int `json:"adjustment" binding:"required"`
+}
+
+type ProductVariantUpdateRequest struct {
+	Price *float64 `json:"price" binding:"omitempty,min=0"`
+	SKU   *string  `json:"sku"`
+	Stock *int     `json:"stock" binding:"omitempty,min=0"`
+	Image *string  `json:"image"`
+}
+
 type ProductCreateRequest struct {
 	Name         string          `json:"name" binding:"required"`
 	Description  string          `json:"description"`
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestVariantIDAcceptsLegacyStrings(t *testing.T) {
+	tests := []struct {
+		raw      string
+		id       uint
+		legacyID string
+	}{
+		{`7`, 7, ""},
+		{`"7"`, 7, ""},
+		{`"var_1700000000_2"`, 0, "var_1700000000_2"},
+		{`null`, 0, ""},
+	}
+	for _, tt := range tests {
+		var item OrderItemRequest
+		body := fmt.Sprintf(`{"product_id": 1, "variant_id": %s, "quantity": 2}`, tt.raw)
+		if err := json.Unmarshal([]byte(body), &item); err != nil {
+			t.Fatalf("%s: %v", body, err)
+		}
+		var id uint
+		if item.VariantID != nil {
+			id = *item.VariantID
+		}
+		if id != tt.id || item.LegacyVariantID != tt.legacyID || item.ProductID != 1 || item.Quantity != 2 {
+			t.Errorf("%s: decoded %+v", body, item)
+		}
+
+		var variant ProductVariant
+		body = fmt.Sprintf(`{"id": %s, "name": "Small"}`, tt.raw)
+		if err := json.Unmarshal([]byte(body), &variant); err != nil {
+			t.Fatalf("%s: %v", body, err)
+		}
+		if variant.ID != tt.id || variant.LegacyID != tt.legacyID || variant.Name != "Small" {
+			t.Errorf("%s: decoded %+v", body, variant)
+		}
+	}
+
+	var item OrderItemRequest
+	if err := json.Unmarshal([]byte(`{"product_id": 1, "variant_id": true}`), &item); err == nil {
+		t.Error("boolean variant_id accepted")
+	}
+}
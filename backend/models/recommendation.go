@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+type RecommendationKind string
+
+const (
+	// RecommendationKindRelated blends co-purchases with category similarity
+	RecommendationKindRelated RecommendationKind = "related"
+	// RecommendationKindBoughtTogether is products often in the same orders
+	RecommendationKindBoughtTogether RecommendationKind = "bought_together"
+)
+
+// ProductRecommendation is a computed recommendation of RecommendedID on
+// ProductID's page. The recommendations job replaces a product's rows each
+// time it runs.
+type ProductRecommendation struct {
+	ID            uint               `json:"id" gorm:"primaryKey"`
+	StoreID       uint               `json:"store_id" gorm:"not null;index"`
+	ProductID     uint               `json:"product_id" gorm:"not null;index:idx_product_recommendations_product_kind"`
+	Kind          RecommendationKind `json:"kind" gorm:"not null;index:idx_product_recommendations_product_kind"`
+	RecommendedID uint               `json:"recommended_id" gorm:"not null"`
+	Score         float64            `json:"score"`
+	Position      int                `json:"position"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+// ProductRecommendationOverride is a merchant's choice to pin a product to
+// the top of another's recommendations, in Position order, or to exclude it
+type ProductRecommendationOverride struct {
+	ID            uint               `json:"id" gorm:"primaryKey"`
+	StoreID       uint               `json:"store_id" gorm:"not null;index"`
+	ProductID     uint               `json:"product_id" gorm:"not null;uniqueIndex:idx_recommendation_overrides_product"`
+	Kind          RecommendationKind `json:"kind" gorm:"not null;uniqueIndex:idx_recommendation_overrides_product"`
+	RecommendedID uint               `json:"recommended_id" gorm:"not null;uniqueIndex:idx_recommendation_overrides_product"`
+	Excluded      bool               `json:"excluded" gorm:"default:false"`
+	Position      int                `json:"position"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+// RecommendationOverrideList pins products, in order, and excludes others
+type RecommendationOverrideList struct {
+	Pinned   []uint `json:"pinned" binding:"max=12"`
+	Excluded []uint `json:"excluded" binding:"max=100"`
+}
+
+// RecommendationOverridesRequest replaces a product's overrides of each kind
+// given; omitted kinds keep theirs
+type RecommendationOverridesRequest struct {
+	Related        *RecommendationOverrideList `json:"related"`
+	BoughtTogether *RecommendationOverrideList `json:"bought_together"`
+}
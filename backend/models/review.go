@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ReviewStatus string
+
+const (
+	ReviewStatusPending  ReviewStatus = "pending"
+	ReviewStatusApproved ReviewStatus = "approved"
+	ReviewStatusRejected ReviewStatus = "rejected"
+)
+
+// Review is a customer's review of a product. New reviews wait in the
+// store's moderation queue; only approved ones are shown on the storefront
+// and counted in the product's rating. Verified reviews were matched to an
+// order that included the product. Each email may review a product once.
+type Review struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	StoreID     uint           `json:"store_id" gorm:"not null;index"`
+	ProductID   uint           `json:"product_id" gorm:"not null;index;uniqueIndex:idx_reviews_product_email,where:deleted_at IS NULL"`
+	OrderID     *uint          `json:"order_id" gorm:"index"`
+	Verified    bool           `json:"verified" gorm:"default:false"`
+	Rating      int            `json:"rating" gorm:"not null"`
+	Title       string         `json:"title"`
+	Body        string         `json:"body" gorm:"type:text"`
+	PhotoIDs    MediaIDs       `json:"photo_ids" gorm:"type:jsonb"`
+	Name        string         `json:"name" gorm:"not null"`
+	Email       string         `json:"email" gorm:"not null;uniqueIndex:idx_reviews_product_email,where:deleted_at IS NULL"`
+	Status      ReviewStatus   `json:"status" gorm:"default:'pending';index"`
+	Reply       string         `json:"reply" gorm:"type:text"`
+	RepliedAt   *time.Time     `json:"replied_at"`
+	ModeratedAt *time.Time     `json:"moderated_at"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Photos holds the media library images of PhotoIDs
+	Photos []Media `json:"photos,omitempty" gorm:"-"`
+
+	// Relationships
+	Store   Store    `json:"-" gorm:"foreignKey:StoreID"`
+	Product *Product `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	Order   *Order   `json:"-" gorm:"foreignKey:OrderID;constraint:OnDelete:SET NULL"`
+}
+
+// ReviewCreateRequest is a storefront review, sent as JSON or, with photos,
+// as multipart/form-data. OrderNumber marks the review verified when it
+// names an order for the product placed with Email.
+type ReviewCreateRequest struct {
+	Rating      int    `json:"rating" form:"rating" binding:"required,min=1,max=5"`
+	Title       string `json:"title" form:"title" binding:"max=200"`
+	Body        string `json:"body" form:"body" binding:"required,max=5000"`
+	Name        string `json:"name" form:"name" binding:"required,max=100"`
+	Email       string `json:"email" form:"email" binding:"required,email"`
+	OrderNumber string `json:"order_number" form:"order_number"`
+}
+
+type ReviewModerateRequest struct {
+	Status ReviewStatus `json:"status" binding:"required,oneof=pending approved rejected"`
+}
+
+type ReviewReplyRequest struct {
+	Body string `json:"body" binding:"required,max=5000"`
+}
@@ -9,26 +9,34 @@ import (
 type StoreStatus string
 
 const (
-	StoreStatusActive   StoreStatus = "active"
+	StoreStatusDraft         StoreStatus = "draft"
+	StoreStatusPendingReview StoreStatus = "pending_review"
+	StoreStatusActive        StoreStatus = "active"
+	StoreStatusSuspended     StoreStatus = "suspended"
+	StoreStatusArchived      StoreStatus = "archived"
+
+	// StoreStatusInactive predates the lifecycle; such stores are migrated to draft
 	StoreStatusInactive StoreStatus = "inactive"
-	StoreStatusDraft    StoreStatus = "draft"
 )
 
 type Store struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	Name        string         `json:"name" gorm:"not null"`
-	Slug        string         `json:"slug" gorm:"uniqueIndex;not null"`
-	Description string         `json:"description"`
-	Logo        string         `json:"logo"`
-	Favicon     string         `json:"favicon"`
-	Domain      string         `json:"domain" gorm:"uniqueIndex"`
-	Subdomain   string         `json:"subdomain" gorm:"uniqueIndex"`
-	Status      StoreStatus    `json:"status" gorm:"default:'draft'"`
-	OwnerID     uint           `json:"owner_id" gorm:"not null"`
-	TemplateID  *uint          `json:"template_id"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID               uint           `json:"id" gorm:"primaryKey"`
+	Name             string         `json:"name" gorm:"not null"`
+	Slug             string         `json:"slug" gorm:"uniqueIndex;not null"`
+	Description      string         `json:"description"`
+	Logo             string         `json:"logo"`
+	Favicon          string         `json:"favicon"`
+	Domain           string         `json:"domain" gorm:"uniqueIndex"`
+	Subdomain        string         `json:"subdomain" gorm:"uniqueIndex"`
+	DomainVerifiedAt *time.Time     `json:"domain_verified_at"`
+	Status           StoreStatus    `json:"status" gorm:"default:'draft'"`
+	SuspensionReason string         `json:"suspension_reason,omitempty"`
+	SuspendedAt      *time.Time     `json:"suspended_at,omitempty"`
+	OwnerID          uint           `json:"owner_id" gorm:"not null"`
+	TemplateID       *uint          `json:"template_id"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	Owner      User           `json:"owner,omitempty" gorm:"foreignKey:OwnerID"`
@@ -117,10 +125,15 @@ type StoreUpdateRequest struct {
 	Description *string      `json:"description,omitempty"`
 	Logo        *string      `json:"logo,omitempty"`
 	Favicon     *string      `json:"favicon,omitempty"`
-	Domain      *string      `json:"domain,omitempty"`
 	Status      *StoreStatus `json:"status,omitempty"`
 }
 
+// StoreLifecycleRequest triggers a lifecycle event such as "submit" or "suspend"
+type StoreLifecycleRequest struct {
+	Event  string `json:"event" binding:"required"`
+	Reason string `json:"reason"`
+}
+
 type StoreResponse struct {
 	ID          uint        `json:"id"`
 	Name        string      `json:"name"`
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+)
+
+type StoreAccessMode string
+
+const (
+	StoreAccessOpen        StoreAccessMode = "open"
+	StoreAccessPassword    StoreAccessMode = "password"
+	StoreAccessMaintenance StoreAccessMode = "maintenance"
+)
+
+// StoreAccessPolicy gates a store's public endpoints. Password-protected
+// stores admit visitors holding an access token issued for the current
+// PasswordVersion; maintenance mode turns everyone away. Listed IPs and
+// preview tokens bypass both.
+type StoreAccessPolicy struct {
+	ID                 uint            `json:"id" gorm:"primaryKey"`
+	StoreID            uint            `json:"store_id" gorm:"uniqueIndex;not null"`
+	Mode               StoreAccessMode `json:"mode" gorm:"default:'open'"`
+	PasswordHash       string          `json:"-"`
+	PasswordVersion    int             `json:"-" gorm:"default:0"`
+	MaintenanceMessage string          `json:"maintenance_message"`
+	RetryAfterSeconds  int             `json:"retry_after_seconds" gorm:"default:0"`
+	BypassIPs          StringList      `json:"bypass_ips" gorm:"type:jsonb"`
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
+
+	// Relationships
+	Store Store `json:"-" gorm:"foreignKey:StoreID"`
+}
+
+// HasPassword reports whether a storefront password has been set
+func (p *StoreAccessPolicy) HasPassword() bool {
+	return p.PasswordHash != ""
+}
+
+type StoreAccessUpdateRequest struct {
+	Mode               StoreAccessMode `json:"mode" binding:"required,oneof=open password maintenance"`
+	Password           *string         `json:"password,omitempty" binding:"omitempty,min=4"`
+	MaintenanceMessage *string         `json:"maintenance_message,omitempty"`
+	RetryAfterSeconds  *int            `json:"retry_after_seconds,omitempty" binding:"omitempty,min=0,max=604800"`
+	BypassIPs          []string        `json:"bypass_ips,omitempty"`
+}
+
+type StoreUnlockRequest struct {
+	Password string `json:"password" binding:"required"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type DomainStatus string
+
+const (
+	DomainStatusPending  DomainStatus = "pending"
+	DomainStatusVerified DomainStatus = "verified"
+	DomainStatusFailed   DomainStatus = "failed"
+)
+
+// StoreDomain is a store's claim on a custom domain. The claim is proven by
+// publishing the token in a DNS TXT record; only once verified does the
+// domain become the store's Domain and route traffic. Several stores may hold
+// pending claims on the same domain, the first to verify wins.
+type StoreDomain struct {
+	ID                  uint           `json:"id" gorm:"primaryKey"`
+	StoreID             uint           `json:"store_id" gorm:"not null;index"`
+	Domain              string         `json:"domain" gorm:"not null;index"`
+	Token               string         `json:"token" gorm:"not null"`
+	Status              DomainStatus   `json:"status" gorm:"default:'pending';index"`
+	ConsecutiveFailures int            `json:"consecutive_failures" gorm:"default:0"`
+	LastError           string         `json:"last_error"`
+	LastCheckedAt       *time.Time     `json:"last_checked_at"`
+	NextCheckAt         *time.Time     `json:"next_check_at" gorm:"index"`
+	VerifiedAt          *time.Time     `json:"verified_at"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	DeletedAt           gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Relationships
+	Store Store `json:"-" gorm:"foreignKey:StoreID"`
+}
+
+type DomainClaimRequest struct {
+	Domain string `json:"domain" binding:"required"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+type StoreTransferStatus string
+
+const (
+	StoreTransferPending   StoreTransferStatus = "pending"
+	StoreTransferAccepted  StoreTransferStatus = "accepted"
+	StoreTransferDeclined  StoreTransferStatus = "declined"
+	StoreTransferCancelled StoreTransferStatus = "cancelled"
+)
+
+// StoreTransfer hands a store to another account. The recipient accepts with
+// the token emailed to them; only its hash is stored.
+type StoreTransfer struct {
+	ID          uint                `json:"id" gorm:"primaryKey"`
+	StoreID     uint                `json:"store_id" gorm:"not null;index"`
+	FromUserID  uint                `json:"from_user_id" gorm:"not null;index"`
+	ToEmail     string              `json:"to_email" gorm:"not null;index"`
+	ToUserID    *uint               `json:"to_user_id"`
+	TokenHash   string              `json:"-" gorm:"uniqueIndex;not null"`
+	Status      StoreTransferStatus `json:"status" gorm:"default:'pending';index"`
+	Message     string              `json:"message"`
+	ExpiresAt   time.Time           `json:"expires_at"`
+	RespondedAt *time.Time          `json:"responded_at"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+
+	// Relationships
+	Store    Store `json:"store,omitempty" gorm:"foreignKey:StoreID"`
+	FromUser User  `json:"-" gorm:"foreignKey:FromUserID"`
+}
+
+// IsOpen reports whether the transfer can still be accepted
+func (t *StoreTransfer) IsOpen() bool {
+	return t.Status == StoreTransferPending && time.Now().Before(t.ExpiresAt)
+}
+
+type StoreTransferRequest struct {
+	Email   string `json:"email" binding:"required,email"`
+	Message string `json:"message" binding:"max=1000"`
+}
+
+type StoreTransferResponseRequest struct {
+	Token string `json:"token" binding:"required"`
+}
@@ -13,19 +13,28 @@ const (
 	RoleMerchant UserRole = "merchant"
 	RoleCustomer UserRole = "customer"
 )
-<<<<<<< HEAD
 
-=======
 // user model
->>>>>>> url/main
 type User struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Email     string         `json:"email" gorm:"uniqueIndex;not null"`
-	Password  string         `json:"-" gorm:"not null"`
-	FirstName string         `json:"first_name"`
-	LastName  string         `json:"last_name"`
-	Role      UserRole       `json:"role" gorm:"default:'merchant'"`
-	IsActive  bool           `json:"is_active" gorm:"default:true"`
+	ID        uint     `json:"id" gorm:"primaryKey"`
+	Email     string   `json:"email" gorm:"uniqueIndex;not null"`
+	Password  string   `json:"-" gorm:"not null"`
+	FirstName string   `json:"first_name"`
+	LastName  string   `json:"last_name"`
+	Role      UserRole `json:"role" gorm:"default:'merchant'"`
+	IsActive  bool     `json:"is_active" gorm:"default:true"`
+
+	// Set once the user proves they own the address
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	// Subscription plan; the default plan applies when unset
+	PlanID *uint `json:"plan_id" gorm:"index"`
+
+	// Two-factor authentication (TOTP)
+	TwoFactorEnabled  bool   `json:"two_factor_enabled" gorm:"default:false"`
+	TwoFactorSecret   string `json:"-"`
+	TwoFactorLastStep int64  `json:"-" gorm:"default:0"`
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
@@ -55,4 +64,11 @@ type UserResponse struct {
 	Role      UserRole  `json:"role"`
 	IsActive  bool      `json:"is_active"`
 	CreatedAt time.Time `json:"created_at"`
+
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+}
+
+type EmailVerifyRequest struct {
+	Token string `json:"token" binding:"required"`
 }
@@ -0,0 +1,19 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"storemaker-backend/utils"
+)
+
+// NewCodeVerifier returns a random PKCE code verifier (RFC 7636 section 4.1)
+func NewCodeVerifier() (string, error) {
+	return utils.GenerateRandomString(64)
+}
+
+// CodeChallengeS256 derives the S256 code challenge for a verifier
+func CodeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,283 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID    = "storemaker-test"
+	testRedirectURL = "http://localhost:3000/auth/oidc/stub/callback"
+	testKeyID       = "stub-key"
+)
+
+// stubIssuer is a local OpenID provider serving discovery, JWKS, authorize
+// and token endpoints. The token endpoint checks the PKCE verifier against
+// the challenge sent to the authorize endpoint.
+type stubIssuer struct {
+	t   *testing.T
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+	nonce     string
+	code      string
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub := &stubIssuer{t: t, key: key, code: "stub-code"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, Discovery{
+			Issuer:                stub.issuer(),
+			AuthorizationEndpoint: stub.issuer() + "/authorize",
+			TokenEndpoint:         stub.issuer() + "/token",
+			JWKSURI:               stub.issuer() + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"keys": []jsonWebKey{{
+			Kty: "RSA",
+			Kid: testKeyID,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != testClientID {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		stub.mu.Lock()
+		stub.challenge = query.Get("code_challenge")
+		stub.nonce = query.Get("nonce")
+		stub.mu.Unlock()
+
+		redirect := query.Get("redirect_uri") + "?" + url.Values{"code": {stub.code}, "state": {query.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		stub.mu.Lock()
+		challenge, nonce := stub.challenge, stub.nonce
+		stub.mu.Unlock()
+
+		if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != stub.code ||
+			r.PostForm.Get("redirect_uri") != testRedirectURL ||
+			CodeChallengeS256(r.PostForm.Get("code_verifier")) != challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, TokenResponse{
+			AccessToken: "stub-access-token",
+			IDToken:     stub.sign(testKeyID, stub.key, stub.claims(nonce)),
+			TokenType:   "Bearer",
+			ExpiresIn:   3600,
+		})
+	})
+
+	stub.srv = httptest.NewServer(mux)
+	t.Cleanup(stub.srv.Close)
+	return stub
+}
+
+func (s *stubIssuer) issuer() string {
+	return s.srv.URL
+}
+
+func (s *stubIssuer) provider() *Provider {
+	return NewProvider(ProviderConfig{
+		Name:        "stub",
+		Issuer:      s.issuer(),
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	}, s.srv.Client())
+}
+
+// claims are valid ID token claims for the given nonce
+func (s *stubIssuer) claims(nonce string) IDTokenClaims {
+	now := time.Now()
+	return IDTokenClaims{
+		Email:         "shopper@example.com",
+		EmailVerified: true,
+		Name:          "Sam Shopper",
+		Nonce:         nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer(),
+			Subject:   "stub-subject-1",
+			Audience:  jwt.ClaimStrings{testClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+}
+
+func (s *stubIssuer) sign(kid string, key *rsa.PrivateKey, claims IDTokenClaims) string {
+	s.t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return signed
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	stub := newStubIssuer(t)
+	provider := stub.provider()
+	ctx := context.Background()
+
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := provider.AuthorizationURL(ctx, "state-1", "nonce-1", CodeChallengeS256(verifier))
+	if err != nil {
+		t.Fatalf("AuthorizationURL: %v", err)
+	}
+
+	// Follow the browser to the provider, stopping at the redirect back to us
+	client := *stub.srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if got := location.Query().Get("state"); got != "state-1" {
+		t.Fatalf("state = %q, want state-1", got)
+	}
+
+	if _, err := provider.Exchange(ctx, location.Query().Get("code"), verifier+"x"); err == nil {
+		t.Fatal("Exchange accepted the wrong PKCE verifier")
+	}
+
+	tokens, err := provider.Exchange(ctx, location.Query().Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, tokens.IDToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims.Subject != "stub-subject-1" || claims.Email != "shopper@example.com" || !bool(claims.EmailVerified) {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	stub := newStubIssuer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  func() string
+		reason string
+	}{
+		{"bad nonce", func() string {
+			return stub.sign(testKeyID, stub.key, stub.claims("other-nonce"))
+		}, "nonce"},
+		{"missing nonce", func() string {
+			return stub.sign(testKeyID, stub.key, stub.claims(""))
+		}, "nonce"},
+		{"bad audience", func() string {
+			claims := stub.claims("nonce-1")
+			claims.Audience = jwt.ClaimStrings{"another-client"}
+			return stub.sign(testKeyID, stub.key, claims)
+		}, "aud"},
+		{"bad issuer", func() string {
+			claims := stub.claims("nonce-1")
+			claims.Issuer = "https://evil.example.com"
+			return stub.sign(testKeyID, stub.key, claims)
+		}, "iss"},
+		{"expired", func() string {
+			claims := stub.claims("nonce-1")
+			claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(-2 * time.Hour))
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+			return stub.sign(testKeyID, stub.key, claims)
+		}, "expired"},
+		{"unknown kid", func() string {
+			return stub.sign("rotated-away", stub.key, stub.claims("nonce-1"))
+		}, "unknown signing key"},
+		{"wrong key", func() string {
+			return stub.sign(testKeyID, otherKey, stub.claims("nonce-1"))
+		}, "signature"},
+		{"unsigned", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodNone, stub.claims("nonce-1"))
+			signed, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return signed
+		}, "signing method"},
+	}
+
+	provider := stub.provider()
+	ctx := context.Background()
+	// Load the key set first, as a real login would have
+	if _, err := provider.VerifyIDToken(ctx, stub.sign(testKeyID, stub.key, stub.claims("nonce-1")), "nonce-1"); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(ctx, tt.token(), "nonce-1")
+			if err == nil {
+				t.Fatal("token was accepted")
+			}
+			if !strings.Contains(err.Error(), tt.reason) {
+				t.Fatalf("error %q does not mention %q", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	stub := newStubIssuer(t)
+	provider := NewProvider(ProviderConfig{
+		Name:        "stub",
+		Issuer:      stub.issuer() + "/",
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	}, stub.srv.Client())
+
+	if _, err := provider.Discover(context.Background()); err == nil {
+		t.Fatal("discovery accepted a document for another issuer")
+	}
+}
@@ -0,0 +1,274 @@
+// Package plans resolves a user's plan and checks usage against its limits
+package plans
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"storemaker-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Quota names a limited resource
+type Quota string
+
+const (
+	QuotaStores     Quota = "stores"
+	QuotaProducts   Quota = "products_per_store"
+	QuotaStorage    Quota = "storage_bytes"
+	QuotaStaffSeats Quota = "staff_seats"
+	QuotaAICredits  Quota = "ai_credits"
+)
+
+// AI features and what they cost in credits
+const (
+	FeatureAIStore = "ai_store"
+
+	AIStoreCredits = 1
+)
+
+// LimitError reports that an action would take usage past the plan limit
+type LimitError struct {
+	Quota Quota
+	Limit int64
+	Used  int64
+	Plan  string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit of %d reached on the %s plan", e.Quota, e.Limit, e.Plan)
+}
+
+// ErrPremiumTemplate is returned when the plan does not include premium templates
+var ErrPremiumTemplate = errors.New("premium templates are not included in your plan")
+
+// Defaults are the plans created on first migration
+func Defaults() []models.Plan {
+	const gb = 1 << 30
+	return []models.Plan{
+		{
+			Code: "free", Name: "Free", Price: 0,
+			MaxStores: 1, MaxProductsPerStore: 50, MaxStorageBytes: gb / 2,
+			MaxStaffSeats: 0, PremiumTemplates: false, AICreditsPerMonth: 3,
+			IsDefault: true,
+		},
+		{
+			Code: "pro", Name: "Pro", Price: 29,
+			MaxStores: 3, MaxProductsPerStore: 1000, MaxStorageBytes: 10 * gb,
+			MaxStaffSeats: 5, PremiumTemplates: true, AICreditsPerMonth: 50,
+		},
+		{
+			Code: "agency", Name: "Agency", Price: 99,
+			MaxStores: models.Unlimited, MaxProductsPerStore: 10000, MaxStorageBytes: 100 * gb,
+			MaxStaffSeats: 25, PremiumTemplates: true, AICreditsPerMonth: 500,
+		},
+	}
+}
+
+// Seed creates the default plans that do not exist yet
+func Seed(db *gorm.DB) error {
+	for _, plan := range Defaults() {
+		plan := plan
+		if err := db.Where("code = ?", plan.Code).FirstOrCreate(&plan).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForUser returns the user's plan, or the default plan when none is assigned
+func ForUser(db *gorm.DB, userID uint) (*models.Plan, error) {
+	var user models.User
+	if err := db.Select("id", "plan_id").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var plan models.Plan
+	if user.PlanID != nil {
+		err := db.First(&plan, *user.PlanID).Error
+		if err == nil {
+			return &plan, nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+	}
+	if err := db.Where("is_default = ?", true).Order("id").First(&plan).Error; err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func check(plan *models.Plan, quota Quota, limit, used, adding int64) error {
+	if limit == models.Unlimited || used+adding <= limit {
+		return nil
+	}
+	return &LimitError{Quota: quota, Limit: limit, Used: used, Plan: plan.Code}
+}
+
+// CheckStores checks the user can own adding more stores
+func CheckStores(db *gorm.DB, plan *models.Plan, userID uint, adding int) error {
+	used, err := StoreCount(db, userID)
+	if err != nil {
+		return err
+	}
+	return check(plan, QuotaStores, int64(plan.MaxStores), used, int64(adding))
+}
+
+// CheckProducts checks the store can take adding more products
+func CheckProducts(db *gorm.DB, plan *models.Plan, storeID uint, adding int) error {
+	var used int64
+	if err := db.Model(&models.Product{}).Where("store_id = ?", storeID).Count(&used).Error; err != nil {
+		return err
+	}
+	return check(plan, QuotaProducts, int64(plan.MaxProductsPerStore), used, int64(adding))
+}
+
+// CheckStorage checks the user's stores can take adding more bytes of uploads
+func CheckStorage(db *gorm.DB, plan *models.Plan, userID uint, adding int64) error {
+	used, err := StorageBytes(db, userID)
+	if err != nil {
+		return err
+	}
+	return check(plan, QuotaStorage, plan.MaxStorageBytes, used, adding)
+}
+
+// CheckAICredits checks the user has credits left this month
+func CheckAICredits(db *gorm.DB, plan *models.Plan, userID uint, credits int) error {
+	used, err := AICreditsUsed(db, userID)
+	if err != nil {
+		return err
+	}
+	return check(plan, QuotaAICredits, int64(plan.AICreditsPerMonth), used, int64(credits))
+}
+
+// CheckTemplate checks the plan may use the template
+func CheckTemplate(plan *models.Plan, template *models.Template) error {
+	if template.IsPremium && !plan.PremiumTemplates {
+		return ErrPremiumTemplate
+	}
+	return nil
+}
+
+// ChargeAICredits records credits spent on an AI feature
+func ChargeAICredits(db *gorm.DB, userID uint, storeID *uint, feature string, credits int) error {
+	return db.Create(&models.AICreditUsage{
+		UserID:  userID,
+		StoreID: storeID,
+		Feature: feature,
+		Credits: credits,
+	}).Error
+}
+
+// StoreCount counts the stores the user owns, leaving out those in the trash
+func StoreCount(db *gorm.DB, userID uint) (int64, error) {
+	var count int64
+	err := db.Model(&models.Store{}).Where("owner_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// StorageBytes sums the uploads of every store the user owns. Uploads of
+// stores in the trash count until the store is purged; pending uploads do
+// not count until they are published.
+func StorageBytes(db *gorm.DB, userID uint) (int64, error) {
+	var total int64
+	err := db.Model(&models.StoreUpload{}).
+		Where("store_id IN (?) AND pending = ?", db.Unscoped().Model(&models.Store{}).Select("id").Where("owner_id = ?", userID), false).
+		Select("COALESCE(SUM(size), 0)").Scan(&total).Error
+	return total, err
+}
+
+// AICreditsUsed sums the credits the user spent in the current calendar month
+func AICreditsUsed(db *gorm.DB, userID uint) (int64, error) {
+	var total int64
+	err := db.Model(&models.AICreditUsage{}).
+		Where("user_id = ? AND created_at >= ?", userID, monthStart(time.Now())).
+		Select("COALESCE(SUM(credits), 0)").Scan(&total).Error
+	return total, err
+}
+
+func monthStart(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+}
+
+// UsageItem pairs consumption with its limit
+type UsageItem struct {
+	Used  int64 `json:"used"`
+	Limit int64 `json:"limit"`
+}
+
+// StoreUsage is the product count of one store
+type StoreUsage struct {
+	StoreID  uint      `json:"store_id"`
+	Name     string    `json:"name"`
+	Products UsageItem `json:"products"`
+}
+
+// Summary is a user's consumption against their plan
+type Summary struct {
+	Plan             *models.Plan `json:"plan"`
+	Stores           UsageItem    `json:"stores"`
+	StorageBytes     UsageItem    `json:"storage_bytes"`
+	AICredits        UsageItem    `json:"ai_credits"`
+	AICreditsResetAt time.Time    `json:"ai_credits_reset_at"`
+	StaffSeats       UsageItem    `json:"staff_seats"`
+	PremiumTemplates bool         `json:"premium_templates"`
+	StoreProducts    []StoreUsage `json:"store_products"`
+}
+
+// Usage summarises the user's consumption
+func Usage(db *gorm.DB, userID uint) (*Summary, error) {
+	plan, err := ForUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stores, err := StoreCount(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := StorageBytes(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	credits, err := AICreditsUsed(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var productCounts []struct {
+		StoreID uint
+		Name    string
+		Count   int64
+	}
+	if err := db.Model(&models.Store{}).
+		Select("stores.id AS store_id, stores.name, COUNT(products.id) AS count").
+		Joins("LEFT JOIN products ON products.store_id = stores.id AND products.deleted_at IS NULL").
+		Where("stores.owner_id = ?", userID).
+		Group("stores.id, stores.name").Order("stores.id").
+		Scan(&productCounts).Error; err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{
+		Plan:             plan,
+		Stores:           UsageItem{Used: stores, Limit: int64(plan.MaxStores)},
+		StorageBytes:     UsageItem{Used: storage, Limit: plan.MaxStorageBytes},
+		AICredits:        UsageItem{Used: credits, Limit: int64(plan.AICreditsPerMonth)},
+		AICreditsResetAt: monthStart(time.Now()).AddDate(0, 1, 0),
+		// There are no staff accounts yet, so no seats are taken
+		StaffSeats:       UsageItem{Used: 0, Limit: int64(plan.MaxStaffSeats)},
+		PremiumTemplates: plan.PremiumTemplates,
+		StoreProducts:    make([]StoreUsage, 0, len(productCounts)),
+	}
+	for _, row := range productCounts {
+		summary.StoreProducts = append(summary.StoreProducts, StoreUsage{
+			StoreID:  row.StoreID,
+			Name:     row.Name,
+			Products: UsageItem{Used: row.Count, Limit: int64(plan.MaxProductsPerStore)},
+		})
+	}
+	return summary, nil
+}
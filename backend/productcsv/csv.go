@@ -0,0 +1,176 @@
+// Package productcsv imports and exports a store's products as CSV files in
+// Shopify's product column layout
+package productcsv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Import file limits
+const (
+	MaxImportBytes = 10 << 20
+	MaxImportRows  = 20000
+)
+
+// ErrInvalidFile is wrapped by errors about the file as a whole
+var ErrInvalidFile = errors.New("invalid product CSV")
+
+// Columns of Shopify's product CSV. Short Description is ours; Shopify
+// ignores columns it does not know.
+const (
+	colHandle              = "Handle"
+	colTitle               = "Title"
+	colBody                = "Body (HTML)"
+	colVendor              = "Vendor"
+	colProductCategory     = "Product Category"
+	colType                = "Type"
+	colTags                = "Tags"
+	colPublished           = "Published"
+	colVariantSKU          = "Variant SKU"
+	colVariantGrams        = "Variant Grams"
+	colInventoryTracker    = "Variant Inventory Tracker"
+	colInventoryQty        = "Variant Inventory Qty"
+	colInventoryPolicy     = "Variant Inventory Policy"
+	colFulfillmentService  = "Variant Fulfillment Service"
+	colVariantPrice        = "Variant Price"
+	colVariantComparePrice = "Variant Compare At Price"
+	colRequiresShipping    = "Variant Requires Shipping"
+	colTaxable             = "Variant Taxable"
+	colBarcode             = "Variant Barcode"
+	colImageSrc            = "Image Src"
+	colImagePosition       = "Image Position"
+	colImageAlt            = "Image Alt Text"
+	colGiftCard            = "Gift Card"
+	colSEOTitle            = "SEO Title"
+	colSEODescription      = "SEO Description"
+	colVariantImage        = "Variant Image"
+	colWeightUnit          = "Variant Weight Unit"
+	colStatus              = "Status"
+	colShortDescription    = "Short Description"
+)
+
+func optionNameColumn(i int) string {
+	return fmt.Sprintf("Option%d Name", i+1)
+}
+
+func optionValueColumn(i int) string {
+	return fmt.Sprintf("Option%d Value", i+1)
+}
+
+// columns is the export column order
+var columns = []string{
+	colHandle, colTitle, colBody, colVendor, colProductCategory, colType, colTags, colPublished,
+	optionNameColumn(0), optionValueColumn(0),
+	optionNameColumn(1), optionValueColumn(1),
+	optionNameColumn(2), optionValueColumn(2),
+	colVariantSKU, colVariantGrams, colInventoryTracker, colInventoryQty, colInventoryPolicy,
+	colFulfillmentService, colVariantPrice, colVariantComparePrice, colRequiresShipping,
+	colTaxable, colBarcode, colImageSrc, colImagePosition, colImageAlt, colGiftCard,
+	colSEOTitle, colSEODescription, colVariantImage, colWeightUnit, colStatus, colShortDescription,
+}
+
+// Shopify's placeholder option for products without variants
+const (
+	defaultOptionName  = "Title"
+	defaultOptionValue = "Default Title"
+)
+
+// File is a parsed import file
+type File struct {
+	// header maps lower-cased column names to their index
+	header map[string]int
+	rows   []row
+}
+
+// row is one data row; line is the line of the file it starts on, counting
+// the header as line 1
+type row struct {
+	line   int
+	fields []string
+	header map[string]int
+}
+
+// Parse reads a product CSV. Columns are matched by name, in any order and
+// case; unknown columns are ignored. Each product needs a Handle, or a Title
+// to derive one from.
+func Parse(r io.Reader) (*File, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	names, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+
+	file := &File{header: make(map[string]int, len(names))}
+	for i, name := range names {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		key := strings.ToLower(strings.TrimSpace(name))
+		if _, dup := file.header[key]; key != "" && !dup {
+			file.header[key] = i
+		}
+	}
+	if !file.hasColumn(colHandle) && !file.hasColumn(colTitle) {
+		return nil, fmt.Errorf("%w: a %s or %s column is required", ErrInvalidFile, colHandle, colTitle)
+	}
+
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+		if blank(fields) {
+			continue
+		}
+		if len(file.rows) == MaxImportRows {
+			return nil, fmt.Errorf("%w: files can have at most %d rows", ErrInvalidFile, MaxImportRows)
+		}
+		line, _ := reader.FieldPos(0)
+		file.rows = append(file.rows, row{line: line, fields: fields, header: file.header})
+	}
+	if len(file.rows) == 0 {
+		return nil, fmt.Errorf("%w: the file has no products", ErrInvalidFile)
+	}
+	return file, nil
+}
+
+// Rows returns the number of data rows
+func (f *File) Rows() int {
+	return len(f.rows)
+}
+
+func (f *File) hasColumn(name string) bool {
+	_, ok := f.header[strings.ToLower(name)]
+	return ok
+}
+
+// get returns the trimmed value of a column, or "" when the file lacks it
+func (r row) get(column string) string {
+	i, ok := r.header[strings.ToLower(column)]
+	if !ok || i >= len(r.fields) {
+		return ""
+	}
+	return strings.TrimSpace(r.fields[i])
+}
+
+func blank(fields []string) bool {
+	for _, field := range fields {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package productcsv
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"storemaker-backend/models"
+	"storemaker-backend/storage"
+
+	"gorm.io/gorm"
+)
+
+// ExportCleaner deletes export files once ExportTTL has passed since their
+// job finished, and those whose job no longer exists
+type ExportCleaner struct {
+	db    *gorm.DB
+	files storage.Storage
+	ttl   time.Duration
+}
+
+// NewExportCleaner creates a cleaner for the exports kept in files
+func NewExportCleaner(db *gorm.DB, files storage.Storage) *ExportCleaner {
+	return &ExportCleaner{db: db, files: files, ttl: ExportTTL}
+}
+
+// DeleteExpired removes every export file that has outlived its job
+func (e *ExportCleaner) DeleteExpired(ctx context.Context) error {
+	var expired []string
+	err := e.files.Walk(ctx, ExportPrefix, func(object storage.Object) error {
+		match := exportKeyPattern.FindStringSubmatch(object.Key)
+		if match == nil {
+			return nil
+		}
+		jobID, err := strconv.ParseUint(match[2], 10, 32)
+		if err != nil {
+			return nil
+		}
+
+		var job models.Job
+		err = e.db.WithContext(ctx).Select("id", "finished_at").
+			Where("id = ? AND type = ?", jobID, models.JobTypeProductExport).First(&job).Error
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			expired = append(expired, object.Key)
+		case err != nil:
+			return err
+		case job.FinishedAt != nil && time.Since(*job.FinishedAt) > e.ttl:
+			expired = append(expired, object.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range expired {
+		if err := e.files.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete expired product export %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// Run deletes expired exports every interval until ctx is cancelled
+func (e *ExportCleaner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.DeleteExpired(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Product export cleanup failed: %v", err)
+			}
+		}
+	}
+}
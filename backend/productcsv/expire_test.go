@@ -0,0 +1,80 @@
+package productcsv
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"storemaker-backend/models"
+	"storemaker-backend/storage"
+	"storemaker-backend/testdb"
+)
+
+func TestDeleteExpiredExports(t *testing.T) {
+	db := testdb.Open(t, &models.Job{})
+	files, err := storage.NewLocal(t.TempDir(), "http://localhost:8080/uploads", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	storeID := uint(7)
+	finished := func(age time.Duration) *time.Time {
+		at := time.Now().Add(-age)
+		return &at
+	}
+	jobs := map[string]*models.Job{
+		"fresh":   {Status: models.JobStatusCompleted, FinishedAt: finished(time.Hour)},
+		"expired": {Status: models.JobStatusCompleted, FinishedAt: finished(ExportTTL + time.Hour)},
+		"running": {Status: models.JobStatusRunning},
+	}
+	keys := make(map[string]string)
+	for name, job := range jobs {
+		job.Type = models.JobTypeProductExport
+		job.StoreID = &storeID
+		if err := db.Create(job).Error; err != nil {
+			t.Fatal(err)
+		}
+		if keys[name], err = exportKey(storeID, job.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A file whose job was deleted with its store
+	if keys["orphaned"], err = exportKey(storeID, 999999); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if err := files.Put(ctx, key, strings.NewReader("Handle\n"), 7, "text/csv"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := NewExportCleaner(db, files).DeleteExpired(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	kept := map[string]bool{"fresh": true, "running": true}
+	for name, key := range keys {
+		file, err := files.Open(ctx, key)
+		if err == nil {
+			file.Close()
+		}
+		if kept[name] && err != nil {
+			t.Errorf("%s export deleted: %v", name, err)
+		}
+		if !kept[name] && !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("%s export kept", name)
+		}
+	}
+}
+
+func TestExportFileRejectsOtherKeys(t *testing.T) {
+	for _, key := range []string{"media_1_abc.jpg", "exports/../media_1_abc.jpg", "exports/products_1_2.csv"} {
+		job := models.Job{Result: models.JobData{"file": key}}
+		if _, ok := ExportFile(&job); ok {
+			t.Errorf("ExportFile accepted %q", key)
+		}
+	}
+}
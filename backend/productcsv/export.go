@@ -0,0 +1,284 @@
+package productcsv
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"storemaker-backend/catalog"
+	"storemaker-backend/jobs"
+	"storemaker-backend/models"
+	"storemaker-backend/storage"
+	"storemaker-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// ExportPrefix is the storage key prefix finished exports are kept under
+// until ExportTTL has passed
+const ExportPrefix = "exports/"
+
+// ExportTTL is how long a finished export can be downloaded
+const ExportTTL = 24 * time.Hour
+
+// exportBatchSize is how many products are read per query
+const exportBatchSize = 100
+
+// exportKeyPattern matches the keys made by exportKey
+var exportKeyPattern = regexp.MustCompile(`^exports/products_(\d+)_(\d+)_[A-Za-z0-9]+\.csv$`)
+
+// exportKey is where the export made by a job is stored. The random part
+// keeps the key from being guessed where storage serves files publicly.
+func exportKey(storeID, jobID uint) (string, error) {
+	token, err := utils.GenerateRandomString(24)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%sproducts_%d_%d_%s.csv", ExportPrefix, storeID, jobID, token), nil
+}
+
+// ExportFile returns the storage key of a completed export job's file
+func ExportFile(job *models.Job) (string, bool) {
+	key, ok := job.Result["file"].(string)
+	return key, ok && exportKeyPattern.MatchString(key)
+}
+
+// ExportHandler returns a job handler writing all of the store's products,
+// in the import column layout, to a file in files
+func ExportHandler(db *gorm.DB, files storage.Storage, storeID uint) jobs.Handler {
+	return func(ctx context.Context, progress *jobs.Progress) (models.JobData, error) {
+		db := db.WithContext(ctx)
+
+		var total int64
+		if err := db.Model(&models.Product{}).Where("store_id = ?", storeID).Count(&total).Error; err != nil {
+			return nil, err
+		}
+		progress.SetTotal(int(total))
+		progress.SetStage("exporting")
+
+		categories, err := catalog.StoreCategories(db, storeID)
+		if err != nil {
+			return nil, err
+		}
+		paths := categoryPaths(categories)
+
+		// The file is spooled to disk first so storage is given its length
+		file, err := os.CreateTemp("", "products-export-*.csv")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		writer := csv.NewWriter(file)
+		if err := writer.Write(columns); err != nil {
+			return nil, err
+		}
+
+		products, rows := 0, 0
+		var batch []models.Product
+		err = db.Scopes(catalog.PreloadVariants).Where("store_id = ?", storeID).Order("id").FindInBatches(&batch, exportBatchSize, func(_ *gorm.DB, _ int) error {
+			for i := range batch {
+				category := ""
+				if batch[i].CategoryID != nil {
+					category = paths[*batch[i].CategoryID]
+				}
+				records := productRecords(&batch[i], category)
+				if err := writer.WriteAll(records); err != nil {
+					return err
+				}
+				rows += len(records)
+			}
+			products += len(batch)
+			progress.Add(len(batch))
+			return nil
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return nil, err
+		}
+		size, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		progress.SetStage("saving")
+		key, err := exportKey(storeID, progress.Job().ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := files.Put(ctx, key, file, size, "text/csv"); err != nil {
+			return nil, err
+		}
+
+		return models.JobData{"products": products, "rows": rows, "file": key}, nil
+	}
+}
+
+// productRecords lays a product out as Shopify does: the first row holds
+// the product and its first variant, later rows the other variants, and the
+// images go one per row alongside them
+func productRecords(product *models.Product, category string) [][]string {
+	index := make(map[string]int, len(columns))
+	for i, column := range columns {
+		index[column] = i
+	}
+	newRecord := func() []string {
+		record := make([]string, len(columns))
+		record[index[colHandle]] = product.Slug
+		return record
+	}
+
+	first := newRecord()
+	first[index[colTitle]] = product.Name
+	first[index[colBody]] = product.Description
+	first[index[colType]] = category
+	first[index[colPublished]] = formatBool(product.Status == models.ProductStatusActive)
+	first[index[colGiftCard]] = formatBool(false)
+	first[index[colSEOTitle]] = product.SeoTitle
+	first[index[colSEODescription]] = product.SeoDesc
+	first[index[colStatus]] = exportStatus(product.Status)
+	first[index[colShortDescription]] = product.ShortDesc
+
+	setVariant := func(record []string, sku string, price float64, stock int, image string) {
+		record[index[colVariantSKU]] = sku
+		record[index[colInventoryTracker]] = "shopify"
+		record[index[colInventoryQty]] = strconv.Itoa(stock)
+		record[index[colInventoryPolicy]] = "deny"
+		record[index[colFulfillmentService]] = "manual"
+		record[index[colVariantPrice]] = formatPrice(price)
+		if product.ComparePrice != nil {
+			record[index[colVariantComparePrice]] = formatPrice(*product.ComparePrice)
+		}
+		record[index[colRequiresShipping]] = formatBool(!product.IsDigital)
+		record[index[colTaxable]] = formatBool(true)
+		record[index[colVariantImage]] = image
+		record[index[colWeightUnit]] = "kg"
+		if product.Weight != nil {
+			record[index[colVariantGrams]] = strconv.FormatFloat(math.Round(*product.Weight*1000), 'f', -1, 64)
+		}
+	}
+
+	records := [][]string{first}
+	names := optionNames(product)
+	if len(product.Variants) == 0 || len(names) == 0 {
+		first[index[optionNameColumn(0)]] = defaultOptionName
+		first[index[optionValueColumn(0)]] = defaultOptionValue
+		setVariant(first, product.SKU, product.Price, product.Stock, "")
+	} else {
+		for i, name := range names {
+			first[index[optionNameColumn(i)]] = name
+		}
+		for i, variant := range product.Variants {
+			record := first
+			if i > 0 {
+				record = newRecord()
+				records = append(records, record)
+			}
+			for j, name := range names {
+				record[index[optionValueColumn(j)]] = optionValue(variant.Options, name)
+			}
+			setVariant(record, variant.SKU, variant.Price, variant.Stock, variant.Image)
+		}
+	}
+
+	for i, image := range product.Images {
+		if i == len(records) {
+			records = append(records, newRecord())
+		}
+		records[i][index[colImageSrc]] = image
+		records[i][index[colImagePosition]] = strconv.Itoa(i + 1)
+	}
+	return records
+}
+
+// optionNames returns the product's option names, or for variants saved
+// without options the names their values use
+func optionNames(product *models.Product) []string {
+	names := make([]string, 0, catalog.MaxOptions)
+	for _, option := range product.Options {
+		names = append(names, option.Name)
+	}
+	if len(names) == 0 && len(product.Variants) > 0 {
+		for name := range product.Variants[0].Options {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if len(names) > catalog.MaxOptions {
+		names = names[:catalog.MaxOptions]
+	}
+	return names
+}
+
+func optionValue(options models.VariantOptions, name string) string {
+	if value, ok := options[name]; ok {
+		return value
+	}
+	for key, value := range options {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// categoryPaths maps category IDs to paths such as "Apparel > Shirts"
+func categoryPaths(categories []models.Category) map[uint]string {
+	byID := make(map[uint]*models.Category, len(categories))
+	for i := range categories {
+		byID[categories[i].ID] = &categories[i]
+	}
+
+	paths := make(map[uint]string, len(categories))
+	for _, category := range categories {
+		var names []string
+		seen := make(map[uint]bool)
+		for current := byID[category.ID]; current != nil && !seen[current.ID]; {
+			seen[current.ID] = true
+			names = append([]string{current.Name}, names...)
+			if current.ParentID == nil {
+				break
+			}
+			current = byID[*current.ParentID]
+		}
+		paths[category.ID] = strings.Join(names, " > ")
+	}
+	return paths
+}
+
+func exportStatus(status models.ProductStatus) string {
+	switch status {
+	case models.ProductStatusActive:
+		return "active"
+	case models.ProductStatusInactive:
+		return "archived"
+	}
+	return "draft"
+}
+
+func formatBool(value bool) string {
+	if value {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', 2, 64)
+}
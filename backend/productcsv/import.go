@@ -0,0 +1,878 @@
+package productcsv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"storemaker-backend/catalog"
+	"storemaker-backend/jobs"
+	"storemaker-backend/models"
+	"storemaker-backend/plans"
+	"storemaker-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// maxReportErrors caps how many row errors a report lists
+const maxReportErrors = 500
+
+// RowError is a problem with a row of an import file. Row 0 stands for the
+// file as a whole.
+type RowError struct {
+	Row     int    `json:"row"`
+	Handle  string `json:"handle,omitempty"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// Report summarises an import. A dry run reports what the import would do
+// without saving anything.
+type Report struct {
+	DryRun            bool       `json:"dry_run"`
+	Products          int        `json:"products"`
+	Created           int        `json:"created"`
+	Updated           int        `json:"updated"`
+	Skipped           int        `json:"skipped"`
+	Variants          int        `json:"variants"`
+	CategoriesCreated []string   `json:"categories_created"`
+	ErrorCount        int        `json:"error_count"`
+	Errors            []RowError `json:"errors"`
+}
+
+func (r *Report) addError(err RowError) {
+	r.ErrorCount++
+	if len(r.Errors) < maxReportErrors {
+		r.Errors = append(r.Errors, err)
+	}
+}
+
+// ImportHandler returns a job handler that creates or updates the store's
+// products from file. Rows are grouped into products by Handle, and a
+// product is matched to an existing one by handle, then by SKU. Products with
+// errors are skipped and listed in the report; the rest are saved, each in
+// its own transaction. With dryRun nothing is saved.
+func ImportHandler(db *gorm.DB, storeID uint, file *File, dryRun bool) jobs.Handler {
+	return func(ctx context.Context, progress *jobs.Progress) (models.JobData, error) {
+		im := &importer{
+			db:       db.WithContext(ctx),
+			storeID:  storeID,
+			file:     file,
+			dryRun:   dryRun,
+			progress: progress,
+		}
+		return im.run()
+	}
+}
+
+type importer struct {
+	db       *gorm.DB
+	storeID  uint
+	file     *File
+	dryRun   bool
+	progress *jobs.Progress
+
+	plan       *models.Plan
+	categories []models.Category
+	// newCategories holds the paths of categories created, or to be created
+	// in a dry run
+	newCategories map[string]bool
+	// matched maps existing product IDs to the handle that matched them
+	matched map[uint]string
+	report  Report
+}
+
+// importProduct is the rows of a file sharing a handle
+type importProduct struct {
+	handle string
+	rows   []row
+	errors []RowError
+
+	// product holds the values read from the file; set names the columns
+	// they go to
+	product      models.Product
+	set          map[string]bool
+	categoryPath []string
+	// variants replace the product's variants when setVariants is true.
+	// variantRows are the rows they were read from and stockSet tells which
+	// had an inventory quantity.
+	setVariants bool
+	variants    []models.ProductVariant
+	variantRows []row
+	stockSet    []bool
+
+	existing *models.Product
+}
+
+func (p *importProduct) fail(r row, column, message string) {
+	p.errors = append(p.errors, RowError{Row: r.line, Handle: p.handle, Column: column, Message: message})
+}
+
+func (im *importer) run() (models.JobData, error) {
+	im.report = Report{DryRun: im.dryRun, CategoriesCreated: []string{}, Errors: []RowError{}}
+	im.newCategories = make(map[string]bool)
+	im.matched = make(map[uint]string)
+
+	var store models.Store
+	if err := im.db.Select("id", "owner_id").First(&store, im.storeID).Error; err != nil {
+		return nil, err
+	}
+	var err error
+	if im.plan, err = plans.ForUser(im.db, store.OwnerID); err != nil {
+		return nil, err
+	}
+	if im.categories, err = catalog.StoreCategories(im.db, im.storeID); err != nil {
+		return nil, err
+	}
+
+	products := im.group()
+	im.report.Products = len(products)
+	im.progress.SetTotal(len(products))
+	if im.dryRun {
+		im.progress.SetStage("validating")
+	} else {
+		im.progress.SetStage("importing")
+	}
+
+	// skus maps the SKUs in the file to the handle using them
+	skus := make(map[string]string)
+	for _, p := range products {
+		if len(p.errors) == 0 {
+			p.parse(im.file)
+			p.checkSKUs(skus)
+		}
+		if len(p.errors) == 0 {
+			if err := im.match(p); err != nil {
+				return nil, err
+			}
+		}
+		if len(p.errors) == 0 {
+			if err := im.checkSKUsFree(p); err != nil {
+				return nil, err
+			}
+		}
+		if len(p.errors) == 0 {
+			var err error
+			if im.dryRun {
+				if p.set["category_id"] {
+					_, err = im.category(p.categoryPath)
+				}
+			} else {
+				err = im.save(p)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		im.tally(p)
+		im.progress.Add(1)
+	}
+
+	if im.dryRun && im.report.Created > 0 {
+		if err := plans.CheckProducts(im.db, im.plan, im.storeID, im.report.Created); err != nil {
+			im.report.addError(RowError{Message: err.Error()})
+		}
+	}
+
+	for path := range im.newCategories {
+		im.report.CategoriesCreated = append(im.report.CategoriesCreated, path)
+	}
+	sort.Strings(im.report.CategoriesCreated)
+	return im.report.data()
+}
+
+func (im *importer) tally(p *importProduct) {
+	if len(p.errors) > 0 {
+		im.report.Skipped++
+		for _, err := range p.errors {
+			im.report.addError(err)
+		}
+		return
+	}
+	if p.existing == nil {
+		im.report.Created++
+	} else {
+		im.report.Updated++
+	}
+	im.report.Variants += len(p.variants)
+}
+
+// group splits the file into products in the order they first appear. Rows
+// without a handle take one from their title.
+func (im *importer) group() []*importProduct {
+	var products []*importProduct
+	byHandle := make(map[string]*importProduct)
+	for _, r := range im.file.rows {
+		raw := r.get(colHandle)
+		if raw == "" {
+			raw = r.get(colTitle)
+		}
+		handle := utils.GenerateSlug(raw)
+
+		p, ok := byHandle[handle]
+		if !ok {
+			p = &importProduct{handle: handle, set: make(map[string]bool)}
+			byHandle[handle] = p
+			products = append(products, p)
+		}
+		p.rows = append(p.rows, r)
+		if handle == "" {
+			p.fail(r, colHandle, "Handle is missing; it needs letters or digits")
+		}
+	}
+	return products
+}
+
+// parse reads a product's fields from its first row, and its variants and
+// images from all its rows. Columns missing from the file are left alone.
+func (p *importProduct) parse(f *File) {
+	first := p.rows[0]
+
+	if title := first.get(colTitle); title != "" {
+		p.product.Name = title
+		p.set["name"] = true
+	}
+	textColumns := []struct {
+		column string
+		field  string
+		value  *string
+	}{
+		{colBody, "description", &p.product.Description},
+		{colShortDescription, "short_desc", &p.product.ShortDesc},
+		{colSEOTitle, "seo_title", &p.product.SeoTitle},
+		{colSEODescription, "seo_desc", &p.product.SeoDesc},
+	}
+	for _, text := range textColumns {
+		if f.hasColumn(text.column) {
+			*text.value = first.get(text.column)
+			p.set[text.field] = true
+		}
+	}
+
+	if status := first.get(colStatus); status != "" {
+		switch strings.ToLower(status) {
+		case "active":
+			p.product.Status = models.ProductStatusActive
+		case "draft":
+			p.product.Status = models.ProductStatusDraft
+		case "archived", "inactive":
+			p.product.Status = models.ProductStatusInactive
+		default:
+			p.fail(first, colStatus, "Status must be active, draft or archived")
+		}
+		p.set["status"] = true
+	} else if published := first.get(colPublished); published != "" {
+		if value, ok := p.parseBool(first, colPublished); ok {
+			p.product.Status = models.ProductStatusDraft
+			if value {
+				p.product.Status = models.ProductStatusActive
+			}
+			p.set["status"] = true
+		}
+	}
+
+	// Type holds the category path, with Shopify's product taxonomy as a
+	// fallback
+	if f.hasColumn(colType) || f.hasColumn(colProductCategory) {
+		path := first.get(colType)
+		if path == "" {
+			path = first.get(colProductCategory)
+		}
+		p.categoryPath = splitCategoryPath(path)
+		p.set["category_id"] = true
+	}
+
+	if f.hasColumn(colImageSrc) {
+		p.product.Images = p.images()
+		p.set["images"] = true
+	}
+
+	p.parseVariants(f)
+}
+
+// images collects the product's image URLs in Image Position order
+func (p *importProduct) images() models.ProductImages {
+	type image struct {
+		src      string
+		position int
+	}
+	var found []image
+	seen := make(map[string]bool)
+	for i, r := range p.rows {
+		src := r.get(colImageSrc)
+		if src == "" || seen[src] {
+			continue
+		}
+		seen[src] = true
+		position := MaxImportRows + i
+		if raw := r.get(colImagePosition); raw != "" {
+			if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+				position = n
+			} else {
+				p.fail(r, colImagePosition, "Image Position must be a positive whole number")
+			}
+		}
+		found = append(found, image{src: src, position: position})
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].position < found[j].position })
+
+	images := make(models.ProductImages, len(found))
+	for i, img := range found {
+		images[i] = img.src
+	}
+	return images
+}
+
+// parseVariants reads the rows that describe variants. Without options the
+// single variant row holds the product's own price, SKU and stock.
+func (p *importProduct) parseVariants(f *File) {
+	first := p.rows[0]
+	var names []string
+	for i := 0; i < catalog.MaxOptions; i++ {
+		name := first.get(optionNameColumn(i))
+		if name == "" {
+			break
+		}
+		names = append(names, name)
+	}
+
+	var variantRows []row
+	for _, r := range p.rows {
+		if r.get(colVariantSKU) != "" || r.get(colVariantPrice) != "" || r.get(colInventoryQty) != "" ||
+			r.get(optionValueColumn(0)) != "" {
+			variantRows = append(variantRows, r)
+		}
+	}
+	if len(names) == 1 && strings.EqualFold(names[0], defaultOptionName) {
+		placeholder := true
+		for _, r := range variantRows {
+			if value := r.get(optionValueColumn(0)); value != "" && !strings.EqualFold(value, defaultOptionValue) {
+				placeholder = false
+			}
+		}
+		if placeholder {
+			names = nil
+		}
+	}
+
+	if len(variantRows) > 0 {
+		p.parseProductVariantFields(f, variantRows[0])
+	}
+
+	if len(names) == 0 {
+		if len(variantRows) > 1 {
+			p.fail(variantRows[1], optionNameColumn(0), "Products with several variants need option names on their first row")
+			return
+		}
+		if len(variantRows) == 1 {
+			p.parseStock(variantRows[0], func(stock int) {
+				p.product.Stock = stock
+				p.set["stock"] = true
+			})
+			if f.hasColumn(colVariantSKU) {
+				p.product.SKU = variantRows[0].get(colVariantSKU)
+				p.set["sku"] = true
+			}
+		}
+		if f.hasColumn(optionNameColumn(0)) {
+			p.product.Options = models.ProductOptions{}
+			p.set["options"] = true
+			p.setVariants = true
+		}
+		return
+	}
+
+	options := make(models.ProductOptions, len(names))
+	for i, name := range names {
+		options[i].Name = name
+	}
+	seenValues := make([]map[string]bool, len(names))
+	for i := range seenValues {
+		seenValues[i] = make(map[string]bool)
+	}
+	combinations := make(map[string]bool)
+
+	for _, r := range variantRows {
+		values := make([]string, len(names))
+		selected := make(models.VariantOptions, len(names))
+		complete := true
+		for i := range names {
+			values[i] = r.get(optionValueColumn(i))
+			if values[i] == "" {
+				p.fail(r, optionValueColumn(i), fmt.Sprintf("A value for %s is required", names[i]))
+				complete = false
+				continue
+			}
+			selected[names[i]] = values[i]
+			if !seenValues[i][strings.ToLower(values[i])] {
+				seenValues[i][strings.ToLower(values[i])] = true
+				options[i].Values = append(options[i].Values, values[i])
+			}
+		}
+		if !complete {
+			continue
+		}
+		key := strings.ToLower(strings.Join(values, "\x00"))
+		if combinations[key] {
+			p.fail(r, optionValueColumn(0), fmt.Sprintf("Variant %s is listed twice", strings.Join(values, " / ")))
+			continue
+		}
+		combinations[key] = true
+
+		variant := models.ProductVariant{
+			Name:    strings.Join(values, " / "),
+			SKU:     r.get(colVariantSKU),
+			Image:   r.get(colVariantImage),
+			Options: selected,
+		}
+		if price, ok := p.parseNumber(r, colVariantPrice); ok && price != nil {
+			variant.Price = *price
+		} else if ok {
+			p.fail(r, colVariantPrice, "Variant Price is required")
+		}
+		stockSet := false
+		p.parseStock(r, func(stock int) {
+			variant.Stock = stock
+			stockSet = true
+		})
+		p.variants = append(p.variants, variant)
+		p.variantRows = append(p.variantRows, r)
+		p.stockSet = append(p.stockSet, stockSet)
+	}
+
+	if len(p.errors) > 0 {
+		return
+	}
+	normalized, err := catalog.NormalizeOptions(options)
+	if err != nil {
+		p.fail(first, optionNameColumn(0), err.Error())
+		return
+	}
+	if len(p.variants) > catalog.MaxVariants {
+		p.fail(first, optionNameColumn(0), catalog.ErrTooManyVariants.Error())
+		return
+	}
+	p.product.Options = normalized
+	p.set["options"] = true
+	p.setVariants = true
+}
+
+// parseProductVariantFields reads the product's price, compare price,
+// weight and shipping from its first variant row
+func (p *importProduct) parseProductVariantFields(f *File, r row) {
+	if price, ok := p.parseNumber(r, colVariantPrice); ok && price != nil {
+		p.product.Price = *price
+		p.set["price"] = true
+	}
+	if f.hasColumn(colVariantComparePrice) {
+		if compare, ok := p.parseNumber(r, colVariantComparePrice); ok {
+			p.product.ComparePrice = compare
+			p.set["compare_price"] = true
+		}
+	}
+	if grams, ok := p.parseNumber(r, colVariantGrams); ok && grams != nil {
+		kg := *grams / 1000
+		p.product.Weight = &kg
+		p.set["weight"] = true
+	}
+
+	requiresShipping, shippingOK := true, true
+	if r.get(colRequiresShipping) != "" {
+		requiresShipping, shippingOK = p.parseBool(r, colRequiresShipping)
+	}
+	giftCard, giftOK := false, true
+	if r.get(colGiftCard) != "" {
+		giftCard, giftOK = p.parseBool(r, colGiftCard)
+	}
+	if shippingOK && giftOK && (r.get(colRequiresShipping) != "" || r.get(colGiftCard) != "") {
+		p.product.IsDigital = !requiresShipping || giftCard
+		p.set["is_digital"] = true
+	}
+}
+
+// parseNumber reads a non-negative number; a blank cell gives nil
+func (p *importProduct) parseNumber(r row, column string) (*float64, bool) {
+	raw := r.get(column)
+	if raw == "" {
+		return nil, true
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || value < 0 {
+		p.fail(r, column, column+" must be a number of at least 0")
+		return nil, false
+	}
+	return &value, true
+}
+
+func (p *importProduct) parseBool(r row, column string) (bool, bool) {
+	value, err := strconv.ParseBool(strings.ToLower(r.get(column)))
+	if err != nil {
+		p.fail(r, column, column+" must be TRUE or FALSE")
+		return false, false
+	}
+	return value, true
+}
+
+// parseStock calls set with the row's inventory quantity, if it has one.
+// Negative quantities, which Shopify allows for oversold items, count as 0.
+func (p *importProduct) parseStock(r row, set func(int)) {
+	raw := r.get(colInventoryQty)
+	if raw == "" {
+		return
+	}
+	stock, err := strconv.Atoi(raw)
+	if err != nil {
+		p.fail(r, colInventoryQty, colInventoryQty+" must be a whole number")
+		return
+	}
+	if stock < 0 {
+		stock = 0
+	}
+	set(stock)
+}
+
+// skus lists the product's own and its variants' SKUs
+func (p *importProduct) skus() []string {
+	var skus []string
+	if p.product.SKU != "" {
+		skus = append(skus, p.product.SKU)
+	}
+	for _, variant := range p.variants {
+		if variant.SKU != "" {
+			skus = append(skus, variant.SKU)
+		}
+	}
+	return skus
+}
+
+// checkSKUs rejects variant SKUs used earlier in the file, recording the
+// product's SKUs in seen
+func (p *importProduct) checkSKUs(seen map[string]string) {
+	for i, variant := range p.variants {
+		if variant.SKU == "" {
+			continue
+		}
+		if handle, dup := seen[variant.SKU]; dup {
+			message := fmt.Sprintf("SKU %q is used twice in the file", variant.SKU)
+			if handle != p.handle {
+				message = fmt.Sprintf("SKU %q is also used by handle %q", variant.SKU, handle)
+			}
+			p.fail(p.variantRows[i], colVariantSKU, message)
+			continue
+		}
+		seen[variant.SKU] = p.handle
+	}
+}
+
+// match finds the existing product the rows update, by handle and then by
+// SKU, and pairs the file's variants with the existing ones by SKU or
+// option values
+func (im *importer) match(p *importProduct) error {
+	var existing models.Product
+	err := im.db.Scopes(catalog.PreloadVariants).Where("store_id = ? AND slug = ?", im.storeID, p.handle).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = im.matchBySKU(p, &existing)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return im.checkNew(p)
+	}
+	if err != nil {
+		return err
+	}
+	if len(p.errors) > 0 {
+		return nil
+	}
+
+	if handle, taken := im.matched[existing.ID]; taken {
+		p.fail(p.rows[0], colHandle, fmt.Sprintf("Matches the same product as handle %q", handle))
+		return nil
+	}
+	im.matched[existing.ID] = p.handle
+	p.existing = &existing
+
+	if !p.setVariants {
+		return nil
+	}
+	used := make(map[uint]bool)
+	for i := range p.variants {
+		variant := &p.variants[i]
+		current := findVariant(existing.Variants, variant, p.product.Options, used)
+		if current == nil {
+			continue
+		}
+		used[current.ID] = true
+		variant.ID = current.ID
+		if !p.stockSet[i] {
+			variant.Stock = current.Stock
+		}
+	}
+	return nil
+}
+
+// matchBySKU loads the product owning the file's SKUs. SKUs spread over
+// several products are an error.
+func (im *importer) matchBySKU(p *importProduct, existing *models.Product) error {
+	skus := p.skus()
+	if len(skus) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	var ids []uint
+	if err := im.db.Model(&models.ProductVariant{}).Distinct("product_id").
+		Where("store_id = ? AND sku IN ?", im.storeID, skus).Pluck("product_id", &ids).Error; err != nil {
+		return err
+	}
+	var productIDs []uint
+	if err := im.db.Model(&models.Product{}).
+		Where("store_id = ? AND sku IN ?", im.storeID, skus).Pluck("id", &productIDs).Error; err != nil {
+		return err
+	}
+	for _, id := range productIDs {
+		if !containsID(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	switch len(ids) {
+	case 0:
+		return gorm.ErrRecordNotFound
+	case 1:
+		return im.db.Scopes(catalog.PreloadVariants).Where("id = ? AND store_id = ?", ids[0], im.storeID).First(existing).Error
+	default:
+		p.fail(p.rows[0], colVariantSKU, "The product's SKUs belong to different existing products")
+		return nil
+	}
+}
+
+// checkSKUsFree rejects variant SKUs used by the store's other products
+func (im *importer) checkSKUsFree(p *importProduct) error {
+	var skus []string
+	for _, variant := range p.variants {
+		if variant.SKU != "" {
+			skus = append(skus, variant.SKU)
+		}
+	}
+	if len(skus) == 0 {
+		return nil
+	}
+
+	query := im.db.Model(&models.ProductVariant{}).Where("store_id = ? AND sku IN ?", im.storeID, skus)
+	if p.existing != nil {
+		query = query.Where("product_id != ?", p.existing.ID)
+	}
+	var taken []string
+	if err := query.Limit(1).Pluck("sku", &taken).Error; err != nil {
+		return err
+	}
+	if len(taken) > 0 {
+		p.fail(p.rows[0], colVariantSKU, (&catalog.SKUConflictError{SKU: taken[0]}).Error())
+	}
+	return nil
+}
+
+// checkNew checks the rows describe a whole product and, when saving, that
+// the plan has room for it
+func (im *importer) checkNew(p *importProduct) error {
+	if !p.set["name"] {
+		p.fail(p.rows[0], colTitle, "Title is required for new products")
+	}
+	if !p.set["price"] {
+		p.fail(p.rows[0], colVariantPrice, "Variant Price is required for new products")
+	}
+	if len(p.errors) > 0 || im.dryRun {
+		return nil
+	}
+
+	err := plans.CheckProducts(im.db, im.plan, im.storeID, 1)
+	var limitErr *plans.LimitError
+	if errors.As(err, &limitErr) {
+		p.fail(p.rows[0], "", limitErr.Error())
+		return nil
+	}
+	return err
+}
+
+// save writes one product with its categories and variants
+func (im *importer) save(p *importProduct) error {
+	if p.set["category_id"] {
+		categoryID, err := im.category(p.categoryPath)
+		if err != nil {
+			return err
+		}
+		p.product.CategoryID = categoryID
+	}
+
+	err := im.db.Transaction(func(tx *gorm.DB) error {
+		if p.existing == nil {
+			product := p.product
+			product.Slug = p.handle
+			product.StoreID = im.storeID
+			if product.Status == "" {
+				product.Status = models.ProductStatusDraft
+			}
+			if err := tx.Omit("Variants").Create(&product).Error; err != nil {
+				return err
+			}
+			if !p.setVariants {
+				return nil
+			}
+			return catalog.SaveVariants(tx, &product, p.variants)
+		}
+
+		fields := make([]string, 0, len(p.set))
+		for field := range p.set {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		if err := tx.Model(p.existing).Select(fields).Omit("Variants").Updates(&p.product).Error; err != nil {
+			return err
+		}
+		if !p.setVariants {
+			return nil
+		}
+		return catalog.SaveVariants(tx, p.existing, p.variants)
+	})
+
+	var conflict *catalog.SKUConflictError
+	switch {
+	case errors.As(err, &conflict):
+		p.fail(p.rows[0], colVariantSKU, conflict.Error())
+		return nil
+	case errors.Is(err, catalog.ErrInvalidOptions):
+		p.fail(p.rows[0], optionNameColumn(0), err.Error())
+		return nil
+	}
+	return err
+}
+
+// category finds the category at path, creating the missing ones. Dry runs
+// only note which would be created.
+func (im *importer) category(path []string) (*uint, error) {
+	var parentID *uint
+	for depth, name := range path {
+		var found *models.Category
+		for i := range im.categories {
+			category := &im.categories[i]
+			if sameParent(category.ParentID, parentID) && strings.EqualFold(category.Name, name) {
+				found = category
+				break
+			}
+		}
+		if found != nil {
+			id := found.ID
+			parentID = &id
+			continue
+		}
+
+		im.newCategories[strings.Join(path[:depth+1], " > ")] = true
+		if im.dryRun {
+			return nil, nil
+		}
+
+		position := 0
+		for _, category := range im.categories {
+			if sameParent(category.ParentID, parentID) {
+				position++
+			}
+		}
+		category := models.Category{
+			Name:     name,
+			Slug:     im.categorySlug(name),
+			ParentID: parentID,
+			Position: position,
+			StoreID:  im.storeID,
+		}
+		if err := im.db.Create(&category).Error; err != nil {
+			return nil, err
+		}
+		im.categories = append(im.categories, category)
+		id := category.ID
+		parentID = &id
+	}
+	return parentID, nil
+}
+
+func (im *importer) categorySlug(name string) string {
+	base := utils.GenerateSlug(name)
+	if base == "" {
+		base = "category"
+	}
+	return utils.GenerateUniqueSlug(base, func(s string) bool {
+		var count int64
+		im.db.Model(&models.Category{}).Where("store_id = ? AND slug = ?", im.storeID, s).Count(&count)
+		return count > 0
+	})
+}
+
+func (r *Report) data() (models.JobData, error) {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	var data models.JobData
+	err = json.Unmarshal(raw, &data)
+	return data, err
+}
+
+// findVariant returns the unused current variant with variant's SKU, or
+// failing that its option values
+func findVariant(current []models.ProductVariant, variant *models.ProductVariant, options models.ProductOptions, used map[uint]bool) *models.ProductVariant {
+	if variant.SKU != "" {
+		for i := range current {
+			if !used[current[i].ID] && current[i].SKU == variant.SKU {
+				return &current[i]
+			}
+		}
+	}
+	key := optionValuesKey(options, variant.Options)
+	for i := range current {
+		if !used[current[i].ID] && optionValuesKey(options, current[i].Options) == key {
+			return &current[i]
+		}
+	}
+	return nil
+}
+
+// optionValuesKey joins a variant's values for options, ignoring case
+func optionValuesKey(options models.ProductOptions, selected models.VariantOptions) string {
+	lowered := make(map[string]string, len(selected))
+	for name, value := range selected {
+		lowered[strings.ToLower(name)] = strings.ToLower(value)
+	}
+	values := make([]string, len(options))
+	for i, option := range options {
+		values[i] = lowered[strings.ToLower(option.Name)]
+	}
+	return strings.Join(values, "\x00")
+}
+
+// splitCategoryPath splits "Apparel > Shirts" into its category names
+func splitCategoryPath(path string) []string {
+	var names []string
+	for _, name := range strings.Split(path, ">") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func sameParent(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,399 @@
+// Package recommendations suggests products to show alongside another:
+// products often bought in the same orders, and related products that blend
+// that affinity with category similarity. Recommendations are computed in
+// the background; merchants can pin or exclude products on top.
+package recommendations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"storemaker-backend/catalog"
+	"storemaker-backend/jobs"
+	"storemaker-backend/models"
+	"storemaker-backend/sqc/concurrency"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxPerKind is how many recommendations of each kind are kept per product
+	MaxPerKind = 12
+
+	// MinCoPurchases is how many orders two products must share before
+	// they count as bought together
+	MinCoPurchases = 2
+
+	// HistoryWindow is how far back orders are considered
+	HistoryWindow = 365 * 24 * time.Hour
+
+	// computeWorkers is how many products are computed at once
+	computeWorkers = 4
+
+	// Weights of co-purchase affinity and category similarity in related
+	// products
+	coPurchaseWeight = 0.7
+	categoryWeight   = 0.3
+)
+
+// purchasedStatuses are the statuses of orders that count as a purchase
+var purchasedStatuses = []models.OrderStatus{
+	models.OrderStatusConfirmed,
+	models.OrderStatusProcessing,
+	models.OrderStatusShipped,
+	models.OrderStatusDelivered,
+}
+
+// Progress receives the progress of a computation; *jobs.Progress is one
+type Progress interface {
+	SetTotal(total int)
+	SetStage(stage string)
+	Add(n int)
+}
+
+type noProgress struct{}
+
+func (noProgress) SetTotal(int)    {}
+func (noProgress) SetStage(string) {}
+func (noProgress) Add(int)         {}
+
+// Handler returns a job handler recomputing the store's recommendations
+func Handler(db *gorm.DB, storeID uint) jobs.Handler {
+	return func(ctx context.Context, progress *jobs.Progress) (models.JobData, error) {
+		computed, err := Compute(ctx, db, storeID, progress)
+		if err != nil {
+			return nil, err
+		}
+		return models.JobData{"products": computed}, nil
+	}
+}
+
+// Compute replaces the recommendations of the store's active products,
+// computing products in parallel on a worker pool, and returns how many
+// products it computed. Recommendations of products that are no longer
+// active are dropped.
+func Compute(ctx context.Context, db *gorm.DB, storeID uint, progress Progress) (int, error) {
+	db = db.WithContext(ctx)
+
+	progress.SetStage("loading")
+	data, err := load(db, storeID)
+	if err != nil {
+		return 0, err
+	}
+
+	stale := db.Where("store_id = ?", storeID)
+	if len(data.products) > 0 {
+		stale = stale.Where("product_id NOT IN ?", data.products)
+	}
+	if err := stale.Delete(&models.ProductRecommendation{}).Error; err != nil {
+		return 0, err
+	}
+
+	progress.SetTotal(len(data.products))
+	progress.SetStage("computing")
+	errs := concurrency.BatchProcess(data.products, computeWorkers, func(productID uint) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		related, together := data.recommend(productID)
+		err := save(db, storeID, productID, map[models.RecommendationKind][]candidate{
+			models.RecommendationKindRelated:        related,
+			models.RecommendationKindBoughtTogether: together,
+		})
+		progress.Add(1)
+		return err
+	})
+
+	failed := 0
+	var first error
+	for _, err := range errs {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	if first != nil {
+		return len(data.products) - failed, fmt.Errorf("%d of %d products failed: %w", failed, len(data.products), first)
+	}
+	return len(data.products), nil
+}
+
+// save replaces a product's computed recommendations
+func save(db *gorm.DB, storeID, productID uint, kinds map[models.RecommendationKind][]candidate) error {
+	var rows []models.ProductRecommendation
+	for kind, candidates := range kinds {
+		for i, c := range candidates {
+			rows = append(rows, models.ProductRecommendation{
+				StoreID:       storeID,
+				ProductID:     productID,
+				Kind:          kind,
+				RecommendedID: c.id,
+				Score:         math.Round(c.score*10000) / 10000,
+				Position:      i,
+			})
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("product_id = ?", productID).Delete(&models.ProductRecommendation{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rows, 100).Error
+	})
+}
+
+// storeData is what a store's recommendations are computed from. It is
+// only read once loaded, so workers share it.
+type storeData struct {
+	// products are the IDs of the active products
+	products []uint
+	category map[uint]uint
+	// inCategory lists the active products of each category
+	inCategory map[uint][]uint
+	parent     map[uint]uint
+	children   map[uint][]uint
+	// orders counts the orders of each product, and together the orders
+	// each pair of products shares
+	orders   map[uint]int
+	together map[uint]map[uint]int
+}
+
+func load(db *gorm.DB, storeID uint) (*storeData, error) {
+	data := &storeData{
+		category:   make(map[uint]uint),
+		inCategory: make(map[uint][]uint),
+		parent:     make(map[uint]uint),
+		children:   make(map[uint][]uint),
+		orders:     make(map[uint]int),
+		together:   make(map[uint]map[uint]int),
+	}
+
+	var products []models.Product
+	if err := db.Select("id", "category_id").Where("store_id = ? AND status = ?", storeID, models.ProductStatusActive).
+		Order("id").Find(&products).Error; err != nil {
+		return nil, err
+	}
+	active := make(map[uint]bool, len(products))
+	for _, product := range products {
+		data.products = append(data.products, product.ID)
+		active[product.ID] = true
+		if product.CategoryID != nil {
+			data.category[product.ID] = *product.CategoryID
+			data.inCategory[*product.CategoryID] = append(data.inCategory[*product.CategoryID], product.ID)
+		}
+	}
+
+	categories, err := catalog.StoreCategories(db, storeID)
+	if err != nil {
+		return nil, err
+	}
+	for _, category := range categories {
+		if category.ParentID != nil {
+			data.parent[category.ID] = *category.ParentID
+			data.children[*category.ParentID] = append(data.children[*category.ParentID], category.ID)
+		}
+	}
+
+	since := time.Now().Add(-HistoryWindow)
+	var counts []struct {
+		ProductID uint
+		Orders    int
+	}
+	if err := db.Raw(`SELECT order_items.product_id, COUNT(DISTINCT order_items.order_id) AS orders
+		FROM order_items JOIN orders ON orders.id = order_items.order_id
+		WHERE orders.store_id = ? AND orders.status IN ? AND orders.created_at >= ?
+			AND orders.deleted_at IS NULL AND order_items.deleted_at IS NULL
+		GROUP BY order_items.product_id`, storeID, purchasedStatuses, since).Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		data.orders[count.ProductID] = count.Orders
+	}
+
+	var pairs []struct {
+		ProductID uint
+		OtherID   uint
+		Orders    int
+	}
+	if err := db.Raw(`SELECT a.product_id, b.product_id AS other_id, COUNT(DISTINCT a.order_id) AS orders
+		FROM order_items a
+		JOIN order_items b ON b.order_id = a.order_id AND b.product_id <> a.product_id AND b.deleted_at IS NULL
+		JOIN orders ON orders.id = a.order_id
+		WHERE orders.store_id = ? AND orders.status IN ? AND orders.created_at >= ?
+			AND orders.deleted_at IS NULL AND a.deleted_at IS NULL
+		GROUP BY a.product_id, b.product_id`, storeID, purchasedStatuses, since).Scan(&pairs).Error; err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		if !active[pair.ProductID] || !active[pair.OtherID] {
+			continue
+		}
+		if data.together[pair.ProductID] == nil {
+			data.together[pair.ProductID] = make(map[uint]int)
+		}
+		data.together[pair.ProductID][pair.OtherID] = pair.Orders
+	}
+
+	return data, nil
+}
+
+// candidate is a product scored for recommendation
+type candidate struct {
+	id       uint
+	score    float64
+	together int
+}
+
+// recommend scores the products bought with productID or in nearby
+// categories and returns the best of each kind
+func (d *storeData) recommend(productID uint) (related, together []candidate) {
+	for _, otherID := range d.neighbours(productID) {
+		shared := d.together[productID][otherID]
+		affinity := 0.0
+		if shared > 0 {
+			// Cosine similarity of the products' order sets, so best
+			// sellers do not top every list
+			affinity = float64(shared) / math.Sqrt(float64(d.orders[productID]*d.orders[otherID]))
+		}
+
+		if score := coPurchaseWeight*affinity + categoryWeight*d.categorySimilarity(productID, otherID); score > 0 {
+			related = append(related, candidate{id: otherID, score: score, together: shared})
+		}
+		if shared >= MinCoPurchases {
+			together = append(together, candidate{id: otherID, score: affinity, together: shared})
+		}
+	}
+	return best(related), best(together)
+}
+
+// neighbours lists the products bought with productID and those in its
+// category, its parent, its children and its siblings
+func (d *storeData) neighbours(productID uint) []uint {
+	seen := map[uint]bool{productID: true}
+	var ids []uint
+	add := func(id uint) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	for otherID := range d.together[productID] {
+		add(otherID)
+	}
+	if categoryID, ok := d.category[productID]; ok {
+		for _, nearID := range d.nearCategories(categoryID) {
+			for _, otherID := range d.inCategory[nearID] {
+				add(otherID)
+			}
+		}
+	}
+	return ids
+}
+
+// nearCategories returns a category with its parent, children and siblings
+func (d *storeData) nearCategories(categoryID uint) []uint {
+	near := []uint{categoryID}
+	near = append(near, d.children[categoryID]...)
+	if parentID, ok := d.parent[categoryID]; ok {
+		near = append(near, parentID)
+		for _, siblingID := range d.children[parentID] {
+			if siblingID != categoryID {
+				near = append(near, siblingID)
+			}
+		}
+	}
+	return near
+}
+
+// categorySimilarity is 1 for products in the same category, 0.5 for
+// parent, child and sibling categories and 0 otherwise
+func (d *storeData) categorySimilarity(a, b uint) float64 {
+	categoryA, okA := d.category[a]
+	categoryB, okB := d.category[b]
+	if !okA || !okB {
+		return 0
+	}
+	if categoryA == categoryB {
+		return 1
+	}
+	parentA, hasParentA := d.parent[categoryA]
+	parentB, hasParentB := d.parent[categoryB]
+	if (hasParentA && parentA == categoryB) || (hasParentB && parentB == categoryA) ||
+		(hasParentA && hasParentB && parentA == parentB) {
+		return 0.5
+	}
+	return 0
+}
+
+// best orders candidates by score, then shared orders, then newest, and
+// keeps the first MaxPerKind
+func best(candidates []candidate) []candidate {
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		if candidates[i].together != candidates[j].together {
+			return candidates[i].together > candidates[j].together
+		}
+		return candidates[i].id > candidates[j].id
+	})
+	if len(candidates) > MaxPerKind {
+		candidates = candidates[:MaxPerKind]
+	}
+	return candidates
+}
+
+// Refresher recomputes the recommendations of every active store
+type Refresher struct {
+	db *gorm.DB
+}
+
+func NewRefresher(db *gorm.DB) *Refresher {
+	return &Refresher{db: db}
+}
+
+// RefreshAll recomputes each active store in turn. A store that fails is
+// logged and skipped.
+func (r *Refresher) RefreshAll(ctx context.Context) error {
+	var storeIDs []uint
+	if err := r.db.WithContext(ctx).Model(&models.Store{}).Where("status = ?", models.StoreStatusActive).
+		Order("id").Pluck("id", &storeIDs).Error; err != nil {
+		return err
+	}
+	for _, storeID := range storeIDs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := Compute(ctx, r.db, storeID, noProgress{}); err != nil {
+			log.Printf("Failed to compute recommendations for store %d: %v", storeID, err)
+		}
+	}
+	return nil
+}
+
+// Run calls RefreshAll every interval until ctx is done
+func (r *Refresher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.RefreshAll(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Recommendation refresh failed: %v", err)
+			}
+		}
+	}
+}
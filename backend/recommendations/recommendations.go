@@ -0,0 +1,244 @@
+package recommendations
+
+import (
+	"errors"
+	"fmt"
+
+	"storemaker-backend/catalog"
+	"storemaker-backend/media"
+	"storemaker-backend/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultLimit = 8
+	MaxLimit     = 24
+)
+
+// Kinds lists the recommendation kinds in the order they are shown
+var Kinds = []models.RecommendationKind{
+	models.RecommendationKindRelated,
+	models.RecommendationKindBoughtTogether,
+}
+
+var (
+	// ErrUnknownProduct is returned when an override names a product that
+	// is not another product of the store
+	ErrUnknownProduct = errors.New("unknown product")
+
+	// ErrConflictingOverride is returned when a product is both pinned and
+	// excluded
+	ErrConflictingOverride = errors.New("a product cannot be both pinned and excluded")
+)
+
+// For returns up to limit recommendations of each kind for product, among
+// products with the given statuses. Pinned products come first, then
+// computed ones. Until recommendations have been computed, related products
+// fall back to the newest products in the same category.
+func For(db *gorm.DB, product *models.Product, statuses []models.ProductStatus, limit int) (map[models.RecommendationKind][]models.Product, error) {
+	overrides, err := Overrides(db, product.ID)
+	if err != nil {
+		return nil, err
+	}
+	computed, err := Computed(db, product.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Take more IDs than needed, as some may no longer be visible
+	ids := make(map[models.RecommendationKind][]uint, len(Kinds))
+	var all []uint
+	for _, kind := range Kinds {
+		list := overrides[kind]
+		excluded := make(map[uint]bool, len(list.Excluded)+len(list.Pinned)+1)
+		excluded[product.ID] = true
+		for _, id := range list.Excluded {
+			excluded[id] = true
+		}
+		add := func(id uint) {
+			if !excluded[id] {
+				excluded[id] = true
+				ids[kind] = append(ids[kind], id)
+			}
+		}
+
+		for _, id := range list.Pinned {
+			add(id)
+		}
+		for _, rec := range computed[kind] {
+			add(rec.RecommendedID)
+		}
+		if kind == models.RecommendationKindRelated && len(ids[kind]) < limit && product.CategoryID != nil {
+			var fallback []uint
+			if err := db.Model(&models.Product{}).
+				Where("store_id = ? AND category_id = ? AND status IN ? AND id <> ?", product.StoreID, *product.CategoryID, statuses, product.ID).
+				Order("created_at DESC, id DESC").Limit(limit*2).Pluck("id", &fallback).Error; err != nil {
+				return nil, err
+			}
+			for _, id := range fallback {
+				add(id)
+			}
+		}
+		all = append(all, ids[kind]...)
+	}
+
+	var products []models.Product
+	if len(all) > 0 {
+		if err := db.Scopes(catalog.PreloadVariants).
+			Where("store_id = ? AND id IN ? AND status IN ?", product.StoreID, all, statuses).
+			Find(&products).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := media.AttachToProducts(db, products); err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+
+	result := make(map[models.RecommendationKind][]models.Product, len(Kinds))
+	for _, kind := range Kinds {
+		result[kind] = make([]models.Product, 0, limit)
+		for _, id := range ids[kind] {
+			if p, ok := byID[id]; ok && len(result[kind]) < limit {
+				result[kind] = append(result[kind], p)
+			}
+		}
+	}
+	return result, nil
+}
+
+// Computed returns a product's computed recommendations by kind, in order
+func Computed(db *gorm.DB, productID uint) (map[models.RecommendationKind][]models.ProductRecommendation, error) {
+	var rows []models.ProductRecommendation
+	if err := db.Where("product_id = ?", productID).Order("kind, position").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	computed := make(map[models.RecommendationKind][]models.ProductRecommendation, len(Kinds))
+	for _, kind := range Kinds {
+		computed[kind] = []models.ProductRecommendation{}
+	}
+	for _, row := range rows {
+		computed[row.Kind] = append(computed[row.Kind], row)
+	}
+	return computed, nil
+}
+
+// Overrides returns a product's pinned and excluded products by kind
+func Overrides(db *gorm.DB, productID uint) (map[models.RecommendationKind]models.RecommendationOverrideList, error) {
+	var rows []models.ProductRecommendationOverride
+	if err := db.Where("product_id = ?", productID).Order("position, id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	lists := make(map[models.RecommendationKind]models.RecommendationOverrideList, len(Kinds))
+	for _, kind := range Kinds {
+		lists[kind] = models.RecommendationOverrideList{Pinned: []uint{}, Excluded: []uint{}}
+	}
+	for _, row := range rows {
+		list := lists[row.Kind]
+		if row.Excluded {
+			list.Excluded = append(list.Excluded, row.RecommendedID)
+		} else {
+			list.Pinned = append(list.Pinned, row.RecommendedID)
+		}
+		lists[row.Kind] = list
+	}
+	return lists, nil
+}
+
+// SetOverrides replaces the product's overrides of each kind in req. It
+// returns ErrUnknownProduct unless every ID is another product of the
+// store, and ErrConflictingOverride when a product is both pinned and
+// excluded.
+func SetOverrides(db *gorm.DB, product *models.Product, req *models.RecommendationOverridesRequest) error {
+	lists := map[models.RecommendationKind]*models.RecommendationOverrideList{
+		models.RecommendationKindRelated:        req.Related,
+		models.RecommendationKindBoughtTogether: req.BoughtTogether,
+	}
+
+	var ids []uint
+	for _, list := range lists {
+		if list == nil {
+			continue
+		}
+		pinned := make(map[uint]bool, len(list.Pinned))
+		for _, id := range list.Pinned {
+			pinned[id] = true
+		}
+		for _, id := range list.Excluded {
+			if pinned[id] {
+				return fmt.Errorf("%w: product %d", ErrConflictingOverride, id)
+			}
+		}
+		ids = append(ids, list.Pinned...)
+		ids = append(ids, list.Excluded...)
+	}
+	if err := checkStoreProducts(db, product, ids); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, kind := range Kinds {
+			list := lists[kind]
+			if list == nil {
+				continue
+			}
+			if err := tx.Where("product_id = ? AND kind = ?", product.ID, kind).
+				Delete(&models.ProductRecommendationOverride{}).Error; err != nil {
+				return err
+			}
+
+			seen := make(map[uint]bool)
+			var rows []models.ProductRecommendationOverride
+			for position, id := range list.Pinned {
+				if !seen[id] {
+					seen[id] = true
+					rows = append(rows, models.ProductRecommendationOverride{
+						StoreID: product.StoreID, ProductID: product.ID, Kind: kind, RecommendedID: id, Position: position,
+					})
+				}
+			}
+			for _, id := range list.Excluded {
+				if !seen[id] {
+					seen[id] = true
+					rows = append(rows, models.ProductRecommendationOverride{
+						StoreID: product.StoreID, ProductID: product.ID, Kind: kind, RecommendedID: id, Excluded: true,
+					})
+				}
+			}
+			if len(rows) > 0 {
+				if err := tx.Create(&rows).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// checkStoreProducts checks ids are other products of product's store
+func checkStoreProducts(db *gorm.DB, product *models.Product, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	unique := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if id == product.ID {
+			return fmt.Errorf("%w: a product cannot recommend itself", ErrUnknownProduct)
+		}
+		unique[id] = true
+	}
+
+	var count int64
+	if err := db.Model(&models.Product{}).Where("store_id = ? AND id IN ?", product.StoreID, ids).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(unique) {
+		return ErrUnknownProduct
+	}
+	return nil
+}
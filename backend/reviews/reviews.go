@@ -0,0 +1,348 @@
+// Package reviews verifies review purchases, keeps the rating cached on
+// products and lists approved reviews the way storefront components show
+// them.
+package reviews
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"storemaker-backend/models"
+	"storemaker-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultListLimit = 10
+	MaxListLimit     = 50
+
+	// MaxPhotos is how many photos a review may have
+	MaxPhotos = 5
+
+	// MaxPerIP and MaxPerStore bound the reviews submitted from one client
+	// IP and to one store in each RateWindow
+	MaxPerIP    = 5
+	MaxPerStore = 100
+	RateWindow  = time.Hour
+)
+
+// Review list sort orders
+const (
+	SortNewest  = "newest"
+	SortOldest  = "oldest"
+	SortHighest = "highest"
+	SortLowest  = "lowest"
+)
+
+var listSorts = map[string]string{
+	SortNewest:  "reviews.created_at DESC, reviews.id DESC",
+	SortOldest:  "reviews.created_at ASC, reviews.id ASC",
+	SortHighest: "reviews.rating DESC, reviews.created_at DESC, reviews.id DESC",
+	SortLowest:  "reviews.rating ASC, reviews.created_at DESC, reviews.id DESC",
+}
+
+var (
+	// ErrOrderNotFound is returned when an order number does not name an
+	// order for the product placed with the reviewer's email
+	ErrOrderNotFound = errors.New("no order for this product matches the order number and email")
+
+	// ErrInvalidList is returned for list parameters that cannot be used
+	ErrInvalidList = errors.New("invalid review list")
+)
+
+// purchasedStatuses are the statuses of orders that count as a purchase
+var purchasedStatuses = []models.OrderStatus{
+	models.OrderStatusConfirmed,
+	models.OrderStatusProcessing,
+	models.OrderStatusShipped,
+	models.OrderStatusDelivered,
+}
+
+// RateLimits are the limits a review submitted to the store from ip counts
+// against
+func RateLimits(storeID uint, ip string) []utils.RateLimit {
+	return []utils.RateLimit{
+		{Key: "review:ip:" + ip, Limit: MaxPerIP, Window: RateWindow},
+		{Key: "review:store:" + strconv.FormatUint(uint64(storeID), 10), Limit: MaxPerStore, Window: RateWindow},
+	}
+}
+
+// NormalizeEmail is the form emails are stored and matched in
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// VerifyPurchase returns the ID of the store's order numbered orderNumber
+// that was placed with email and includes the product
+func VerifyPurchase(db *gorm.DB, storeID, productID uint, email, orderNumber string) (uint, error) {
+	var ids []uint
+	err := db.Model(&models.Order{}).
+		Joins("JOIN order_items ON order_items.order_id = orders.id AND order_items.deleted_at IS NULL").
+		Where("orders.store_id = ? AND orders.order_number = ? AND lower(orders.customer_email) = ?",
+			storeID, strings.TrimSpace(orderNumber), NormalizeEmail(email)).
+		Where("orders.status IN ? AND order_items.product_id = ?", purchasedStatuses, productID).
+		Limit(1).Pluck("orders.id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, ErrOrderNotFound
+	}
+	return ids[0], nil
+}
+
+// RefreshRating recomputes the rating cached on a product from its
+// approved reviews
+func RefreshRating(db *gorm.DB, productID uint) error {
+	return db.Exec(`UPDATE products SET rating_count = stats.count, rating_average = stats.average
+		FROM (SELECT COUNT(*) AS count, COALESCE(ROUND(AVG(rating)::numeric, 2), 0) AS average
+			FROM reviews WHERE product_id = ? AND status = ? AND deleted_at IS NULL) AS stats
+		WHERE products.id = ?`, productID, models.ReviewStatusApproved, productID).Error
+}
+
+// Approved limits a query to the approved reviews of the store's products
+// with the given statuses, so reviews of hidden products stay hidden
+func Approved(storeID uint, productStatuses []models.ProductStatus) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		products := db.Session(&gorm.Session{NewDB: true}).Model(&models.Product{}).
+			Select("id").Where("store_id = ? AND status IN ?", storeID, productStatuses)
+		return db.Where("reviews.store_id = ? AND reviews.status = ? AND reviews.product_id IN (?)",
+			storeID, models.ReviewStatusApproved, products)
+	}
+}
+
+// AttachPhotos fills in the Photos of reviews from their PhotoIDs. Photos
+// deleted from the library since are left out.
+func AttachPhotos(db *gorm.DB, reviews []models.Review) error {
+	var ids []uint
+	for _, review := range reviews {
+		ids = append(ids, review.PhotoIDs...)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var found []models.Media
+	if err := db.Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]models.Media, len(found))
+	for _, media := range found {
+		byID[media.ID] = media
+	}
+
+	for i := range reviews {
+		reviews[i].Photos = make([]models.Media, 0, len(reviews[i].PhotoIDs))
+		for _, id := range reviews[i].PhotoIDs {
+			if media, ok := byID[id]; ok && media.StoreID == reviews[i].StoreID {
+				reviews[i].Photos = append(reviews[i].Photos, media)
+			}
+		}
+	}
+	return nil
+}
+
+// Photo is a review photo as the storefront shows it
+type Photo struct {
+	URL    string `json:"url"`
+	Srcset string `json:"srcset"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Alt    string `json:"alt"`
+}
+
+// Public is an approved review as the storefront shows it, without the
+// reviewer's email. Name, Rating, Comment and Date are the fields the
+// reviews-grid and testimonials components read.
+type Public struct {
+	ID          uint       `json:"id"`
+	ProductID   uint       `json:"product_id"`
+	ProductName string     `json:"product_name,omitempty"`
+	ProductSlug string     `json:"product_slug,omitempty"`
+	Rating      int        `json:"rating"`
+	Title       string     `json:"title"`
+	Comment     string     `json:"comment"`
+	Name        string     `json:"name"`
+	Date        time.Time  `json:"date"`
+	Verified    bool       `json:"verified"`
+	Photos      []Photo    `json:"photos"`
+	Reply       string     `json:"reply,omitempty"`
+	RepliedAt   *time.Time `json:"replied_at,omitempty"`
+}
+
+// ToPublic converts reviews, with their photos and products attached, to
+// their storefront form
+func ToPublic(reviews []models.Review) []Public {
+	public := make([]Public, 0, len(reviews))
+	for _, review := range reviews {
+		item := Public{
+			ID:        review.ID,
+			ProductID: review.ProductID,
+			Rating:    review.Rating,
+			Title:     review.Title,
+			Comment:   review.Body,
+			Name:      review.Name,
+			Date:      review.CreatedAt,
+			Verified:  review.Verified,
+			Photos:    make([]Photo, 0, len(review.Photos)),
+			Reply:     review.Reply,
+			RepliedAt: review.RepliedAt,
+		}
+		if review.Product != nil {
+			item.ProductName = review.Product.Name
+			item.ProductSlug = review.Product.Slug
+		}
+		for _, photo := range review.Photos {
+			item.Photos = append(item.Photos, Photo{
+				URL:    photo.URL,
+				Srcset: photo.Srcset,
+				Width:  photo.Width,
+				Height: photo.Height,
+				Alt:    photo.Alt,
+			})
+		}
+		public = append(public, item)
+	}
+	return public
+}
+
+// Summary is the rating breakdown of a set of reviews. Distribution counts
+// reviews by star rating, "1" to "5".
+type Summary struct {
+	Average      float64          `json:"average"`
+	Count        int64            `json:"count"`
+	Distribution map[string]int64 `json:"distribution"`
+}
+
+// Summarize breaks down the ratings of the reviews query selects
+func Summarize(query *gorm.DB) (*Summary, error) {
+	var rows []struct {
+		Rating int
+		Count  int64
+	}
+	if err := query.Session(&gorm.Session{}).Select("reviews.rating AS rating, COUNT(*) AS count").
+		Group("reviews.rating").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{Distribution: make(map[string]int64, 5)}
+	for stars := 1; stars <= 5; stars++ {
+		summary.Distribution[strconv.Itoa(stars)] = 0
+	}
+	var total int64
+	for _, row := range rows {
+		summary.Distribution[strconv.Itoa(row.Rating)] += row.Count
+		summary.Count += row.Count
+		total += int64(row.Rating) * row.Count
+	}
+	if summary.Count > 0 {
+		summary.Average = math.Round(float64(total)/float64(summary.Count)*100) / 100
+	}
+	return summary, nil
+}
+
+// ListParams are a storefront review list's filters, sort and page
+type ListParams struct {
+	Rating     int
+	Verified   bool
+	WithPhotos bool
+	Sort       string
+	Page       int
+	Limit      int
+}
+
+// ParseListParams reads list parameters from a query string:
+//
+//	rating=5           only reviews with this many stars
+//	verified=true      only verified purchases
+//	with_photos=true   only reviews with photos
+//	sort=newest        newest, oldest, highest or lowest
+//	page=1             page number
+//	limit=10           page size, at most 50
+func ParseListParams(values url.Values) (*ListParams, error) {
+	params := &ListParams{
+		Verified:   values.Get("verified") == "true",
+		WithPhotos: values.Get("with_photos") == "true",
+		Sort:       values.Get("sort"),
+		Page:       1,
+		Limit:      DefaultListLimit,
+	}
+	if params.Sort == "" {
+		params.Sort = SortNewest
+	}
+	if _, ok := listSorts[params.Sort]; !ok {
+		return nil, fmt.Errorf("%w: unknown sort %q", ErrInvalidList, params.Sort)
+	}
+	if raw := values.Get("rating"); raw != "" {
+		rating, err := strconv.Atoi(raw)
+		if err != nil || rating < 1 || rating > 5 {
+			return nil, fmt.Errorf("%w: rating must be 1 to 5", ErrInvalidList)
+		}
+		params.Rating = rating
+	}
+	if raw := values.Get("page"); raw != "" {
+		page, err := strconv.Atoi(raw)
+		if err != nil || page < 1 {
+			return nil, fmt.Errorf("%w: invalid page %q", ErrInvalidList, raw)
+		}
+		params.Page = page
+	}
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > MaxListLimit {
+			return nil, fmt.Errorf("%w: limit must be 1 to %d", ErrInvalidList, MaxListLimit)
+		}
+		params.Limit = limit
+	}
+	return params, nil
+}
+
+// Listing is a page of approved reviews. Summary covers every review the
+// list was drawn from, before the rating, verified and photo filters.
+type Listing struct {
+	Data    []Public `json:"data"`
+	Page    int      `json:"page"`
+	Limit   int      `json:"limit"`
+	Total   int64    `json:"total"`
+	Summary *Summary `json:"summary"`
+}
+
+// List returns a page of the reviews query selects
+func List(query *gorm.DB, params *ListParams) (*Listing, error) {
+	summary, err := Summarize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := query.Session(&gorm.Session{})
+	if params.Rating > 0 {
+		filtered = filtered.Where("reviews.rating = ?", params.Rating)
+	}
+	if params.Verified {
+		filtered = filtered.Where("reviews.verified = ?", true)
+	}
+	if params.WithPhotos {
+		filtered = filtered.Where("jsonb_array_length(COALESCE(reviews.photo_ids, '[]'::jsonb)) > 0")
+	}
+
+	listing := &Listing{Page: params.Page, Limit: params.Limit, Summary: summary}
+	if err := filtered.Session(&gorm.Session{}).Count(&listing.Total).Error; err != nil {
+		return nil, err
+	}
+	var items []models.Review
+	if err := filtered.Preload("Product").Order(listSorts[params.Sort]).
+		Offset((params.Page - 1) * params.Limit).Limit(params.Limit).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	if err := AttachPhotos(query.Session(&gorm.Session{NewDB: true}), items); err != nil {
+		return nil, err
+	}
+	listing.Data = ToPublic(items)
+	return listing, nil
+}
@@ -1,29 +1,106 @@
 package routes
 
 import (
+	"context"
+	"log"
+	"time"
+
 	"storemaker-backend/controllers"
+	"storemaker-backend/domains"
+	"storemaker-backend/jobs"
+	"storemaker-backend/mail"
 	"storemaker-backend/middleware"
+	"storemaker-backend/oidc"
+	"storemaker-backend/productcsv"
+	"storemaker-backend/recommendations"
+	"storemaker-backend/storage"
+	"storemaker-backend/trash"
+	"storemaker-backend/utils"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 func SetupRoutes(router *gin.Engine, db *gorm.DB) {
+	// Failed-login tracking is kept in memory; swap the store to share it across nodes
+	loginLimiter := utils.NewLoginLimiter(utils.NewMemoryLimiterStore(), utils.DefaultLoginLimiterConfig())
+	storePasswordLimiter := utils.NewLoginLimiter(utils.NewMemoryLimiterStore(), utils.DefaultLoginLimiterConfig())
+	reviewLimiter := utils.NewRateLimiter(utils.NewMemoryLimiterStore())
+
+	// External identity providers are configured as a JSON array in OIDC_PROVIDERS
+	oidcRegistry, err := oidc.NewRegistryFromJSON(utils.GetEnv("OIDC_PROVIDERS", ""), nil)
+	if err != nil {
+		log.Printf("Failed to load OIDC providers: %v", err)
+	}
+
+	// Outgoing email goes through SMTP_HOST when set, otherwise to the log
+	mailer := mail.NewSenderFromEnv()
+
+	// Custom domain claims are rechecked in the background
+	domainVerifier := domains.NewVerifier(db, domains.NetResolver{}, utils.StorefrontBaseDomain(), domains.DefaultVerifierConfig())
+	go domainVerifier.Run(context.Background(), time.Minute)
+
+	// Long-running work such as store clones and product imports runs on a
+	// shared job runner
+	jobRunner := jobs.NewRunner(db, 4, 100)
+	jobRunner.Start()
+
+	// Uploads are kept where STORAGE_DRIVER says. Local files are served,
+	// and take presigned uploads, under the path of their base URL.
+	files, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure upload storage: %v", err)
+	}
+	if local, ok := files.(*storage.Local); ok {
+		log.Printf("Serving uploads from %s", local.Root)
+		router.Static(local.BasePath(), local.Root)
+		router.PUT(local.BasePath()+"/*key", gin.WrapF(local.ServePresignedUpload))
+	}
+
+	// Product recommendations are recomputed from order history every few
+	// hours; merchants can also start a recompute as a job
+	recommendationRefresher := recommendations.NewRefresher(db)
+	go recommendationRefresher.Run(context.Background(), 6*time.Hour)
+
+	// Deleted stores are purged once STORE_TRASH_RETENTION_DAYS have passed
+	storePurger := trash.NewPurger(db, trash.RetentionFromEnv(), files)
+	go storePurger.Run(context.Background(), time.Hour)
+
+	// Product exports can be downloaded for productcsv.ExportTTL
+	exportCleaner := productcsv.NewExportCleaner(db, files)
+	go exportCleaner.Run(context.Background(), time.Hour)
+
 	// Initialize controllers
-	authController := controllers.NewAuthController(db)
+	authController := controllers.NewAuthController(db, loginLimiter)
 	userController := controllers.NewUserController(db)
 	storeController := controllers.NewStoreController(db)
 	templateController := controllers.NewTemplateController(db)
 	productController := controllers.NewProductController(db)
+	categoryController := controllers.NewCategoryController(db)
 	orderController := controllers.NewOrderController(db)
 	customizationController := controllers.NewCustomizationController(db)
 	newsletterController := controllers.NewNewsletterController(db)
-<<<<<<< HEAD
-=======
-	fileController := controllers.NewFileController(db)
+	fileController := controllers.NewFileController(db, files)
 	exportController := controllers.NewExportController(db)
 	sqcController := controllers.NewSQCController(db) // Software Construction Concepts with REAL DB!
->>>>>>> url/main
+	twoFactorController := controllers.NewTwoFactorController(db, loginLimiter)
+	apiKeyController := controllers.NewAPIKeyController(db)
+	oidcController := controllers.NewOIDCController(db, oidcRegistry, loginLimiter)
+	impersonationController := controllers.NewImpersonationController(db)
+	auditController := controllers.NewAuditController(db)
+	domainController := controllers.NewDomainController(db, domainVerifier)
+	previewController := controllers.NewPreviewController(db)
+	storeAccessController := controllers.NewStoreAccessController(db, storePasswordLimiter)
+	emailVerificationController := controllers.NewEmailVerificationController(db, mailer)
+	jobController := controllers.NewJobController(db)
+	storeCloneController := controllers.NewStoreCloneController(db, jobRunner)
+	productCSVController := controllers.NewProductCSVController(db, jobRunner, files)
+	mediaController := controllers.NewMediaController(db, files)
+	reviewController := controllers.NewReviewController(db, files, reviewLimiter)
+	recommendationController := controllers.NewRecommendationController(db, jobRunner)
+	trashController := controllers.NewTrashController(db, storePurger)
+	storeTransferController := controllers.NewStoreTransferController(db, mailer)
+	planController := controllers.NewPlanController(db)
 
 	// API v1 routes
 	v1 := router.Group("/api/v1")
@@ -35,59 +112,165 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 		public.POST("/auth/register", authController.Register)
 		public.POST("/auth/login", authController.Login)
 		public.POST("/auth/refresh", authController.RefreshToken)
+		public.POST("/auth/2fa/verify", twoFactorController.VerifyLogin)
+		public.POST("/auth/2fa/setup", twoFactorController.BeginSetup)
+		public.POST("/auth/2fa/setup/confirm", twoFactorController.ConfirmSetup)
+		public.GET("/auth/oidc/providers", oidcController.GetProviders)
+		public.POST("/auth/oidc/:provider/authorize", oidcController.Authorize)
+		public.POST("/auth/oidc/:provider/callback", oidcController.Callback)
+		public.POST("/auth/email/verify", emailVerificationController.VerifyEmail)
+
+		// Plans
+		public.GET("/plans", planController.GetPlans)
 
 		// Template routes
 		public.GET("/templates", templateController.GetPublicTemplates)
 		public.GET("/templates/:id", templateController.GetTemplate)
 
-		// Public store routes
-		public.GET("/stores/:slug", storeController.GetStoreBySlug)
-		public.GET("/stores/:slug/layout", customizationController.GetPublicStoreLayout)
-		public.GET("/stores/:slug/pages", customizationController.GetPublicStorePages)
-		public.GET("/stores/:slug/pages/:pageSlug", customizationController.GetPublicStorePage)
-<<<<<<< HEAD
-=======
-		public.GET("/stores/:slug/pages/:pageSlug/layout", customizationController.GetPublicPageLayout)
->>>>>>> url/main
-		public.GET("/stores/:slug/products", productController.GetStoreProducts)
-		public.GET("/stores/:slug/products/:productSlug", productController.GetStoreProduct)
+		// Store access gate, reachable while the store is locked
+		public.GET("/stores/:slug/access", storeAccessController.GetAccessStatus)
+		public.POST("/stores/:slug/access", storeAccessController.UnlockStore)
+	}
+
+	// Public store routes, behind the store's access policy
+	publicStore := v1.Group("/stores/:slug")
+	publicStore.Use(middleware.StoreAccessMiddleware(db))
+	{
+		publicStore.GET("", storeController.GetStoreBySlug)
+		publicStore.GET("/layout", customizationController.GetPublicStoreLayout)
+		publicStore.GET("/pages", customizationController.GetPublicStorePages)
+		publicStore.GET("/pages/:pageSlug", customizationController.GetPublicStorePage)
+		publicStore.GET("/pages/:pageSlug/layout", customizationController.GetPublicPageLayout)
+		publicStore.GET("/products", productController.GetStoreProducts)
+		publicStore.GET("/products/:productSlug", productController.GetStoreProduct)
+		publicStore.GET("/products/:productSlug/reviews", reviewController.GetProductReviews)
+		publicStore.POST("/products/:productSlug/reviews", reviewController.CreateProductReview)
+		publicStore.GET("/products/:productSlug/recommendations", recommendationController.GetProductRecommendations)
+		publicStore.GET("/reviews", reviewController.GetStoreReviews)
+		publicStore.GET("/categories", categoryController.GetStoreCategories)
+		publicStore.GET("/categories/:categorySlug/products", categoryController.GetStoreCategoryProducts)
 
 		// Newsletter routes
-		public.POST("/stores/:slug/newsletter/subscribe", newsletterController.Subscribe)
-		public.GET("/stores/:slug/newsletter/unsubscribe", newsletterController.Unsubscribe)
+		publicStore.POST("/newsletter/subscribe", newsletterController.Subscribe)
+		publicStore.GET("/newsletter/unsubscribe", newsletterController.Unsubscribe)
 
 		// Order routes
-		public.POST("/stores/:slug/orders", orderController.CreateOrder)
-		public.GET("/stores/:slug/orders/:orderNumber", orderController.GetOrderByNumber)
+		publicStore.POST("/orders", orderController.CreateOrder)
+		publicStore.GET("/orders/:orderNumber", orderController.GetOrderByNumber)
+	}
+
+	// Storefront routes resolve the store from the Host header (store
+	// subdomain or verified custom domain) instead of the :slug parameter
+	storefront := v1.Group("/storefront")
+	storefront.Use(middleware.StorefrontMiddleware(db, utils.StorefrontBaseDomain()))
+	{
+		storefront.GET("/access", storeAccessController.GetAccessStatus)
+		storefront.POST("/access", storeAccessController.UnlockStore)
+
+		gated := storefront.Group("")
+		gated.Use(middleware.StoreAccessMiddleware(db))
+		gated.GET("", storeController.GetStoreBySlug)
+		gated.GET("/layout", customizationController.GetPublicStoreLayout)
+		gated.GET("/pages", customizationController.GetPublicStorePages)
+		gated.GET("/pages/:pageSlug", customizationController.GetPublicStorePage)
+		gated.GET("/products", productController.GetStoreProducts)
+		gated.GET("/products/:productSlug", productController.GetStoreProduct)
+		gated.GET("/products/:productSlug/reviews", reviewController.GetProductReviews)
+		gated.POST("/products/:productSlug/reviews", reviewController.CreateProductReview)
+		gated.GET("/products/:productSlug/recommendations", recommendationController.GetProductRecommendations)
+		gated.GET("/reviews", reviewController.GetStoreReviews)
+		gated.GET("/categories", categoryController.GetStoreCategories)
+		gated.GET("/categories/:categorySlug/products", categoryController.GetStoreCategoryProducts)
+		gated.POST("/newsletter/subscribe", newsletterController.Subscribe)
+		gated.GET("/newsletter/unsubscribe", newsletterController.Unsubscribe)
+		gated.POST("/orders", orderController.CreateOrder)
+		gated.GET("/orders/:orderNumber", orderController.GetOrderByNumber)
 	}
 
 	// Protected routes
 	protected := v1.Group("")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(db), middleware.AuditContextMiddleware())
 	{
-		// User routes
-		protected.GET("/user/profile", userController.GetProfile)
-		protected.PUT("/user/profile", userController.UpdateProfile)
-		protected.DELETE("/user/profile", userController.DeleteProfile)
+		// User routes (interactive sessions only, not API keys)
+		userRoutes := protected.Group("/user")
+		userRoutes.Use(middleware.SessionOnlyMiddleware())
+		{
+			userRoutes.GET("/profile", userController.GetProfile)
+			userRoutes.PUT("/profile", userController.UpdateProfile)
+			userRoutes.DELETE("/profile", userController.DeleteProfile)
+			userRoutes.POST("/email/verification", emailVerificationController.SendVerification)
+			userRoutes.GET("/usage", planController.GetUsage)
+
+			// Stores offered to the user
+			userRoutes.GET("/store-transfers", storeTransferController.GetIncomingTransfers)
+			userRoutes.POST("/store-transfers/accept", storeTransferController.AcceptTransfer)
+			userRoutes.POST("/store-transfers/decline", storeTransferController.DeclineTransfer)
+
+			// Two-factor authentication
+			userRoutes.POST("/2fa/enroll", twoFactorController.Enroll)
+			userRoutes.POST("/2fa/enable", twoFactorController.Enable)
+			userRoutes.POST("/2fa/disable", twoFactorController.Disable)
+			userRoutes.POST("/2fa/recovery-codes", twoFactorController.RegenerateRecoveryCodes)
+		}
 
 		// Store management (merchant only) - using /manage prefix to avoid conflicts
 		storeRoutes := protected.Group("/manage/stores")
-		storeRoutes.Use(middleware.MerchantMiddleware())
+		storeRoutes.Use(middleware.MerchantMiddleware(), middleware.APIKeyScopeMiddleware())
 		{
 			storeRoutes.GET("", storeController.GetUserStores)
 			storeRoutes.POST("", storeController.CreateStore)
 			storeRoutes.POST("/ai", storeController.CreateStoreWithAI)
+
+			// Deleted stores
+			storeRoutes.GET("/trash", trashController.GetTrash)
+			storeRoutes.POST("/trash/:id/restore", trashController.RestoreStore)
+			storeRoutes.DELETE("/trash/:id", trashController.PurgeStore)
+
 			storeRoutes.GET("/:id", storeController.GetStore)
 			storeRoutes.PUT("/:id", storeController.UpdateStore)
 			storeRoutes.DELETE("/:id", storeController.DeleteStore)
+			storeRoutes.POST("/:id/clone", storeCloneController.CloneStore)
+
+			// Ownership transfer
+			storeRoutes.GET("/:id/transfer", storeTransferController.GetTransfer)
+			storeRoutes.POST("/:id/transfer", storeTransferController.InitiateTransfer)
+			storeRoutes.DELETE("/:id/transfer", storeTransferController.CancelTransfer)
+
+			// Background jobs
+			storeRoutes.GET("/:id/jobs", jobController.GetStoreJobs)
+			storeRoutes.GET("/:id/jobs/:jobId", jobController.GetStoreJob)
+
+			// Store lifecycle and launch checklist
+			storeRoutes.GET("/:id/lifecycle", storeController.GetStoreLifecycle)
+			storeRoutes.POST("/:id/lifecycle", storeController.ChangeStoreLifecycle)
+
+			// Store API keys
+			storeRoutes.GET("/:id/api-keys", apiKeyController.GetAPIKeys)
+			storeRoutes.POST("/:id/api-keys", apiKeyController.CreateAPIKey)
+			storeRoutes.DELETE("/:id/api-keys/:keyId", apiKeyController.RevokeAPIKey)
+
+			// Custom domains
+			storeRoutes.GET("/:id/domains", domainController.GetDomains)
+			storeRoutes.POST("/:id/domains", domainController.ClaimDomain)
+			storeRoutes.POST("/:id/domains/:domainId/verify", domainController.VerifyDomain)
+			storeRoutes.DELETE("/:id/domains/:domainId", domainController.DeleteDomain)
+
+			// Draft preview tokens
+			storeRoutes.GET("/:id/preview-tokens", previewController.GetPreviewTokens)
+			storeRoutes.POST("/:id/preview-tokens", previewController.CreatePreviewToken)
+			storeRoutes.DELETE("/:id/preview-tokens/:tokenId", previewController.RevokePreviewToken)
+
+			// Storefront access mode
+			storeRoutes.GET("/:id/access", storeAccessController.GetStoreAccess)
+			storeRoutes.PUT("/:id/access", storeAccessController.UpdateStoreAccess)
+
+			// Store audit log
+			storeRoutes.GET("/:id/audit", auditController.GetStoreAuditLog)
 
-<<<<<<< HEAD
-=======
 			// File upload routes (logo & favicon)
 			storeRoutes.POST("/:id/logo", fileController.UploadStoreLogo)
 			storeRoutes.POST("/:id/favicon", fileController.UploadStoreFavicon)
 
->>>>>>> url/main
 			// Store settings
 			storeRoutes.GET("/:id/settings", customizationController.GetStoreSettings)
 			storeRoutes.PUT("/:id/settings", customizationController.UpdateStoreSettings)
@@ -99,6 +282,8 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 			// Store layout
 			storeRoutes.GET("/:id/layout", customizationController.GetStoreLayout)
 			storeRoutes.POST("/:id/layout", customizationController.SaveStoreLayout)
+			storeRoutes.POST("/:id/layout/publish", customizationController.PublishStoreLayout)
+			storeRoutes.GET("/:id/layout/revisions", customizationController.GetLayoutRevisions)
 
 			// Store pages
 			storeRoutes.GET("/:id/pages", customizationController.GetPages)
@@ -106,18 +291,52 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 			storeRoutes.PUT("/:id/pages/:pageId", customizationController.UpdatePage)
 			storeRoutes.DELETE("/:id/pages/:pageId", customizationController.DeletePage)
 
-<<<<<<< HEAD
-=======
 			// Page layouts
 			storeRoutes.GET("/:id/pages/:pageId/layout", customizationController.GetPageLayout)
 			storeRoutes.POST("/:id/pages/:pageId/layout", customizationController.SavePageLayout)
 
->>>>>>> url/main
 			// Store products
 			storeRoutes.GET("/:id/products", productController.GetProducts)
 			storeRoutes.POST("/:id/products", productController.CreateProduct)
 			storeRoutes.PUT("/:id/products/:productId", productController.UpdateProduct)
 			storeRoutes.DELETE("/:id/products/:productId", productController.DeleteProduct)
+			storeRoutes.PUT("/:id/products/:productId/options", productController.SetProductOptions)
+			storeRoutes.PUT("/:id/products/:productId/variants/:variantId", productController.UpdateProductVariant)
+			storeRoutes.POST("/:id/products/:productId/variants/:variantId/stock", productController.AdjustVariantStock)
+
+			// Product recommendations
+			storeRoutes.GET("/:id/products/:productId/recommendations", recommendationController.GetRecommendations)
+			storeRoutes.PUT("/:id/products/:productId/recommendations", recommendationController.UpdateRecommendations)
+			storeRoutes.POST("/:id/recommendations/recompute", recommendationController.RecomputeRecommendations)
+
+			// Product reviews and moderation
+			storeRoutes.GET("/:id/reviews", reviewController.GetReviews)
+			storeRoutes.PUT("/:id/reviews/:reviewId", reviewController.ModerateReview)
+			storeRoutes.DELETE("/:id/reviews/:reviewId", reviewController.DeleteReview)
+			storeRoutes.PUT("/:id/reviews/:reviewId/reply", reviewController.ReplyToReview)
+			storeRoutes.DELETE("/:id/reviews/:reviewId/reply", reviewController.DeleteReviewReply)
+
+			// Product CSV import and export
+			storeRoutes.POST("/:id/products/import", productCSVController.ImportProducts)
+			storeRoutes.POST("/:id/products/export", productCSVController.ExportProducts)
+			storeRoutes.GET("/:id/products/export/:jobId", productCSVController.DownloadProductExport)
+
+			// Media library
+			storeRoutes.GET("/:id/media", mediaController.GetMedia)
+			storeRoutes.POST("/:id/media", mediaController.UploadMedia)
+			storeRoutes.POST("/:id/media/uploads", mediaController.CreateMediaUpload)
+			storeRoutes.POST("/:id/media/uploads/complete", mediaController.CompleteMediaUpload)
+			storeRoutes.GET("/:id/media/:mediaId", mediaController.GetMediaItem)
+			storeRoutes.PUT("/:id/media/:mediaId", mediaController.UpdateMedia)
+			storeRoutes.DELETE("/:id/media/:mediaId", mediaController.DeleteMedia)
+
+			// Store categories
+			storeRoutes.GET("/:id/categories", categoryController.GetCategories)
+			storeRoutes.POST("/:id/categories", categoryController.CreateCategory)
+			storeRoutes.GET("/:id/categories/:categoryId", categoryController.GetCategory)
+			storeRoutes.PUT("/:id/categories/:categoryId", categoryController.UpdateCategory)
+			storeRoutes.DELETE("/:id/categories/:categoryId", categoryController.DeleteCategory)
+			storeRoutes.POST("/:id/categories/:categoryId/move", categoryController.MoveCategory)
 
 			// Store orders
 			storeRoutes.GET("/:id/orders", orderController.GetStoreOrders)
@@ -126,23 +345,38 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 			// Store newsletter
 			storeRoutes.GET("/:id/newsletter/subscriptions", newsletterController.GetSubscriptions)
 			storeRoutes.DELETE("/:id/newsletter/subscriptions/:subscriptionId", newsletterController.DeleteSubscription)
-<<<<<<< HEAD
-=======
 
 			// Store export
 			storeRoutes.GET("/:id/download", exportController.DownloadStoreSource)
->>>>>>> url/main
 		}
 	}
 
 	// Admin routes (admin only)
 	admin := v1.Group("/admin")
-	admin.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware())
+	admin.Use(middleware.AuthMiddleware(db), middleware.AdminMiddleware(), middleware.AuditContextMiddleware())
 	{
 		admin.GET("/stores", storeController.GetAllStores)
 		admin.PUT("/stores/:id/status", storeController.UpdateStoreStatus)
 		admin.GET("/analytics", storeController.GetSystemAnalytics)
 
+		// Admin security policy
+		admin.GET("/security/policy", twoFactorController.GetSecurityPolicy)
+		admin.PUT("/security/policy", twoFactorController.UpdateSecurityPolicy)
+
+		// Impersonation
+		admin.POST("/users/:id/impersonate", impersonationController.Impersonate)
+		admin.PUT("/users/:id/plan", planController.SetUserPlan)
+		admin.GET("/impersonations", impersonationController.GetImpersonationSessions)
+		admin.POST("/impersonations/:id/end", impersonationController.EndImpersonation)
+
+		// Audit log
+		admin.GET("/audit", auditController.GetAuditLog)
+
+		// Admin plan management
+		admin.GET("/plans", planController.GetPlans)
+		admin.POST("/plans", planController.CreatePlan)
+		admin.PUT("/plans/:id", planController.UpdatePlan)
+
 		// Admin template management
 		admin.GET("/templates", templateController.GetAllTemplates)
 		admin.GET("/templates/:id", templateController.GetTemplateAdmin)
@@ -150,18 +384,15 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 		admin.PUT("/templates/:id", templateController.UpdateTemplate)
 		admin.DELETE("/templates/:id", templateController.DeleteTemplate)
 	}
-<<<<<<< HEAD
-=======
 
 	// Software Construction Concepts routes (public for educational purposes)
 	sqc := v1.Group("/sqc")
 	{
-		sqc.POST("/query", sqcController.ExecuteQuery)       // Execute StoreQL query on REAL data
-		sqc.POST("/validate", sqcController.ValidateQuery)   // Validate query syntax
-		sqc.POST("/tokenize", sqcController.TokenizeQuery)   // Tokenize query (debugging)
-		sqc.GET("/grammar", sqcController.GetGrammar)        // Get BNF grammar
-		sqc.GET("/examples", sqcController.RunExamples)      // Run examples
-		sqc.GET("/docs", sqcController.GetDocumentation)     // Get documentation
+		sqc.POST("/query", sqcController.ExecuteQuery)     // Execute StoreQL query on REAL data
+		sqc.POST("/validate", sqcController.ValidateQuery) // Validate query syntax
+		sqc.POST("/tokenize", sqcController.TokenizeQuery) // Tokenize query (debugging)
+		sqc.GET("/grammar", sqcController.GetGrammar)      // Get BNF grammar
+		sqc.GET("/examples", sqcController.RunExamples)    // Run examples
+		sqc.GET("/docs", sqcController.GetDocumentation)   // Get documentation
 	}
->>>>>>> url/main
 }
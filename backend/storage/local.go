@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Local keeps files in a directory. The backend serves them itself under
+// the path of its base URL, and accepts presigned uploads there too.
+type Local struct {
+	// Root is the absolute directory files are kept in
+	Root string
+
+	baseURL  string
+	basePath string
+	secret   []byte
+}
+
+// NewLocal creates root if needed. Relative roots are resolved against the
+// working directory once, here, so later changes to it do not scatter files.
+func NewLocal(root, baseURL string, secret []byte) (*Local, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, err
+	}
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload URL %q: %w", baseURL, err)
+	}
+	if strings.Trim(parsed.Path, "/") == "" {
+		return nil, fmt.Errorf("upload URL %q needs a path such as /uploads", baseURL)
+	}
+	return &Local{
+		Root:     abs,
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		basePath: strings.TrimRight(parsed.Path, "/"),
+		secret:   secret,
+	}, nil
+}
+
+// BasePath is the URL path files are served under, such as "/uploads"
+func (l *Local) BasePath() string {
+	return l.basePath
+}
+
+func (l *Local) path(key string) (string, error) {
+	if !ValidKey(key) {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(l.Root, filepath.FromSlash(key)), nil
+}
+
+// Put writes through a temporary file so a file is never served half
+// written
+func (l *Local) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("wrote %d of %d bytes", written, size)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(target)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Walk skips the temporary files of uploads in progress
+func (l *Local) Walk(ctx context.Context, prefix string, fn func(Object) error) error {
+	return filepath.WalkDir(l.Root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(l.Root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return fn(Object{Key: key, Size: info.Size()})
+	})
+}
+
+func (l *Local) BaseURL() string {
+	return l.baseURL
+}
+
+func (l *Local) URL(key string) string {
+	return l.baseURL + "/" + key
+}
+
+// Key matches on the path alone, as files used to be linked through
+// whichever host the upload request came in on
+func (l *Local) Key(raw string) (string, bool) {
+	parsed, err := url.Parse(raw)
+	if err != nil || raw == "" {
+		return "", false
+	}
+	key := strings.TrimPrefix(parsed.Path, l.basePath+"/")
+	if key == parsed.Path || !ValidKey(key) {
+		return "", false
+	}
+	return key, true
+}
+
+// PresignUpload signs a PUT to the file's own URL, which
+// ServePresignedUpload accepts
+func (l *Local) PresignUpload(ctx context.Context, key, contentType string, size int64, expires time.Duration) (*PresignedUpload, error) {
+	if !ValidKey(key) {
+		return nil, fmt.Errorf("invalid key %q", key)
+	}
+	expiresAt := time.Now().Add(expires).UTC().Truncate(time.Second)
+	query := url.Values{}
+	query.Set("size", strconv.FormatInt(size, 10))
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", l.sign(key, contentType, size, expiresAt.Unix()))
+
+	return &PresignedUpload{
+		Key:       key,
+		Method:    http.MethodPut,
+		URL:       l.URL(key) + "?" + query.Encode(),
+		Headers:   map[string]string{"Content-Type": contentType},
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (l *Local) sign(key, contentType string, size, expires int64) string {
+	mac := hmac.New(sha256.New, l.secret)
+	fmt.Fprintf(mac, "PUT\n%s\n%s\n%d\n%d", key, contentType, size, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServePresignedUpload handles PUTs to URLs made by PresignUpload
+func (l *Local) ServePresignedUpload(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, l.basePath+"/")
+	if key == r.URL.Path || !ValidKey(key) {
+		http.Error(w, "invalid upload path", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	size, sizeErr := strconv.ParseInt(query.Get("size"), 10, 64)
+	expires, expiresErr := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if sizeErr != nil || expiresErr != nil {
+		http.Error(w, "invalid upload signature", http.StatusForbidden)
+		return
+	}
+	expected := l.sign(key, r.Header.Get("Content-Type"), size, expires)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		http.Error(w, "invalid upload signature", http.StatusForbidden)
+		return
+	}
+	if time.Now().Unix() > expires {
+		http.Error(w, "upload URL has expired", http.StatusForbidden)
+		return
+	}
+	if r.ContentLength != size {
+		http.Error(w, fmt.Sprintf("the upload must be exactly %d bytes", size), http.StatusBadRequest)
+		return
+	}
+
+	if err := l.Put(r.Context(), key, io.LimitReader(r.Body, size), size, r.Header.Get("Content-Type")); err != nil {
+		http.Error(w, "failed to store upload", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
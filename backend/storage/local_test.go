@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testLocal(t *testing.T) *Local {
+	t.Helper()
+	l, err := NewLocal(t.TempDir(), "http://localhost:8080/uploads", []byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// putPresigned sends body to a presigned URL as a browser would
+func putPresigned(l *Local, rawURL, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, rawURL, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	l.ServePresignedUpload(w, req)
+	return w
+}
+
+func TestServePresignedUpload(t *testing.T) {
+	l := testLocal(t)
+	ctx := context.Background()
+
+	upload, err := l.PresignUpload(ctx, "incoming/1/photo.jpg", "image/jpeg", 5, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withQuery := func(name, value string) string {
+		u, _ := url.Parse(upload.URL)
+		query := u.Query()
+		query.Set(name, value)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	// A correctly signed URL whose time has passed
+	expiredAt := time.Now().Add(-time.Minute).Unix()
+	expiredURL := func() string {
+		u, _ := url.Parse(upload.URL)
+		query := u.Query()
+		query.Set("expires", strconv.FormatInt(expiredAt, 10))
+		query.Set("signature", l.sign("incoming/1/photo.jpg", "image/jpeg", 5, expiredAt))
+		u.RawQuery = query.Encode()
+		return u.String()
+	}()
+
+	tests := []struct {
+		name        string
+		url         string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"tampered signature", withQuery("signature", strings.Repeat("0", 64)), "image/jpeg", "12345", http.StatusForbidden},
+		{"larger size", withQuery("size", "5000000"), "image/jpeg", "12345", http.StatusForbidden},
+		{"later expiry", withQuery("expires", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)), "image/jpeg", "12345", http.StatusForbidden},
+		{"other content type", upload.URL, "text/html", "12345", http.StatusForbidden},
+		{"other key", strings.Replace(upload.URL, "photo.jpg", "other.jpg", 1), "image/jpeg", "12345", http.StatusForbidden},
+		{"expired", expiredURL, "image/jpeg", "12345", http.StatusForbidden},
+		{"too short", upload.URL, "image/jpeg", "1234", http.StatusBadRequest},
+		{"too long", upload.URL, "image/jpeg", "123456", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := putPresigned(l, tt.url, tt.contentType, tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if _, err := l.Open(ctx, "incoming/1/photo.jpg"); err != ErrNotFound {
+				t.Fatalf("rejected upload was stored: %v", err)
+			}
+		})
+	}
+
+	if w := putPresigned(l, upload.URL, "image/jpeg", "12345"); w.Code != http.StatusOK {
+		t.Fatalf("valid upload: status %d: %s", w.Code, w.Body.String())
+	}
+	file, err := l.Open(ctx, "incoming/1/photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if data, _ := io.ReadAll(file); string(data) != "12345" {
+		t.Fatalf("stored %q", data)
+	}
+}
+
+func TestServePresignedUploadRejectsPathsOutsideBase(t *testing.T) {
+	l := testLocal(t)
+	for _, path := range []string{"/other/photo.jpg", "/uploads/", "/uploads/a//b.jpg"} {
+		req := httptest.NewRequest(http.MethodPut, path, strings.NewReader("x"))
+		w := httptest.NewRecorder()
+		l.ServePresignedUpload(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package storage keeps uploaded files in a local directory or an
+// S3-compatible bucket. Files are addressed by keys such as
+// "media_1_9f86d081884c7d65.jpg" and served from the URL the backend gives
+// for them.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"storemaker-backend/utils"
+)
+
+// ErrNotFound is returned when a key has no file
+var ErrNotFound = errors.New("file not found")
+
+// Storage is where uploaded files are kept
+type Storage interface {
+	// Put stores body under key, replacing any file there. size may be -1
+	// when unknown.
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Open reads the file under key
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file under key; a missing file is not an error
+	Delete(ctx context.Context, key string) error
+	// Walk calls fn for every file whose key starts with prefix
+	Walk(ctx context.Context, prefix string, fn func(Object) error) error
+	// BaseURL is the public URL keys are served under
+	BaseURL() string
+	// URL is the public URL of the file under key
+	URL(key string) string
+	// Key returns the key a URL made by URL refers to
+	Key(url string) (string, bool)
+	// PresignUpload lets a client PUT one file of exactly size bytes to key
+	// until expires has passed
+	PresignUpload(ctx context.Context, key, contentType string, size int64, expires time.Duration) (*PresignedUpload, error)
+}
+
+// Object is a stored file found by Walk
+type Object struct {
+	Key  string
+	Size int64
+}
+
+// PresignedUpload tells a client how to upload a file directly to storage.
+// The request must carry Headers unchanged.
+type PresignedUpload struct {
+	Key       string            `json:"key"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// ValidKey reports whether key is a clean relative path, so it cannot point
+// outside a local root or be read two ways
+func ValidKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	if path.Clean(key) != key {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// NewFromEnv returns the storage STORAGE_DRIVER names, "local" by default
+func NewFromEnv() (Storage, error) {
+	return DriverFromEnv(utils.GetEnv("STORAGE_DRIVER", "local"))
+}
+
+// DriverFromEnv configures a driver from the environment:
+//
+//	local: UPLOAD_DIR (default "uploads") served at UPLOAD_URL (default
+//	       SERVER_URL + "/uploads"); presigned uploads are signed with
+//	       STORAGE_SIGNING_KEY, falling back to JWT_SECRET
+//	s3:    S3_BUCKET, S3_REGION, S3_ENDPOINT, S3_ACCESS_KEY_ID,
+//	       S3_SECRET_ACCESS_KEY, S3_PATH_STYLE and S3_PUBLIC_URL
+func DriverFromEnv(driver string) (Storage, error) {
+	switch driver {
+	case "local":
+		baseURL := utils.GetEnv("UPLOAD_URL", "")
+		if baseURL == "" {
+			baseURL = strings.TrimRight(utils.GetEnv("SERVER_URL", "http://localhost:8080"), "/") + "/uploads"
+		}
+		secret := utils.GetEnv("STORAGE_SIGNING_KEY", "")
+		if secret == "" {
+			secret = utils.GetEnv("JWT_SECRET", "your-super-secret-jwt-key-change-this-in-production")
+		}
+		return NewLocal(utils.GetEnv("UPLOAD_DIR", "uploads"), baseURL, []byte(secret))
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:  utils.GetEnv("S3_ENDPOINT", ""),
+			Region:    utils.GetEnv("S3_REGION", "us-east-1"),
+			Bucket:    utils.GetEnv("S3_BUCKET", ""),
+			AccessKey: utils.GetEnv("S3_ACCESS_KEY_ID", ""),
+			SecretKey: utils.GetEnv("S3_SECRET_ACCESS_KEY", ""),
+			PathStyle: utils.GetEnv("S3_PATH_STYLE", "") == "true",
+			PublicURL: utils.GetEnv("S3_PUBLIC_URL", ""),
+		})
+	}
+	return nil, fmt.Errorf("unknown storage driver %q", driver)
+}
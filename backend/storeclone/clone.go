@@ -0,0 +1,452 @@
+// Package storeclone copies the catalogue and design of one store into another
+package storeclone
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"storemaker-backend/catalog"
+	"storemaker-backend/jobs"
+	"storemaker-backend/media"
+	"storemaker-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// productBatchSize is how many products are copied per query
+const productBatchSize = 100
+
+// AllOptions copies everything that can be cloned
+func AllOptions() models.StoreCloneOptions {
+	return models.StoreCloneOptions{
+		Products:   true,
+		Categories: true,
+		Pages:      true,
+		Layout:     true,
+		Theme:      true,
+		Settings:   true,
+	}
+}
+
+// Handler returns a job handler copying source into target. The target store
+// must already exist.
+func Handler(db *gorm.DB, sourceID, targetID uint, opts models.StoreCloneOptions) jobs.Handler {
+	return func(ctx context.Context, progress *jobs.Progress) (models.JobData, error) {
+		c := &cloner{
+			db:       db.WithContext(ctx),
+			sourceID: sourceID,
+			targetID: targetID,
+			opts:     opts,
+			progress: progress,
+		}
+		return c.run()
+	}
+}
+
+type cloner struct {
+	db       *gorm.DB
+	sourceID uint
+	targetID uint
+	opts     models.StoreCloneOptions
+	progress *jobs.Progress
+
+	// categoryIDs and mediaIDs map source IDs to their copies
+	categoryIDs map[uint]uint
+	mediaIDs    map[uint]uint
+	copied      models.JobData
+}
+
+func (c *cloner) run() (models.JobData, error) {
+	c.categoryIDs = make(map[uint]uint)
+	c.mediaIDs = make(map[uint]uint)
+	c.copied = models.JobData{}
+
+	total, err := c.count()
+	if err != nil {
+		return nil, err
+	}
+	c.progress.SetTotal(total)
+
+	steps := []struct {
+		enabled bool
+		stage   string
+		fn      func() error
+	}{
+		{c.opts.Settings, "settings", c.copySettings},
+		{c.opts.Theme, "theme", c.copyTheme},
+		{c.opts.Categories, "categories", c.copyCategories},
+		{c.copiesMedia(), "media", c.copyMedia},
+		{c.opts.Products, "products", c.copyProducts},
+		{c.opts.Pages, "pages", c.copyPages},
+		{c.opts.Layout, "layout", c.copyLayout},
+	}
+	for _, step := range steps {
+		if !step.enabled {
+			continue
+		}
+		c.progress.SetStage(step.stage)
+		if err := step.fn(); err != nil {
+			return nil, fmt.Errorf("failed to copy %s: %w", step.stage, err)
+		}
+	}
+
+	return models.JobData{"store_id": c.targetID, "copied": c.copied}, nil
+}
+
+// count returns the number of items that will be copied. Settings, theme and
+// layout count as one item each.
+func (c *cloner) count() (int, error) {
+	total := int64(0)
+	counts := []struct {
+		enabled bool
+		model   interface{}
+	}{
+		{c.opts.Settings, &models.StoreSettings{}},
+		{c.opts.Theme, &models.StoreTheme{}},
+		{c.opts.Categories, &models.Category{}},
+		{c.copiesMedia(), &models.Media{}},
+		{c.opts.Products, &models.Product{}},
+		{c.opts.Pages, &models.Page{}},
+		{c.opts.Layout, &models.StoreLayout{}},
+	}
+	for _, entry := range counts {
+		if !entry.enabled {
+			continue
+		}
+		var n int64
+		if err := c.db.Model(entry.model).Where("store_id = ?", c.sourceID).Count(&n).Error; err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return int(total), nil
+}
+
+func (c *cloner) copySettings() error {
+	var settings models.StoreSettings
+	if err := c.db.Where("store_id = ?", c.sourceID).First(&settings).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+
+	settings.ID = 0
+	settings.StoreID = c.targetID
+	if err := c.db.Create(&settings).Error; err != nil {
+		return err
+	}
+	// Zero values take the column defaults on create, so write them explicitly
+	if err := c.db.Model(&settings).Updates(map[string]interface{}{
+		"allow_guest_checkout": settings.AllowGuestCheckout,
+		"require_shipping":     settings.RequireShipping,
+	}).Error; err != nil {
+		return err
+	}
+	c.copied["settings"] = 1
+	c.progress.Add(1)
+	return nil
+}
+
+func (c *cloner) copyTheme() error {
+	var theme models.StoreTheme
+	if err := c.db.Where("store_id = ?", c.sourceID).First(&theme).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+
+	theme.ID = 0
+	theme.StoreID = c.targetID
+	if err := c.db.Create(&theme).Error; err != nil {
+		return err
+	}
+	c.copied["theme"] = 1
+	c.progress.Add(1)
+	return nil
+}
+
+// copyCategories copies parents before their children so ParentID can be
+// pointed at the copy
+func (c *cloner) copyCategories() error {
+	var categories []models.Category
+	if err := c.db.Where("store_id = ?", c.sourceID).Order("id").Find(&categories).Error; err != nil {
+		return err
+	}
+
+	children := make(map[uint][]models.Category)
+	var queue []models.Category
+	known := make(map[uint]bool, len(categories))
+	for _, category := range categories {
+		known[category.ID] = true
+	}
+	for _, category := range categories {
+		// Parents outside the store are treated as missing
+		if category.ParentID == nil || !known[*category.ParentID] {
+			queue = append(queue, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	for len(queue) > 0 {
+		source := queue[0]
+		queue = queue[1:]
+
+		category := models.Category{
+			Name:        source.Name,
+			Slug:        source.Slug,
+			Description: source.Description,
+			Image:       source.Image,
+			Position:    source.Position,
+			StoreID:     c.targetID,
+		}
+		if source.ParentID != nil {
+			if parentID, ok := c.categoryIDs[*source.ParentID]; ok {
+				category.ParentID = &parentID
+			}
+		}
+		if err := c.db.Create(&category).Error; err != nil {
+			return err
+		}
+		c.categoryIDs[source.ID] = category.ID
+		c.progress.Add(1)
+
+		queue = append(queue, children[source.ID]...)
+	}
+
+	c.copied["categories"] = len(c.categoryIDs)
+	return nil
+}
+
+// copiesMedia reports whether anything copied can refer to the media library
+func (c *cloner) copiesMedia() bool {
+	return c.opts.Products || c.opts.Pages || c.opts.Layout
+}
+
+// copyMedia copies the media library. The copies share the source's files,
+// which the trash keeps while any media row names them, so they are not
+// counted against the target owner's storage.
+func (c *cloner) copyMedia() error {
+	var items []models.Media
+	// Pending media belongs to reviews, which are not copied
+	if err := c.db.Where("store_id = ? AND pending = ?", c.sourceID, false).Order("id").Find(&items).Error; err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	sourceIDs := make([]uint, len(items))
+	for i := range items {
+		sourceIDs[i] = items[i].ID
+		items[i].ID = 0
+		items[i].StoreID = c.targetID
+		items[i].CreatedAt = time.Time{}
+		items[i].UpdatedAt = time.Time{}
+	}
+	if err := c.db.CreateInBatches(&items, productBatchSize).Error; err != nil {
+		return err
+	}
+	for i, item := range items {
+		c.mediaIDs[sourceIDs[i]] = item.ID
+	}
+
+	c.copied["media"] = len(items)
+	c.progress.Add(len(items))
+	return nil
+}
+
+// copyProducts copies products in batches. Categories that were not copied
+// are dropped from the copies.
+func (c *cloner) copyProducts() error {
+	copied := 0
+	var batch []models.Product
+	err := c.db.Scopes(catalog.PreloadVariants).Where("store_id = ?", c.sourceID).Order("id").FindInBatches(&batch, productBatchSize, func(tx *gorm.DB, _ int) error {
+		products := make([]models.Product, 0, len(batch))
+		for _, source := range batch {
+			product := source
+			product.ID = 0
+			product.StoreID = c.targetID
+			product.CategoryID = nil
+			product.MediaIDs = c.copiedMedia(source.MediaIDs)
+			// Reviews are not copied, so neither is their rating
+			product.RatingAverage = 0
+			product.RatingCount = 0
+			product.CreatedAt = time.Time{}
+			product.UpdatedAt = time.Time{}
+			product.Variants = make([]models.ProductVariant, len(source.Variants))
+			for i, variant := range source.Variants {
+				variant.ID = 0
+				variant.ProductID = 0
+				variant.StoreID = c.targetID
+				variant.CreatedAt = time.Time{}
+				variant.UpdatedAt = time.Time{}
+				product.Variants[i] = variant
+			}
+			if source.CategoryID != nil {
+				if categoryID, ok := c.categoryIDs[*source.CategoryID]; ok {
+					product.CategoryID = &categoryID
+				}
+			}
+			products = append(products, product)
+		}
+
+		// Variants are created with their products
+		if err := c.db.Create(&products).Error; err != nil {
+			return err
+		}
+		copied += len(products)
+		c.progress.Add(len(products))
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	c.copied["products"] = copied
+	return nil
+}
+
+// copiedMedia points media IDs at their copies, dropping any not copied
+func (c *cloner) copiedMedia(ids models.MediaIDs) models.MediaIDs {
+	if ids == nil {
+		return nil
+	}
+	copied := make(models.MediaIDs, 0, len(ids))
+	for _, id := range ids {
+		if mediaID, ok := c.mediaIDs[id]; ok {
+			copied = append(copied, mediaID)
+		}
+	}
+	return copied
+}
+
+// copyPages copies each page with its sections and components in one
+// transaction, so a page is never left half copied
+func (c *cloner) copyPages() error {
+	var pageIDs []uint
+	if err := c.db.Model(&models.Page{}).Where("store_id = ?", c.sourceID).Order("id").Pluck("id", &pageIDs).Error; err != nil {
+		return err
+	}
+
+	for _, pageID := range pageIDs {
+		var source models.Page
+		if err := c.db.Preload("Sections.Components").First(&source, pageID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				continue
+			}
+			return err
+		}
+
+		err := c.db.Transaction(func(tx *gorm.DB) error {
+			page := models.Page{
+				Title:       source.Title,
+				Slug:        source.Slug,
+				Content:     source.Content,
+				Type:        source.Type,
+				IsPublished: source.IsPublished,
+				SeoTitle:    source.SeoTitle,
+				SeoDesc:     source.SeoDesc,
+				StoreID:     c.targetID,
+			}
+			if source.MediaID != nil {
+				if mediaID, ok := c.mediaIDs[*source.MediaID]; ok {
+					page.MediaID = &mediaID
+				}
+			}
+			if err := tx.Create(&page).Error; err != nil {
+				return err
+			}
+
+			for _, sourceSection := range source.Sections {
+				section := models.Section{
+					Name:      sourceSection.Name,
+					Type:      sourceSection.Type,
+					Config:    sourceSection.Config,
+					Order:     sourceSection.Order,
+					IsVisible: sourceSection.IsVisible,
+					PageID:    page.ID,
+				}
+				if err := tx.Create(&section).Error; err != nil {
+					return err
+				}
+				// IsVisible defaults to true on create
+				if !sourceSection.IsVisible {
+					if err := tx.Model(&section).Update("is_visible", false).Error; err != nil {
+						return err
+					}
+				}
+
+				for _, sourceComponent := range sourceSection.Components {
+					media.RemapProps(sourceComponent.Config, c.mediaIDs)
+					component := models.Component{
+						Name:      sourceComponent.Name,
+						Type:      sourceComponent.Type,
+						Config:    sourceComponent.Config,
+						Order:     sourceComponent.Order,
+						IsVisible: sourceComponent.IsVisible,
+						SectionID: section.ID,
+					}
+					if err := tx.Create(&component).Error; err != nil {
+						return err
+					}
+					if !sourceComponent.IsVisible {
+						if err := tx.Model(&component).Update("is_visible", false).Error; err != nil {
+							return err
+						}
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		c.progress.Add(1)
+	}
+
+	c.copied["pages"] = len(pageIDs)
+	return nil
+}
+
+// copyLayout copies the working store layout. Published revisions are not
+// copied, so the clone starts unpublished.
+func (c *cloner) copyLayout() error {
+	var source models.StoreLayout
+	if err := c.db.Preload("Components").Where("store_id = ?", c.sourceID).First(&source).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		layout := models.StoreLayout{StoreID: c.targetID}
+		if err := tx.Omit("Components").Create(&layout).Error; err != nil {
+			return err
+		}
+		for _, sourceComponent := range source.Components {
+			media.RemapProps(sourceComponent.Props, c.mediaIDs)
+			component := models.StoreLayoutComponent{
+				StoreLayoutID: layout.ID,
+				Type:          sourceComponent.Type,
+				Props:         sourceComponent.Props,
+				Order:         sourceComponent.Order,
+			}
+			if err := tx.Create(&component).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.copied["layout"] = 1
+	c.progress.Add(1)
+	return nil
+}
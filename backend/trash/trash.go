@@ -0,0 +1,361 @@
+// Package trash soft-deletes stores together with their content, restores
+// them, and purges them for good once the retention window has passed
+package trash
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"storemaker-backend/models"
+	"storemaker-backend/productcsv"
+	"storemaker-backend/storage"
+	"storemaker-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// DefaultRetention is how long deleted stores stay in the trash
+const DefaultRetention = 30 * 24 * time.Hour
+
+// ErrRetentionExpired is returned when restoring a store past its retention window
+var ErrRetentionExpired = errors.New("store is past its retention window")
+
+// purgeBatchSize bounds how many stores one purge pass handles
+const purgeBatchSize = 20
+
+// RetentionFromEnv reads STORE_TRASH_RETENTION_DAYS, falling back to
+// DefaultRetention
+func RetentionFromEnv() time.Duration {
+	days, err := strconv.Atoi(utils.GetEnv("STORE_TRASH_RETENTION_DAYS", ""))
+	if err != nil || days <= 0 {
+		return DefaultRetention
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// PurgeAt is when a deleted store becomes eligible for purging
+func PurgeAt(store *models.Store, retention time.Duration) time.Time {
+	return store.DeletedAt.Time.Add(retention)
+}
+
+// storeChildren are the soft-deletable models that belong to a store directly
+func storeChildren() []interface{} {
+	return []interface{}{
+		&models.Review{},
+		&models.ProductVariant{},
+		&models.Product{},
+		&models.Category{},
+		&models.Page{},
+		&models.StoreSettings{},
+		&models.StoreTheme{},
+		&models.StoreLayout{},
+		&models.Order{},
+		&models.NewsletterSubscription{},
+		&models.APIKey{},
+		&models.StoreDomain{},
+		&models.Media{},
+	}
+}
+
+// Delete moves a store and its content to the trash. Children are deleted
+// after the store, so restoring only brings back rows deleted at or after the
+// store's deleted_at and leaves rows the merchant had deleted earlier alone.
+func Delete(db *gorm.DB, store *models.Store) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(store).Error; err != nil {
+			return err
+		}
+		for _, model := range storeChildren() {
+			if err := tx.Where("store_id = ?", store.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		pages := tx.Unscoped().Model(&models.Page{}).Select("id").Where("store_id = ?", store.ID)
+		sections := tx.Unscoped().Model(&models.Section{}).Select("id").Where("page_id IN (?)", pages)
+		layouts := tx.Unscoped().Model(&models.StoreLayout{}).Select("id").Where("store_id = ?", store.ID)
+		orders := tx.Unscoped().Model(&models.Order{}).Select("id").Where("store_id = ?", store.ID)
+		if err := tx.Where("section_id IN (?)", sections).Delete(&models.Component{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("page_id IN (?)", pages).Delete(&models.Section{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("store_layout_id IN (?)", layouts).Delete(&models.StoreLayoutComponent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("order_id IN (?)", orders).Delete(&models.OrderItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().First(store, store.ID).Error
+	})
+}
+
+// Restore brings a trashed store and the content deleted with it back
+func Restore(db *gorm.DB, store *models.Store, retention time.Duration) error {
+	if !store.DeletedAt.Valid {
+		return nil
+	}
+	if time.Now().After(PurgeAt(store, retention)) {
+		return ErrRetentionExpired
+	}
+
+	deletedAt := store.DeletedAt.Time
+	return db.Transaction(func(tx *gorm.DB) error {
+		undelete := func(model interface{}, column string, ids interface{}) error {
+			return tx.Unscoped().Model(model).
+				Where(column+" IN (?) AND deleted_at >= ?", ids, deletedAt).
+				Update("deleted_at", nil).Error
+		}
+
+		storeIDs := []uint{store.ID}
+		for _, model := range storeChildren() {
+			if err := undelete(model, "store_id", storeIDs); err != nil {
+				return err
+			}
+		}
+		pages := tx.Unscoped().Model(&models.Page{}).Select("id").Where("store_id = ?", store.ID)
+		sections := tx.Unscoped().Model(&models.Section{}).Select("id").Where("page_id IN (?)", pages)
+		layouts := tx.Unscoped().Model(&models.StoreLayout{}).Select("id").Where("store_id = ?", store.ID)
+		orders := tx.Unscoped().Model(&models.Order{}).Select("id").Where("store_id = ?", store.ID)
+		if err := undelete(&models.Component{}, "section_id", sections); err != nil {
+			return err
+		}
+		if err := undelete(&models.Section{}, "page_id", pages); err != nil {
+			return err
+		}
+		if err := undelete(&models.StoreLayoutComponent{}, "store_layout_id", layouts); err != nil {
+			return err
+		}
+		if err := undelete(&models.OrderItem{}, "order_id", orders); err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Model(store).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		store.DeletedAt = gorm.DeletedAt{}
+		return nil
+	})
+}
+
+// Purger hard-deletes stores whose retention window has passed, along with
+// every row that belongs to them and the uploaded files only they use.
+// Audit log entries are kept.
+type Purger struct {
+	db        *gorm.DB
+	retention time.Duration
+	files     storage.Storage
+}
+
+// NewPurger creates a purger removing uploads from files
+func NewPurger(db *gorm.DB, retention time.Duration, files storage.Storage) *Purger {
+	return &Purger{db: db, retention: retention, files: files}
+}
+
+// Retention is how long stores stay in the trash
+func (p *Purger) Retention() time.Duration {
+	return p.retention
+}
+
+// PurgeExpired purges stores deleted more than the retention window ago
+func (p *Purger) PurgeExpired(ctx context.Context) error {
+	var stores []models.Store
+	if err := p.db.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", time.Now().Add(-p.retention)).
+		Order("deleted_at").Limit(purgeBatchSize).Find(&stores).Error; err != nil {
+		return err
+	}
+
+	for i := range stores {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := p.Purge(ctx, &stores[i]); err != nil {
+			log.Printf("Failed to purge store %d: %v", stores[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// Purge hard-deletes a store and everything belonging to it, then removes
+// uploaded files no remaining row refers to and the store's product exports
+func (p *Purger) Purge(ctx context.Context, store *models.Store) error {
+	db := p.db.WithContext(ctx)
+
+	files, err := p.storeFiles(db, store)
+	if err != nil {
+		return err
+	}
+	var exports []models.Job
+	if err := db.Where("store_id = ? AND type = ?", store.ID, models.JobTypeProductExport).
+		Find(&exports).Error; err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		pages := tx.Unscoped().Model(&models.Page{}).Select("id").Where("store_id = ?", store.ID)
+		sections := tx.Unscoped().Model(&models.Section{}).Select("id").Where("page_id IN (?)", pages)
+		layouts := tx.Unscoped().Model(&models.StoreLayout{}).Select("id").Where("store_id = ?", store.ID)
+		orders := tx.Unscoped().Model(&models.Order{}).Select("id").Where("store_id = ?", store.ID)
+
+		nested := []struct {
+			model  interface{}
+			column string
+			ids    *gorm.DB
+		}{
+			{&models.Component{}, "section_id", sections},
+			{&models.Section{}, "page_id", pages},
+			{&models.StoreLayoutComponent{}, "store_layout_id", layouts},
+			{&models.OrderItem{}, "order_id", orders},
+		}
+		for _, child := range nested {
+			if err := tx.Unscoped().Where(child.column+" IN (?)", child.ids).Delete(child.model).Error; err != nil {
+				return err
+			}
+		}
+
+		children := append(storeChildren(),
+			&models.StorePreviewToken{},
+			&models.StoreLayoutRevision{},
+			&models.StoreAccessPolicy{},
+			&models.StoreTransfer{},
+			&models.StoreUpload{},
+			&models.Job{},
+			&models.ProductRecommendation{},
+			&models.ProductRecommendationOverride{},
+		)
+		// Products refer to categories, so delete them first; categories
+		// refer to each other, so clear parents before deleting
+		if err := tx.Unscoped().Model(&models.Category{}).Where("store_id = ?", store.ID).Update("parent_id", nil).Error; err != nil {
+			return err
+		}
+		for _, model := range children {
+			if err := tx.Unscoped().Where("store_id = ?", store.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Unscoped().Delete(store).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range files {
+		if p.fileInUse(db, name) {
+			continue
+		}
+		if err := p.files.Delete(ctx, name); err != nil {
+			log.Printf("Failed to remove upload %s of purged store %d: %v", name, store.ID, err)
+		}
+	}
+	for i := range exports {
+		key, ok := productcsv.ExportFile(&exports[i])
+		if !ok {
+			continue
+		}
+		if err := p.files.Delete(ctx, key); err != nil {
+			log.Printf("Failed to remove product export %d of purged store %d: %v", exports[i].ID, store.ID, err)
+		}
+	}
+	return nil
+}
+
+// Run purges expired stores every interval until ctx is cancelled
+func (p *Purger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.PurgeExpired(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Store purge failed: %v", err)
+			}
+		}
+	}
+}
+
+// storeFiles collects the names of uploaded files the store's rows refer to
+// or that were uploaded for it
+func (p *Purger) storeFiles(db *gorm.DB, store *models.Store) ([]string, error) {
+	urls := []string{store.Logo, store.Favicon}
+
+	var themes []models.StoreTheme
+	if err := db.Unscoped().Where("store_id = ?", store.ID).Find(&themes).Error; err != nil {
+		return nil, err
+	}
+	for _, theme := range themes {
+		urls = append(urls, theme.LogoURL, theme.FaviconURL)
+	}
+
+	var categoryImages []string
+	if err := db.Unscoped().Model(&models.Category{}).Where("store_id = ?", store.ID).Pluck("image", &categoryImages).Error; err != nil {
+		return nil, err
+	}
+	urls = append(urls, categoryImages...)
+
+	var products []models.Product
+	if err := db.Unscoped().Select("id", "images").Where("store_id = ?", store.ID).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	for _, product := range products {
+		urls = append(urls, product.Images...)
+	}
+
+	var variantImages []string
+	if err := db.Unscoped().Model(&models.ProductVariant{}).Where("store_id = ?", store.ID).Pluck("image", &variantImages).Error; err != nil {
+		return nil, err
+	}
+	urls = append(urls, variantImages...)
+
+	seen := make(map[string]bool)
+	var files []string
+	for _, raw := range urls {
+		name, ok := p.files.Key(raw)
+		if ok && !seen[name] {
+			seen[name] = true
+			files = append(files, name)
+		}
+	}
+
+	// Uploads that were replaced are no longer referenced but still on disk
+	var uploaded []string
+	if err := db.Model(&models.StoreUpload{}).Where("store_id = ?", store.ID).Pluck("filename", &uploaded).Error; err != nil {
+		return nil, err
+	}
+	for _, name := range uploaded {
+		if !seen[name] && storage.ValidKey(name) {
+			seen[name] = true
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// fileInUse reports whether another store still refers to an upload, as
+// cloned stores share their source's files
+func (p *Purger) fileInUse(db *gorm.DB, name string) bool {
+	pattern := "%/" + name
+	checks := []*gorm.DB{
+		db.Unscoped().Model(&models.Store{}).Where("logo LIKE ? OR favicon LIKE ?", pattern, pattern),
+		db.Unscoped().Model(&models.StoreTheme{}).Where("logo_url LIKE ? OR favicon_url LIKE ?", pattern, pattern),
+		db.Unscoped().Model(&models.Category{}).Where("image LIKE ?", pattern),
+		db.Unscoped().Model(&models.Product{}).Where("images::text LIKE ?", "%/"+name+"\"%"),
+		db.Unscoped().Model(&models.ProductVariant{}).Where("image LIKE ?", pattern),
+		db.Unscoped().Model(&models.Media{}).Where("filename = ? OR renditions::text LIKE ?", name, "%\"filename\": \""+name+"\"%"),
+	}
+	for _, query := range checks {
+		var count int64
+		// Err on the side of keeping the file
+		if err := query.Count(&count).Error; err != nil || count > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// AttemptRecord tracks consecutive failed logins for one account or IP.
+// Attempts are counted as failures from the moment they are reserved.
+type AttemptRecord struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// LimiterStore persists attempt records. The in-memory store suits a single
+// node; a shared implementation (e.g. Redis) lets several nodes enforce the
+// same limits. The ttl is a hint for stores that can expire keys.
+type LimiterStore interface {
+	Get(key string) (AttemptRecord, bool, error)
+	Put(key string, record AttemptRecord, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// MemoryLimiterStore is a process-local LimiterStore
+type MemoryLimiterStore struct {
+	mu      sync.Mutex
+	records map[string]memoryRecord
+}
+
+type memoryRecord struct {
+	record    AttemptRecord
+	expiresAt time.Time
+}
+
+// NewMemoryLimiterStore creates an empty in-memory store
+func NewMemoryLimiterStore() *MemoryLimiterStore {
+	return &MemoryLimiterStore{records: make(map[string]memoryRecord)}
+}
+
+func (s *MemoryLimiterStore) Get(key string) (AttemptRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.records[key]
+	if !ok {
+		return AttemptRecord{}, false, nil
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(s.records, key)
+		return AttemptRecord{}, false, nil
+	}
+	return entry.record, true, nil
+}
+
+func (s *MemoryLimiterStore) Put(key string, record AttemptRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[key] = memoryRecord{record: record, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryLimiterStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+// LoginLimiterConfig controls backoff and lockout thresholds
+type LoginLimiterConfig struct {
+	// FreeAttempts is the number of failures allowed before backoff starts
+	FreeAttempts int
+	// BaseDelay is the wait after the first failure past FreeAttempts; it doubles per failure
+	BaseDelay time.Duration
+	// MaxDelay caps the exponential backoff
+	MaxDelay time.Duration
+	// MaxAccountFailures locks the account once reached
+	MaxAccountFailures int
+	// MaxIPFailures locks the client IP once reached
+	MaxIPFailures int
+	// LockoutDuration is how long a lockout lasts
+	LockoutDuration time.Duration
+	// FailureWindow resets the counter when no failure happened for this long
+	FailureWindow time.Duration
+}
+
+// DefaultLoginLimiterConfig returns the limits used by the API
+func DefaultLoginLimiterConfig() LoginLimiterConfig {
+	return LoginLimiterConfig{
+		FreeAttempts:       3,
+		BaseDelay:          time.Second,
+		MaxDelay:           5 * time.Minute,
+		MaxAccountFailures: 10,
+		MaxIPFailures:      50,
+		LockoutDuration:    15 * time.Minute,
+		FailureWindow:      time.Hour,
+	}
+}
+
+// LoginLimiter applies per-account and per-IP exponential backoff and lockout
+type LoginLimiter struct {
+	store  LimiterStore
+	config LoginLimiterConfig
+	mu     sync.Mutex
+}
+
+// NewLoginLimiter creates a limiter backed by the given store
+func NewLoginLimiter(store LimiterStore, config LoginLimiterConfig) *LoginLimiter {
+	return &LoginLimiter{store: store, config: config}
+}
+
+// Reserve counts an attempt against both the account and the IP before its
+// credential is checked, and returns how long the caller must wait instead
+// when the account or IP is backing off or locked; nothing is counted then.
+// Checking and counting happen together, so parallel guesses cannot all get
+// through before the first failure is recorded. A reserved attempt that
+// fails needs nothing further; one that succeeds is passed to RecordSuccess
+// and any other outcome to Release.
+func (l *LoginLimiter) Reserve(account, ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	wait := l.waitFor(accountKey(account), now)
+	if ipWait := l.waitFor(ipKey(ip), now); ipWait > wait {
+		wait = ipWait
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	l.increment(accountKey(account), l.config.MaxAccountFailures, now)
+	l.increment(ipKey(ip), l.config.MaxIPFailures, now)
+	return 0
+}
+
+// Release uncounts a reserved attempt that neither failed nor succeeded, such
+// as one that now waits for a second factor
+func (l *LoginLimiter) Release(account, ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.decrement(accountKey(account), l.config.MaxAccountFailures)
+	l.decrement(ipKey(ip), l.config.MaxIPFailures)
+}
+
+// RecordSuccess clears the account counter and uncounts the reserved attempt
+// from the IP. The rest of the IP counter is left alone so a valid login
+// cannot be used to reset a spraying attack from the same address.
+func (l *LoginLimiter) RecordSuccess(account, ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_ = l.store.Delete(accountKey(account))
+	l.decrement(ipKey(ip), l.config.MaxIPFailures)
+}
+
+func (l *LoginLimiter) waitFor(key string, now time.Time) time.Duration {
+	record, ok, err := l.store.Get(key)
+	if err != nil || !ok {
+		return 0
+	}
+
+	if now.Before(record.LockedUntil) {
+		return record.LockedUntil.Sub(now)
+	}
+	if now.Sub(record.LastFailure) > l.config.FailureWindow {
+		return 0
+	}
+
+	nextAllowed := record.LastFailure.Add(l.backoff(record.Failures))
+	if now.Before(nextAllowed) {
+		return nextAllowed.Sub(now)
+	}
+	return 0
+}
+
+func (l *LoginLimiter) increment(key string, maxFailures int, now time.Time) {
+	record, ok, err := l.store.Get(key)
+	if err != nil {
+		return
+	}
+	if !ok || now.Sub(record.LastFailure) > l.config.FailureWindow {
+		record = AttemptRecord{}
+	}
+
+	record.Failures++
+	record.LastFailure = now
+	if maxFailures > 0 && record.Failures >= maxFailures {
+		record.LockedUntil = now.Add(l.config.LockoutDuration)
+	}
+
+	_ = l.store.Put(key, record, l.ttl())
+}
+
+func (l *LoginLimiter) decrement(key string, maxFailures int) {
+	record, ok, err := l.store.Get(key)
+	if err != nil || !ok {
+		return
+	}
+
+	record.Failures--
+	if record.Failures <= 0 {
+		_ = l.store.Delete(key)
+		return
+	}
+	if maxFailures > 0 && record.Failures < maxFailures {
+		record.LockedUntil = time.Time{}
+	}
+	_ = l.store.Put(key, record, l.ttl())
+}
+
+func (l *LoginLimiter) ttl() time.Duration {
+	if l.config.LockoutDuration > l.config.FailureWindow {
+		return l.config.LockoutDuration
+	}
+	return l.config.FailureWindow
+}
+
+// backoff returns the delay required after the given number of failures
+func (l *LoginLimiter) backoff(failures int) time.Duration {
+	excess := failures - l.config.FreeAttempts
+	if excess <= 0 {
+		return 0
+	}
+
+	delay := l.config.BaseDelay
+	for i := 1; i < excess; i++ {
+		delay *= 2
+		if delay >= l.config.MaxDelay {
+			return l.config.MaxDelay
+		}
+	}
+	return delay
+}
+
+func accountKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
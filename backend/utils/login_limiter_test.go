@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func testLimiter() *LoginLimiter {
+	return NewLoginLimiter(NewMemoryLimiterStore(), LoginLimiterConfig{
+		FreeAttempts:       3,
+		BaseDelay:          time.Minute,
+		MaxDelay:           time.Hour,
+		MaxAccountFailures: 10,
+		MaxIPFailures:      50,
+		LockoutDuration:    15 * time.Minute,
+		FailureWindow:      time.Hour,
+	})
+}
+
+func TestReserveCountsParallelAttempts(t *testing.T) {
+	limiter := testLimiter()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if limiter.Reserve("user@example.com", "203.0.113.1") == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The first FreeAttempts are free and the next starts the backoff
+	if allowed != 4 {
+		t.Fatalf("allowed %d parallel attempts, want 4", allowed)
+	}
+}
+
+func TestReserveLocksAccount(t *testing.T) {
+	limiter := testLimiter()
+	limiter.config.BaseDelay = 0
+
+	for i := 0; i < 10; i++ {
+		if wait := limiter.Reserve("user@example.com", "203.0.113.1"); wait != 0 {
+			t.Fatalf("attempt %d waits %v", i+1, wait)
+		}
+	}
+	if wait := limiter.Reserve("USER@example.com", "198.51.100.7"); wait <= 0 {
+		t.Fatal("account is not locked after MaxAccountFailures attempts")
+	}
+}
+
+func TestReleaseAndSuccessUncountAttempts(t *testing.T) {
+	limiter := testLimiter()
+
+	for i := 0; i < 3; i++ {
+		limiter.Reserve("user@example.com", "203.0.113.1")
+	}
+	limiter.Release("user@example.com", "203.0.113.1")
+	limiter.Reserve("user@example.com", "203.0.113.1")
+	limiter.RecordSuccess("user@example.com", "203.0.113.1")
+
+	if record, ok, _ := limiter.store.Get(accountKey("user@example.com")); ok {
+		t.Fatalf("account counter kept after success: %+v", record)
+	}
+	record, _, _ := limiter.store.Get(ipKey("203.0.113.1"))
+	if record.Failures != 2 {
+		t.Fatalf("IP failures = %d, want 2", record.Failures)
+	}
+	if wait := limiter.Reserve("user@example.com", "203.0.113.1"); wait != 0 {
+		t.Fatalf("attempt after success waits %v", wait)
+	}
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimit allows Limit requests per Window under Key
+type RateLimit struct {
+	Key    string
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimiter counts requests in fixed windows. It keeps its counters in a
+// LimiterStore, using Failures as the count and LockedUntil as the end of
+// the window, so several nodes can share limits as they do for logins.
+type RateLimiter struct {
+	store LimiterStore
+	mu    sync.Mutex
+}
+
+// NewRateLimiter creates a limiter backed by the given store
+func NewRateLimiter(store LimiterStore) *RateLimiter {
+	return &RateLimiter{store: store}
+}
+
+// Allow counts a request against every limit and returns zero, or returns
+// how long the caller must wait when any limit has been reached; nothing is
+// counted then
+func (r *RateLimiter) Allow(limits ...RateLimit) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	records := make([]AttemptRecord, len(limits))
+	var wait time.Duration
+	for i, limit := range limits {
+		record, ok, err := r.store.Get(limit.Key)
+		if err != nil {
+			return 0
+		}
+		if !ok || !now.Before(record.LockedUntil) {
+			record = AttemptRecord{LockedUntil: now.Add(limit.Window)}
+		}
+		if record.Failures >= limit.Limit {
+			if remaining := record.LockedUntil.Sub(now); remaining > wait {
+				wait = remaining
+			}
+		}
+		records[i] = record
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	for i, limit := range limits {
+		records[i].Failures++
+		records[i].LastFailure = now
+		_ = r.store.Put(limit.Key, records[i], records[i].LockedUntil.Sub(now))
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllowsLimitPerWindow(t *testing.T) {
+	limiter := NewRateLimiter(NewMemoryLimiterStore())
+	ip := RateLimit{Key: "ip:203.0.113.1", Limit: 2, Window: time.Hour}
+	store := RateLimit{Key: "store:1", Limit: 3, Window: time.Hour}
+
+	for i := 0; i < 2; i++ {
+		if wait := limiter.Allow(ip, store); wait != 0 {
+			t.Fatalf("request %d waits %v", i+1, wait)
+		}
+	}
+	if wait := limiter.Allow(ip, store); wait <= 0 || wait > time.Hour {
+		t.Fatalf("third request from the IP waits %v", wait)
+	}
+
+	// The refused request was not counted against the store
+	other := RateLimit{Key: "ip:198.51.100.7", Limit: 2, Window: time.Hour}
+	if wait := limiter.Allow(other, store); wait != 0 {
+		t.Fatalf("another IP waits %v", wait)
+	}
+	if wait := limiter.Allow(other, store); wait <= 0 {
+		t.Fatal("store limit not enforced")
+	}
+}
+
+func TestRateLimiterStartsNewWindow(t *testing.T) {
+	limiter := NewRateLimiter(NewMemoryLimiterStore())
+	limit := RateLimit{Key: "ip:203.0.113.1", Limit: 1, Window: 20 * time.Millisecond}
+
+	if wait := limiter.Allow(limit); wait != 0 {
+		t.Fatalf("first request waits %v", wait)
+	}
+	if wait := limiter.Allow(limit); wait <= 0 {
+		t.Fatal("second request in the window allowed")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if wait := limiter.Allow(limit); wait != 0 {
+		t.Fatalf("request in a new window waits %v", wait)
+	}
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of RFC 6238 appendix B,
+// "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfc6238Vectors are the SHA-1 test vectors of RFC 6238 appendix B. The RFC
+// lists eight digits; codes here are the last TOTPDigits of them.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestGenerateTOTPCodeMatchesRFC6238(t *testing.T) {
+	for _, tt := range rfc6238Vectors {
+		code, err := GenerateTOTPCode(rfc6238Secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTPCodeMatchesRFC6238(t *testing.T) {
+	for _, tt := range rfc6238Vectors {
+		at := time.Unix(tt.unix, 0)
+		step, ok := ValidateTOTPCode(rfc6238Secret, tt.code, at)
+		if !ok || step != TOTPStep(at) {
+			t.Errorf("code %s at %d: step %d, valid %v", tt.code, tt.unix, step, ok)
+		}
+	}
+
+	// Lower-case secrets and spaced codes are accepted
+	if _, ok := ValidateTOTPCode(" gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", "287 082", time.Unix(59, 0)); !ok {
+		t.Error("normalised secret or code rejected")
+	}
+}
+
+func TestValidateTOTPCodeSkew(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	current := TOTPStep(at)
+
+	for offset := int64(-TOTPSkew - 1); offset <= TOTPSkew+1; offset++ {
+		code, err := GenerateTOTPCode(rfc6238Secret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := ValidateTOTPCode(rfc6238Secret, code, at)
+		inWindow := offset >= -TOTPSkew && offset <= TOTPSkew
+		if ok != inWindow {
+			t.Errorf("code %d steps away: valid %v, want %v", offset, ok, inWindow)
+		}
+		if ok && step != current+offset {
+			t.Errorf("code %d steps away matched step %d, want %d", offset, step, current+offset)
+		}
+	}
+}
+
+func TestValidateTOTPCodeRejects(t *testing.T) {
+	at := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "287083", "abcdef"} {
+		if _, ok := ValidateTOTPCode(rfc6238Secret, code, at); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+	if _, ok := ValidateTOTPCode("not base32!", "287082", at); ok {
+		t.Error("invalid secret accepted")
+	}
+}
@@ -104,6 +104,25 @@ func GetEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// StorefrontBaseDomain returns the domain store subdomains are served under,
+// e.g. "storemaker.com" for "my-shop.storemaker.com"
+func StorefrontBaseDomain() string {
+	return strings.ToLower(strings.Trim(GetEnv("STOREFRONT_BASE_DOMAIN", "storemaker.com"), "."))
+}
+
+// TrustedProxies returns the addresses or CIDR ranges listed in
+// TRUSTED_PROXIES, the only peers whose X-Forwarded-For header is believed.
+// It is empty by default, so client IPs come from the connection itself.
+func TrustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(GetEnv("TRUSTED_PROXIES", ""), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
 // ValidatePassword validates password requirements
 func ValidatePassword(password string) error {
 	if len(password) < 6 {
@@ -85,7 +85,7 @@ export default function StoreCustomPage() {
       // Load products for this store (for product components)
       try {
         const productsResponse = await api.getStoreProducts(slug)
-        const productsData = Array.isArray(productsResponse.data) ? productsResponse.data : []
+        const productsData = Array.isArray(productsResponse.data?.data) ? productsResponse.data.data : []
         setProducts(productsData)
       } catch {
         console.warn('Could not load store products')
@@ -71,7 +71,7 @@ export default function StoreHomePage() {
       // Load products for carousels
       try {
         const productsResponse = await api.getStoreProducts(slug)
-        const productsData = Array.isArray(productsResponse.data) ? productsResponse.data : []
+        const productsData = Array.isArray(productsResponse.data?.data) ? productsResponse.data.data : []
         console.log('=== PRODUCTS DEBUG ===')
         console.log('Raw API response:', productsResponse)
         console.log('Products data:', productsData)